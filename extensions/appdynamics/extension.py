@@ -20,14 +20,18 @@ import os
 import os.path
 import logging
 from extension_helpers import PHPExtensionHelper
+from service_bindings import ServiceRule, find_service, FOUND
 from subprocess import call
-import re
 
 _log = logging.getLogger('appdynamics')
 
+SERVICE_RULE = ServiceRule('appdynamics',
+                           labels=['appdynamics'],
+                           tags=['appdynamics'],
+                           name_pattern='app-?dynamics')
+
 class AppDynamicsInstaller(PHPExtensionHelper):
-    _detected = None                # Boolean to check if AppDynamics service is detected
-    _FILTER = "app[-]?dynamics"
+    _binding = None                 # Binding of the AppDynamics service, found once
     _appdynamics_credentials = None # JSON which contains all appdynamics credentials
     _account_access_key = None      # AppDynamics Controller Account Access Key
     _account_name = None            # AppDynamics Controller Account Name
@@ -64,15 +68,12 @@ class AppDynamicsInstaller(PHPExtensionHelper):
         It should return true if the payload of the extension should
         be installed (i.e. the `install` method is called).
         """
-        if AppDynamicsInstaller._detected is None:
-            VCAP_SERVICES_STRING = str(self._services)
-            if bool(re.search(AppDynamicsInstaller._FILTER, VCAP_SERVICES_STRING)):
+        if AppDynamicsInstaller._binding is None:
+            AppDynamicsInstaller._binding = find_service(self._ctx, SERVICE_RULE)
+            if AppDynamicsInstaller._binding.result == FOUND:
                 print("AppDynamics service detected, beginning compilation")
                 _log.info("AppDynamics service detected")
-                AppDynamicsInstaller._detected = True
-            else:
-                AppDynamicsInstaller._detected = False
-        return AppDynamicsInstaller._detected
+        return AppDynamicsInstaller._binding.result == FOUND
 
     def _configure(self):
         """
@@ -89,42 +90,25 @@ class AppDynamicsInstaller(PHPExtensionHelper):
 
         """
         print("Setting AppDynamics credentials info...")
-        services = self._ctx.get('VCAP_SERVICES', {})
-        service_defs = services.get("appdynamics")
-        if service_defs is None:
-            # Search in user-provided service
-            print("No Marketplace AppDynamics services found")
-            print("Searching for AppDynamics service in user-provided services")
-            user_services = services.get("user-provided")
-            for user_service in user_services:
-                if bool(re.search(AppDynamicsInstaller._FILTER, user_service.get("name"))):
-                    print("Using the first AppDynamics service present in user-provided services")
-                    AppDynamicsInstaller._appdynamics_credentials = user_service.get("credentials")
-                    self._load_service_credentials()
-                    try:
-                        # load the app details from user-provided service
-                        print("Setting AppDynamics App, Tier and Node names from user-provided service")
-                        AppDynamicsInstaller._app_name = AppDynamicsInstaller._appdynamics_credentials.get("application-name")
-                        print("User-provided service application-name = " + AppDynamicsInstaller._app_name)
-                        AppDynamicsInstaller._tier_name = AppDynamicsInstaller._appdynamics_credentials.get("tier-name")
-                        print("User-provided service tier-name = " + AppDynamicsInstaller._tier_name)
-                        AppDynamicsInstaller._node_name = AppDynamicsInstaller._appdynamics_credentials.get("node-name")
-                        print("User-provided service node-name = " + AppDynamicsInstaller._node_name)
-                    except Exception:
-                        print("Exception occurred while setting AppDynamics App, Tier and Node names from user-provided service, using default naming")
-                        self._load_app_details()
-        elif len(service_defs) > 1:
-            print("Multiple AppDynamics services found in VCAP_SERVICES, using credentials from first one.")
-            AppDynamicsInstaller._appdynamics_credentials = service_defs[0].get("credentials")
-            self._load_service_credentials()
+        binding = AppDynamicsInstaller._binding
+        AppDynamicsInstaller._appdynamics_credentials = binding.credentials
+        self._load_service_credentials()
+        if binding.service.get("label") != "user-provided":
             self._load_app_details()
-        elif len(service_defs) == 1:
-            print("AppDynamics service found in VCAP_SERVICES")
-            AppDynamicsInstaller._appdynamics_credentials = service_defs[0].get("credentials")
-            self._load_service_credentials()
+            return
+        try:
+            # load the app details from user-provided service
+            print("Setting AppDynamics App, Tier and Node names from user-provided service")
+            AppDynamicsInstaller._app_name = AppDynamicsInstaller._appdynamics_credentials.get("application-name")
+            print("User-provided service application-name = " + AppDynamicsInstaller._app_name)
+            AppDynamicsInstaller._tier_name = AppDynamicsInstaller._appdynamics_credentials.get("tier-name")
+            print("User-provided service tier-name = " + AppDynamicsInstaller._tier_name)
+            AppDynamicsInstaller._node_name = AppDynamicsInstaller._appdynamics_credentials.get("node-name")
+            print("User-provided service node-name = " + AppDynamicsInstaller._node_name)
+        except Exception:
+            print("Exception occurred while setting AppDynamics App, Tier and Node names from user-provided service, using default naming")
             self._load_app_details()
 
-
     def _load_service_credentials(self):
         """
         Configure AppDynamics Controller Binding credentials
@@ -17,14 +17,19 @@ import os
 import os.path
 import logging
 from subprocess import call
+from service_bindings import ServiceRule, find_service, FOUND
 
 _log = logging.getLogger('CAAPM')
 
+SERVICE_RULE = ServiceRule('caapm',
+                           labels=['caapm'],
+                           tags=['caapm'],
+                           name_pattern='caapm')
+
 
 class CAAPMInstaller(object):
     def __init__(self, ctx):
         self._detected = None  # Boolean to check if caapm service is _detected        
-        self._servicefilter = "caapm"
         self._collport = None  # IA agent port
         self._collhost = None  # IA agent remote host/ip address
         self._appname = None  # PHP App name
@@ -66,26 +71,14 @@ class CAAPMInstaller(object):
         Get IA agent details from caapm service
         """
         self._log.info("Loading service info to find CA APM Service")
-        services = self._ctx.get('VCAP_SERVICES', {})
-        service_defs = services.get(self._servicefilter)
+        binding = find_service(self._ctx, SERVICE_RULE)
         credentials = None
-        if service_defs is None:
-            # Search in user-provided service
-            self._log.info("Searching for CA APM service in user-provided services")
-            user_services = services.get("user-provided")
-            for user_service in user_services:
-                if self._servicefilter in user_service.get('name'):
-                    print("Using the first CA APM service present in user-provided services")
-                    self._log.info("Using the first CA APM service present in user-provided services")
-                    serviceFound = True
-                    credentials = user_service.get("credentials")
-                    break
-        elif len(service_defs) > 1:
-            self._log.info("Multiple CA APM services found in VCAP_SERVICES, using properties from first one.")
-            credentials = service_defs[0].get("credentials")
-        elif len(service_defs) == 1:
-            self._log.info("CA APM service found in VCAP_SERVICES")
-            credentials = service_defs[0].get("credentials")
+        if binding.result == FOUND:
+            if binding.candidates:
+                self._log.info("Multiple CA APM services found in VCAP_SERVICES, using properties from first one.")
+            else:
+                self._log.info("CA APM service found in VCAP_SERVICES")
+            credentials = binding.credentials
 
         if (credentials is not None):
             self._collport = credentials.get("collport")
@@ -99,10 +92,6 @@ class CAAPMInstaller(object):
                  print("Error: CA APM service detected but required credential (collhost) is missing.Skipping the CA APM PHP Agent installation")
                  _log.error("CA APM service detected but required credential (collhost) is missing.Skipping the CA APM PHP Agent installation")
                  self._detected = False
-        elif serviceFound:
-            print("Error: CA APM service detected but required credential (collhost) is missing.Skipping the CA APM PHP Agent installation")
-	    _log.error("CA APM service detected but required credential (collhost) is missing.Skipping the CA APM PHP Agent installation")
-            self._detected = False
 
 
     def should_install(self):
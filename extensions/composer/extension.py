@@ -25,9 +25,11 @@ import json
 import StringIO
 import copy
 import shutil
+import subprocess
 from build_pack_utils import utils
 from build_pack_utils import stream_output
 from compile_helpers import warn_invalid_php_version
+from compile_helpers import php_memory_defaults
 from extension_helpers import ExtensionHelper
 
 sys.path.append(os.path.join(os.path.dirname(os.path.abspath(__file__)), '..', '..', 'vendor', 'node-semver'))
@@ -38,6 +40,9 @@ from build_pack_utils.compile_extensions import CompileExtensions
 
 _log = logging.getLogger('composer')
 
+# modules which PHP loads with zend_extension, not extension
+ZEND_MODULES = ('opcache', 'xdebug')
+
 
 def find_composer_paths(ctx):
     build_dir = ctx['BUILD_DIR']
@@ -77,6 +82,21 @@ def find_composer_paths(ctx):
     return (json_path, lock_path)
 
 
+def installs_dev_packages(ctx):
+    """True if composer should install the `require-dev` packages
+
+    `COMPOSER_NO_DEV` takes precedence, otherwise the presence of `--no-dev`
+    in `COMPOSER_INSTALL_OPTIONS` decides.
+    """
+    no_dev = ctx.get('COMPOSER_NO_DEV', None)
+    if no_dev is None:
+        return '--no-dev' not in ctx.get('COMPOSER_INSTALL_OPTIONS',
+                                         ['--no-dev'])
+    if hasattr(no_dev, 'lower'):
+        no_dev = no_dev.lower() not in ('false', 'no', '0')
+    return not no_dev
+
+
 class ComposerConfiguration(object):
     def __init__(self, ctx):
         self._ctx = ctx
@@ -163,6 +183,75 @@ class ComposerConfiguration(object):
             self._ctx['PHP_VM'] = 'php'
 
 
+class PlatformRequirements(object):
+    """Checks the platform requirements of every package in composer.lock
+
+    Extensions required by any locked package are enabled, when the selected
+    PHP version provides them.  Staging fails before composer runs if a
+    package needs an extension or a PHP version that is not available.
+    """
+    def __init__(self, ctx):
+        self._ctx = ctx
+        self._log = _log
+        (_, self.lock_path) = find_composer_paths(self._ctx)
+
+    def _should_check(self):
+        if not self.lock_path or \
+                not self._ctx.get('COMPOSER_PLATFORM_CHECK', True):
+            return False
+        if self._ctx['PHP_VERSION'] not in self._ctx.get('ALL_PHP_VERSIONS', []):
+            self._log.debug('PHP [%s] is not in the manifest, skipping '
+                            'platform check', self._ctx['PHP_VERSION'])
+            return False
+        return True
+
+    def _command(self):
+        cmd = [os.path.join(self._ctx['BP_DIR'], 'bin', 'check-platform'),
+               '-lock', self.lock_path,
+               '-manifest', os.path.join(self._ctx['BP_DIR'], 'manifest.yml'),
+               '-php', self._ctx['PHP_VERSION']]
+        if installs_dev_packages(self._ctx):
+            cmd.append('-dev')
+        return cmd
+
+    def check(self):
+        if not self._should_check():
+            return
+        cmd = self._command()
+        if not os.path.exists(cmd[0]):
+            # it is on by default, only warn apps which asked for it
+            if 'COMPOSER_PLATFORM_CHECK' in self._ctx:
+                print('WARNING: ignoring COMPOSER_PLATFORM_CHECK, this '
+                      'buildpack was built without check-platform')
+            else:
+                self._log.debug('Skipping the platform check, this buildpack '
+                                'was built without check-platform')
+            return
+        self._log.debug("Running command [%s]", ' '.join(cmd))
+        process = subprocess.Popen(cmd, stdout=subprocess.PIPE,
+                                   stderr=subprocess.PIPE)
+        (output, errors) = process.communicate()
+        if process.returncode == 1:
+            print('-----> composer.lock has platform requirements which PHP '
+                  '%s cannot satisfy:' % self._ctx['PHP_VERSION'])
+            for line in errors.strip().split('\n'):
+                print('       %s' % line)
+            sys.exit(1)
+        elif process.returncode != 0:
+            self._log.error("Error checking platform requirements: %s", errors)
+            raise RuntimeError("Error checking platform requirements")
+
+        exts = [ext for ext in output.strip().split('\n') if ext]
+        self._log.debug('composer.lock requires extensions [%s]',
+                        ', '.join(exts))
+        self._ctx['PHP_EXTENSIONS'] = utils.unique(
+            self._ctx.get('PHP_EXTENSIONS', []) +
+            [ext for ext in exts if ext not in ZEND_MODULES])
+        self._ctx['ZEND_EXTENSIONS'] = utils.unique(
+            self._ctx.get('ZEND_EXTENSIONS', []) +
+            [ext for ext in exts if ext in ZEND_MODULES])
+
+
 class ComposerExtension(ExtensionHelper):
     def __init__(self, ctx):
         ExtensionHelper.__init__(self, ctx)
@@ -184,7 +273,9 @@ class ComposerExtension(ExtensionHelper):
             'COMPOSER_BIN_DIR': '{BUILD_DIR}/php/bin',
             'COMPOSER_HOME': '{CACHE_DIR}/composer',
             'COMPOSER_CACHE_DIR': '{COMPOSER_HOME}/cache',
-            'COMPOSER_INSTALL_GLOBAL': []
+            'COMPOSER_INSTALL_GLOBAL': [],
+            'COMPOSER_RUN_SCRIPTS': 'all',
+            'COMPOSER_GITHUB_API_URL': 'https://api.github.com'
         }
 
     def _should_compile(self):
@@ -239,11 +330,15 @@ class ComposerExtension(ExtensionHelper):
                 os.path.join(self._ctx['BUILD_DIR'], 'php', 'bin'),
                 extract=False)
 
+    def _github_rate_limit_url(self):
+        return '%s/rate_limit' % \
+            self._ctx['COMPOSER_GITHUB_API_URL'].rstrip('/')
+
     def _github_oauth_token_is_valid(self, candidate_oauth_token):
         stringio_writer = StringIO.StringIO()
 
-        curl_command = 'curl -H "Authorization: token %s" ' \
-            'https://api.github.com/rate_limit' % candidate_oauth_token
+        curl_command = 'curl -H "Authorization: token %s" %s' % (
+            candidate_oauth_token, self._github_rate_limit_url())
 
         stream_output(stringio_writer,
                       curl_command,
@@ -260,10 +355,10 @@ class ComposerExtension(ExtensionHelper):
         stringio_writer = StringIO.StringIO()
         if token_is_valid:
             candidate_oauth_token = os.getenv('COMPOSER_GITHUB_OAUTH_TOKEN')
-            curl_command = 'curl -H "Authorization: token %s" ' \
-                'https://api.github.com/rate_limit' % candidate_oauth_token
+            curl_command = 'curl -H "Authorization: token %s" %s' % (
+                candidate_oauth_token, self._github_rate_limit_url())
         else:
-            curl_command = 'curl https://api.github.com/rate_limit'
+            curl_command = 'curl %s' % self._github_rate_limit_url()
 
         stream_output(stringio_writer,
                       curl_command,
@@ -293,6 +388,14 @@ class ComposerExtension(ExtensionHelper):
                   '$COMPOSER_GITHUB_OAUTH_TOKEN is invalid')
             return False
 
+    def setup_github_access(self):
+        token_is_valid = False
+        # config composer to use github token, if provided
+        if os.getenv('COMPOSER_GITHUB_OAUTH_TOKEN', False):
+            token_is_valid = self.setup_composer_github_token()
+        # check that the api rate limit has not been exceeded, otherwise exit
+        self.check_github_rate_exceeded(token_is_valid)
+
     def check_github_rate_exceeded(self, token_is_valid):
         if self._github_rate_exceeded(token_is_valid):
             print('-----> The GitHub api rate limit has been exceeded. '
@@ -330,12 +433,7 @@ class ComposerExtension(ExtensionHelper):
         if self._ctx.get('BP_DEBUG', False):
             self.composer_runner.run('-V')
         if not os.path.exists(os.path.join(self._ctx['BP_DIR'], 'dependencies')):
-            token_is_valid = False
-            # config composer to use github token, if provided
-            if os.getenv('COMPOSER_GITHUB_OAUTH_TOKEN', False):
-                token_is_valid = self.setup_composer_github_token()
-            # check that the api rate limit has not been exceeded, otherwise exit
-            self.check_github_rate_exceeded(token_is_valid)
+            self.setup_github_access()
         # install global Composer dependencies
         if len(self._ctx['COMPOSER_INSTALL_GLOBAL']) > 0:
             globalCtx = copy.deepcopy(self._ctx)
@@ -345,8 +443,100 @@ class ComposerExtension(ExtensionHelper):
             globalRunner.run('global', 'require', '--no-progress',
                              *self._ctx['COMPOSER_INSTALL_GLOBAL'])
         # install dependencies w/Composer
+        (before, after) = self._scripts_to_run()
+        for script in before:
+            self.run_script(script)
         self.composer_runner.run('install', '--no-progress',
-                                 *self._ctx['COMPOSER_INSTALL_OPTIONS'])
+                                 *self._install_options())
+        for script in after:
+            self.run_script(script)
+            if script == 'pre-autoload-dump':
+                self.dump_autoload()
+
+    def _scripts_policy(self):
+        if '--no-scripts' in self._ctx['COMPOSER_INSTALL_OPTIONS']:
+            return 'none'
+        policy = self._ctx['COMPOSER_RUN_SCRIPTS']
+        if hasattr(policy, 'split') and policy not in ('all', 'none'):
+            policy = [name.strip() for name in policy.split(',')]
+        return policy
+
+    def _install_options(self):
+        opts = [opt for opt in self._ctx['COMPOSER_INSTALL_OPTIONS']
+                if opt not in ('--no-dev', '--dev')]
+        if not installs_dev_packages(self._ctx):
+            opts.append('--no-dev')
+        if '--no-scripts' not in opts:
+            opts.append('--no-scripts')
+        return opts
+
+    def _defined_scripts(self):
+        json_path = os.path.join(self._ctx['BUILD_DIR'], 'composer.json')
+        try:
+            with open(json_path, 'rt') as fp:
+                return json.load(fp).get('scripts', {})
+        except IOError:
+            return {}
+
+    def _scripts_to_run(self):
+        """Returns the allowed scripts to run before and after install
+
+        Composer installs with `--no-scripts` and the scripts are run one at
+        a time with `run-script`, so each gets its own timeout and a failure
+        can be attributed to the script.  With `COMPOSER_RUN_SCRIPTS` set to
+        `all` that is every install (or update) event the app defines, with
+        `none` nothing runs.  Otherwise it is an allowlist of event or script
+        names.
+
+        The install has already written the autoloader when the after
+        scripts run, so `pre-autoload-dump` is followed by `dump-autoload
+        --no-scripts` to pick up what it changed, then `post-autoload-dump`
+        and `post-install-cmd` (or `post-update-cmd`) run as with composer.
+        """
+        policy = self._scripts_policy()
+        if policy == 'none':
+            return ([], [])
+        defined = self._defined_scripts()
+        # without a lock file, composer install runs the update events
+        cmd = 'install'
+        if not os.path.exists(os.path.join(self._ctx['BUILD_DIR'],
+                                           'composer.lock')):
+            cmd = 'update'
+        before = ['pre-%s-cmd' % cmd]
+        after = ['pre-autoload-dump', 'post-autoload-dump',
+                 'post-%s-cmd' % cmd]
+        if policy == 'all':
+            policy = before + after
+        events = ['pre-install-cmd', 'post-install-cmd',
+                  'pre-update-cmd', 'post-update-cmd'] + after
+        after.extend([name for name in policy if name not in events])
+        return ([name for name in before if name in policy and name in defined],
+                [name for name in after if name in policy and name in defined])
+
+    def dump_autoload(self):
+        args = ['dump-autoload', '--no-scripts']
+        args.extend([opt for opt in self._ctx['COMPOSER_INSTALL_OPTIONS']
+                     if opt in ('-o', '--optimize-autoloader',
+                                '-a', '--classmap-authoritative',
+                                '--apcu-autoloader')])
+        if not installs_dev_packages(self._ctx):
+            args.append('--no-dev')
+        print('-----> Dumping the composer autoloader again')
+        self.composer_runner.run(*args)
+
+    def run_script(self, name):
+        args = ['run-script']
+        if not installs_dev_packages(self._ctx):
+            args.append('--no-dev')
+        if self._ctx.get('COMPOSER_SCRIPT_TIMEOUT', None) is not None:
+            args.append('--timeout=%s' % self._ctx['COMPOSER_SCRIPT_TIMEOUT'])
+        args.append(name)
+        print('-----> Running composer script [%s]' % name)
+        try:
+            self.composer_runner.run(*args)
+        except:
+            print('-----> Composer script [%s] failed' % name)
+            raise
 
 
 class ComposerCommandRunner(object):
@@ -413,10 +603,11 @@ class PHPComposerStrategy(object):
             .where_name_is('php.ini')
             .into('TMPDIR')
          .done())
+        cfg = dict(php_memory_defaults(self._ctx))
+        cfg.update({'TMPDIR': self._ctx['TMPDIR'],
+                    'HOME': self._ctx['BUILD_DIR']})
         utils.rewrite_cfgs(os.path.join(self._ctx['TMPDIR'], 'php.ini'),
-                           {'TMPDIR': self._ctx['TMPDIR'],
-                            'HOME': self._ctx['BUILD_DIR']},
-                           delim='@')
+                           cfg, delim='@')
 
     def ld_library_path(self):
         return os.path.join(
@@ -427,6 +618,7 @@ class PHPComposerStrategy(object):
 def configure(ctx):
     config = ComposerConfiguration(ctx)
     config.configure()
+    PlatformRequirements(ctx).check()
 
 
 def preprocess_commands(ctx):
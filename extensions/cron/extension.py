@@ -0,0 +1,108 @@
+# Licensed to the Apache Software Foundation (ASF) under one or more
+# contributor license agreements.  See the NOTICE file distributed with
+# this work for additional information regarding copyright ownership.
+# The ASF licenses this file to You under the Apache License, Version 2.0
+# (the "License"); you may not use this file except in compliance with
+# the License.  You may obtain a copy of the License at
+#
+#     http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+"""Cron Extension
+
+Runs the cron jobs of the app with `php-cron`, in the app container next to
+the web server.  Jobs are crontab lines, listed as `CRON_JOBS` in
+`.bp-config/options.json` or written to `.bp-config/crontab`:
+
+    "CRON_JOBS": ["*/5 * * * * php bin/console app:sync"]
+
+They run with bash in the app directory, with `PHPRC` and `LD_LIBRARY_PATH`
+set for the PHP of the app.  A job still running when it is due again is
+skipped, and each run logs its start, end and exit code.  Times are UTC
+unless `TZ` is set.
+
+The scheduler runs on every instance, but only instance 0 runs the jobs,
+so scaling the app out does not run them more often.  Jobs which should run
+on each instance, such as clearing a local cache, need
+`"CRON_ALL_INSTANCES": true`; with N instances they then run N times.
+"""
+from __future__ import print_function
+import os
+import shutil
+import subprocess
+from extension_helpers import ExtensionHelper
+from build_pack_utils import utils
+
+
+CRONTAB = os.path.join('.bp', 'crontab')
+
+
+class Cron(ExtensionHelper):
+    def _app_crontab(self):
+        return os.path.join(self._ctx['BUILD_DIR'], '.bp-config', 'crontab')
+
+    def _jobs(self):
+        jobs = self._ctx.get('CRON_JOBS') or []
+        if hasattr(jobs, 'strip') or not hasattr(jobs, '__iter__') or \
+                not all(hasattr(job, 'strip') for job in jobs):
+            raise RuntimeError('CRON_JOBS must be a list of crontab lines')
+        return jobs
+
+    def _should_compile(self):
+        return bool(self._ctx.get('CRON_JOBS')) or \
+            os.path.exists(self._app_crontab())
+
+    def _configure(self):
+        self._jobs()
+
+    def _compile(self, install):
+        scheduler = os.path.join(self._ctx['BP_DIR'], 'bin', 'php-cron')
+        if not os.path.exists(scheduler):
+            print('WARNING: ignoring the cron jobs, this buildpack was built '
+                  'without php-cron')
+            return
+
+        lines = ['# written during staging, edit CRON_JOBS of '
+                 '.bp-config/options.json or .bp-config/crontab']
+        lines.extend(self._jobs())
+        if os.path.exists(self._app_crontab()):
+            with open(self._app_crontab()) as f:
+                lines.extend(f.read().splitlines())
+        crontab = os.path.join(self._ctx['BUILD_DIR'], CRONTAB)
+        if not os.path.exists(os.path.dirname(crontab)):
+            os.makedirs(os.path.dirname(crontab))
+        with open(crontab, 'w') as f:
+            f.write('\n'.join(lines) + '\n')
+
+        proc = subprocess.Popen([scheduler, '-check', crontab],
+                                stdout=subprocess.PIPE,
+                                stderr=subprocess.PIPE)
+        (stdout, stderr) = proc.communicate()
+        if proc.returncode != 0:
+            os.remove(crontab)
+            raise RuntimeError('Invalid cron jobs\n%s' % stderr.rstrip())
+        print('-----> Scheduling cron jobs')
+        for line in stdout.splitlines():
+            print('       %s' % line)
+        bin_dir = os.path.join(self._ctx['BUILD_DIR'], '.bp', 'bin')
+        if not os.path.exists(bin_dir):
+            os.makedirs(bin_dir)
+        shutil.copy(scheduler, bin_dir)
+
+    def _service_commands(self):
+        if not os.path.exists(os.path.join(self._ctx['BUILD_DIR'], CRONTAB)):
+            return {}
+        command = ['$HOME/.bp/bin/php-cron']
+        if self._ctx.get('CRON_ALL_INSTANCES'):
+            command.append('-all-instances')
+        command.append('"$HOME/%s"' % CRONTAB)
+        return {
+            utils.process_key('cron', 'always', 1, 0): tuple(command)
+        }
+
+
+Cron.register(__name__)
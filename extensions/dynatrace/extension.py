@@ -23,9 +23,17 @@ from subprocess import call
 import urllib2
 import json
 import time
+from service_bindings import ServiceRule, find_service, FOUND, DUPLICATE, FAIL
 
 _log = logging.getLogger('dynatrace')
 
+SERVICE_RULE = ServiceRule('dynatrace',
+                           labels=['dynatrace'],
+                           tags=['dynatrace'],
+                           name_pattern='dynatrace',
+                           credentials=['environmentid', 'apitoken'],
+                           duplicates=FAIL)
+
 class DynatraceInstaller(object):
     def __init__(self, ctx):
         self._log = _log
@@ -50,29 +58,23 @@ class DynatraceInstaller(object):
 
     # verify if 'dynatrace' service is available
     def _load_service_info(self):
-        detected_services = []
-        vcap_services = self._ctx.get('VCAP_SERVICES', {})
-        for provider, services in vcap_services.iteritems():
-            for service in services:
-                if 'dynatrace' in service.get('name', ''):
-                    creds = service.get('credentials', {})
-                    if creds.get('environmentid', None) and creds.get('apitoken', None):
-                        detected_services.append(creds)
-                    else:
-                        self._log.info("Dynatrace service detected. But without proper credentials!")
-
-        if len(detected_services) == 1:
+        binding = find_service(self._ctx, SERVICE_RULE)
+        if binding.skipped:
+            self._log.info("Dynatrace service detected. But without proper credentials!")
+
+        if binding.result == FOUND:
             self._log.info("Found one matching Dynatrace service")
+            creds = binding.credentials
 
-            self._ctx['DYNATRACE_API_URL'] = detected_services[0].get('apiurl', None)
-            self._ctx['DYNATRACE_ENVIRONMENT_ID'] = detected_services[0].get('environmentid', None)
-            self._ctx['DYNATRACE_TOKEN'] = detected_services[0].get('apitoken', None)
-            self._ctx['DYNATRACE_SKIPERRORS'] = detected_services[0].get('skiperrors', None)
+            self._ctx['DYNATRACE_API_URL'] = creds.get('apiurl', None)
+            self._ctx['DYNATRACE_ENVIRONMENT_ID'] = creds.get('environmentid', None)
+            self._ctx['DYNATRACE_TOKEN'] = creds.get('apitoken', None)
+            self._ctx['DYNATRACE_SKIPERRORS'] = creds.get('skiperrors', None)
 
             self._convert_api_url()
             self._detected = True
 
-        elif len(detected_services) > 1:
+        elif binding.result == DUPLICATE:
             self._log.warning("More than one matching service found!")
             raise SystemExit(1)
 
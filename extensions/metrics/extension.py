@@ -0,0 +1,55 @@
+# Licensed to the Apache Software Foundation (ASF) under one or more
+# contributor license agreements.  See the NOTICE file distributed with
+# this work for additional information regarding copyright ownership.
+# The ASF licenses this file to You under the Apache License, Version 2.0
+# (the "License"); you may not use this file except in compliance with
+# the License.  You may obtain a copy of the License at
+#
+#     http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+"""Metrics Extension
+
+Runs `php-metrics`, which serves the php-fpm and web server status pages as
+Prometheus metrics. The web server proxies METRICS_PATH to it, and php-fpm
+gets a status page for it to read, see `setup_fpm_status`.
+
+Turn it on with `"METRICS_EXPORTER": true` in `.bp-config/options.json`.
+"""
+import os
+import shutil
+from extension_helpers import ExtensionHelper
+from compile_helpers import is_web_app
+
+
+class MetricsExporter(ExtensionHelper):
+    def _should_compile(self):
+        return bool(self._ctx.get('METRICS_EXPORTER', False)) and \
+            is_web_app(self._ctx)
+
+    def _compile(self, install):
+        exporter = os.path.join(self._ctx['BP_DIR'], 'bin', 'php-metrics')
+        if not os.path.exists(exporter):
+            print('WARNING: ignoring METRICS_EXPORTER, this buildpack was '
+                  'built without php-metrics')
+            return
+        bin_dir = os.path.join(self._ctx['BUILD_DIR'], '.bp', 'bin')
+        if not os.path.exists(bin_dir):
+            os.makedirs(bin_dir)
+        shutil.copy(exporter, bin_dir)
+
+    def _service_commands(self):
+        return {
+            'php-metrics': (
+                '$HOME/.bp/bin/php-metrics',
+                '-path "%s"' % self._ctx.get('METRICS_PATH', '/metrics'),
+                '-web-server %s' % self._ctx['WEB_SERVER'],
+                '-fpm-conf "$HOME/php/etc/php-fpm.conf"')
+        }
+
+
+MetricsExporter.register(__name__)
@@ -21,9 +21,16 @@ import os.path
 import logging
 import shutil
 from build_pack_utils.compile_extensions import CompileExtensions
+from service_bindings import ServiceRule, find_service, FOUND
 
 _log = logging.getLogger('newrelic')
 
+SERVICE_RULE = ServiceRule('newrelic',
+                           labels=['newrelic'],
+                           tags=['newrelic'],
+                           name_pattern='new-?relic',
+                           credentials=['licenseKey'])
+
 DEFAULTS = {
     'NEWRELIC_HOST': 'download.newrelic.com',
     'NEWRELIC_PACKAGE': 'newrelic-php5-{NEWRELIC_VERSION}-linux.tar.gz',
@@ -71,20 +78,16 @@ class NewRelicInstaller(object):
                 self._ctx[key] = val
 
     def _load_service_info(self):
-        services = self._ctx.get('VCAP_SERVICES', {})
-        services = services.get('newrelic', [])
-        if len(services) == 0:
+        binding = find_service(self._ctx, SERVICE_RULE)
+        if binding.result != FOUND:
             self._log.info("NewRelic services not detected.")
-        if len(services) > 1:
+            return
+        if binding.candidates:
             self._log.warn("Multiple NewRelic services found, "
                            "credentials from first one.")
-        if len(services) > 0:
-            service = services[0]
-            creds = service.get('credentials', {})
-            self.license_key = creds.get('licenseKey', None)
-            if self.license_key:
-                self._log.debug("NewRelic service detected.")
-                self._detected = True
+        self.license_key = binding.credentials['licenseKey']
+        self._log.debug("NewRelic service detected.")
+        self._detected = True
 
     def _load_newrelic_info(self):
         vcap_app = self._ctx.get('VCAP_APPLICATION', {})
@@ -0,0 +1,205 @@
+# Licensed to the Apache Software Foundation (ASF) under one or more
+# contributor license agreements.  See the NOTICE file distributed with
+# this work for additional information regarding copyright ownership.
+# The ASF licenses this file to You under the Apache License, Version 2.0
+# (the "License"); you may not use this file except in compliance with
+# the License.  You may obtain a copy of the License at
+#
+#     http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+"""OpenTelemetry Extension
+
+Configures the OTLP exporter of the OpenTelemetry SDK for PHP, from a bound
+service or the OTEL_* environment variables.  The app brings the SDK with
+composer, the OpenTelemetry PHP extension for auto-instrumentation needs
+PHP 8, which the buildpack does not provide, so none is installed.
+"""
+import os
+import os.path
+import logging
+from service_bindings import ServiceRule, find_service, FOUND
+
+_log = logging.getLogger('opentelemetry')
+
+SERVICE_RULE = ServiceRule('opentelemetry',
+                           labels=['opentelemetry', 'otel'],
+                           tags=['opentelemetry', 'otel', 'otlp'],
+                           name_pattern=r'\botel\b|open-?telemetry',
+                           credentials=['endpoint'])
+
+# jq filter for the headers credential of the service $name, which is
+# either a string like OTEL_EXPORTER_OTLP_HEADERS or an object
+HEADERS_FILTER = ('.[][] | select(.name == $name) | .credentials.headers'
+                  ' | if type == "object" then to_entries'
+                  ' | map("\\(.key)=\\(.value | @uri)") | join(",")'
+                  ' else . end')
+
+# OTEL_RESOURCE_ATTRIBUTES taken from VCAP_APPLICATION
+APPLICATION_ATTRIBUTES = (
+    ('cloudfoundry.app.id', 'application_id'),
+    ('cloudfoundry.app.name', 'application_name'),
+    ('cloudfoundry.space.id', 'space_id'),
+    ('cloudfoundry.space.name', 'space_name'),
+    ('cloudfoundry.org.id', 'organization_id'),
+    ('cloudfoundry.org.name', 'organization_name')
+)
+
+# OTEL_RESOURCE_ATTRIBUTES which only the running instance knows
+INSTANCE_ATTRIBUTES = (
+    ('service.instance.id', '${CF_INSTANCE_GUID:-}'),
+    ('cloudfoundry.app.instance.id', '${CF_INSTANCE_INDEX:-}')
+)
+
+
+def _shell_quote(value):
+    return "'%s'" % value.replace("'", "'\\''")
+
+
+def _shell_escape(value):
+    """Escapes a value for use between double quotes"""
+    for char in '\\"$`':
+        value = value.replace(char, '\\' + char)
+    return value
+
+
+def _shell_default(name, value):
+    """Exports name, unless it is set already, as value"""
+    return 'export %s="${%s:-%s}"' % (
+        name, name, _shell_escape(value).replace('}', '\\}'))
+
+
+def _encode_attribute(value):
+    """Percent encodes the separators of OTEL_RESOURCE_ATTRIBUTES"""
+    for char in '%,=':
+        value = value.replace(char, '%%%02X' % ord(char))
+    return value
+
+
+class OpenTelemetryInstaller(object):
+    def __init__(self, ctx):
+        self._log = _log
+        self._ctx = ctx
+        self._detected = False
+        self.service_name = None
+        self.endpoint = None
+        self.protocol = None
+        self.headers_service = None
+        try:
+            self._log.info("Initializing")
+            if ctx['PHP_VM'] == 'php':
+                self._load_service_info()
+                self._load_env_info()
+        except Exception:
+            self._log.exception("Error configuring OpenTelemetry! "
+                                "OpenTelemetry will not be available.")
+            self._detected = False
+
+    def _load_service_info(self):
+        binding = find_service(self._ctx, SERVICE_RULE)
+        if binding.result != FOUND:
+            self._log.info("OpenTelemetry services not detected.")
+            return
+        creds = binding.credentials
+        self.endpoint = creds['endpoint']
+        self.protocol = creds.get('protocol')
+        self.service_name = creds.get('service_name')
+        if creds.get('headers'):
+            # read at runtime, so the headers stay out of the droplet
+            self.headers_service = binding.service.get('name')
+        self._log.debug("OpenTelemetry service detected.")
+        self._detected = True
+
+    def _load_env_info(self):
+        """OTEL_* from the environment or options.json win over a service"""
+        endpoint = self._ctx.get('OTEL_EXPORTER_OTLP_ENDPOINT')
+        if endpoint:
+            if self._detected:
+                self._log.warn("Detected an OpenTelemetry service & "
+                               "OTEL_EXPORTER_OTLP_ENDPOINT, using "
+                               "OTEL_EXPORTER_OTLP_ENDPOINT.")
+            self.endpoint = endpoint
+            self._detected = True
+        self.protocol = self._ctx.get('OTEL_EXPORTER_OTLP_PROTOCOL',
+                                      self.protocol)
+        vcap_app = self._ctx.get('VCAP_APPLICATION', {})
+        self.service_name = (self._ctx.get('OTEL_SERVICE_NAME') or
+                             self.service_name or
+                             vcap_app.get('application_name') or
+                             vcap_app.get('name'))
+
+    def should_install(self):
+        return self._detected
+
+    def resource_attributes(self):
+        """OTEL_RESOURCE_ATTRIBUTES for the running instance
+
+        Instance attributes are left to the shell, attributes set with
+        OTEL_RESOURCE_ATTRIBUTES are appended and so take precedence.
+        """
+        vcap_app = self._ctx.get('VCAP_APPLICATION', {})
+        attributes = ['%s=%s' % (key, _shell_escape(
+                          _encode_attribute(vcap_app[name])))
+                      for (key, name) in APPLICATION_ATTRIBUTES
+                      if vcap_app.get(name)]
+        attributes.extend('%s=%s' % attribute
+                          for attribute in INSTANCE_ATTRIBUTES)
+        return ','.join(attributes)
+
+    def profile_script(self):
+        lines = [
+            '# Written by the OpenTelemetry extension, variables set with '
+            '`cf set-env` win',
+            _shell_default('OTEL_SERVICE_NAME',
+                           self.service_name or 'unknown_service:php'),
+            _shell_default('OTEL_EXPORTER_OTLP_ENDPOINT', self.endpoint),
+            'export OTEL_RESOURCE_ATTRIBUTES="%s'
+            '${OTEL_RESOURCE_ATTRIBUTES:+,$OTEL_RESOURCE_ATTRIBUTES}"' %
+            self.resource_attributes()
+        ]
+        if self.protocol:
+            lines.append(_shell_default('OTEL_EXPORTER_OTLP_PROTOCOL',
+                                        self.protocol))
+        if self.headers_service:
+            lines.extend([
+                'if [[ -z "${OTEL_EXPORTER_OTLP_HEADERS:-}" ]]; then',
+                '  export OTEL_EXPORTER_OTLP_HEADERS=$(echo "$VCAP_SERVICES" '
+                '| jq -r --arg name %s %s)' % (
+                    _shell_quote(self.headers_service),
+                    _shell_quote(HEADERS_FILTER)),
+                'fi'
+            ])
+        return '\n'.join(lines) + '\n'
+
+    def write_profile_script(self):
+        dest_folder = os.path.join(self._ctx['BUILD_DIR'], '.profile.d')
+        if not os.path.exists(dest_folder):
+            os.makedirs(dest_folder)
+        dest = os.path.join(dest_folder, '0_opentelemetry_env.sh')
+        with open(dest, 'wt') as script:
+            script.write(self.profile_script())
+
+
+# Extension Methods
+def preprocess_commands(ctx):
+    return ()
+
+
+def service_commands(ctx):
+    return {}
+
+
+def service_environment(ctx):
+    return {}
+
+
+def compile(install):
+    otel = OpenTelemetryInstaller(install.builder._ctx)
+    if otel.should_install():
+        _log.info("Configuring the OpenTelemetry exporter")
+        otel.write_profile_script()
+    return 0
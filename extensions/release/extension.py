@@ -0,0 +1,125 @@
+# Licensed to the Apache Software Foundation (ASF) under one or more
+# contributor license agreements.  See the NOTICE file distributed with
+# this work for additional information regarding copyright ownership.
+# The ASF licenses this file to You under the Apache License, Version 2.0
+# (the "License"); you may not use this file except in compliance with
+# the License.  You may obtain a copy of the License at
+#
+#     http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+"""Release Extension
+
+Runs `RELEASE_COMMANDS`, such as database migrations, with `php-release`
+on instance 0 only:
+
+    "RELEASE_COMMANDS": ["php artisan migrate --force"],
+    "RELEASE_FAILURE_POLICY": "fail-closed",
+    "RELEASE_WAIT": true
+
+With `RELEASE_WAIT`, the default, `bin/start` runs the commands before it
+starts the processes of the app, so `cf ssh` sessions and tasks never run
+them.  Otherwise they run as the `release` process next to the others.
+When a command fails, `fail-closed`, the default, stops the instance so it
+is restarted and the commands run again, `fail-open` starts the app anyway.
+
+A marker in `RELEASE_MARKER_DIR` keeps the commands from running twice in
+one place.  By default it is in the container, so the commands run once per
+container, not once per droplet: each restart, crash, restage or evacuation
+of instance 0 gets a new container which runs them again, and they must be
+safe to run more than once, as migrations usually are.  Only a directory on
+a volume service mounted by every instance makes it once per droplet, and
+`php-release` prints a WARNING at startup while the marker is on the disk of
+the container.
+"""
+from __future__ import print_function
+import json
+import os
+import shutil
+import time
+import uuid
+from extension_helpers import ExtensionHelper
+from build_pack_utils import utils
+
+
+CONFIG = os.path.join('.bp', 'release.json')
+POLICIES = ('fail-closed', 'fail-open')
+
+
+class Release(ExtensionHelper):
+    def _defaults(self):
+        return {
+            'RELEASE_FAILURE_POLICY': 'fail-closed',
+            'RELEASE_WAIT': True,
+            'RELEASE_MARKER_DIR': '$HOME/.bp/release'
+        }
+
+    def _should_compile(self):
+        return bool(self._ctx.get('RELEASE_COMMANDS'))
+
+    def _commands(self):
+        commands = self._ctx.get('RELEASE_COMMANDS') or []
+        if hasattr(commands, 'strip') or \
+                not hasattr(commands, '__iter__') or \
+                not all(hasattr(cmd, 'strip') and cmd.strip()
+                        for cmd in commands):
+            raise RuntimeError('RELEASE_COMMANDS must be a list of commands')
+        return [cmd.strip() for cmd in commands]
+
+    def _configure(self):
+        self._commands()
+        policy = self._ctx['RELEASE_FAILURE_POLICY']
+        if policy not in POLICIES:
+            raise RuntimeError('RELEASE_FAILURE_POLICY must be one of %s, '
+                               'not [%s]' % (', '.join(POLICIES), policy))
+        if not isinstance(self._ctx['RELEASE_WAIT'], bool):
+            raise RuntimeError('RELEASE_WAIT must be true or false, not [%s]'
+                               % self._ctx['RELEASE_WAIT'])
+
+    def _compile(self, install):
+        runner = os.path.join(self._ctx['BP_DIR'], 'bin', 'php-release')
+        if not os.path.exists(runner):
+            print('WARNING: ignoring RELEASE_COMMANDS, this buildpack was '
+                  'built without php-release')
+            return
+        bin_dir = os.path.join(self._ctx['BUILD_DIR'], '.bp', 'bin')
+        if not os.path.exists(bin_dir):
+            os.makedirs(bin_dir)
+        shutil.copy(runner, bin_dir)
+
+        # identifies the droplet, its marker tells whether it ran
+        release_id = '%s-%s' % (time.strftime('%Y%m%dT%H%M%S', time.gmtime()),
+                                uuid.uuid4().hex[:8])
+        with open(os.path.join(self._ctx['BUILD_DIR'], CONFIG), 'w') as f:
+            json.dump({
+                'release_id': release_id,
+                'commands': self._commands(),
+                'policy': self._ctx['RELEASE_FAILURE_POLICY'],
+                'marker_dir': self._ctx['RELEASE_MARKER_DIR'],
+                'wait': self._ctx['RELEASE_WAIT']
+            }, f, indent=2)
+        print('-----> RELEASE_COMMANDS run on instance 0 for release %s, '
+              'once per container unless RELEASE_MARKER_DIR is on a volume '
+              'service' % release_id)
+
+    def _command(self):
+        return ('$HOME/.bp/bin/php-release', '"$HOME/%s"' % CONFIG)
+
+    def _installed(self):
+        return os.path.exists(os.path.join(self._ctx['BUILD_DIR'], CONFIG))
+
+    def _service_commands(self):
+        # waiting, bin/start runs them before the processes
+        if not self._installed() or self._ctx['RELEASE_WAIT']:
+            return {}
+        # a failure closed is tried once more, then stops the instance
+        return {
+            utils.process_key('release', 'on-failure', 1, 1): self._command()
+        }
+
+
+Release.register(__name__)
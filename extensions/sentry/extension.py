@@ -0,0 +1,97 @@
+# Licensed to the Apache Software Foundation (ASF) under one or more
+# contributor license agreements.  See the NOTICE file distributed with
+# this work for additional information regarding copyright ownership.
+# The ASF licenses this file to You under the Apache License, Version 2.0
+# (the "License"); you may not use this file except in compliance with
+# the License.  You may obtain a copy of the License at
+#
+#     http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+"""Sentry Extension
+
+Reports PHP errors and uncaught exceptions to Sentry, or any service which
+accepts its events, without the Sentry SDK. A script prepended to every
+request, see `add_auto_prepend_file`, reads the DSN from SENTRY_DSN.
+
+Bind a service labelled or tagged `sentry`, or with `sentry` in its name,
+with the DSN in its `dsn` credential, or set SENTRY_DSN. Events carry the
+release `<app>@<app version>+php-buildpack.<buildpack version>`, unless
+SENTRY_RELEASE is set.
+"""
+import os
+import pipes
+from extension_helpers import ExtensionHelper
+from compile_helpers import add_auto_prepend_file
+from service_bindings import ServiceRule, find_service, FOUND
+
+
+SERVICE_RULE = ServiceRule('sentry',
+                           labels=['sentry'],
+                           tags=['sentry'],
+                           name_pattern='sentry',
+                           credentials=['dsn'])
+
+
+class SentryExtension(ExtensionHelper):
+    def __init__(self, ctx):
+        ExtensionHelper.__init__(self, ctx)
+        self._binding = None        # Binding of the sentry service, found once
+
+    def _binding_found(self):
+        if self._binding is None:
+            self._binding = find_service(self._ctx, SERVICE_RULE)
+        return self._binding.result == FOUND
+
+    def _should_compile(self):
+        return self._binding_found() or bool(self._ctx.get('SENTRY_DSN'))
+
+    def release(self):
+        version_file = os.path.join(self._ctx['BP_DIR'], 'VERSION')
+        buildpack = 'unknown'
+        if os.path.isfile(version_file):
+            buildpack = open(version_file).read().strip()
+        release = self._application.get('application_name') or \
+            self._application.get('name') or 'app'
+        if self._application.get('application_version'):
+            release += '@' + self._application['application_version']
+        return '%s+php-buildpack.%s' % (release, buildpack)
+
+    def profile_script(self):
+        lines = ['# Written by the sentry extension, variables set with '
+                 '`cf set-env` win',
+                 'if [[ -z "${SENTRY_RELEASE:-}" ]]; then',
+                 '  export SENTRY_RELEASE=%s' % pipes.quote(self.release()),
+                 'fi',
+                 'if [[ -z "${SENTRY_DSN:-}" ]]; then']
+        if self._ctx.get('SENTRY_DSN'):
+            lines.append('  export SENTRY_DSN=%s' %
+                         pipes.quote(self._ctx['SENTRY_DSN']))
+        else:
+            # read at runtime, so the DSN stays out of the droplet
+            lines.append(
+                '  export SENTRY_DSN=$(echo "$VCAP_SERVICES" | jq -r --arg '
+                'name %s \'.[][] | select(.name == $name) | '
+                '.credentials.dsn\')' %
+                pipes.quote(self._binding.service['name']))
+        lines.append('fi')
+        return '\n'.join(lines) + '\n'
+
+    def _compile(self, install):
+        add_auto_prepend_file(
+            self._ctx,
+            os.path.join(self._ctx['BP_DIR'], 'extensions', 'sentry',
+                         'sentry.php'),
+            'sentry')
+        profile_d = os.path.join(self._ctx['BUILD_DIR'], '.profile.d')
+        if not os.path.exists(profile_d):
+            os.makedirs(profile_d)
+        with open(os.path.join(profile_d, '0_sentry_env.sh'), 'wt') as f:
+            f.write(self.profile_script())
+
+
+SentryExtension.register(__name__)
@@ -0,0 +1,182 @@
+<?php
+// Prepended to every script by the sentry extension. Reports errors and
+// uncaught exceptions to the Sentry DSN in SENTRY_DSN, as SENTRY_RELEASE and
+// SENTRY_ENVIRONMENT, without composer or the Sentry SDK. Runs on PHP 5.6
+// and later.
+
+function _bp_sentry_store()
+{
+    static $store = null;
+    if ($store === null) {
+        $store = false;
+        // {scheme}://{public key}[:{secret key}]@{host}[:{port}][/{path}]/{project}
+        $dsn = parse_url((string) getenv('SENTRY_DSN'));
+        if (!empty($dsn['scheme']) && !empty($dsn['user']) && !empty($dsn['host'])
+            && isset($dsn['path']) && preg_match('#^(.*)/([^/]+)$#', $dsn['path'], $path)) {
+            $auth = 'Sentry sentry_version=7, sentry_client=php-buildpack/1.0'
+                . ', sentry_key=' . $dsn['user']
+                . (isset($dsn['pass']) ? ', sentry_secret=' . $dsn['pass'] : '');
+            $port = isset($dsn['port']) ? ':' . $dsn['port'] : '';
+            $store = array(
+                'url' => "{$dsn['scheme']}://{$dsn['host']}$port{$path[1]}/api/{$path[2]}/store/",
+                'auth' => $auth,
+            );
+        }
+    }
+    return $store;
+}
+
+function _bp_sentry_level($type)
+{
+    switch ($type) {
+        case E_ERROR:
+        case E_PARSE:
+        case E_CORE_ERROR:
+        case E_COMPILE_ERROR:
+            return 'fatal';
+        case E_USER_ERROR:
+        case E_RECOVERABLE_ERROR:
+            return 'error';
+        case E_WARNING:
+        case E_CORE_WARNING:
+        case E_COMPILE_WARNING:
+        case E_USER_WARNING:
+            return 'warning';
+    }
+    return 'info';
+}
+
+function _bp_sentry_error_name($type)
+{
+    $constants = get_defined_constants(true);
+    foreach ($constants['Core'] as $name => $value) {
+        if ($value === $type && strpos($name, 'E_') === 0 && $name !== 'E_ALL') {
+            return $name;
+        }
+    }
+    return 'E_UNKNOWN';
+}
+
+function _bp_sentry_frames($trace, $file, $line)
+{
+    // Sentry lists the oldest call first, the trace starts with the newest
+    $frames = array();
+    foreach (array_reverse($trace) as $call) {
+        $function = isset($call['class']) ? $call['class'] . $call['type'] . $call['function'] : $call['function'];
+        $frames[] = array(
+            'filename' => isset($call['file']) ? $call['file'] : '[internal]',
+            'lineno' => isset($call['line']) ? $call['line'] : 0,
+            'function' => $function,
+        );
+    }
+    $frames[] = array('filename' => $file, 'lineno' => $line);
+    return array('frames' => $frames);
+}
+
+function _bp_sentry_event_id()
+{
+    if (function_exists('random_bytes')) {
+        return bin2hex(random_bytes(16));
+    }
+    $id = '';
+    for ($i = 0; $i < 8; $i++) {
+        $id .= sprintf('%04x', mt_rand(0, 0xffff));
+    }
+    return $id;
+}
+
+function _bp_sentry_send($level, $type, $value, $stacktrace)
+{
+    $store = _bp_sentry_store();
+    if ($store === false) {
+        return;
+    }
+    $event = array(
+        'event_id' => _bp_sentry_event_id(),
+        'timestamp' => gmdate('Y-m-d\TH:i:s\Z'),
+        'platform' => 'php',
+        'logger' => 'php',
+        'level' => $level,
+        'server_name' => getenv('CF_INSTANCE_GUID') ?: gethostname(),
+        'exception' => array('values' => array(array(
+            'type' => $type,
+            'value' => (string) $value,
+            'stacktrace' => $stacktrace,
+        ))),
+        'tags' => array('php_version' => PHP_VERSION, 'php_sapi' => PHP_SAPI),
+    );
+    foreach (array('release' => 'SENTRY_RELEASE', 'environment' => 'SENTRY_ENVIRONMENT') as $key => $name) {
+        if (getenv($name) !== false && getenv($name) !== '') {
+            $event[$key] = getenv($name);
+        }
+    }
+    if (isset($_SERVER['REQUEST_METHOD'])) {
+        $https = !empty($_SERVER['HTTPS']) && $_SERVER['HTTPS'] !== 'off';
+        $host = isset($_SERVER['HTTP_HOST']) ? $_SERVER['HTTP_HOST'] : 'localhost';
+        $event['request'] = array(
+            'method' => $_SERVER['REQUEST_METHOD'],
+            'url' => ($https ? 'https' : 'http') . '://' . $host . strtok($_SERVER['REQUEST_URI'], '?'),
+            'query_string' => isset($_SERVER['QUERY_STRING']) ? $_SERVER['QUERY_STRING'] : '',
+        );
+    }
+    $context = stream_context_create(array('http' => array(
+        'method' => 'POST',
+        'header' => "Content-Type: application/json\r\nX-Sentry-Auth: {$store['auth']}",
+        'content' => json_encode($event, JSON_UNESCAPED_SLASHES | JSON_PARTIAL_OUTPUT_ON_ERROR),
+        'timeout' => 2,
+        'ignore_errors' => true,
+    )));
+    if (@file_get_contents($store['url'], false, $context) === false) {
+        error_log('sentry: could not report to ' . parse_url($store['url'], PHP_URL_HOST));
+    }
+}
+
+function _bp_sentry_report_exception($e)
+{
+    _bp_sentry_send('error', get_class($e), $e->getMessage(),
+        _bp_sentry_frames($e->getTrace(), $e->getFile(), $e->getLine()));
+}
+
+// Every handler calls the one it replaces, so handlers prepended before, like
+// the one of LOG_FORMAT json, keep working.
+$GLOBALS['_bp_sentry_previous_error_handler'] = set_error_handler(
+    function ($type, $message, $file = null, $line = null, $context = null) {
+        $report = E_ALL & ~(E_NOTICE | E_USER_NOTICE | E_DEPRECATED | E_USER_DEPRECATED | E_STRICT);
+        if (error_reporting() & $type & $report) {
+            $trace = debug_backtrace(DEBUG_BACKTRACE_IGNORE_ARGS);
+            array_shift($trace);
+            _bp_sentry_send(_bp_sentry_level($type), _bp_sentry_error_name($type), $message,
+                _bp_sentry_frames($trace, $file, $line));
+        }
+        $previous = $GLOBALS['_bp_sentry_previous_error_handler'];
+        return $previous === null ? false : call_user_func($previous, $type, $message, $file, $line, $context);
+    }
+);
+
+$GLOBALS['_bp_sentry_previous_exception_handler'] = set_exception_handler(function ($e) {
+    $GLOBALS['_bp_sentry_reported_exception'] = true;
+    _bp_sentry_report_exception($e);
+    $previous = $GLOBALS['_bp_sentry_previous_exception_handler'];
+    if ($previous !== null) {
+        call_user_func($previous, $e);
+        return;
+    }
+    // without a handler PHP reports the exception as uncaught, as usual
+    restore_exception_handler();
+    throw $e;
+});
+
+// Errors the handler does not see, which stop the script, are reported when
+// it shuts down. The uncaught exception was reported by its handler.
+register_shutdown_function(function () {
+    $error = error_get_last();
+    $fatal = E_ERROR | E_PARSE | E_CORE_ERROR | E_COMPILE_ERROR;
+    if ($error === null || !($error['type'] & $fatal)) {
+        return;
+    }
+    if (!empty($GLOBALS['_bp_sentry_reported_exception']) && strpos($error['message'], 'Uncaught ') === 0) {
+        return;
+    }
+    _bp_sentry_send(_bp_sentry_level($error['type']), _bp_sentry_error_name($error['type']), $error['message'],
+        _bp_sentry_frames(array(), $error['file'], $error['line']));
+});
@@ -0,0 +1,4 @@
+<?php
+$config = json_decode(file_get_contents(getenv('GREETING_CONFIG')), true);
+printf("%s on %s\n", $config['greeting'], $config['web_server']);
+printf("visits dir: %s\n", is_dir(getenv('HOME') . '/tmp/visits') ? 'yes' : 'no');
@@ -0,0 +1,8 @@
+<?php
+function wait_for_the_report($seconds)
+{
+    sleep($seconds);
+}
+
+wait_for_the_report(isset($_GET['seconds']) ? (int) $_GET['seconds'] : 3);
+echo "done\n";
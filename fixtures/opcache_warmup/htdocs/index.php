@@ -0,0 +1,4 @@
+<?php
+require __DIR__ . '/../lib/Greeting.php';
+
+echo (new Greeting())->hello(), "\n";
@@ -0,0 +1,9 @@
+<?php
+
+class Greeting
+{
+    public function hello()
+    {
+        return 'Hello from ' . basename(__DIR__);
+    }
+}
@@ -0,0 +1,5 @@
+<?php
+// a worker which exits after each job, as queue workers with --max-jobs do
+file_put_contents(getenv('HOME') . '/heartbeats', getmypid() . "\n", FILE_APPEND);
+echo "heartbeat from " . getmypid() . "\n";
+sleep(1);
@@ -0,0 +1,2 @@
+<?php
+echo "migrations done\n";
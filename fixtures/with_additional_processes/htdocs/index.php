@@ -0,0 +1,3 @@
+<?php
+$beats = @file(getenv('HOME') . '/heartbeats', FILE_IGNORE_NEW_LINES);
+printf("heartbeats: %d\n", $beats === false ? 0 : count($beats));
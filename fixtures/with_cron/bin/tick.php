@@ -0,0 +1,3 @@
+<?php
+file_put_contents(getenv('HOME') . '/ticks', date('c') . "\n", FILE_APPEND);
+echo "tick with " . php_ini_loaded_file() . "\n";
@@ -0,0 +1,3 @@
+<?php
+$ticks = @file(getenv('HOME') . '/ticks', FILE_IGNORE_NEW_LINES);
+printf("ticks: %d\n", $ticks === false ? 0 : count($ticks));
@@ -0,0 +1,74 @@
+<?php
+// Exports one server span per request over OTLP/HTTP JSON, configured only
+// through the OTEL_* environment variables the opentelemetry extension sets,
+// like the OpenTelemetry SDK an app brings with composer. The buildpack only
+// configures the exporter, it does not instrument the app.
+
+function otel_env($name, $default = '')
+{
+    $value = getenv($name);
+    return $value === false || $value === '' ? $default : $value;
+}
+
+function otel_pairs($list)
+{
+    $pairs = array();
+    foreach (array_filter(explode(',', $list), 'strlen') as $pair) {
+        list($key, $value) = array_pad(explode('=', $pair, 2), 2, '');
+        $pairs[trim(rawurldecode($key))] = trim(rawurldecode($value));
+    }
+    return $pairs;
+}
+
+function otel_attributes($pairs)
+{
+    $attributes = array();
+    foreach ($pairs as $key => $value) {
+        $attributes[] = array('key' => $key, 'value' => array('stringValue' => (string) $value));
+    }
+    return $attributes;
+}
+
+$start = microtime(true);
+echo "Hello from php-fpm\n";
+
+if (otel_env('OTEL_EXPORTER_OTLP_PROTOCOL', 'http/protobuf') !== 'http/json') {
+    echo "OTEL_EXPORTER_OTLP_PROTOCOL must be http/json\n";
+    return;
+}
+
+$resource = array_merge(
+    array('service.name' => otel_env('OTEL_SERVICE_NAME', 'unknown_service:php')),
+    otel_pairs(otel_env('OTEL_RESOURCE_ATTRIBUTES'))
+);
+$span = array(
+    'traceId' => bin2hex(random_bytes(16)),
+    'spanId' => bin2hex(random_bytes(8)),
+    'name' => $_SERVER['REQUEST_METHOD'] . ' ' . parse_url($_SERVER['REQUEST_URI'], PHP_URL_PATH),
+    'kind' => 2,
+    'startTimeUnixNano' => sprintf('%.0f', $start * 1e9),
+    'endTimeUnixNano' => sprintf('%.0f', microtime(true) * 1e9),
+    'attributes' => otel_attributes(array(
+        'http.method' => $_SERVER['REQUEST_METHOD'],
+        'http.target' => $_SERVER['REQUEST_URI'],
+    )),
+);
+$traces = array('resourceSpans' => array(array(
+    'resource' => array('attributes' => otel_attributes($resource)),
+    'scopeSpans' => array(array('scope' => array('name' => 'with_opentelemetry'), 'spans' => array($span))),
+)));
+
+$headers = array('Content-Type: application/json');
+foreach (otel_pairs(otel_env('OTEL_EXPORTER_OTLP_HEADERS')) as $key => $value) {
+    $headers[] = "$key: $value";
+}
+$context = stream_context_create(array('http' => array(
+    'method' => 'POST',
+    'header' => implode("\r\n", $headers),
+    'content' => json_encode($traces),
+    'timeout' => 5,
+)));
+$endpoint = rtrim(otel_env('OTEL_EXPORTER_OTLP_ENDPOINT', 'http://localhost:4318'), '/');
+if (@file_get_contents($endpoint . '/v1/traces', false, $context) === false) {
+    echo "Exporting the span to $endpoint failed\n";
+}
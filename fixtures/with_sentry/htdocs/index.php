@@ -0,0 +1,5 @@
+<?php
+if (isset($_GET['fail'])) {
+    throw new RuntimeException('checkout failed');
+}
+echo "Hello from php-fpm\n";
@@ -0,0 +1,3 @@
+<?php
+// run with cf run-task, through $HOME/.bp/bin/php-task
+printf("migrate: ini=%s bcmath=%s\n", php_ini_loaded_file(), extension_loaded('bcmath') ? 'yes' : 'no');
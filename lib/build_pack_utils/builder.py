@@ -345,8 +345,12 @@ class ExtensionRegister(object):
             if os.path.exists(os.path.join(path, 'extension.py')):
                 self._paths.append(os.path.abspath(path))
             else:
+                # extensions without extension.py declare a manifest, which
+                # lib/declarative_extensions executes
                 for p in os.listdir(path):
-                    self._paths.append(os.path.abspath(os.path.join(path, p)))
+                    if os.path.exists(os.path.join(path, p, 'extension.py')):
+                        self._paths.append(
+                            os.path.abspath(os.path.join(path, p)))
         return self._reg
 
 
@@ -1,8 +1,11 @@
 from __future__ import print_function
 
+import errno
+import os
 import signal
 import subprocess
 import sys
+import time
 import logging
 from datetime import datetime
 from threading import Thread
@@ -58,25 +61,61 @@ def _enqueue_output(proc, queue):
 class Process(subprocess.Popen):
     def __init__(self, cmd, name=None, quiet=False, *args, **kwargs):
         self.name = name
+        self.cmd = cmd
+        self.base_name = name
         self.quiet = quiet
         self.reader = None
         self.printer = None
         self.dead = False
+        self.policy = None
+        self.restart_at = None
 
         if self.quiet:
             self.name = "{0} (quiet)".format(self.name)
 
+        # the process and what its shell starts get a group of their own,
+        # so signals reach the server and not only the shell around it
         defaults = {
             'stdout': subprocess.PIPE,
             'stderr': subprocess.STDOUT,
             'shell': True,
             'bufsize': 1,
-            'close_fds': True
+            'close_fds': True,
+            'preexec_fn': os.setpgrp
         }
         defaults.update(kwargs)
 
         super(Process, self).__init__(cmd, *args, **defaults)
 
+    def signal_group(self, signum):
+        """Sends signum to the group of the process, False once it is gone"""
+        try:
+            os.killpg(self.pid, signum)
+        except OSError as e:
+            if e.errno != errno.ESRCH:
+                raise
+            return False
+        return True
+
+    def group_alive(self):
+        """Whether a process of the group still runs.  Zombies don't count,
+        those left by a shell which exited wait for init to reap them."""
+        if not os.path.isdir('/proc'):
+            return self.signal_group(0)
+        for pid in os.listdir('/proc'):
+            if not pid.isdigit():
+                continue
+            try:
+                with open(os.path.join('/proc', pid, 'stat')) as f:
+                    stat = f.read()
+            except IOError:
+                continue  # it exited meanwhile
+            # pid (comm) state ppid pgrp ..., comm may hold spaces
+            fields = stat[stat.rfind(')') + 2:].split()
+            if int(fields[2]) == self.pid and fields[0] != 'Z':
+                return True
+        return False
+
 
 class ProcessManager(object):
     """
@@ -88,30 +127,56 @@ class ProcessManager(object):
 
         pm = ProcessManager()
         pm.add_process('name', 'ruby server.rb')
-        pm.add_process('name', 'python worker.py')
+        pm.add_process('name', 'python worker.py', restart='always')
 
         pm.loop()
+
+    Stopping the processes, those of the `drain` stages are stopped
+    gracefully first, a stage at a time, each with the signal named for it.
+    A stage starts when the processes of the one before exited, and the
+    drain ends after `grace` seconds at most.  Then the processes left get
+    SIGTERM, and SIGKILL 5 seconds later.
+
+        pm = ProcessManager(grace=5, drain=(
+            {'nginx': 'SIGQUIT'}, {'php-fpm': 'SIGQUIT'}))
     """
-    def __init__(self):
+    def __init__(self, grace=0, drain=()):
         self.processes = []
         self.queue = Queue()
         self.returncode = None
+        self.grace = grace
+        self.drain = drain
         self._terminating = False
+        self._signalled = None
+        self._stages = []
+        self._draining = None
+        self._drain_started = None
         self._log = logging.getLogger('process')
 
-    def add_process(self, name, cmd, quiet=False):
+    def add_process(self, name, cmd, quiet=False, restart='never',
+                    restart_delay=1, max_restarts=0):
         """
         Add a process to this manager instance:
 
         Arguments:
 
-        name        - a human-readable identifier for the process
-                      (e.g. 'worker'/'server')
-        cmd         - the command-line used to run the process
-                      (e.g. 'python run.py')
+        name          - a human-readable identifier for the process
+                        (e.g. 'worker'/'server')
+        cmd           - the command-line used to run the process
+                        (e.g. 'python run.py')
+        restart       - 'never' stops all the processes when this one exits,
+                        'on-failure' starts it again when it exits with an
+                        error and 'always' whenever it exits
+        restart_delay - seconds to wait before starting it again
+        max_restarts  - restarts after which it is given up on, stopping
+                        all the processes, or 0 for no limit
         """
-        self._log.debug("Adding process [%s] with cmd [%s]", name, cmd)
-        self.processes.append(Process(cmd, name=name, quiet=quiet))
+        self._log.debug("Adding process [%s] with cmd [%s] restart [%s]",
+                        name, cmd, restart)
+        proc = Process(cmd, name=name, quiet=quiet)
+        proc.policy = {'restart': restart, 'delay': restart_delay,
+                       'max_restarts': max_restarts, 'restarts': 0}
+        self.processes.append(proc)
 
     def loop(self):
         """
@@ -122,8 +187,8 @@ class ProcessManager(object):
         If one process terminates, all the others will be terminated
         and loop() will return.
 
-        Returns: the returncode of the first process to exit, or 130 if
-        interrupted with Ctrl-C (SIGINT)
+        Returns: the returncode of the first process to exit, 130 if
+        interrupted with Ctrl-C (SIGINT) or 143 if stopped with SIGTERM
         """
         self._init_readers()
         self._init_printers()
@@ -131,6 +196,10 @@ class ProcessManager(object):
         for proc in self.processes:
             self._log.info("Started [%s] with pid [%s]", proc.name, proc.pid)
 
+        def sigterm(signum, frame):
+            self._signalled = signum
+        previous = signal.signal(signal.SIGTERM, sigterm)
+
         while True:
             try:
                 proc, line = self.queue.get(timeout=0.1)
@@ -143,22 +212,28 @@ class ProcessManager(object):
             else:
                 self._print_line(proc, line)
 
+            if self._signalled is not None:
+                self._signalled = None
+                self._log.info("SIGTERM received")
+                if self.returncode is None:
+                    self.returncode = 143
+                self.terminate()
+
             for proc in self.processes:
                 if not proc.dead and proc.poll() is not None:
                     self._log.info('process [%s] with pid [%s] terminated',
                                    proc.name, proc.pid)
                     proc.dead = True
+                    self._exited(proc)
 
-                    # Set the returncode of the ProcessManager instance if not
-                    # already set.
-                    if self.returncode is None:
-                        self.returncode = proc.returncode
-
-                    self.terminate()
+            self._restart_due()
+            self._drain_step()
 
             if not self._process_count() > 0:
                 break
 
+        signal.signal(signal.SIGTERM, previous)
+
         while True:
             try:
                 proc, line = self.queue.get(timeout=0.1)
@@ -169,36 +244,135 @@ class ProcessManager(object):
 
         return self.returncode
 
+    def _exited(self, proc):
+        """Restarts proc, or stops all the processes, as its policy says"""
+        policy = proc.policy or {'restart': 'never'}
+        if not self._terminating and policy['restart'] != 'never':
+            if policy['restart'] == 'on-failure' and proc.returncode == 0:
+                self._notice(proc, 'exited with status 0, not restarting it')
+                return
+            if (not policy['max_restarts'] or
+                    policy['restarts'] < policy['max_restarts']):
+                policy['restarts'] += 1
+                self._notice(proc, 'exited with status %s, restarting it in '
+                             '%ss (restart %d)' % (proc.returncode,
+                                                   policy['delay'],
+                                                   policy['restarts']))
+                proc.restart_at = time.time() + float(policy['delay'])
+                return
+            self._notice(proc, 'exited with status %s, giving up after %d '
+                         'restarts' % (proc.returncode, policy['restarts']))
+
+        # Set the returncode of the ProcessManager instance if not
+        # already set.
+        if self.returncode is None:
+            self.returncode = proc.returncode
+
+        self.terminate()
+
+    def _restart_due(self):
+        for i, proc in enumerate(self.processes):
+            if proc.restart_at is None or proc.restart_at > time.time():
+                continue
+            new = Process(proc.cmd, name=proc.base_name, quiet=proc.quiet)
+            new.policy = proc.policy
+            new.printer = proc.printer
+            self.processes[i] = new
+            t = Thread(target=_enqueue_output, args=(new, self.queue))
+            t.daemon = True
+            t.start()
+            self._log.info("Restarted [%s] with pid [%s]", new.name, new.pid)
+
+    def _notice(self, proc, message):
+        self._log.info('process [%s] %s', proc.name, message)
+        if not proc.quiet:
+            self._print_line(proc, '%s\n' % message)
+
     def terminate(self):
         """
 
         Terminate all the child processes of this ProcessManager, bringing the
-        loop() to an end.
+        loop() to an end.  The drain stages go first, when there is a grace
+        period.
 
         """
         if self._terminating:
             return False
 
         self._terminating = True
-
+        for proc in self.processes:
+            proc.restart_at = None
+
+        if self.grace > 0:
+            self._stages = list(self.drain)
+            self._drain_started = time.time()
+            self._log.info("draining for up to %ss", self.grace)
+        self._drain_next()
+
+    def _drain_next(self):
+        """Starts the next drain stage with processes left, or stops them
+        all once there is none"""
+        while self._stages:
+            stage = self._stages.pop(0)
+            self._draining = [p for p in self.processes
+                              if p.base_name in stage and p.group_alive()]
+            for proc in self._draining:
+                name = stage[proc.base_name]
+                self._notice(proc, 'stopping gracefully with %s, waiting up '
+                             'to %ss for it' % (name, self._grace_left()))
+                proc.signal_group(getattr(signal, name))
+            if self._draining:
+                return
+        self._draining = None
+        self._stop()
+
+    def _drain_step(self):
+        if self._draining is None:
+            return
+        # check each group once, one which ends meanwhile is seen next time
+        stopped = [p for p in self._draining if not p.group_alive()]
+        for proc in stopped:
+            self._notice(proc, 'stopped after %.1fs' %
+                         (time.time() - self._drain_started))
+        self._draining = [p for p in self._draining if p not in stopped]
+        if not self._draining:
+            self._drain_next()
+        elif self._grace_left() <= 0:
+            for proc in self._draining:
+                self._notice(proc, 'still running after the %ss grace '
+                             'period, stopping it' % self.grace)
+            self._stages = []
+            self._draining = None
+            self._stop()
+
+    def _grace_left(self):
+        left = self.grace - (time.time() - self._drain_started)
+        return max(0, int(round(left)))
+
+    def _stop(self):
         self._log.info("sending SIGTERM to all processes")
         for proc in self.processes:
-            if proc.poll() is None:
+            if proc.group_alive():
                 self._log.info("sending SIGTERM to pid [%d]", proc.pid)
-                proc.terminate()
+                proc.signal_group(signal.SIGTERM)
 
         def kill(signum, frame):
             # If anything is still alive, SIGKILL it
             for proc in self.processes:
-                if proc.poll() is None:
+                if proc.group_alive():
                     self._log.info("sending SIGKILL to pid [%d]", proc.pid)
-                    proc.kill()
+                    proc.signal_group(signal.SIGKILL)
 
         signal.signal(signal.SIGALRM, kill)  # @UndefinedVariable
         signal.alarm(5)  # @UndefinedVariable
 
     def _process_count(self):
-        return [p.poll() for p in self.processes].count(None)
+        # processes whose exit was not handled yet, or which wait to be
+        # restarted, count as running, and while stopping those which left
+        # what they started behind
+        return len([p for p in self.processes
+                    if not p.dead or p.restart_at is not None or
+                    (self._terminating and p.group_alive())])
 
     def _init_readers(self):
         for proc in self.processes:
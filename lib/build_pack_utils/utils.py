@@ -32,15 +32,56 @@ def load_env(path):
     return env
 
 
-def load_processes(path):
+RESTART_POLICIES = ('never', 'on-failure', 'always')
+
+# name [restart=always,delay=2,max_restarts=10]: command
+_proc_line = re.compile(r'^(?P<name>[^\s\[:]+)\s*'
+                        r'(?:\[(?P<policy>[^\]]*)\])?\s*:\s*(?P<cmd>.*)$')
+
+
+def process_key(name, restart='never', delay=None, max_restarts=None):
+    """The name of a process in .procs, with its restart policy
+
+    A process restarted by the process manager is written as
+    `name [restart=always,delay=2]: command`, the others keep the plain
+    `name: command`.
+    """
+    if restart == 'never':
+        return name
+    policy = ['restart=%s' % restart]
+    if delay is not None:
+        policy.append('delay=%s' % delay)
+    if max_restarts is not None:
+        policy.append('max_restarts=%s' % max_restarts)
+    return '%s [%s]' % (name, ','.join(policy))
+
+
+def load_process_specs(path):
+    """Returns the (name, command, policy) of each process in .procs"""
     _log.info("Loading processes from [%s]", path)
-    procs = {}
+    specs = []
     with open(path, 'rt') as procFile:
         for line in procFile:
-            name, cmd = line.strip().split(':', 1)
-            procs[name.strip()] = cmd.strip()
-    _log.debug("Loaded processes [%s]", procs)
-    return procs
+            m = _proc_line.match(line.strip())
+            if not m:
+                continue
+            policy = {}
+            for item in (m.group('policy') or '').split(','):
+                if '=' in item:
+                    key, val = item.split('=', 1)
+                    policy[key.strip()] = val.strip()
+            specs.append((m.group('name'), m.group('cmd').strip(), {
+                'restart': policy.get('restart', 'never'),
+                'restart_delay': float(policy.get('delay', 1)),
+                'max_restarts': int(policy.get('max_restarts', 0))
+            }))
+    _log.debug("Loaded processes [%s]", specs)
+    return specs
+
+
+def load_processes(path):
+    return dict((name, cmd) for (name, cmd, policy)
+                in load_process_specs(path))
 
 
 def load_extension(path):
@@ -16,12 +16,17 @@ from __future__ import print_function
 import os
 import os.path
 import re
+import json
 import yaml
 import logging
 import glob
+import pipes
+import shutil
 import subprocess
 import platform
+from build_pack_utils import utils
 from build_pack_utils import FileUtil
+from build_pack_utils import CloudFoundryUtil
 
 
 _log = logging.getLogger('helpers')
@@ -64,6 +69,127 @@ def setup_webdir_if_it_doesnt_exist(ctx):
             fu.done()
 
 
+def detect_framework(ctx):
+    """Applies the WEBDIR, LIBDIR and front controller of a known framework
+
+    Settings from `.bp-config/options.json` always win.  Detection can be
+    turned off with `"FRAMEWORK_DETECTION": false`.
+    """
+    ctx['FRAMEWORK_CACHE_DIRS'] = []
+    if not ctx.get('FRAMEWORK_DETECTION', True):
+        return
+    detector = os.path.join(ctx['BP_DIR'], 'bin', 'detect-framework')
+    if not os.path.exists(detector):
+        _log.debug('Framework detection is not available')
+        return
+    proc = subprocess.Popen([detector, ctx['BUILD_DIR']],
+                            stdout=subprocess.PIPE, stderr=subprocess.PIPE)
+    (stdout, stderr) = proc.communicate()
+    if proc.returncode != 0:
+        _log.warning('Framework detection failed: %s', stderr)
+        return
+    framework = json.loads(stdout)
+    if not framework:
+        return
+
+    user_config = CloudFoundryUtil.load_json_config_file_from(
+        ctx['BUILD_DIR'], os.path.join('.bp-config', 'options.json'))
+    presets = [('WEBDIR', framework['webdir']),
+               ('LIBDIR', framework['libdir']),
+               ('FRAMEWORK_FRONT_CONTROLLER', framework['front_controller'])]
+    if framework['libdir'] and 'LIBDIR' not in user_config:
+        # only a LIBDIR of the framework holds the vendor directory itself
+        presets.append(('COMPOSER_VENDOR_DIR', '{BUILD_DIR}/{LIBDIR}'))
+
+    print('-----> Detected %s (found %s)' % (
+        framework['name'], ', '.join(framework['evidence'])))
+    for (key, value) in presets:
+        if not value:
+            continue
+        if key in user_config:
+            print('       %s kept at [%s] from options.json' %
+                  (key, user_config[key]))
+        else:
+            ctx[key] = value
+            print('       %s set to [%s]' % (key, ctx[key]))
+    cache_dirs = framework['cache_dirs']
+    if not framework['webdir']:
+        # the app is moved into WEBDIR, so are its cache directories
+        cache_dirs = [os.path.join(ctx['WEBDIR'], d) for d in cache_dirs]
+    ctx['FRAMEWORK_CACHE_DIRS'] = cache_dirs
+    print('       Writable directories: %s' % ', '.join(cache_dirs))
+    print('       Set "FRAMEWORK_DETECTION": false in .bp-config/options.json'
+          ' to turn this off')
+
+
+SERVER_CONF_OPTIONS = ('NGINX_GZIP', 'FORCE_HTTPS', 'SECURITY_HEADERS',
+                       'STATIC_CACHE_MAX_AGE', 'CLIENT_MAX_BODY_SIZE',
+                       'HTTPD_DEFLATE_TYPES', 'HTTPD_EXTRA_MODULES',
+                       'FPM_STATUS', 'FPM_STATUS_PATH', 'FPM_PING_PATH',
+                       'FPM_STATUS_HTPASSWD', 'METRICS_EXPORTER',
+                       'METRICS_PATH', 'LOG_FORMAT')
+
+
+def render_server_conf(ctx, server, conf_dir):
+    """Renders the includes which apply the web server options
+
+    The buildpack ships the includes rendered from the defaults, which are
+    kept when `server-conf` is not available.
+    """
+    options = dict((key, ctx[key]) for key in SERVER_CONF_OPTIONS
+                   if key in ctx)
+    renderer = os.path.join(ctx['BP_DIR'], 'bin', 'server-conf')
+    if not os.path.exists(renderer):
+        if options:
+            print('WARNING: ignoring %s, this buildpack was built without '
+                  'server-conf' % ', '.join(sorted(options)))
+        return
+    args = [renderer, '-server', server, '-dir', conf_dir]
+    if server == 'httpd':
+        args.extend(['-fpm-listen', ctx['PHP_FPM_LISTEN']])
+    proc = subprocess.Popen(args, stdin=subprocess.PIPE,
+                            stdout=subprocess.PIPE, stderr=subprocess.PIPE)
+    (stdout, stderr) = proc.communicate(json.dumps(options))
+    if proc.returncode != 0:
+        raise RuntimeError('Invalid web server options: %s' % stderr.strip())
+
+
+def report_config_drift(ctx):
+    """Warns about configuration in .bp-config copied from an old default
+
+    `or_from_build_pack` prefers the copy of the application, so changes to
+    the default, such as security fixes, never reach it.  This only warns,
+    `bin/config-drift <app dir>` prints the full diff.
+    """
+    reporter = os.path.join(ctx['BP_DIR'], 'bin', 'config-drift')
+    if not os.path.exists(reporter):
+        _log.debug('Config drift report is not available')
+        return
+    proc = subprocess.Popen([
+        reporter, '-summary',
+        '-defaults', os.path.join(ctx['BP_DIR'], 'defaults', 'config'),
+        '-history', os.path.join(ctx['BP_DIR'], 'defaults',
+                                 'config-history.json'),
+        '-web-server', ctx['WEB_SERVER'],
+        '-php-version', ctx['PHP_VERSION'],
+        ctx['BUILD_DIR']], stdout=subprocess.PIPE, stderr=subprocess.PIPE)
+    (stdout, stderr) = proc.communicate()
+    if proc.returncode != 0:
+        _log.warning('Config drift report failed: %s', stderr)
+        return
+    if stdout:
+        print(stdout.rstrip())
+        print('       Run bin/config-drift of the buildpack on the app to '
+              'see the full diff')
+
+
+def setup_framework_dirs(ctx):
+    for cache_dir in ctx.get('FRAMEWORK_CACHE_DIRS', []):
+        path = os.path.join(ctx['BUILD_DIR'], cache_dir)
+        if not os.path.exists(path):
+            os.makedirs(path)
+
+
 def setup_log_dir(ctx):
     logPath = os.path.join(ctx['BUILD_DIR'], 'logs')
     if not os.path.exists(logPath):
@@ -178,6 +304,509 @@ def include_fpm_d_confs(ctx):
         ctx['PHP_FPM_CONF_INCLUDE'] = 'include=fpm.d/*.conf'
 
 
+def setup_fpm_status(ctx):
+    """Sets pm.status_path and ping.path when FPM_STATUS is on
+
+    The web server exposes the same paths, see `render_server_conf`, and
+    protects them with basic auth when FPM_STATUS_HTPASSWD names a file.
+    METRICS_EXPORTER needs the paths too, but reads them from php-fpm
+    directly, so they are only exposed with FPM_STATUS.
+    """
+    ctx['PHP_FPM_STATUS'] = ''
+    if not ctx.get('FPM_STATUS', False) and \
+            not ctx.get('METRICS_EXPORTER', False):
+        return
+    ctx['PHP_FPM_STATUS'] = 'pm.status_path = %s\nping.path = %s' % (
+        ctx.get('FPM_STATUS_PATH', '/fpm-status'),
+        ctx.get('FPM_PING_PATH', '/fpm-ping'))
+    if not ctx.get('FPM_STATUS', False):
+        return
+    htpasswd = ctx.get('FPM_STATUS_HTPASSWD')
+    if not htpasswd:
+        print('WARNING: FPM_STATUS exposes the php-fpm status to anyone, set '
+              'FPM_STATUS_HTPASSWD to require a password')
+    elif not os.path.isfile(os.path.join(ctx['BUILD_DIR'], htpasswd)):
+        raise RuntimeError('FPM_STATUS_HTPASSWD names [%s], which is not a '
+                           'file of the application' % htpasswd)
+
+
+FPM_SLOWLOG_FIFO = os.path.join('php', 'var', 'log', 'slowlog.fifo')
+
+FPM_TIMEOUT_OPTIONS = (
+    ('PHP_FPM_SLOWLOG_TIMEOUT', 'request_slowlog_timeout'),
+    ('PHP_FPM_TERMINATE_TIMEOUT', 'request_terminate_timeout'))
+
+_fpm_timeout = re.compile(r'^[0-9]+[smhd]?$')
+
+
+def setup_fpm_request_limits(ctx):
+    """Sets the slowlog, request_terminate_timeout and pm.max_requests
+
+    PHP_FPM_SLOWLOG_TIMEOUT and PHP_FPM_TERMINATE_TIMEOUT take php-fpm
+    times such as 5s or 2m, PHP_FPM_MAX_REQUESTS a number of requests.  The
+    slowlog is a fifo which the `php-fpm-slowlog` process copies to stdout,
+    so the traces show up in the app logs under its name.
+    """
+    lines = []
+    for (key, setting) in FPM_TIMEOUT_OPTIONS:
+        value = str(ctx.get(key, '')).strip()
+        if not value:
+            continue
+        if not _fpm_timeout.match(value):
+            raise RuntimeError('%s must be a time such as 30s or 2m, not [%s]'
+                               % (key, value))
+        lines.append('%s = %s' % (setting, value))
+    if fpm_slowlog_enabled(ctx):
+        lines.append('slowlog = @{HOME}/%s' % FPM_SLOWLOG_FIFO)
+    max_requests = str(ctx.get('PHP_FPM_MAX_REQUESTS', '')).strip()
+    if max_requests:
+        if not max_requests.isdigit():
+            raise RuntimeError('PHP_FPM_MAX_REQUESTS must be a number of '
+                               'requests, not [%s]' % max_requests)
+        lines.append('pm.max_requests = %s' % max_requests)
+    ctx['PHP_FPM_REQUEST_LIMITS'] = '\n'.join(lines)
+
+
+def shutdown_grace_seconds(ctx):
+    """The seconds of SHUTDOWN_GRACE_SECONDS, 5 by default
+
+    Stopping the instance, `bin/start` gives the web server and php-fpm this
+    long to finish the requests in flight, and php-fpm its workers with
+    process_control_timeout.  Cloud Foundry kills the processes which are
+    left 10 seconds after asking them to stop, unless it is set up to wait
+    longer, and the processes which are not drained get 5 of them.
+    """
+    value = str(ctx.get('SHUTDOWN_GRACE_SECONDS', 5)).strip()
+    if not value.isdigit():
+        raise RuntimeError('SHUTDOWN_GRACE_SECONDS must be a number of '
+                           'seconds, not [%s]' % value)
+    return int(value)
+
+
+def fpm_slowlog_enabled(ctx):
+    return bool(str(ctx.get('PHP_FPM_SLOWLOG_TIMEOUT', '')).strip())
+
+
+def fpm_slowlog_fifo_command(ctx):
+    """Start script command which creates the fifo php-fpm writes the
+    slowlog to"""
+    fifo = '"$HOME/%s"' % FPM_SLOWLOG_FIFO
+    return ('mkdir', '-p', '"$HOME/%s"' % os.path.dirname(FPM_SLOWLOG_FIFO),
+            '&&', 'rm', '-f', fifo, '&&', 'mkfifo', fifo)
+
+
+def fpm_slowlog_command(ctx):
+    """Process which copies the slowlog to stdout
+
+    It opens the fifo for writing as well, so it does not read the end of
+    the fifo each time php-fpm closes it after a trace.
+    """
+    return ('cat', '0<>"$HOME/%s"' % FPM_SLOWLOG_FIFO)
+
+
+_process_name = re.compile(r'^[a-z0-9][a-z0-9_-]*$')
+
+
+def buildpack_processes(ctx):
+    """The processes the buildpack starts, which ADDITIONAL_PROCESSES can't
+    replace.  `bin/extension-manifest` holds the list, so app extensions are
+    checked against the same names."""
+    lister = os.path.join(ctx['BP_DIR'], 'bin', 'extension-manifest')
+    if not os.path.exists(lister):
+        print('WARNING: not checking ADDITIONAL_PROCESSES against the '
+              'processes of the buildpack, this buildpack was built without '
+              'extension-manifest')
+        return ()
+    return tuple(subprocess.check_output(
+        [lister, '-reserved-processes']).split())
+
+
+def additional_processes(ctx):
+    """The processes of ADDITIONAL_PROCESSES, keyed as in .procs
+
+    Each entry of the map is a command, or an object with the `command`, its
+    `restart` policy, `restart_delay` in seconds and `max_restarts`.  They
+    are restarted whenever they exit unless the policy says otherwise, see
+    `ProcessManager.add_process`.
+    """
+    processes = ctx.get('ADDITIONAL_PROCESSES') or {}
+    if not hasattr(processes, 'items'):
+        raise RuntimeError('ADDITIONAL_PROCESSES must map process names to '
+                           'commands')
+    reserved = processes and buildpack_processes(ctx)
+    commands = {}
+    for name, spec in sorted(processes.items()):
+        if not _process_name.match(name):
+            raise RuntimeError('ADDITIONAL_PROCESSES names must be lower '
+                               'case letters, digits, - and _, not [%s]'
+                               % name)
+        if name in reserved:
+            raise RuntimeError('ADDITIONAL_PROCESSES can not replace [%s], '
+                               'which the buildpack starts' % name)
+        if hasattr(spec, 'strip'):
+            spec = {'command': spec}
+        if not hasattr(spec, 'items'):
+            raise RuntimeError('ADDITIONAL_PROCESSES [%s] must be a command '
+                               'or an object with a command' % name)
+        unknown = set(spec) - set(('command', 'restart', 'restart_delay',
+                                   'max_restarts'))
+        if unknown:
+            raise RuntimeError('ADDITIONAL_PROCESSES [%s] has unknown keys '
+                               '[%s]' % (name, ', '.join(sorted(unknown))))
+        command = spec.get('command')
+        if not hasattr(command, 'strip') or not command.strip():
+            raise RuntimeError('ADDITIONAL_PROCESSES [%s] needs a command'
+                               % name)
+        restart = spec.get('restart', 'always')
+        if restart not in utils.RESTART_POLICIES:
+            raise RuntimeError('ADDITIONAL_PROCESSES [%s] restart must be '
+                               'one of %s, not [%s]' % (
+                                   name, ', '.join(utils.RESTART_POLICIES),
+                                   restart))
+        delay = spec.get('restart_delay', 1)
+        if isinstance(delay, bool) or not isinstance(delay, (int, float)) \
+                or delay < 0:
+            raise RuntimeError('ADDITIONAL_PROCESSES [%s] restart_delay must '
+                               'be a number of seconds, not [%s]'
+                               % (name, delay))
+        max_restarts = spec.get('max_restarts', 0)
+        if isinstance(max_restarts, bool) or \
+                not isinstance(max_restarts, int) or max_restarts < 0:
+            raise RuntimeError('ADDITIONAL_PROCESSES [%s] max_restarts must '
+                               'be a number of restarts, 0 for no limit, not '
+                               '[%s]' % (name, max_restarts))
+        key = utils.process_key(name, restart, delay, max_restarts)
+        commands[key] = (command.strip(),)
+    return commands
+
+
+FPM_POOL_OPTIONS = (
+    ('PHP_FPM_PM', '-pm', 'dynamic'),
+    ('PHP_FPM_MAX_CHILDREN', '-max-children', 5),
+    ('PHP_FPM_START_SERVERS', '-start-servers', 2),
+    ('PHP_FPM_MIN_SPARE_SERVERS', '-min-spare-servers', 1),
+    ('PHP_FPM_MAX_SPARE_SERVERS', '-max-spare-servers', 3),
+    ('PHP_FPM_PROCESS_IDLE_TIMEOUT', '-process-idle-timeout', '10s'))
+
+
+def php_memory_defaults(ctx):
+    """The php.ini memory settings used when they are not sized at launch
+
+    `fpm-tune -defaults` prints the values it falls back to at launch, so
+    staging uses the same ones.  A buildpack built without fpm-tune never
+    sizes them and uses a copy of fpmtune.DefaultMemory.
+    """
+    tuner = os.path.join(ctx['BP_DIR'], 'bin', 'fpm-tune')
+    if not os.path.exists(tuner):
+        return (('PHP_MEMORY_LIMIT', '128M'),
+                ('PHP_OPCACHE_MEMORY_CONSUMPTION', '128'),
+                ('PHP_REALPATH_CACHE_SIZE', '4096K'))
+    return tuple(tuple(line.split('=', 1)) for line in
+                 subprocess.check_output([tuner, '-defaults']).splitlines())
+
+
+def fpm_pool_command(ctx):
+    """Start script command which exports the php-fpm pool settings
+
+    `fpm-tune` sizes the pool at launch from the container memory, keeping
+    any setting from options.json, and derives the memory settings of
+    php.ini from it.  Without it the static defaults are used.
+    """
+    if os.path.exists(os.path.join(ctx['BUILD_DIR'], '.bp', 'bin',
+                                   'fpm-tune')):
+        args = ['$HOME/.bp/bin/fpm-tune']
+        for (key, flag, _) in FPM_POOL_OPTIONS:
+            if ctx.get(key):
+                args.append('%s=%s' % (flag, pipes.quote(str(ctx[key]))))
+        if ctx.get('PHP_FPM_RESERVED_MEMORY'):
+            args.append('-reserved=%s' %
+                        pipes.quote(str(ctx['PHP_FPM_RESERVED_MEMORY'])))
+        return ('eval', '"$(%s)"' % ' '.join(args))
+    return ('export',) + tuple(
+        '%s=%s' % (key, pipes.quote(str(ctx.get(key, default))))
+        for (key, _, default) in FPM_POOL_OPTIONS) + tuple(
+        '%s=%s' % (key, value) for (key, value) in php_memory_defaults(ctx))
+
+
+OPCACHE_DIR = '.opcache'
+
+# top level directories of the droplet which do not hold application code
+OPCACHE_SKIP_DIRS = ('.bp', '.bp-config', '.cloudfoundry', '.extensions',
+                     '.git', OPCACHE_DIR, 'httpd', 'logs', 'nginx', 'php')
+
+
+def _php_version_at_least(ctx, *version):
+    try:
+        parts = [int(p) for p in str(ctx['PHP_VERSION']).split('.')]
+    except ValueError:
+        return False
+    return tuple(parts[:len(version)]) >= version
+
+
+def setup_opcache_warmup(ctx):
+    """Loads OPcache when `OPCACHE_WARMUP` is set
+
+    The warmup fills `opcache.file_cache`, which PHP 5.6 does not have.
+    """
+    if not ctx.get('OPCACHE_WARMUP', False):
+        if ctx.get('OPCACHE_PRELOAD'):
+            print('WARNING: OPCACHE_PRELOAD needs OPCACHE_WARMUP, '
+                  'nothing is preloaded')
+        return
+    if not _php_version_at_least(ctx, 7, 0):
+        print('WARNING: OPCACHE_WARMUP needs PHP 7.0 or later, '
+              'skipping it for PHP %s' % ctx['PHP_VERSION'])
+        ctx['OPCACHE_WARMUP'] = False
+        return
+    if 'opcache' not in ctx['ZEND_EXTENSIONS']:
+        ctx['ZEND_EXTENSIONS'] = list(ctx['ZEND_EXTENSIONS']) + ['opcache']
+
+
+def _opcache_ini_path(ctx):
+    return os.path.join(ctx['BUILD_DIR'], 'php', 'etc', 'php.ini.d',
+                        'opcache-warmup.ini')
+
+
+def write_opcache_ini(ctx):
+    """Points OPcache at the file cache shipped in the droplet"""
+    if not ctx.get('OPCACHE_WARMUP', False):
+        return
+    path = _opcache_ini_path(ctx)
+    if not os.path.exists(os.path.dirname(path)):
+        os.makedirs(os.path.dirname(path))
+    with open(path, 'wt') as f:
+        f.write('; written during staging because OPCACHE_WARMUP is set\n')
+        f.write('opcache.file_cache=@{HOME}/%s\n' % OPCACHE_DIR)
+
+
+AUTO_PREPEND_SCRIPT = os.path.join('.bp', 'lib', 'auto-prepend.php')
+
+
+def add_auto_prepend_file(ctx, source, reason):
+    """Runs the PHP script at source before every script of the app
+
+    PHP has a single auto_prepend_file, so it names a script which requires
+    all of the scripts added during staging, in the order they were added.
+    A handler they install should call the one it replaces.
+    """
+    etc = os.path.join(ctx['BUILD_DIR'], 'php', 'etc')
+    ini_path = os.path.join(etc, 'php.ini.d', 'auto-prepend.ini')
+    scripts = ctx.setdefault('AUTO_PREPEND_FILES', [])
+    if not scripts:
+        prepend = re.compile(r'^[ \t]*auto_prepend_file[ \t]*=[ \t]*[^\s"]',
+                             re.M)
+        for ini in [os.path.join(etc, 'php.ini')] + \
+                glob.glob(os.path.join(etc, 'php.ini.d', '*.ini')):
+            if os.path.isfile(ini) and prepend.search(open(ini).read()):
+                print('WARNING: %s replaces the auto_prepend_file of %s' % (
+                    reason, os.path.basename(ini)))
+    scripts.append((os.path.basename(source), reason))
+
+    lib = os.path.join(ctx['BUILD_DIR'], os.path.dirname(AUTO_PREPEND_SCRIPT))
+    if not os.path.exists(lib):
+        os.makedirs(lib)
+    shutil.copy(source, lib)
+    with open(os.path.join(ctx['BUILD_DIR'], AUTO_PREPEND_SCRIPT), 'wt') as f:
+        f.write('<?php\n// written during staging\n')
+        for (name, why) in scripts:
+            f.write("require __DIR__ . '/%s'; // %s\n" % (name, why))
+    if not os.path.exists(os.path.dirname(ini_path)):
+        os.makedirs(os.path.dirname(ini_path))
+    with open(ini_path, 'wt') as f:
+        f.write('; written during staging for %s\n' %
+                ', '.join(why for (name, why) in scripts))
+        f.write('auto_prepend_file = "@{HOME}/%s"\n' % AUTO_PREPEND_SCRIPT)
+
+
+def setup_fpm_log_format(ctx):
+    """Sends the output of the php-fpm workers to its error_log when
+    LOG_FORMAT is json
+
+    The prepended log-format.php writes the JSON lines to stderr, which is
+    the output of the app for php-app and tasks.  php-fpm drops the stderr
+    of its workers unless catch_workers_output is on, then writes it to its
+    error_log, prefixed with the pool and the worker.
+    """
+    ctx['PHP_FPM_LOG_FORMAT'] = ''
+    if ctx.get('LOG_FORMAT', 'text') == 'json':
+        ctx['PHP_FPM_LOG_FORMAT'] = 'catch_workers_output = yes'
+
+
+def write_log_format_ini(ctx):
+    """Makes PHP log errors as JSON when LOG_FORMAT is json
+
+    The web servers switch their access logs in `render_server_conf`, PHP
+    gets a prepended script which logs errors with the same keys.
+    """
+    if ctx.get('LOG_FORMAT', 'text') != 'json':
+        return
+    add_auto_prepend_file(
+        ctx, os.path.join(ctx['BP_DIR'], 'lib', 'php', 'log-format.php'),
+        'LOG_FORMAT json')
+
+
+def _opcache_warmup_files(build_dir):
+    files = []
+    for (root, dirs, names) in os.walk(build_dir):
+        if root == build_dir:
+            dirs[:] = [d for d in dirs if d not in OPCACHE_SKIP_DIRS]
+        dirs[:] = sorted(d for d in dirs if d != '.git')
+        files.extend(os.path.join(root, name) for name in sorted(names)
+                     if name.endswith('.php'))
+    return files
+
+
+def _link_runtime_dir(runtime_dir, build_dir):
+    """Makes the app reachable where it runs while the warmup compiles it
+
+    The file cache is keyed by the path of each script and paths such as
+    `__DIR__` are compiled into it, so the scripts are compiled through the
+    path the app has at runtime.  Returns whether a link was made, None
+    when the path is taken.
+    """
+    if os.path.realpath(runtime_dir) == build_dir:
+        return False
+    if os.path.lexists(runtime_dir):
+        print('WARNING: %s exists, skipping the OPcache warmup' % runtime_dir)
+        return None
+    try:
+        if not os.path.exists(os.path.dirname(runtime_dir)):
+            os.makedirs(os.path.dirname(runtime_dir))
+        os.symlink(build_dir, runtime_dir)
+    except OSError as e:
+        print('WARNING: could not link %s to the app, skipping the OPcache '
+              'warmup: %s' % (runtime_dir, e))
+        return None
+    return True
+
+
+def _php_string(value):
+    return "'%s'" % value.replace('\\', '\\\\').replace("'", "\\'")
+
+
+def _write_opcache_preload(ctx, build_dir):
+    """Writes `php/etc/preload.php` from `OPCACHE_PRELOAD`
+
+    `OPCACHE_PRELOAD` is either `composer`, to preload the composer classmap,
+    or a list of files and globs relative to the application root.
+    """
+    preload = ctx.get('OPCACHE_PRELOAD')
+    if not preload:
+        return
+    if not _php_version_at_least(ctx, 7, 4):
+        print('WARNING: OPCACHE_PRELOAD needs PHP 7.4 or later, PHP %s does '
+              'not support it, nothing is preloaded' % ctx['PHP_VERSION'])
+        return
+
+    lines = ['<?php',
+             '// written during staging from OPCACHE_PRELOAD',
+             '$app = dirname(__DIR__, 2);']
+    if preload == 'composer':
+        vendor_dir = ctx.get('COMPOSER_VENDOR_DIR',
+                             os.path.join(ctx['BUILD_DIR'], ctx['LIBDIR'],
+                                          'vendor'))
+        classmap = os.path.join(os.path.realpath(vendor_dir),
+                                'composer', 'autoload_classmap.php')
+        if not os.path.exists(classmap):
+            print('WARNING: OPCACHE_PRELOAD is "composer", but there is no '
+                  'composer classmap. Run composer with '
+                  '--optimize-autoloader to generate one.')
+            return
+        lines.extend([
+            'foreach (require $app . %s as $file) {' %
+            _php_string('/' + os.path.relpath(classmap, build_dir)),
+            '    opcache_compile_file($file);',
+            '}'])
+    else:
+        if not isinstance(preload, list):
+            preload = [preload]
+        files = sorted(set(
+            os.path.relpath(path, build_dir)
+            for pattern in preload
+            for path in glob.glob(os.path.join(build_dir, pattern))
+            if os.path.isfile(path)))
+        if not files:
+            print('WARNING: OPCACHE_PRELOAD matches no files, '
+                  'nothing is preloaded')
+            return
+        lines.append('foreach (array(')
+        lines.extend('    %s,' % _php_string(f) for f in files)
+        lines.extend([
+            ') as $file) {',
+            "    opcache_compile_file($app . '/' . $file);",
+            '}'])
+
+    with open(os.path.join(ctx['BUILD_DIR'], 'php', 'etc', 'preload.php'),
+              'wt') as f:
+        f.write('\n'.join(lines) + '\n')
+    with open(_opcache_ini_path(ctx), 'at') as f:
+        f.write('opcache.preload=@{HOME}/php/etc/preload.php\n')
+    print('       Preloading from %s' % (
+        'the composer classmap' if preload == 'composer'
+        else 'OPCACHE_PRELOAD'))
+
+
+def warm_opcache(ctx):
+    """Compiles the application into the OPcache file cache of the droplet
+
+    This runs after the extensions, so the dependencies installed by composer
+    are cached as well.  Files which do not compile are skipped.
+    """
+    if not ctx.get('OPCACHE_WARMUP', False):
+        return
+    build_dir = os.path.realpath(ctx['BUILD_DIR'])
+    php = os.path.join(build_dir, 'php', 'bin', 'php')
+    opcache = glob.glob(os.path.join(build_dir, 'php', 'lib', 'php',
+                                     'extensions', '*', 'opcache.so'))
+    if not os.path.exists(php) or not opcache:
+        print('WARNING: OPcache is not installed, skipping the warmup')
+        return
+
+    _write_opcache_preload(ctx, build_dir)
+    runtime_dir = ctx.get('OPCACHE_RUNTIME_DIR', '/home/vcap/app')
+    linked = _link_runtime_dir(runtime_dir, build_dir)
+    if linked is None:
+        return
+    try:
+        _compile_opcache(ctx, build_dir, runtime_dir, php, opcache[0])
+    finally:
+        if linked:
+            os.remove(runtime_dir)
+
+
+def _compile_opcache(ctx, build_dir, runtime_dir, php, opcache):
+    print('-----> Warming up OPcache')
+    cache_dir = os.path.join(build_dir, OPCACHE_DIR)
+    if os.path.exists(cache_dir):
+        shutil.rmtree(cache_dir)
+    os.makedirs(cache_dir)
+    file_list = os.path.join(ctx['TMPDIR'], 'opcache-warmup.txt')
+    with open(file_list, 'wt') as f:
+        f.write('\n'.join(
+            os.path.join(runtime_dir, os.path.relpath(path, build_dir))
+            for path in _opcache_warmup_files(build_dir)) + '\n')
+
+    env = dict(os.environ)
+    env['LD_LIBRARY_PATH'] = os.path.join(build_dir, 'php', 'lib')
+    proc = subprocess.Popen(
+        [php, '-n',
+         '-d', 'zend_extension=%s' % opcache,
+         '-d', 'opcache.enable_cli=1',
+         '-d', 'display_errors=stderr',
+         '-d', 'opcache.file_cache=%s' % cache_dir,
+         '-d', 'opcache.memory_consumption=256',
+         '-d', 'opcache.max_accelerated_files=100000',
+         os.path.join(ctx['BP_DIR'], 'lib', 'php', 'opcache_warmup.php'),
+         file_list],
+        stdout=subprocess.PIPE, stderr=subprocess.PIPE, env=env)
+    (stdout, stderr) = proc.communicate()
+    if proc.returncode != 0:
+        print('WARNING: OPcache warmup failed: %s' % stderr.strip())
+        return
+    _log.debug('OPcache warmup: %s', stderr)
+    print('       %s' % stdout.strip())
+
+
 def convert_php_extensions(ctx):
     _log.debug('Converting PHP extensions')
     SKIP = ('cli', 'pear', 'cgi')
@@ -0,0 +1,259 @@
+# Licensed to the Apache Software Foundation (ASF) under one or more
+# contributor license agreements.  See the NOTICE file distributed with
+# this work for additional information regarding copyright ownership.
+# The ASF licenses this file to You under the Apache License, Version 2.0
+# (the "License"); you may not use this file except in compliance with
+# the License.  You may obtain a copy of the License at
+#
+#     http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+"""Executes the declarative manifests of app extensions
+
+An app extension, `.extensions/<name>`, either has an `extension.py`, which
+is loaded as a Python module, or an `extension.yml`, `extension.yaml` or
+`extension.json`, which declares what the extension adds and is executed
+here:
+
+    api_version: 1
+    name: phpmyadmin
+    downloads:
+      - url: https://example.com/phpMyAdmin-4.3.12-english.tar.gz
+        sha256: <SHA-256 of the file>
+        to: htdocs/phpmyadmin
+        strip: true
+    config_files:
+      - from: config.inc.php
+        to: htdocs/phpmyadmin/config.inc.php
+        rewrite: true
+    env:
+      PMA_CONFIG: $HOME/htdocs/phpmyadmin/config.inc.php
+    processes:
+      worker: php $HOME/htdocs/worker.php
+    profile_d:
+      - name: setup.sh
+        script: mkdir -p $HOME/tmp/phpmyadmin
+
+Downloads are extracted into, or copied into, the directory `to` of the
+app.  Config files with `rewrite` get `#{KEY}` replaced during staging.
+Values of `env` are expanded by the shell at launch, so `$HOME` works.
+`bin/extension-manifest` of the buildpack, built from
+src/php/extmanifest, validates the manifests before any is executed, and
+`bin/extension-kit` stages an extension offline for its authors.
+"""
+from __future__ import print_function
+import hashlib
+import json
+import logging
+import os
+import os.path
+import shutil
+import subprocess
+import yaml
+from urlparse import urlparse
+from build_pack_utils import utils
+from build_pack_utils.downloads import Downloader
+from build_pack_utils.zips import UnzipUtil
+
+
+_log = logging.getLogger('declarative_extensions')
+
+API_VERSION = 1
+MANIFEST_NAMES = ('extension.yml', 'extension.yaml', 'extension.json')
+
+
+def find_extensions(build_dir, warn=False):
+    """Returns the app extensions which have a manifest, sorted by name"""
+    root = os.path.join(build_dir, '.extensions')
+    if not os.path.isdir(root):
+        return []
+    found = []
+    for name in sorted(os.listdir(root)):
+        path = os.path.join(root, name)
+        if not os.path.isdir(path):
+            continue
+        if os.path.exists(os.path.join(path, 'extension.py')):
+            continue
+        if manifest_path(path):
+            found.append(path)
+        elif warn:
+            print('-----> WARNING: ignoring .extensions/%s, it has neither '
+                  'an extension.py nor an %s' % (name, MANIFEST_NAMES[0]))
+    return found
+
+
+def manifest_path(ext_dir):
+    for name in MANIFEST_NAMES:
+        path = os.path.join(ext_dir, name)
+        if os.path.exists(path):
+            return path
+
+
+def load_manifest(ext_dir):
+    path = manifest_path(ext_dir)
+    with open(path) as f:
+        if path.endswith('.json'):
+            return json.load(f)
+        return yaml.safe_load(f)
+
+
+def validate(ctx, ext_dirs):
+    """Checks the manifests with bin/extension-manifest
+
+    Fails staging with all the problems found, rather than at the first
+    step of a manifest which can't be executed.
+    """
+    validator = os.path.join(ctx['BP_DIR'], 'bin', 'extension-manifest')
+    if not os.path.exists(validator):
+        print('-----> WARNING: not validating the manifests of .extensions, '
+              'this buildpack was built without extension-manifest')
+        return
+    proc = subprocess.Popen([validator] + list(ext_dirs),
+                            stdout=subprocess.PIPE, stderr=subprocess.PIPE)
+    (stdout, stderr) = proc.communicate()
+    if proc.returncode != 0:
+        raise RuntimeError('Invalid extension manifest\n%s' % stderr.rstrip())
+    _log.debug('Validated extension manifests: %s', stdout)
+
+
+def download(ctx, url, sha256):
+    """Downloads url into TMPDIR, failing unless its SHA-256 matches"""
+    path = os.path.join(ctx['TMPDIR'], os.path.basename(urlparse(url).path))
+    Downloader(ctx).custom_extension_download(url, url, path)
+    digest = hashlib.sha256()
+    with open(path, 'rb') as f:
+        for chunk in iter(lambda: f.read(64 * 1024), ''):
+            digest.update(chunk)
+    if digest.hexdigest() != sha256:
+        raise RuntimeError('SHA-256 of %s is %s, the manifest expects %s'
+                           % (url, digest.hexdigest(), sha256))
+    return path
+
+
+def _inside(root, rel):
+    """Joins rel to root, refusing paths which leave root"""
+    path = os.path.normpath(os.path.join(root, rel))
+    if path != root and not path.startswith(root.rstrip(os.sep) + os.sep):
+        raise RuntimeError('%s is outside of %s' % (rel, root))
+    return path
+
+
+def _shell_quote(value):
+    """Double quotes value, keeping the expansion of variables"""
+    for c in ('\\', '"', '`'):
+        value = value.replace(c, '\\' + c)
+    return '"%s"' % value
+
+
+def _scalar(value):
+    if isinstance(value, bool):
+        return 'true' if value else 'false'
+    if isinstance(value, basestring):
+        return value
+    return str(value)
+
+
+def _write(path, content):
+    if isinstance(content, unicode):
+        content = content.encode('utf-8')
+    if not os.path.exists(os.path.dirname(path)):
+        os.makedirs(os.path.dirname(path))
+    with open(path, 'w') as f:
+        f.write(content)
+
+
+def install(ctx, ext_dir, manifest, fetch=download):
+    """Executes the manifest of the extension in ext_dir
+
+    fetch(ctx, url, sha256) returns the path of a verified download, the
+    extension kit replaces it to stage offline.  Returns the paths written,
+    relative to BUILD_DIR.
+    """
+    build_dir = os.path.normpath(ctx['BUILD_DIR'])
+    name = manifest['name']
+    written = []
+    print('-----> Installing extension %s' % name)
+
+    for dl in manifest.get('downloads') or []:
+        path = fetch(ctx, dl['url'], dl['sha256'])
+        to_dir = _inside(build_dir, dl['to'])
+        if dl.get('extract', True):
+            UnzipUtil(ctx).extract(path, to_dir, dl.get('strip', False))
+        else:
+            if not os.path.exists(to_dir):
+                os.makedirs(to_dir)
+            shutil.copy(path, to_dir)
+        written.append(dl['to'])
+
+    for cfg in manifest.get('config_files') or []:
+        src = _inside(ext_dir, cfg['from'])
+        dest = _inside(build_dir, cfg['to'])
+        if not os.path.exists(os.path.dirname(dest)):
+            os.makedirs(os.path.dirname(dest))
+        shutil.copy(src, dest)
+        if cfg.get('rewrite', False):
+            utils.rewrite_cfgs(dest, ctx, delim='#')
+        written.append(cfg['to'])
+
+    # sourced in name order, so the variables are set for the scripts
+    profile_d = os.path.join(build_dir, '.profile.d')
+    env = manifest.get('env') or {}
+    if env:
+        lines = ['# written during staging from .extensions/%s/%s' % (
+            os.path.basename(ext_dir),
+            os.path.basename(manifest_path(ext_dir)))]
+        for key in sorted(env):
+            lines.append('export %s=%s' % (key, _shell_quote(_scalar(env[key]))))
+        _write(os.path.join(profile_d, 'ext_%s.sh' % name),
+               '\n'.join(lines) + '\n')
+        written.append('.profile.d/ext_%s.sh' % name)
+
+    for script in manifest.get('profile_d') or []:
+        if script.get('from'):
+            with open(_inside(ext_dir, script['from'])) as f:
+                content = f.read()
+        else:
+            content = script['script']
+        file_name = 'ext_%s_%s' % (name, script['name'])
+        _write(os.path.join(profile_d, file_name), content)
+        written.append('.profile.d/%s' % file_name)
+    return written
+
+
+def processes(manifest):
+    """The processes of the manifest, as service_commands returns them"""
+    return dict((name, (cmd,)) for name, cmd in
+                (manifest.get('processes') or {}).iteritems())
+
+
+# Extension Methods
+def configure(ctx):
+    ext_dirs = find_extensions(ctx['BUILD_DIR'], warn=True)
+    if ext_dirs:
+        validate(ctx, ext_dirs)
+
+
+def preprocess_commands(ctx):
+    return ()
+
+
+def service_commands(ctx):
+    cmds = {}
+    for ext_dir in find_extensions(ctx['BUILD_DIR']):
+        cmds.update(processes(load_manifest(ext_dir)))
+    return cmds
+
+
+def service_environment(ctx):
+    return {}
+
+
+def compile(install_):
+    ctx = install_.builder._ctx
+    for ext_dir in find_extensions(ctx['BUILD_DIR']):
+        install(ctx, ext_dir, load_manifest(ext_dir))
+    return 0
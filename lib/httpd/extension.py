@@ -12,6 +12,8 @@
 # WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
 # See the License for the specific language governing permissions and
 # limitations under the License.
+import os
+from compile_helpers import render_server_conf
 
 
 def preprocess_commands(ctx):
@@ -41,6 +43,11 @@ def compile(install):
     print 'HTTPD %s' % (install.builder._ctx['HTTPD_VERSION'])
 
     install.builder._ctx['PHP_FPM_LISTEN'] = '127.0.0.1:9000'
+    install.builder._ctx['HTTPD_FRONT_CONTROLLER'] = ''
+    front_controller = install.builder._ctx.get('FRAMEWORK_FRONT_CONTROLLER')
+    if front_controller:
+        install.builder._ctx['HTTPD_FRONT_CONTROLLER'] = \
+            'FallbackResource /%s' % front_controller
     (install
         .package('HTTPD')
         .config()
@@ -49,4 +56,6 @@ def compile(install):
             .to('httpd/conf')
             .rewrite()
             .done())
+    render_server_conf(install.builder._ctx, 'httpd', os.path.join(
+        install.builder._ctx['BUILD_DIR'], 'httpd', 'conf'))
     return 0
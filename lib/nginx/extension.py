@@ -12,6 +12,8 @@
 # WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
 # See the License for the specific language governing permissions and
 # limitations under the License.
+import os
+from compile_helpers import render_server_conf
 
 
 def preprocess_commands(ctx):
@@ -35,6 +37,11 @@ def service_environment(ctx):
 def compile(install):
     print 'Installing Nginx'
     install.builder._ctx['PHP_FPM_LISTEN'] = '{TMPDIR}/php-fpm.socket'
+    install.builder._ctx['NGINX_FRONT_CONTROLLER'] = ''
+    front_controller = install.builder._ctx.get('FRAMEWORK_FRONT_CONTROLLER')
+    if front_controller:
+        install.builder._ctx['NGINX_FRONT_CONTROLLER'] = \
+            'try_files $uri $uri/ /%s$is_args$args;' % front_controller
     (install
         .package('NGINX')
         .config()
@@ -43,6 +50,8 @@ def compile(install):
             .to('nginx/conf')
             .rewrite()
             .done())
+    render_server_conf(install.builder._ctx, 'nginx', os.path.join(
+        install.builder._ctx['BUILD_DIR'], 'nginx', 'conf'))
 
     print 'NGINX %s' % (install.builder._ctx['NGINX_VERSION'])
     return 0
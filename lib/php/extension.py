@@ -26,6 +26,18 @@ from compile_helpers import validate_php_version
 from compile_helpers import validate_php_extensions
 from compile_helpers import validate_php_ini_extensions
 from compile_helpers import include_fpm_d_confs
+from compile_helpers import setup_fpm_status
+from compile_helpers import setup_fpm_request_limits
+from compile_helpers import setup_fpm_log_format
+from compile_helpers import shutdown_grace_seconds
+from compile_helpers import fpm_slowlog_enabled
+from compile_helpers import fpm_slowlog_fifo_command
+from compile_helpers import fpm_slowlog_command
+from compile_helpers import fpm_pool_command
+from compile_helpers import additional_processes
+from compile_helpers import setup_opcache_warmup
+from compile_helpers import write_opcache_ini
+from compile_helpers import write_log_format_ini
 from extension_helpers import ExtensionHelper
 
 def find_composer_paths(ctx):
@@ -74,33 +86,51 @@ class PHPExtension(ExtensionHelper):
         manifest = load_manifest(self._ctx)
         dependencies = manifest['dependencies']
         self._ctx['ALL_PHP_VERSIONS'] = find_all_php_versions(dependencies)
+        # fails staging before anything is installed
+        additional_processes(self._ctx)
+        self._ctx['SHUTDOWN_GRACE_SECONDS'] = shutdown_grace_seconds(self._ctx)
 
     def _preprocess_commands(self):
-        return (('$HOME/.bp/bin/rewrite', '"$HOME/php/etc"'),)
+        if is_web_app(self._ctx):
+            commands = (fpm_pool_command(self._ctx),
+                        ('$HOME/.bp/bin/rewrite', '"$HOME/php/etc"'))
+        else:
+            # a stand-alone app is a single PHP process
+            commands = (fpm_pool_command(dict(self._ctx, PHP_FPM_PM='static',
+                                              PHP_FPM_MAX_CHILDREN=1)),
+                        ('$HOME/.bp/bin/rewrite', '"$HOME/php/etc"'))
+        if is_web_app(self._ctx) and fpm_slowlog_enabled(self._ctx):
+            commands += (fpm_slowlog_fifo_command(self._ctx),)
+        return commands
 
     def _service_commands(self):
         if is_web_app(self._ctx):
-            return {
+            commands = {
                 'php-fpm': (
                     '$HOME/php/sbin/php-fpm',
                     '-p "$HOME/php/etc"',
                     '-y "$HOME/php/etc/php-fpm.conf"',
                     '-c "$HOME/php/etc"')
             }
+            if fpm_slowlog_enabled(self._ctx):
+                commands['php-fpm-slowlog'] = fpm_slowlog_command(self._ctx)
         else:
             app = find_stand_alone_app_to_run(self._ctx)
-            return {
+            commands = {
                 'php-app': (
                     '$HOME/php/bin/php',
                     '-c "$HOME/php/etc"',
                     app)
             }
+        commands.update(additional_processes(self._ctx))
+        return commands
 
     def _service_environment(self):
         env = {
             'LD_LIBRARY_PATH': '$LD_LIBRARY_PATH:$HOME/php/lib',
             'PATH': '$PATH:$HOME/php/bin:$HOME/php/sbin',
-            'PHPRC': '$HOME/php/etc'
+            'PHPRC': '$HOME/php/etc',
+            'SHUTDOWN_GRACE_SECONDS': shutdown_grace_seconds(self._ctx)
         }
         if 'snmp' in self._ctx['PHP_EXTENSIONS']:
             env['MIBDIRS'] = '$HOME/php/mibs'
@@ -141,8 +171,12 @@ class PHPExtension(ExtensionHelper):
 
         validate_php_ini_extensions(ctx)
         validate_php_extensions(ctx)
+        setup_opcache_warmup(ctx)
         convert_php_extensions(ctx)
         include_fpm_d_confs(ctx)
+        setup_fpm_status(ctx)
+        setup_fpm_request_limits(ctx)
+        setup_fpm_log_format(ctx)
 
         (install
             .config()
@@ -151,6 +185,8 @@ class PHPExtension(ExtensionHelper):
                 .to('php/etc')
                 .rewrite()
                 .done())
+        write_opcache_ini(ctx)
+        write_log_format_ini(ctx)
 
         return 0
 
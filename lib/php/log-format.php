@@ -0,0 +1,95 @@
+<?php
+// Prepended to every script when LOG_FORMAT is json. Writes PHP errors as
+// JSON lines with the keys of the web server access logs, see LogFields in
+// src/php/serverconf/logformat.go. Runs on PHP 5.6 and later.
+
+function _bp_log_json_output()
+{
+    // php-fpm writes the stderr of its workers to its error_log, which is
+    // the output of the app, staging turns on catch_workers_output for it
+    static $output = null;
+    if ($output === null) {
+        $output = fopen('php://stderr', 'a');
+    }
+    return $output;
+}
+
+function _bp_log_json_level($type)
+{
+    switch ($type) {
+        case E_ERROR:
+        case E_PARSE:
+        case E_CORE_ERROR:
+        case E_COMPILE_ERROR:
+        case E_USER_ERROR:
+        case E_RECOVERABLE_ERROR:
+            return 'error';
+        case E_WARNING:
+        case E_CORE_WARNING:
+        case E_COMPILE_WARNING:
+        case E_USER_WARNING:
+            return 'warning';
+        case E_DEPRECATED:
+        case E_USER_DEPRECATED:
+            return 'deprecated';
+    }
+    return 'notice';
+}
+
+function _bp_log_json_server($name)
+{
+    return isset($_SERVER[$name]) && $_SERVER[$name] !== '' ? (string) $_SERVER[$name] : null;
+}
+
+function _bp_log_json($type, $message, $file, $line)
+{
+    $requestId = _bp_log_json_server('REQUEST_ID');
+    if ($requestId === null) {
+        $requestId = _bp_log_json_server('UNIQUE_ID');
+    }
+    $duration = null;
+    if (isset($_SERVER['REQUEST_TIME_FLOAT']) && PHP_SAPI !== 'cli') {
+        $duration = (int) round((microtime(true) - $_SERVER['REQUEST_TIME_FLOAT']) * 1000);
+    }
+    $entry = array(
+        'time' => date('c'),
+        'source' => 'php',
+        'type' => 'error',
+        'level' => _bp_log_json_level($type),
+        'request_id' => $requestId,
+        'vcap_request_id' => _bp_log_json_server('HTTP_X_VCAP_REQUEST_ID'),
+        'remote_addr' => _bp_log_json_server('REMOTE_ADDR'),
+        'method' => _bp_log_json_server('REQUEST_METHOD'),
+        'uri' => _bp_log_json_server('REQUEST_URI'),
+        'protocol' => _bp_log_json_server('SERVER_PROTOCOL'),
+        'status' => null,
+        'bytes' => null,
+        'duration_ms' => $duration,
+        'referer' => _bp_log_json_server('HTTP_REFERER'),
+        'user_agent' => _bp_log_json_server('HTTP_USER_AGENT'),
+        'message' => (string) $message,
+        'file' => $file === null ? null : (string) $file,
+        'line' => $line === null ? null : (int) $line,
+    );
+    $json = json_encode($entry, JSON_UNESCAPED_SLASHES | JSON_PARTIAL_OUTPUT_ON_ERROR);
+    fwrite(_bp_log_json_output(), $json . "\n");
+}
+
+// Errors the handler does not see, which stop the script, are logged when
+// it shuts down, after PHP logged them as text. Returning true keeps PHP
+// from logging the others a second time, unless display_errors needs them.
+set_error_handler(function ($type, $message, $file = null, $line = null) {
+    if (!(error_reporting() & $type)) {
+        return false;
+    }
+    _bp_log_json($type, $message, $file, $line);
+    return !ini_get('display_errors');
+});
+
+register_shutdown_function(function () {
+    $error = error_get_last();
+    $fatal = E_ERROR | E_PARSE | E_CORE_ERROR | E_COMPILE_ERROR;
+    if ($error !== null && ($error['type'] & $fatal)) {
+        _bp_log_json($error['type'], $error['message'], $error['file'], $error['line']);
+    }
+});
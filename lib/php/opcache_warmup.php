@@ -0,0 +1,20 @@
+<?php
+// Compiles the files listed in $argv[1] into the OPcache file cache. Used
+// during staging when OPCACHE_WARMUP is set.
+$compiled = 0;
+$skipped = array();
+foreach (file($argv[1], FILE_IGNORE_NEW_LINES | FILE_SKIP_EMPTY_LINES) as $file) {
+    try {
+        if (opcache_compile_file($file)) {
+            $compiled++;
+            continue;
+        }
+    } catch (Throwable $e) {
+        // syntax errors are reported at runtime, as without the warmup
+    }
+    $skipped[] = $file;
+}
+foreach ($skipped as $file) {
+    fwrite(STDERR, "skipped $file\n");
+}
+printf("%d files compiled, %d skipped\n", $compiled, count($skipped));
@@ -0,0 +1,161 @@
+# Licensed to the Apache Software Foundation (ASF) under one or more
+# contributor license agreements.  See the NOTICE file distributed with
+# this work for additional information regarding copyright ownership.
+# The ASF licenses this file to You under the Apache License, Version 2.0
+# (the "License"); you may not use this file except in compliance with
+# the License.  You may obtain a copy of the License at
+#
+#     http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+"""Finds the service an agent extension is bound to
+
+Every agent extension describes its service with a `ServiceRule`, and
+`find_service` applies the same rules to all of them, in this order:
+
+1. `<AGENT>_SERVICE_NAME`, from the environment or options.json, names the
+   service, whatever its label.
+2. The label of the service, which is its key in VCAP_SERVICES.
+3. A tag of the service.
+4. The name of the service matches a pattern, which finds user-provided
+   services.
+
+The first rule which matches a service decides, later rules are not tried.
+Services without the credentials the agent needs are skipped, and when a
+rule matches only such services the next rule is tried.  When more than one
+service is left, the duplicate policy of the agent either takes the first
+one, in the order of VCAP_SERVICES with the labels sorted, or binds none.
+
+A lookup which finds a service, skips one or misses the service named by
+the override prints one line for the staging log, such as
+
+    service-binding agent=dynatrace result=duplicate match=label
+    candidates=dt-a,dt-b
+
+on one line, with the keys agent, result (found, none or duplicate),
+service, match (override, label, tag or name), candidates and skipped.  Keys
+without a value are left out, values with spaces are quoted.
+"""
+from __future__ import print_function
+import json
+import re
+
+
+FOUND = 'found'
+NONE = 'none'
+DUPLICATE = 'duplicate'
+
+# duplicate policies
+FIRST = 'first'
+FAIL = 'fail'
+
+
+class ServiceRule(object):
+    def __init__(self, agent, labels=(), tags=(), name_pattern=None,
+                 credentials=(), duplicates=FIRST):
+        self.agent = agent
+        self.labels = tuple(labels)
+        self.tags = tuple(t.lower() for t in tags)
+        self.name_pattern = name_pattern and re.compile(name_pattern, re.I)
+        self.credentials = tuple(credentials)
+        self.duplicates = duplicates
+
+    @property
+    def override_key(self):
+        return '%s_SERVICE_NAME' % self.agent.upper().replace('-', '_')
+
+
+class Binding(object):
+    def __init__(self, agent, result, service=None, match=None,
+                 candidates=(), skipped=()):
+        self.agent = agent
+        self.result = result
+        self.service = service
+        self.match = match
+        self.candidates = list(candidates)
+        self.skipped = list(skipped)
+
+    @property
+    def credentials(self):
+        return (self.service or {}).get('credentials', {})
+
+    def diagnostic(self):
+        fields = [('agent', self.agent), ('result', self.result)]
+        if self.service is not None:
+            fields.append(('service', self.service.get('name', '')))
+        fields.extend([('match', self.match),
+                       ('candidates', ','.join(self.candidates)),
+                       ('skipped', ','.join(self.skipped))])
+        return 'service-binding ' + ' '.join(
+            '%s=%s' % (key, _quote(value)) for (key, value) in fields
+            if value)
+
+
+def _quote(value):
+    if re.search(r'[\s"]', value):
+        return json.dumps(value)
+    return value
+
+
+def _services(ctx):
+    """All bound services, the labels sorted and each label in order"""
+    services = []
+    for (label, bound) in sorted(ctx.get('VCAP_SERVICES', {}).items()):
+        for service in bound:
+            service = dict(service)
+            service.setdefault('label', label)
+            services.append(service)
+    return services
+
+
+def _matchers(ctx, rule):
+    name = ctx.get(rule.override_key)
+    if name:
+        yield ('override', lambda s: s.get('name') == name)
+        return
+    yield ('label', lambda s: s['label'] in rule.labels)
+    yield ('tag', lambda s: any(str(t).lower() in rule.tags
+                                for t in s.get('tags') or []))
+    if rule.name_pattern:
+        yield ('name', lambda s: rule.name_pattern.search(s.get('name', ''))
+               is not None)
+
+
+def find_service(ctx, rule):
+    """Returns the `Binding` of the agent, after printing its diagnostic
+    unless no service came close, so apps without services stage quietly"""
+    binding = _find_service(ctx, rule)
+    if binding.result != NONE or binding.skipped or \
+            ctx.get(rule.override_key):
+        print(binding.diagnostic())
+    return binding
+
+
+def _find_service(ctx, rule):
+    services = _services(ctx)
+    unusable = []
+    for (match, matches) in _matchers(ctx, rule):
+        found = [s for s in services if matches(s)]
+        usable = [s for s in found
+                  if all(s.get('credentials', {}).get(c)
+                         for c in rule.credentials)]
+        unusable.extend(s for s in found
+                        if s not in usable and s not in unusable)
+        skipped = [s.get('name', '') for s in unusable]
+        if not usable:
+            continue
+        candidates = [s.get('name', '') for s in usable]
+        if len(usable) == 1:
+            return Binding(rule.agent, FOUND, usable[0], match,
+                           skipped=skipped)
+        if rule.duplicates == FAIL:
+            return Binding(rule.agent, DUPLICATE, match=match,
+                           candidates=candidates, skipped=skipped)
+        return Binding(rule.agent, FOUND, usable[0], match, candidates,
+                       skipped)
+    return Binding(rule.agent, NONE,
+                   skipped=[s.get('name', '') for s in unusable])
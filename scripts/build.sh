@@ -0,0 +1,17 @@
+#!/usr/bin/env bash
+set -exuo pipefail
+
+cd "$( dirname "${BASH_SOURCE[0]}" )/.."
+source .envrc
+
+GOOS=linux go build -ldflags="-s -w" -o bin/check-platform php/platform/cli
+GOOS=linux go build -ldflags="-s -w" -o bin/detect-framework php/frameworks/cli
+GOOS=linux go build -ldflags="-s -w" -o bin/php-detect php/detect/cli
+GOOS=linux go build -ldflags="-s -w" -o bin/fpm-tune php/fpmtune/cli
+GOOS=linux go build -ldflags="-s -w" -o bin/server-conf php/serverconf/cli
+GOOS=linux go build -ldflags="-s -w" -o bin/config-drift php/configdrift/cli
+GOOS=linux go build -ldflags="-s -w" -o bin/php-metrics php/metrics/cli
+GOOS=linux go build -ldflags="-s -w" -o bin/extension-manifest php/extmanifest/cli
+GOOS=linux go build -ldflags="-s -w" -o bin/extension-kit php/extkit/cli
+GOOS=linux go build -ldflags="-s -w" -o bin/php-cron php/cron/cli
+GOOS=linux go build -ldflags="-s -w" -o bin/php-release php/release/cli
@@ -16,8 +16,12 @@
 # limitations under the License.
 from datetime import datetime
 from build_pack_utils import Builder
+from compile_helpers import detect_framework
 from compile_helpers import setup_webdir_if_it_doesnt_exist
+from compile_helpers import setup_framework_dirs
 from compile_helpers import setup_log_dir
+from compile_helpers import warm_opcache
+from compile_helpers import report_config_drift
 
 
 if __name__ == '__main__':
@@ -28,8 +32,12 @@ if __name__ == '__main__':
             .user_config()
             .validate()
             .done()
+        .execute()
+            .method(detect_framework)
         .execute()
             .method(setup_webdir_if_it_doesnt_exist)
+        .execute()
+            .method(setup_framework_dirs)
         .execute()
             .method(setup_log_dir)
         .register()
@@ -49,12 +57,24 @@ if __name__ == '__main__':
                 .from_build_pack('extensions/newrelic')
             .extension()
                 .from_build_pack('extensions/caapm')
+            .extension()
+                .from_build_pack('extensions/opentelemetry')
+            .extension()
+                .from_build_pack('extensions/sentry')
             .extension()
                 .from_build_pack('extensions/sessions')
+            .extension()
+                .from_build_pack('extensions/metrics')
+            .extension()
+                .from_build_pack('extensions/cron')
+            .extension()
+                .from_build_pack('extensions/release')
             .extension()
                 .from_build_pack('extensions/composer')
             .extensions()
                 .from_application('.extensions')
+            .extension()
+                .from_build_pack('lib/declarative_extensions')
             .extension()
                 .from_build_pack('lib/additional_commands')
             .done()
@@ -62,11 +82,17 @@ if __name__ == '__main__':
             .build_pack_utils()
             .extensions()
             .done()
+        .execute()
+            .method(report_config_drift)
+        .execute()
+            .method(warm_opcache)
         .copy()
             .under('{BP_DIR}/bin')
             .into('{BUILD_DIR}/.bp/bin')
             .where_name_is('rewrite')
             .where_name_is('start')
+            .where_name_is('fpm-tune')
+            .where_name_is('php-task')
             .any_true()
             .done()
         .save()
@@ -0,0 +1,86 @@
+#!/usr/bin/env python
+
+# Licensed to the Apache Software Foundation (ASF) under one or more
+# contributor license agreements.  See the NOTICE file distributed with
+# this work for additional information regarding copyright ownership.
+# The ASF licenses this file to You under the Apache License, Version 2.0
+# (the "License"); you may not use this file except in compliance with
+# the License.  You may obtain a copy of the License at
+#
+#     http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+"""Executes the manifest of an app extension offline, for bin/extension-kit
+
+usage: extension_kit.py <app dir> <extension name> <downloads dir>
+
+The extension is .extensions/<extension name> of the app.  Downloads are
+read from the downloads dir by the file name of their URL, and checked
+against their SHA-256 as during staging.  Prints the processes and the
+paths the extension added as JSON.
+"""
+from __future__ import print_function
+import hashlib
+import json
+import os
+import shutil
+import sys
+import tempfile
+from urlparse import urlparse
+from build_pack_utils import utils
+from build_pack_utils.cloudfoundry import CloudFoundryUtil
+
+
+def offline_fetch(downloads_dir):
+    def fetch(ctx, url, sha256):
+        name = os.path.basename(urlparse(url).path)
+        path = os.path.join(downloads_dir, name)
+        if not os.path.exists(path):
+            raise RuntimeError('%s is not in %s, the kit does not download'
+                               % (name, downloads_dir))
+        with open(path, 'rb') as f:
+            digest = hashlib.sha256(f.read()).hexdigest()
+        if digest != sha256:
+            raise RuntimeError('SHA-256 of %s is %s, the manifest expects %s'
+                               % (path, digest, sha256))
+        return path
+    return fetch
+
+
+if __name__ == '__main__':
+    if len(sys.argv) != 4:
+        print(__doc__.split('\n\n')[1], file=sys.stderr)
+        sys.exit(2)
+    (app_dir, name, downloads_dir) = sys.argv[1:]
+    bp_dir = os.path.dirname(os.path.dirname(os.path.abspath(__file__)))
+    tmp_dir = tempfile.mkdtemp(prefix='extension-kit-')
+    try:
+        ctx = utils.FormattedDict(CloudFoundryUtil.load_json_config_file_from(
+            bp_dir, 'defaults/options.json'))
+        ctx.update(CloudFoundryUtil.load_json_config_file_from(
+            app_dir, os.path.join('.bp-config', 'options.json')))
+        ctx.update({
+            'BP_DIR': bp_dir,
+            'BUILD_DIR': os.path.abspath(app_dir),
+            'TMPDIR': tmp_dir,
+        })
+        executor = utils.load_extension(
+            os.path.join(bp_dir, 'lib', 'declarative_extensions'))
+        ext_dir = os.path.join(ctx['BUILD_DIR'], '.extensions', name)
+        manifest = executor.load_manifest(ext_dir)
+        # progress goes to stderr, stdout is the result
+        stdout, sys.stdout = sys.stdout, sys.stderr
+        written = executor.install(ctx, ext_dir, manifest,
+                                   fetch=offline_fetch(downloads_dir))
+        sys.stdout = stdout
+        print(json.dumps({
+            'processes': dict((k, ' '.join(v)) for k, v in
+                              executor.processes(manifest).iteritems()),
+            'paths': written,
+        }))
+    finally:
+        shutil.rmtree(tmp_dir)
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+
+	"php/configdrift"
+)
+
+var (
+	latestPattern  = regexp.MustCompile(`^\{PHP_([0-9])([0-9]+)_LATEST\}$`)
+	versionPattern = regexp.MustCompile(`^[0-9]+\.[0-9]+`)
+)
+
+func main() {
+	bpDir := buildpackDir()
+	defaultsDir := flag.String("defaults", filepath.Join(bpDir, "defaults", "config"), "directory of the buildpack defaults")
+	historyPath := flag.String("history", filepath.Join(bpDir, "defaults", "config-history.json"), "directives of the defaults of past buildpack versions")
+	webServer := flag.String("web-server", "", "httpd, nginx or none, read from .bp-config/options.json when empty")
+	phpVersion := flag.String("php-version", "", "PHP version of the app, read from .bp-config/options.json when empty")
+	summary := flag.Bool("summary", false, "only warn about files copied from an outdated default, as staging does")
+	record := flag.String("record", "", "add the current defaults to the history under this buildpack version")
+	flag.Parse()
+
+	history, err := configdrift.LoadHistory(*historyPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	if *record != "" {
+		paths, err := history.Record(*defaultsDir, *record)
+		if err == nil {
+			err = history.Save(*historyPath)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		for _, path := range paths {
+			fmt.Printf("recorded %s for %s\n", path, *record)
+		}
+		return
+	}
+
+	if flag.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "usage: config-drift [-summary] [-web-server SERVER] [-php-version VERSION] <app dir>")
+		fmt.Fprintln(os.Stderr, "       config-drift -record VERSION")
+		os.Exit(2)
+	}
+	appDir := flag.Arg(0)
+
+	options, err := appOptions(appDir)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if *webServer == "" {
+		*webServer = options.WebServer
+	}
+	if *phpVersion == "" {
+		*phpVersion = options.PHPVersion
+		if m := latestPattern.FindStringSubmatch(*phpVersion); m != nil {
+			*phpVersion = m[1] + "." + m[2]
+		}
+		if _, err := os.Stat(filepath.Join(appDir, ".bp-config", "php")); err == nil && !versionPattern.MatchString(*phpVersion) {
+			fmt.Fprintln(os.Stderr, "skipping .bp-config/php, pass the PHP version of the app with -php-version")
+		}
+	}
+
+	overrides, err := configdrift.Find(appDir, *defaultsDir, configdrift.Mappings(*webServer, *phpVersion))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	if *summary {
+		for _, o := range overrides {
+			fmt.Print(configdrift.Check(o, history).Summary())
+		}
+		return
+	}
+
+	if len(overrides) == 0 {
+		fmt.Println("no file in .bp-config replaces a buildpack default")
+	}
+	for _, o := range overrides {
+		report := configdrift.Check(o, history)
+		switch report.Status {
+		case configdrift.Drifted:
+			fmt.Print(report.Summary())
+		case configdrift.Unknown:
+			fmt.Printf("%s differs too much from every recorded version of %s to tell which one it was copied from\n", o.App, o.Default)
+		default:
+			fmt.Printf("%s is %s from the current %s\n", o.App, report.Status, o.Default)
+		}
+		fmt.Print(configdrift.Unified(filepath.Join("defaults", "config", o.Default), o.App, o.DefaultContent, o.AppContent))
+		fmt.Println()
+	}
+}
+
+type options struct {
+	WebServer  string `json:"WEB_SERVER"`
+	PHPVersion string `json:"PHP_VERSION"`
+}
+
+// appOptions reads the settings of .bp-config/options.json which choose the
+// defaults, with the web server defaulting like defaults/options.json.
+func appOptions(appDir string) (options, error) {
+	opts := options{WebServer: "httpd"}
+	data, err := ioutil.ReadFile(filepath.Join(appDir, ".bp-config", "options.json"))
+	if os.IsNotExist(err) {
+		return opts, nil
+	} else if err != nil {
+		return opts, err
+	}
+	if err := json.Unmarshal(data, &opts); err != nil {
+		return opts, fmt.Errorf(".bp-config/options.json: %s", err)
+	}
+	return opts, nil
+}
+
+// buildpackDir is the root of the buildpack when running from its bin
+// directory.
+func buildpackDir() string {
+	exe, err := os.Executable()
+	if err != nil {
+		return "."
+	}
+	return filepath.Dir(filepath.Dir(exe))
+}
@@ -0,0 +1,282 @@
+// Package configdrift compares the configuration files an application ships
+// in .bp-config with the buildpack defaults they replace, and tells when a
+// default changed after the application copied it.
+package configdrift
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+type Status string
+
+const (
+	// Identical files have the same directives as the current default.
+	Identical Status = "identical"
+	// Customized files are based on the current default.
+	Customized Status = "customized"
+	// Drifted files are based on an older default which changed since.
+	Drifted Status = "drifted"
+	// Unknown files share too little with every default to tell.
+	Unknown Status = "unknown"
+)
+
+// MinSimilarity is the share of directives a file must have in common with a
+// default to count as a copy of it.
+const MinSimilarity = 0.5
+
+// Mapping pairs a directory of the application with the directory of
+// defaults/config it replaces files of.
+type Mapping struct {
+	App      string
+	Defaults string
+}
+
+// Mappings returns the directories staging installs for the web server and
+// PHP version. An empty webServer covers both httpd and nginx.
+func Mappings(webServer, phpVersion string) []Mapping {
+	var mappings []Mapping
+	for _, server := range []string{"httpd", "nginx"} {
+		if webServer == "" || webServer == server {
+			mappings = append(mappings, Mapping{filepath.Join(".bp-config", server), server})
+		}
+	}
+	if parts := strings.SplitN(phpVersion, ".", 3); len(parts) >= 2 {
+		mappings = append(mappings, Mapping{filepath.Join(".bp-config", "php"), filepath.Join("php", parts[0]+"."+parts[1]+".x")})
+	}
+	return mappings
+}
+
+// Override is a file of the application which replaces a buildpack default.
+// App is relative to the application, Default to the defaults directory.
+type Override struct {
+	App            string
+	Default        string
+	AppContent     []byte
+	DefaultContent []byte
+}
+
+// Find lists the files of appDir which replace a file of defaultsDir. Files
+// without a default, such as those in php.ini.d, are extra configuration and
+// are left out.
+func Find(appDir, defaultsDir string, mappings []Mapping) ([]Override, error) {
+	var overrides []Override
+	for _, m := range mappings {
+		root := filepath.Join(appDir, m.App)
+		if _, err := os.Stat(root); os.IsNotExist(err) {
+			continue
+		}
+		err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+			if err != nil || info.IsDir() {
+				return err
+			}
+			rel, err := filepath.Rel(root, path)
+			if err != nil {
+				return err
+			}
+			def := filepath.Join(m.Defaults, rel)
+			defaultContent, err := ioutil.ReadFile(filepath.Join(defaultsDir, def))
+			if os.IsNotExist(err) {
+				return nil
+			} else if err != nil {
+				return err
+			}
+			appContent, err := ioutil.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			overrides = append(overrides, Override{
+				App:            filepath.Join(m.App, rel),
+				Default:        def,
+				AppContent:     appContent,
+				DefaultContent: defaultContent,
+			})
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return overrides, nil
+}
+
+type Report struct {
+	Override
+	Status Status
+	// Base is the buildpack version whose default a drifted file was copied
+	// from.
+	Base string
+	// Missing lists directives the default gained since Base which the file
+	// lacks, Stale those the default dropped which the file still has.
+	Missing []string
+	Stale   []string
+}
+
+// Check works out which recorded default the file was copied from, by the
+// share of directives they have in common, and what changed in the default
+// since.
+func Check(o Override, history History) Report {
+	report := Report{Override: o}
+	app := Directives(o.AppContent)
+	appSet := hashSet(app)
+	current := Directives(o.DefaultContent)
+	currentSet := hashSet(current)
+	if sameSet(appSet, currentSet) {
+		report.Status = Identical
+		return report
+	}
+
+	// later versions win ties, the current default comes last
+	candidates := append(append([]Version{}, history[o.Default]...), Version{Lines: hashList(current)})
+	var base Version
+	best := -1.0
+	for _, v := range candidates {
+		if s := similarity(appSet, stringSet(v.Lines)); s >= best {
+			base, best = v, s
+		}
+	}
+	baseSet := stringSet(base.Lines)
+	if best < MinSimilarity {
+		report.Status = Unknown
+		return report
+	}
+
+	listed := map[string]bool{}
+	for _, line := range current {
+		h := Hash(line)
+		if !baseSet[h] && !appSet[h] && !listed[h] {
+			report.Missing = append(report.Missing, line)
+			listed[h] = true
+		}
+	}
+	for _, line := range app {
+		h := Hash(line)
+		if baseSet[h] && !currentSet[h] && !listed[h] {
+			report.Stale = append(report.Stale, line)
+			listed[h] = true
+		}
+	}
+	report.Status = Customized
+	if len(report.Missing) > 0 || len(report.Stale) > 0 {
+		report.Status = Drifted
+		report.Base = base.Version
+	}
+	return report
+}
+
+// Summary explains a drifted file in a few lines, for the staging log.
+func (r Report) Summary() string {
+	if r.Status != Drifted {
+		return ""
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "WARNING: %s replaces the buildpack default %s, which changed since buildpack %s\n", r.App, r.Default, r.Base)
+	writeLines(&b, fmt.Sprintf("your copy lacks %s the default added:", plural(len(r.Missing), "line")), "+", r.Missing)
+	writeLines(&b, fmt.Sprintf("your copy keeps %s the default removed:", plural(len(r.Stale), "line")), "-", r.Stale)
+	return b.String()
+}
+
+// summaryLines caps the directives listed by Summary.
+const summaryLines = 5
+
+func writeLines(b *strings.Builder, title, prefix string, lines []string) {
+	if len(lines) == 0 {
+		return
+	}
+	fmt.Fprintf(b, "         %s\n", title)
+	for i, line := range lines {
+		if i == summaryLines {
+			fmt.Fprintf(b, "           ... and %d more\n", len(lines)-summaryLines)
+			break
+		}
+		fmt.Fprintf(b, "           %s %s\n", prefix, line)
+	}
+}
+
+func plural(n int, noun string) string {
+	if n == 1 {
+		return fmt.Sprintf("1 %s", noun)
+	}
+	return fmt.Sprintf("%d %ss", n, noun)
+}
+
+// Directives returns the lines which configure something, with comments,
+// blank lines and differences in spacing left out. Placeholders such as
+// #{WEBDIR}, which staging replaces, are kept.
+func Directives(content []byte) []string {
+	var directives []string
+	for _, line := range strings.Split(string(content), "\n") {
+		line = strings.Join(strings.Fields(line), " ")
+		if line == "" || line[0] == ';' || line[0] == '#' && !strings.HasPrefix(line, "#{") {
+			continue
+		}
+		directives = append(directives, line)
+	}
+	return directives
+}
+
+// Hash identifies a directive in the history.
+func Hash(directive string) string {
+	sum := sha1.Sum([]byte(directive))
+	return hex.EncodeToString(sum[:4])
+}
+
+// hashList returns the sorted, unique hashes of the directives.
+func hashList(directives []string) []string {
+	set := hashSet(directives)
+	list := make([]string, 0, len(set))
+	for h := range set {
+		list = append(list, h)
+	}
+	sort.Strings(list)
+	return list
+}
+
+func hashSet(directives []string) map[string]bool {
+	set := map[string]bool{}
+	for _, d := range directives {
+		set[Hash(d)] = true
+	}
+	return set
+}
+
+func stringSet(list []string) map[string]bool {
+	set := map[string]bool{}
+	for _, s := range list {
+		set[s] = true
+	}
+	return set
+}
+
+func sameSet(a, b map[string]bool) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k := range a {
+		if !b[k] {
+			return false
+		}
+	}
+	return true
+}
+
+// similarity is the Jaccard index of two sets of directives.
+func similarity(a, b map[string]bool) float64 {
+	common := 0
+	for k := range a {
+		if b[k] {
+			common++
+		}
+	}
+	union := len(a) + len(b) - common
+	if union == 0 {
+		return 1
+	}
+	return float64(common) / float64(union)
+}
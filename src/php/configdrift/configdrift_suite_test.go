@@ -0,0 +1,13 @@
+package configdrift_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestConfigdrift(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Configdrift Suite")
+}
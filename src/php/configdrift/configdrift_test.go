@@ -0,0 +1,139 @@
+package configdrift_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"php/configdrift"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Configdrift", func() {
+	var history configdrift.History
+
+	BeforeEach(func() {
+		history = configdrift.History{}
+		_, err := history.Record(filepath.Join("testdata", "defaults-1.0"), "1.0")
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	Describe("Directives", func() {
+		It("leaves out comments, blank lines and spacing but keeps placeholders", func() {
+			Expect(configdrift.Directives([]byte("# comment\n; comment\n\n  Listen    ${PORT}\n#{NGINX_FRONT_CONTROLLER}\n"))).To(Equal([]string{
+				"Listen ${PORT}",
+				"#{NGINX_FRONT_CONTROLLER}",
+			}))
+		})
+	})
+
+	Describe("Find", func() {
+		find := func(app, webServer, phpVersion string) []string {
+			overrides, err := configdrift.Find(filepath.Join("testdata", "apps", app), filepath.Join("testdata", "defaults"), configdrift.Mappings(webServer, phpVersion))
+			Expect(err).NotTo(HaveOccurred())
+			var files []string
+			for _, o := range overrides {
+				files = append(files, o.App+" "+o.Default)
+			}
+			return files
+		}
+
+		It("pairs the files of .bp-config with the defaults they replace", func() {
+			Expect(find("php", "nginx", "7.2.3")).To(Equal([]string{
+				".bp-config/nginx/nginx.conf nginx/nginx.conf",
+				".bp-config/php/php.ini php/7.2.x/php.ini",
+			}))
+		})
+
+		It("only looks at the configuration of the web server and PHP version staged", func() {
+			Expect(find("php", "httpd", "7.2.3")).To(Equal([]string{".bp-config/php/php.ini php/7.2.x/php.ini"}))
+			Expect(find("php", "nginx", "")).To(Equal([]string{".bp-config/nginx/nginx.conf nginx/nginx.conf"}))
+			Expect(find("php", "nginx", "7.1.0")).To(Equal([]string{".bp-config/nginx/nginx.conf nginx/nginx.conf"}))
+		})
+
+		It("finds nothing without .bp-config", func() {
+			Expect(find("missing", "", "7.2.3")).To(BeEmpty())
+		})
+	})
+
+	DescribeTable("Check",
+		func(app string, status configdrift.Status, base string, missing, stale []string) {
+			overrides, err := configdrift.Find(filepath.Join("testdata", "apps", app), filepath.Join("testdata", "defaults"), configdrift.Mappings("httpd", ""))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(overrides).To(HaveLen(1))
+
+			report := configdrift.Check(overrides[0], history)
+			Expect(report.Status).To(Equal(status))
+			Expect(report.Base).To(Equal(base))
+			Expect(report.Missing).To(Equal(missing))
+			Expect(report.Stale).To(Equal(stale))
+		},
+		Entry("a copy of an older default", "old", configdrift.Drifted, "1.0",
+			[]string{"RequestHeader unset Proxy early", "Include conf/extra/httpd-features.conf"},
+			[]string{"TraceEnable On"}),
+		Entry("a copy of the current default", "current", configdrift.Identical, "", nil, nil),
+		Entry("a copy which picked up the changes of the default", "merged", configdrift.Customized, "", nil, nil),
+		Entry("a file written from scratch", "rewritten", configdrift.Unknown, "", nil, nil),
+	)
+
+	Describe("Summary", func() {
+		It("lists what changed in the default", func() {
+			report := configdrift.Report{
+				Override: configdrift.Override{App: ".bp-config/httpd/httpd.conf", Default: "httpd/httpd.conf"},
+				Status:   configdrift.Drifted,
+				Base:     "1.0",
+				Missing:  []string{"a", "b", "c", "d", "e", "f", "g"},
+				Stale:    []string{"TraceEnable On"},
+			}
+			Expect(report.Summary()).To(Equal(`WARNING: .bp-config/httpd/httpd.conf replaces the buildpack default httpd/httpd.conf, which changed since buildpack 1.0
+         your copy lacks 7 lines the default added:
+           + a
+           + b
+           + c
+           + d
+           + e
+           ... and 2 more
+         your copy keeps 1 line the default removed:
+           - TraceEnable On
+`))
+		})
+
+		It("is empty unless the file drifted", func() {
+			Expect(configdrift.Report{Status: configdrift.Customized}.Summary()).To(BeEmpty())
+		})
+	})
+
+	Describe("History", func() {
+		It("records only the defaults which changed", func() {
+			recorded, err := history.Record(filepath.Join("testdata", "defaults"), "2.0")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(recorded).To(ConsistOf("httpd/httpd.conf", "httpd/extra/httpd-modules.conf", "nginx/nginx.conf", "php/7.2.x/php.ini"))
+			Expect(history["httpd/httpd.conf"]).To(HaveLen(2))
+			Expect(history["httpd/httpd.conf"][1].Version).To(Equal("2.0"))
+
+			recorded, err = history.Record(filepath.Join("testdata", "defaults"), "2.1")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(recorded).To(BeEmpty())
+		})
+
+		It("is saved and loaded", func() {
+			dir, err := ioutil.TempDir("", "configdrift")
+			Expect(err).NotTo(HaveOccurred())
+			defer os.RemoveAll(dir)
+			path := filepath.Join(dir, "history.json")
+
+			Expect(configdrift.LoadHistory(path)).To(BeEmpty())
+			Expect(history.Save(path)).To(Succeed())
+			Expect(configdrift.LoadHistory(path)).To(Equal(history))
+		})
+
+		It("loads the history shipped with the buildpack", func() {
+			shipped, err := configdrift.LoadHistory(filepath.Join("..", "..", "..", "defaults", "config-history.json"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(shipped).To(HaveKey("httpd/httpd.conf"))
+		})
+	})
+})
@@ -0,0 +1,151 @@
+package configdrift
+
+import (
+	"fmt"
+	"strings"
+)
+
+// DiffContext is the number of unchanged lines shown around each change.
+const DiffContext = 3
+
+type edit struct {
+	kind byte
+	line string
+}
+
+// Unified returns the changes from a to b in the unified diff format, or an
+// empty string when they are the same.
+func Unified(fromName, toName string, a, b []byte) string {
+	edits := editScript(splitLines(a), splitLines(b))
+
+	var changes []int
+	for i, e := range edits {
+		if e.kind != ' ' {
+			changes = append(changes, i)
+		}
+	}
+	if len(changes) == 0 {
+		return ""
+	}
+
+	var out strings.Builder
+	fmt.Fprintf(&out, "--- %s\n+++ %s\n", fromName, toName)
+	for len(changes) > 0 {
+		// a hunk runs until the gap between two changes is too wide to show
+		last := 0
+		for last+1 < len(changes) && changes[last+1]-changes[last] <= 2*DiffContext {
+			last++
+		}
+		start := max(0, changes[0]-DiffContext)
+		end := min(len(edits), changes[last]+DiffContext+1)
+		changes = changes[last+1:]
+
+		aStart, bStart := lineNumbers(edits[:start])
+		aLen, bLen := lineNumbers(edits[start:end])
+		fmt.Fprintf(&out, "@@ -%s +%s @@\n", hunkRange(aStart, aLen), hunkRange(bStart, bLen))
+		for _, e := range edits[start:end] {
+			fmt.Fprintf(&out, "%c%s\n", e.kind, e.line)
+		}
+	}
+	return out.String()
+}
+
+func hunkRange(before, length int) string {
+	if length == 0 {
+		return fmt.Sprintf("%d,0", before)
+	}
+	if length == 1 {
+		return fmt.Sprintf("%d", before+1)
+	}
+	return fmt.Sprintf("%d,%d", before+1, length)
+}
+
+// lineNumbers counts the lines of a and b the edits cover.
+func lineNumbers(edits []edit) (int, int) {
+	a, b := 0, 0
+	for _, e := range edits {
+		if e.kind != '+' {
+			a++
+		}
+		if e.kind != '-' {
+			b++
+		}
+	}
+	return a, b
+}
+
+// editScript finds a shortest edit from a to b through their longest common
+// subsequence. The common head and tail are skipped first, which keeps the
+// table small for copies of a default.
+func editScript(a, b []string) []edit {
+	var head, tail []edit
+	for len(a) > 0 && len(b) > 0 && a[0] == b[0] {
+		head = append(head, edit{' ', a[0]})
+		a, b = a[1:], b[1:]
+	}
+	for len(a) > 0 && len(b) > 0 && a[len(a)-1] == b[len(b)-1] {
+		tail = append([]edit{{' ', a[len(a)-1]}}, tail...)
+		a, b = a[:len(a)-1], b[:len(b)-1]
+	}
+
+	lcs := make([][]int32, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int32, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	edits := head
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			edits = append(edits, edit{' ', a[i]})
+			i, j = i+1, j+1
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			edits = append(edits, edit{'-', a[i]})
+			i++
+		default:
+			edits = append(edits, edit{'+', b[j]})
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		edits = append(edits, edit{'-', a[i]})
+	}
+	for ; j < len(b); j++ {
+		edits = append(edits, edit{'+', b[j]})
+	}
+	return append(edits, tail...)
+}
+
+func splitLines(content []byte) []string {
+	s := strings.TrimSuffix(string(content), "\n")
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, "\n")
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func max(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
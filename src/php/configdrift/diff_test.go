@@ -0,0 +1,60 @@
+package configdrift_test
+
+import (
+	"php/configdrift"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Unified", func() {
+	It("is empty for the same content", func() {
+		Expect(configdrift.Unified("a", "b", []byte("x\ny\n"), []byte("x\ny\n"))).To(BeEmpty())
+	})
+
+	It("shows each change with three lines of context", func() {
+		a := []byte("1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\n13\n14\n15\n")
+		b := []byte("1\n2\nthree\n4\n5\n6\n7\n8\n9\n10\n11\n12\n13\n15\nsixteen\n")
+		Expect(configdrift.Unified("default", "app", a, b)).To(Equal(`--- default
++++ app
+@@ -1,6 +1,6 @@
+ 1
+ 2
+-3
++three
+ 4
+ 5
+ 6
+@@ -11,5 +11,5 @@
+ 11
+ 12
+ 13
+-14
+ 15
++sixteen
+`))
+	})
+
+	It("joins changes with little between them into one hunk", func() {
+		a := []byte("1\n2\n3\n4\n5\n6\n7\n8\n")
+		b := []byte("1\nB\n3\n4\n5\n6\nG\n8\n")
+		Expect(configdrift.Unified("default", "app", a, b)).To(Equal(`--- default
++++ app
+@@ -1,8 +1,8 @@
+ 1
+-2
++B
+ 3
+ 4
+ 5
+ 6
+-7
++G
+ 8
+`))
+	})
+
+	It("numbers insertions into an empty file", func() {
+		Expect(configdrift.Unified("default", "app", nil, []byte("x\n"))).To(Equal("--- default\n+++ app\n@@ -0,0 +1 @@\n+x\n"))
+	})
+})
@@ -0,0 +1,71 @@
+package configdrift
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// History holds the directives of every default the buildpack shipped, as
+// hashes, keyed by the path relative to defaults/config and oldest first.
+type History map[string][]Version
+
+type Version struct {
+	Version string   `json:"version"`
+	Lines   []string `json:"lines"`
+}
+
+// LoadHistory reads a history written by Save. A missing file is an empty
+// history, so files only compare with the current defaults.
+func LoadHistory(path string) (History, error) {
+	history := History{}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return history, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &history); err != nil {
+		return nil, err
+	}
+	return history, nil
+}
+
+func (h History) Save(path string) error {
+	data, err := json.MarshalIndent(h, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, append(data, '\n'), 0644)
+}
+
+// Record adds the defaults of a buildpack version to the history. Only files
+// whose directives differ from every recorded version are added, and their
+// paths are returned.
+func (h History) Record(defaultsDir, version string) ([]string, error) {
+	var recorded []string
+	err := filepath.Walk(defaultsDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(defaultsDir, path)
+		if err != nil {
+			return err
+		}
+		content, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		lines := hashSet(Directives(content))
+		for _, v := range h[rel] {
+			if sameSet(lines, stringSet(v.Lines)) {
+				return nil
+			}
+		}
+		h[rel] = append(h[rel], Version{Version: version, Lines: hashList(Directives(content))})
+		recorded = append(recorded, rel)
+		return nil
+	})
+	return recorded, err
+}
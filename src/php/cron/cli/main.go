@@ -0,0 +1,72 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"php/cron"
+)
+
+func main() {
+	check := flag.Bool("check", false, "validate the crontab and print when each job runs next, rather than running them")
+	dir := flag.String("dir", os.Getenv("HOME"), "app directory, the jobs run in it with its PHP")
+	grace := flag.Duration("grace", 10*time.Second, "how long running jobs get to exit after SIGTERM")
+	allInstances := flag.Bool("all-instances", false, "run the jobs on every instance rather than on instance 0 only")
+	flag.Parse()
+	if flag.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "usage: php-cron [-check] [-all-instances] [-dir <app dir>] <crontab>")
+		os.Exit(2)
+	}
+
+	jobs, err := cron.Load(flag.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	if *check {
+		now := time.Now()
+		for _, job := range jobs {
+			fmt.Printf("job %d (line %d) %s, next at %s: %s\n", job.ID, job.Line, job.Spec, job.Schedule.Next(now).Format(time.RFC3339), job.Command)
+		}
+		return
+	}
+
+	logger := log.New(os.Stdout, "", 0)
+	scheduler := &cron.Scheduler{
+		Jobs:  jobs,
+		Clock: cron.RealClock{},
+		Exec: cron.Shell{
+			Dir:    *dir,
+			Env:    cron.PHPEnv(*dir, os.Environ()),
+			Stdout: os.Stdout,
+			Stderr: os.Stderr,
+			Grace:  *grace,
+		}.Exec,
+		Log: logger,
+	}
+
+	stop := make(chan struct{})
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, syscall.SIGINT)
+	go func() {
+		sig := <-signals
+		logger.Printf("stopping on %s", sig)
+		close(stop)
+	}()
+
+	// an instance without jobs stays up, so the process is not restarted
+	if reason := cron.InstanceSkipped(os.Getenv("CF_INSTANCE_INDEX")); reason != "" && !*allInstances {
+		logger.Printf("not scheduling, %s", reason)
+		<-stop
+		return
+	}
+
+	logger.Printf("scheduling %d jobs from %s", len(jobs), flag.Arg(0))
+	scheduler.Run(stop)
+}
@@ -0,0 +1,129 @@
+package cron
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Job is one line of a crontab.
+type Job struct {
+	// ID numbers the jobs from 1 in the order of the crontab, for the logs.
+	ID       int
+	Line     int
+	Spec     string
+	Schedule Schedule
+	// Command is run by bash, % has no special meaning.
+	Command string
+}
+
+// LineError is a problem with one line of a crontab. The text of the line
+// is kept, staging merges crontabs so the number alone may not find it.
+type LineError struct {
+	Line    int
+	Text    string
+	Message string
+}
+
+func (e LineError) Error() string {
+	return fmt.Sprintf("line %d (%s): %s", e.Line, e.Text, e.Message)
+}
+
+// Errors are all the problems of a crontab, one per line.
+type Errors []LineError
+
+func (e Errors) Error() string {
+	lines := make([]string, len(e))
+	for i, err := range e {
+		lines[i] = err.Error()
+	}
+	return strings.Join(lines, "\n")
+}
+
+var envLinePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*\s*=`)
+
+// never is checked for schedules which don't run at all, any start works as
+// Next looks 5 years ahead.
+var never = time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// Parse reads the jobs of a crontab. Blank lines and lines starting with #
+// are skipped. Lines setting variables are rejected, the jobs run with the
+// environment of the app.
+func Parse(r io.Reader) ([]Job, error) {
+	var jobs []Job
+	var errs Errors
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if envLinePattern.MatchString(line) {
+			errs = append(errs, LineError{n, line, "setting variables is not supported, set them with cf set-env"})
+			continue
+		}
+
+		count := 5
+		if strings.HasPrefix(line, "@") {
+			count = 1
+		}
+		fields, command := splitFields(line, count)
+		spec := strings.Join(fields, " ")
+		schedule, err := ParseSchedule(spec)
+		if err != nil {
+			errs = append(errs, LineError{n, line, err.Error()})
+			continue
+		}
+		if command == "" {
+			errs = append(errs, LineError{n, line, "the command is missing"})
+			continue
+		}
+		if schedule.Next(never).IsZero() {
+			errs = append(errs, LineError{n, line, fmt.Sprintf("%s never runs", spec)})
+			continue
+		}
+		jobs = append(jobs, Job{ID: len(jobs) + 1, Line: n, Spec: spec, Schedule: schedule, Command: command})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	return jobs, nil
+}
+
+// Load reads the jobs of the crontab at path.
+func Load(path string) ([]Job, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	jobs, err := Parse(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s:\n%s", path, err)
+	}
+	return jobs, nil
+}
+
+// splitFields returns the first count fields of line and the rest of it,
+// keeping the spacing of the command.
+func splitFields(line string, count int) ([]string, string) {
+	var fields []string
+	rest := line
+	for len(fields) < count && rest != "" {
+		rest = strings.TrimLeft(rest, " \t")
+		end := strings.IndexAny(rest, " \t")
+		if end < 0 {
+			end = len(rest)
+		}
+		fields = append(fields, rest[:end])
+		rest = rest[end:]
+	}
+	return fields, strings.TrimSpace(rest)
+}
@@ -0,0 +1,109 @@
+package cron_test
+
+import (
+	"path/filepath"
+	"strings"
+	"time"
+
+	"php/cron"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+)
+
+func at(value string) time.Time {
+	t, err := time.Parse("2006-01-02 15:04", value)
+	Expect(err).NotTo(HaveOccurred())
+	return t
+}
+
+var _ = Describe("Schedule", func() {
+	DescribeTable("matching a minute",
+		func(spec, minute string, matches bool) {
+			s, err := cron.ParseSchedule(spec)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(s.Matches(at(minute))).To(Equal(matches))
+		},
+		Entry("every minute", "* * * * *", "2026-10-18 10:07", true),
+		Entry("a step", "*/15 * * * *", "2026-10-18 10:45", true),
+		Entry("off the step", "*/15 * * * *", "2026-10-18 10:46", false),
+		Entry("a step from a value", "5/20 * * * *", "2026-10-18 10:45", true),
+		Entry("a range with a step", "0 8-18/2 * * *", "2026-10-18 14:00", true),
+		Entry("off a range with a step", "0 8-18/2 * * *", "2026-10-18 15:00", false),
+		Entry("a list", "0,30 * * * *", "2026-10-18 10:30", true),
+		Entry("month names", "0 0 1 jan,JUL *", "2026-07-01 00:00", true),
+		Entry("day names", "0 9 * * mon-fri", "2026-10-19 09:00", true),
+		Entry("the weekend", "0 9 * * mon-fri", "2026-10-18 09:00", false),
+		Entry("7 is Sunday", "0 9 * * 7", "2026-10-18 09:00", true),
+		Entry("either day field when both are set", "0 0 13 * fri", "2026-10-16 00:00", true),
+		Entry("both day fields when one is *", "0 0 */2 * fri", "2026-10-16 00:00", false),
+		Entry("a macro", "@hourly", "2026-10-18 10:00", true),
+		Entry("off a macro", "@daily", "2026-10-18 10:00", false),
+	)
+
+	DescribeTable("rejecting a schedule",
+		func(spec, message string) {
+			_, err := cron.ParseSchedule(spec)
+			Expect(err).To(MatchError(ContainSubstring(message)))
+		},
+		Entry("too few fields", "* * * *", "has 5 fields"),
+		Entry("out of range", "60 * * * *", "minute: 60 is not between 0 and 59"),
+		Entry("not a number", "* noon * * *", `hour: "noon" is not a number`),
+		Entry("a backwards range", "* * * * fri-mon", `day of week: the range "fri-mon" is backwards`),
+		Entry("a zero step", "*/0 * * * *", "must be a positive number"),
+		Entry("an unknown macro", "@fortnightly", "unknown schedule @fortnightly"),
+		Entry("@reboot", "@reboot", "start the command with ADDITIONAL_PROCESSES"),
+	)
+
+	It("finds the next run", func() {
+		s, err := cron.ParseSchedule("30 2 * * sun")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(s.Next(at("2026-10-18 10:00"))).To(Equal(at("2026-10-25 02:30")))
+		Expect(s.Next(at("2026-10-18 02:29"))).To(Equal(at("2026-10-18 02:30")))
+	})
+
+	It("finds February 29th", func() {
+		s, err := cron.ParseSchedule("0 0 29 2 *")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(s.Next(at("2026-10-18 10:00"))).To(Equal(at("2028-02-29 00:00")))
+	})
+})
+
+var _ = Describe("Load", func() {
+	It("reads the jobs of a crontab", func() {
+		jobs, err := cron.Load(filepath.Join("testdata", "crontab"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(jobs).To(HaveLen(3))
+
+		Expect(jobs[0].ID).To(Equal(1))
+		Expect(jobs[0].Line).To(Equal(2))
+		Expect(jobs[0].Spec).To(Equal("* * * * *"))
+		Expect(jobs[0].Command).To(Equal("php artisan schedule:run   >> /dev/null 2>&1"))
+
+		Expect(jobs[1].Spec).To(Equal("*/15 9-17 * * mon-fri"))
+		Expect(jobs[1].Command).To(Equal("php bin/console app:sync --since='15 minutes'"))
+
+		Expect(jobs[2].ID).To(Equal(3))
+		Expect(jobs[2].Line).To(Equal(5))
+		Expect(jobs[2].Spec).To(Equal("@daily"))
+		Expect(jobs[2].Command).To(Equal("php bin/console cache:prune"))
+	})
+
+	It("reports every invalid line", func() {
+		_, err := cron.Load(filepath.Join("testdata", "invalid_crontab"))
+		Expect(err).To(HaveOccurred())
+		Expect(strings.Split(err.Error(), "\n")[1:]).To(Equal([]string{
+			"line 1 (MAILTO=ops@example.com): setting variables is not supported, set them with cf set-env",
+			"line 2 (61 * * * * php worker.php): minute: 61 is not between 0 and 59",
+			"line 3 (* * * *): a schedule has 5 fields, minute hour day-of-month month day-of-week, not 4",
+			"line 4 (@reboot php warmup.php): @reboot is not supported, start the command with ADDITIONAL_PROCESSES",
+			"line 5 (0 0 30 feb * php never.php): 0 0 30 feb * never runs",
+		}))
+	})
+
+	It("needs a command", func() {
+		_, err := cron.Parse(strings.NewReader("@hourly\n"))
+		Expect(err).To(MatchError("line 1 (@hourly): the command is missing"))
+	})
+})
@@ -0,0 +1,116 @@
+package cron
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+// Clock tells the time to the scheduler, tests replace it with a fake one.
+type Clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+}
+
+// RealClock is the clock of the system, in the zone of TZ.
+type RealClock struct{}
+
+// Now returns the current time.
+func (RealClock) Now() time.Time { return time.Now() }
+
+// After waits for d to elapse.
+func (RealClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+// Scheduler runs each job in the minutes its schedule matches. A job which
+// is still running when it is due again is skipped rather than run twice.
+type Scheduler struct {
+	Jobs  []Job
+	Clock Clock
+	// Exec runs the command of a job and returns its exit code. It stops
+	// the command when stop is closed.
+	Exec func(job Job, stop <-chan struct{}) (int, error)
+	Log  *log.Logger
+
+	mu      sync.Mutex
+	running map[int]time.Time
+	wg      sync.WaitGroup
+}
+
+// Run schedules the jobs until stop is closed, then waits for the running
+// ones to end.
+func (s *Scheduler) Run(stop <-chan struct{}) {
+	s.mu.Lock()
+	s.running = map[int]time.Time{}
+	s.mu.Unlock()
+
+	next := s.Clock.Now().Truncate(time.Minute).Add(time.Minute)
+	for {
+		select {
+		case <-stop:
+			s.wg.Wait()
+			return
+		case <-s.Clock.After(next.Sub(s.Clock.Now())):
+		}
+		s.tick(next, stop)
+
+		next = next.Add(time.Minute)
+		// after the container was frozen or the clock was set, carry on from
+		// now rather than running every minute missed
+		if now := s.Clock.Now(); now.Sub(next) >= time.Minute {
+			s.Log.Printf("skipping the runs due from %s to %s, the clock jumped", stamp(next), stamp(now))
+			next = now.Truncate(time.Minute).Add(time.Minute)
+		}
+	}
+}
+
+func (s *Scheduler) tick(due time.Time, stop <-chan struct{}) {
+	for _, job := range s.Jobs {
+		if !job.Schedule.Matches(due) {
+			continue
+		}
+		s.mu.Lock()
+		previous, busy := s.running[job.ID]
+		if !busy {
+			s.running[job.ID] = due
+		}
+		s.mu.Unlock()
+		if busy {
+			s.Log.Printf("job %d skipped, the run due %s is still running", job.ID, stamp(previous))
+			continue
+		}
+		s.wg.Add(1)
+		go s.run(job, due, stop)
+	}
+}
+
+func (s *Scheduler) run(job Job, due time.Time, stop <-chan struct{}) {
+	defer s.wg.Done()
+	defer func() {
+		s.mu.Lock()
+		delete(s.running, job.ID)
+		s.mu.Unlock()
+	}()
+
+	start := s.Clock.Now()
+	s.Log.Printf("job %d started, due %s: %s", job.ID, stamp(due), job.Command)
+	code, err := s.Exec(job, stop)
+	if err != nil {
+		s.Log.Printf("job %d failed to start: %s", job.ID, err)
+		return
+	}
+	s.Log.Printf("job %d ended with exit code %d after %s", job.ID, code, s.Clock.Now().Sub(start).Round(time.Millisecond))
+}
+
+func stamp(t time.Time) string {
+	return t.Format(time.RFC3339)
+}
+
+// InstanceSkipped tells why the jobs do not run on the instance with the
+// given CF_INSTANCE_INDEX, empty when they do. They run on instance 0 only,
+// so a scaled app runs each job once, and wherever no index is set.
+func InstanceSkipped(instanceIndex string) string {
+	if instanceIndex == "" || instanceIndex == "0" {
+		return ""
+	}
+	return "the cron jobs run on instance 0 and this is instance " + instanceIndex
+}
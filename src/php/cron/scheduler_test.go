@@ -0,0 +1,282 @@
+package cron_test
+
+import (
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"php/cron"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+)
+
+// fakeClock only moves when the test advances it.
+type fakeClock struct {
+	mu      sync.Mutex
+	now     time.Time
+	waiters []waiter
+}
+
+type waiter struct {
+	at time.Time
+	c  chan time.Time
+}
+
+func (f *fakeClock) Now() time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.now
+}
+
+func (f *fakeClock) After(d time.Duration) <-chan time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	c := make(chan time.Time, 1)
+	if d <= 0 {
+		c <- f.now
+	} else {
+		f.waiters = append(f.waiters, waiter{f.now.Add(d), c})
+	}
+	return c
+}
+
+func (f *fakeClock) Advance(d time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.now = f.now.Add(d)
+	var waiting []waiter
+	for _, w := range f.waiters {
+		if w.at.After(f.now) {
+			waiting = append(waiting, w)
+		} else {
+			w.c <- f.now
+		}
+	}
+	f.waiters = waiting
+}
+
+func (f *fakeClock) Waiting() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.waiters)
+}
+
+// fakeExec records the jobs run, each blocks until it is released.
+type fakeExec struct {
+	release chan int
+	mu      sync.Mutex
+	ran     []int
+}
+
+func (f *fakeExec) Exec(job cron.Job, stop <-chan struct{}) (int, error) {
+	f.mu.Lock()
+	f.ran = append(f.ran, job.ID)
+	f.mu.Unlock()
+	select {
+	case code := <-f.release:
+		return code, nil
+	case <-stop:
+		return 143, nil
+	}
+}
+
+func (f *fakeExec) Ran() []int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]int{}, f.ran...)
+}
+
+func job(id int, spec, command string) cron.Job {
+	s, err := cron.ParseSchedule(spec)
+	Expect(err).NotTo(HaveOccurred())
+	return cron.Job{ID: id, Spec: spec, Schedule: s, Command: command}
+}
+
+var _ = Describe("Scheduler", func() {
+	var (
+		clock  *fakeClock
+		exec   *fakeExec
+		output *gbytes.Buffer
+		stop   chan struct{}
+		done   chan struct{}
+	)
+
+	start := func(jobs ...cron.Job) {
+		scheduler := &cron.Scheduler{
+			Jobs:  jobs,
+			Clock: clock,
+			Exec:  exec.Exec,
+			Log:   log.New(output, "", 0),
+		}
+		go func() {
+			defer close(done)
+			scheduler.Run(stop)
+		}()
+	}
+
+	// advance moves to the next wait of the scheduler
+	advance := func(d time.Duration) {
+		Eventually(clock.Waiting).Should(Equal(1))
+		clock.Advance(d)
+	}
+
+	BeforeEach(func() {
+		clock = &fakeClock{now: time.Date(2026, 10, 18, 10, 0, 30, 0, time.UTC)}
+		exec = &fakeExec{release: make(chan int)}
+		output = gbytes.NewBuffer()
+		stop = make(chan struct{})
+		done = make(chan struct{})
+	})
+
+	AfterEach(func() {
+		close(stop)
+		Eventually(done).Should(BeClosed())
+	})
+
+	It("runs the jobs in the minutes they match", func() {
+		start(job(1, "*/2 * * * *", "php even.php"), job(2, "* * * * *", "php every.php"))
+
+		advance(30 * time.Second)
+		Eventually(exec.Ran).Should(Equal([]int{2}))
+		Eventually(output).Should(gbytes.Say(`job 2 started, due 2026-10-18T10:01:00Z: php every.php`))
+		exec.release <- 0
+		Eventually(output).Should(gbytes.Say(`job 2 ended with exit code 0 after 0s`))
+
+		advance(time.Minute)
+		Eventually(exec.Ran).Should(ConsistOf(2, 1, 2))
+		exec.release <- 0
+		exec.release <- 0
+	})
+
+	It("skips a job which is still running", func() {
+		start(job(1, "* * * * *", "php slow.php"))
+
+		advance(30 * time.Second)
+		Eventually(output).Should(gbytes.Say(`job 1 started, due 2026-10-18T10:01:00Z`))
+		advance(time.Minute)
+		Eventually(output).Should(gbytes.Say(`job 1 skipped, the run due 2026-10-18T10:01:00Z is still running`))
+		Expect(exec.Ran()).To(Equal([]int{1}))
+
+		exec.release <- 3
+		Eventually(output).Should(gbytes.Say(`job 1 ended with exit code 3 after 1m0s`))
+		advance(time.Minute)
+		Eventually(exec.Ran).Should(Equal([]int{1, 1}))
+		exec.release <- 0
+	})
+
+	It("carries on from now after the clock jumps", func() {
+		start(job(1, "1 13 * * *", "php daily.php"))
+
+		advance(3 * time.Hour)
+		Eventually(output).Should(gbytes.Say(`skipping the runs due from 2026-10-18T10:02:00Z to 2026-10-18T13:00:30Z, the clock jumped`))
+		Expect(exec.Ran()).To(BeEmpty())
+
+		advance(30 * time.Second)
+		Eventually(output).Should(gbytes.Say(`job 1 started, due 2026-10-18T13:01:00Z`))
+		Expect(exec.Ran()).To(Equal([]int{1}))
+		Consistently(exec.Ran).Should(Equal([]int{1}))
+		exec.release <- 0
+	})
+
+	It("stops the running jobs and waits for them", func() {
+		start(job(1, "* * * * *", "php slow.php"))
+
+		advance(30 * time.Second)
+		Eventually(exec.Ran).Should(HaveLen(1))
+		close(stop)
+		Eventually(done).Should(BeClosed())
+		Expect(output).To(gbytes.Say(`job 1 ended with exit code 143`))
+		stop = make(chan struct{})
+	})
+})
+
+var _ = Describe("Shell", func() {
+	var (
+		home   string
+		output *gbytes.Buffer
+		shell  cron.Shell
+	)
+
+	BeforeEach(func() {
+		var err error
+		home, err = ioutil.TempDir("", "cron")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(os.MkdirAll(filepath.Join(home, "php", "etc", "php.ini.d"), 0755)).To(Succeed())
+		output = gbytes.NewBuffer()
+		shell = cron.Shell{
+			Dir:    home,
+			Env:    cron.PHPEnv(home, []string{"PATH=/usr/bin:/bin", "LD_LIBRARY_PATH=/opt/lib"}),
+			Stdout: output,
+			Stderr: output,
+			Grace:  time.Second,
+		}
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(home)
+	})
+
+	It("runs the command in the app with its PHP", func() {
+		code, err := shell.Exec(cron.Job{Command: `echo "$PWD $PHPRC $PHP_INI_SCAN_DIR $LD_LIBRARY_PATH"; exit 3`}, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(code).To(Equal(3))
+		Expect(strings.TrimSpace(string(output.Contents()))).To(Equal(strings.Join([]string{
+			home,
+			filepath.Join(home, "php", "etc"),
+			filepath.Join(home, "php", "etc", "php.ini.d") + "/",
+			"/opt/lib:" + filepath.Join(home, "php", "lib"),
+		}, " ")))
+	})
+
+	It("stops the command and what it started", func() {
+		stop := make(chan struct{})
+		close(stop)
+		started := time.Now()
+		code, err := shell.Exec(cron.Job{Command: "sleep 30 & sleep 30"}, stop)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(code).To(Equal(143))
+		Expect(time.Since(started)).To(BeNumerically("<", 5*time.Second))
+	})
+})
+
+var _ = Describe("PHPEnv", func() {
+	It("keeps what is set already", func() {
+		Expect(cron.PHPEnv("/home/vcap/app", []string{
+			"PHPRC=/custom",
+			"PATH=/usr/bin:/home/vcap/app/php/bin",
+			"LD_LIBRARY_PATH=/home/vcap/app/php/lib",
+		})).To(Equal([]string{
+			"PHPRC=/custom",
+			"PATH=/usr/bin:/home/vcap/app/php/bin",
+			"LD_LIBRARY_PATH=/home/vcap/app/php/lib",
+		}))
+	})
+
+	It("adds the PHP of the app", func() {
+		Expect(cron.PHPEnv("/home/vcap/app", []string{"PATH=/usr/bin"})).To(Equal([]string{
+			"PATH=/usr/bin:/home/vcap/app/php/bin",
+			"PHPRC=/home/vcap/app/php/etc",
+			"LD_LIBRARY_PATH=/home/vcap/app/php/lib",
+		}))
+	})
+})
+
+var _ = Describe("InstanceSkipped", func() {
+	It("runs the jobs on instance 0", func() {
+		Expect(cron.InstanceSkipped("0")).To(BeEmpty())
+	})
+
+	It("runs the jobs without an instance index", func() {
+		Expect(cron.InstanceSkipped("")).To(BeEmpty())
+	})
+
+	It("skips the other instances", func() {
+		Expect(cron.InstanceSkipped("2")).To(Equal("the cron jobs run on instance 0 and this is instance 2"))
+	})
+})
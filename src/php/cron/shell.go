@@ -0,0 +1,111 @@
+package cron
+
+import (
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Shell runs the commands of jobs with bash, in their own process group so
+// stopping a job stops what it started.
+type Shell struct {
+	Dir    string
+	Env    []string
+	Stdout io.Writer
+	Stderr io.Writer
+	// Grace is how long a job gets to exit after SIGTERM before it is
+	// killed, when the scheduler stops.
+	Grace time.Duration
+}
+
+// Exec runs the command of job and returns its exit code.
+func (sh Shell) Exec(job Job, stop <-chan struct{}) (int, error) {
+	cmd := exec.Command("bash", "-c", job.Command)
+	cmd.Dir, cmd.Env = sh.Dir, sh.Env
+	cmd.Stdout, cmd.Stderr = sh.Stdout, sh.Stderr
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	if err := cmd.Start(); err != nil {
+		return 0, err
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- cmd.Wait() }()
+	var err error
+	select {
+	case err = <-done:
+	case <-stop:
+		syscall.Kill(-cmd.Process.Pid, syscall.SIGTERM)
+		select {
+		case err = <-done:
+		case <-time.After(sh.Grace):
+			syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+			err = <-done
+		}
+	}
+
+	if exit, ok := err.(*exec.ExitError); ok {
+		if status, ok := exit.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+			return 128 + int(status.Signal()), nil
+		}
+		return exit.ExitCode(), nil
+	}
+	return 0, err
+}
+
+// PHPEnv adds what runs the PHP of the app in home to environ, as
+// .profile.d/bp_env_vars.sh does, so jobs find it when the scheduler is
+// started without sourcing .profile.d.
+func PHPEnv(home string, environ []string) []string {
+	env := map[string]string{}
+	var order []string
+	for _, kv := range environ {
+		i := strings.Index(kv, "=")
+		if i < 0 {
+			continue
+		}
+		if _, ok := env[kv[:i]]; !ok {
+			order = append(order, kv[:i])
+		}
+		env[kv[:i]] = kv[i+1:]
+	}
+	set := func(key, value string) {
+		if _, ok := env[key]; !ok {
+			order = append(order, key)
+		}
+		env[key] = value
+	}
+
+	php := filepath.Join(home, "php")
+	if env["PHPRC"] == "" {
+		set("PHPRC", filepath.Join(php, "etc"))
+	}
+	if scanDir := filepath.Join(php, "etc", "php.ini.d"); env["PHP_INI_SCAN_DIR"] == "" {
+		if info, err := os.Stat(scanDir); err == nil && info.IsDir() {
+			set("PHP_INI_SCAN_DIR", scanDir+"/")
+		}
+	}
+	set("LD_LIBRARY_PATH", appendPath(env["LD_LIBRARY_PATH"], filepath.Join(php, "lib")))
+	set("PATH", appendPath(env["PATH"], filepath.Join(php, "bin")))
+
+	result := make([]string, len(order))
+	for i, key := range order {
+		result[i] = key + "=" + env[key]
+	}
+	return result
+}
+
+func appendPath(list, dir string) string {
+	if list == "" {
+		return dir
+	}
+	for _, d := range filepath.SplitList(list) {
+		if d == dir {
+			return list
+		}
+	}
+	return list + string(filepath.ListSeparator) + dir
+}
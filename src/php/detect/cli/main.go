@@ -0,0 +1,55 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"php/detect"
+)
+
+func main() {
+	explain := flag.Bool("explain", false, "print which rule matched, or why each rule failed, to stderr")
+	version := flag.String("version", "", "buildpack version printed on success")
+	webDir := flag.String("webdir", "htdocs", "WEBDIR when .bp-config/options.json does not set one")
+	maxEntries := flag.Int("max-entries", detect.DefaultMaxEntries, "maximum number of entries searched for PHP files")
+	ignore := flag.String("ignore", strings.Join(detect.DefaultIgnore, ","), "comma separated directory names never searched for PHP files")
+	flag.Parse()
+
+	if flag.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "usage: php-detect [-explain] [-version VERSION] <build dir>")
+		os.Exit(2)
+	}
+
+	opts := detect.Options{
+		WebDir:       *webDir,
+		ComposerPath: os.Getenv("COMPOSER_PATH"),
+		MaxEntries:   *maxEntries,
+	}
+	if *ignore != "" {
+		opts.Ignore = strings.Split(*ignore, ",")
+	}
+
+	result, err := detect.Run(flag.Arg(0), opts)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	if *explain {
+		for _, r := range result.Rules {
+			if r.Matched {
+				fmt.Fprintf(os.Stderr, "%s: matched %s\n", r.Rule, r.File)
+			} else {
+				fmt.Fprintf(os.Stderr, "%s: %s\n", r.Rule, r.Reason)
+			}
+		}
+	}
+
+	if !result.Detected {
+		fmt.Println("no")
+		os.Exit(1)
+	}
+	fmt.Println(strings.TrimSpace("php " + *version))
+}
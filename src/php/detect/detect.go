@@ -0,0 +1,193 @@
+// Package detect implements the rules of scripts/detect.py and records why
+// each of them matched or not.
+package detect
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	ComposerRule = "composer.json"
+	PHPFileRule  = "*.php"
+	WebDirRule   = "WEBDIR"
+)
+
+// DefaultIgnore lists directories which are never searched for PHP files.
+var DefaultIgnore = []string{".git", "node_modules", "vendor", "bower_components"}
+
+// DefaultMaxEntries caps the number of files and directories looked at while
+// searching for PHP files.
+const DefaultMaxEntries = 20000
+
+var errLimitReached = errors.New("limit reached")
+
+type Options struct {
+	// WebDir is used when .bp-config/options.json does not set WEBDIR.
+	WebDir string
+	// ComposerPath is the value of $COMPOSER_PATH.
+	ComposerPath string
+	MaxEntries   int
+	Ignore       []string
+}
+
+// RuleResult is the outcome of a single rule. File is set when the rule
+// matched, Reason explains a failure.
+type RuleResult struct {
+	Rule    string
+	Matched bool
+	File    string
+	Reason  string
+}
+
+type Result struct {
+	Detected bool
+	Rules    []RuleResult
+}
+
+// Run evaluates the rules in the order scripts/detect.py does and stops at
+// the first one which matches.
+func Run(buildDir string, opts Options) (*Result, error) {
+	if _, err := os.Stat(buildDir); err != nil {
+		return nil, err
+	}
+	if opts.MaxEntries <= 0 {
+		opts.MaxEntries = DefaultMaxEntries
+	}
+	webDir, err := webDirFor(buildDir, opts.WebDir)
+	if err != nil {
+		return nil, err
+	}
+
+	rules := []func() (RuleResult, error){
+		func() (RuleResult, error) { return composerRule(buildDir, webDir, opts.ComposerPath), nil },
+		func() (RuleResult, error) { return phpFileRule(buildDir, opts.MaxEntries, opts.Ignore) },
+		func() (RuleResult, error) { return webDirRule(buildDir, webDir) },
+	}
+
+	result := &Result{}
+	for _, rule := range rules {
+		r, err := rule()
+		if err != nil {
+			return nil, err
+		}
+		result.Rules = append(result.Rules, r)
+		if r.Matched {
+			result.Detected = true
+			break
+		}
+	}
+	return result, nil
+}
+
+// webDirFor reads WEBDIR from the application's options.json, the same way
+// detect.py applies the user config.
+func webDirFor(buildDir, fallback string) (string, error) {
+	if fallback == "" {
+		fallback = "htdocs"
+	}
+	data, err := ioutil.ReadFile(filepath.Join(buildDir, ".bp-config", "options.json"))
+	if os.IsNotExist(err) {
+		return fallback, nil
+	} else if err != nil {
+		return "", err
+	}
+	options := struct {
+		WebDir string `json:"WEBDIR"`
+	}{}
+	// detect.py ignores an invalid options.json during detection
+	if err := json.Unmarshal(data, &options); err != nil || options.WebDir == "" {
+		return fallback, nil
+	}
+	return options.WebDir, nil
+}
+
+// composerRule checks the locations searched by find_composer_paths in the
+// composer extension.
+func composerRule(buildDir, webDir, composerPath string) RuleResult {
+	candidates := []string{"composer.json", filepath.Join(webDir, "composer.json")}
+	if composerPath != "" {
+		candidates = append(candidates,
+			filepath.Join(composerPath, "composer.json"),
+			filepath.Join(webDir, composerPath, "composer.json"))
+	}
+	for _, c := range candidates {
+		if _, err := os.Stat(filepath.Join(buildDir, c)); err == nil {
+			return RuleResult{Rule: ComposerRule, Matched: true, File: c}
+		}
+	}
+	return RuleResult{Rule: ComposerRule, Reason: "no composer.json at " + strings.Join(candidates, ", ")}
+}
+
+func phpFileRule(buildDir string, maxEntries int, ignore []string) (RuleResult, error) {
+	ignored := map[string]bool{}
+	for _, name := range ignore {
+		ignored[name] = true
+	}
+
+	var found string
+	var skipped []string
+	entries := 0
+	err := filepath.Walk(buildDir, func(path string, info os.FileInfo, err error) error {
+		// like os.walk, skip what cannot be read instead of failing detection
+		if err != nil {
+			if info != nil && info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if path == buildDir {
+			return nil
+		}
+		rel, err := filepath.Rel(buildDir, path)
+		if err != nil {
+			return err
+		}
+		if info.IsDir() && ignored[info.Name()] {
+			skipped = append(skipped, rel)
+			return filepath.SkipDir
+		}
+		if entries >= maxEntries {
+			return errLimitReached
+		}
+		entries++
+		if strings.HasSuffix(info.Name(), ".php") {
+			found = rel
+			return errLimitReached
+		}
+		return nil
+	})
+	if err != nil && err != errLimitReached {
+		return RuleResult{}, err
+	}
+
+	if found != "" {
+		return RuleResult{Rule: PHPFileRule, Matched: true, File: found}, nil
+	}
+	reason := fmt.Sprintf("no file ending in .php among %d entries", entries)
+	if err == errLimitReached {
+		reason = fmt.Sprintf("no file ending in .php in the first %d entries, stopped searching", maxEntries)
+	}
+	if len(skipped) > 0 {
+		reason += fmt.Sprintf(" (skipped %s)", strings.Join(skipped, ", "))
+	}
+	return RuleResult{Rule: PHPFileRule, Reason: reason}, nil
+}
+
+func webDirRule(buildDir, webDir string) (RuleResult, error) {
+	names, err := ioutil.ReadDir(buildDir)
+	if err != nil {
+		return RuleResult{}, err
+	}
+	for _, info := range names {
+		if info.Name() == webDir {
+			return RuleResult{Rule: WebDirRule, Matched: true, File: webDir}, nil
+		}
+	}
+	return RuleResult{Rule: WebDirRule, Reason: fmt.Sprintf("no %s at the application root", webDir)}, nil
+}
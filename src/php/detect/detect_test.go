@@ -0,0 +1,191 @@
+package detect_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"php/detect"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gexec"
+)
+
+var _ = Describe("Detect", func() {
+	var (
+		buildDir string
+		opts     detect.Options
+	)
+
+	touch := func(paths ...string) {
+		for _, p := range paths {
+			path := filepath.Join(buildDir, p)
+			Expect(os.MkdirAll(filepath.Dir(path), 0755)).To(Succeed())
+			Expect(ioutil.WriteFile(path, []byte{}, 0644)).To(Succeed())
+		}
+	}
+
+	BeforeEach(func() {
+		var err error
+		buildDir, err = ioutil.TempDir("", "detect")
+		Expect(err).NotTo(HaveOccurred())
+		opts = detect.Options{Ignore: detect.DefaultIgnore}
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(buildDir)
+	})
+
+	Context("composer.json", func() {
+		It("matches at the application root", func() {
+			touch("composer.json", "index.php")
+
+			result, err := detect.Run(buildDir, opts)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.Detected).To(BeTrue())
+			Expect(result.Rules).To(Equal([]detect.RuleResult{
+				{Rule: detect.ComposerRule, Matched: true, File: "composer.json"},
+			}))
+		})
+
+		It("matches inside WEBDIR from options.json", func() {
+			touch("public/composer.json")
+			Expect(os.MkdirAll(filepath.Join(buildDir, ".bp-config"), 0755)).To(Succeed())
+			Expect(ioutil.WriteFile(filepath.Join(buildDir, ".bp-config", "options.json"), []byte(`{"WEBDIR": "public"}`), 0644)).
+				To(Succeed())
+
+			result, err := detect.Run(buildDir, opts)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.Rules[0]).To(Equal(detect.RuleResult{Rule: detect.ComposerRule, Matched: true, File: "public/composer.json"}))
+		})
+
+		It("matches under $COMPOSER_PATH", func() {
+			touch("app/composer.json")
+			opts.ComposerPath = "app"
+
+			result, err := detect.Run(buildDir, opts)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.Rules[0]).To(Equal(detect.RuleResult{Rule: detect.ComposerRule, Matched: true, File: "app/composer.json"}))
+		})
+
+		It("lists the locations it checked", func() {
+			touch("index.php")
+
+			result, err := detect.Run(buildDir, opts)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.Rules[0].Matched).To(BeFalse())
+			Expect(result.Rules[0].Reason).To(Equal("no composer.json at composer.json, htdocs/composer.json"))
+		})
+	})
+
+	Context("*.php", func() {
+		It("matches a nested PHP file", func() {
+			touch("README.md", "src/lib/app.php")
+
+			result, err := detect.Run(buildDir, opts)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.Detected).To(BeTrue())
+			Expect(result.Rules).To(HaveLen(2))
+			Expect(result.Rules[1]).To(Equal(detect.RuleResult{Rule: detect.PHPFileRule, Matched: true, File: "src/lib/app.php"}))
+		})
+
+		It("does not search ignored directories", func() {
+			touch("README.md", "node_modules/pkg/index.php", "vendor/lib/index.php")
+
+			result, err := detect.Run(buildDir, opts)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.Detected).To(BeFalse())
+			Expect(result.Rules[1].Matched).To(BeFalse())
+			Expect(result.Rules[1].Reason).To(Equal("no file ending in .php among 1 entries (skipped node_modules, vendor)"))
+		})
+
+		It("skips directories it cannot read", func() {
+			if os.Geteuid() == 0 {
+				Skip("root can read every directory")
+			}
+			touch("locked/secret.txt", "src/app.php")
+			Expect(os.Chmod(filepath.Join(buildDir, "locked"), 0)).To(Succeed())
+			defer os.Chmod(filepath.Join(buildDir, "locked"), 0755)
+
+			result, err := detect.Run(buildDir, opts)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.Rules[1]).To(Equal(detect.RuleResult{Rule: detect.PHPFileRule, Matched: true, File: "src/app.php"}))
+		})
+
+		It("stops searching after the maximum number of entries", func() {
+			for i := 0; i < 10; i++ {
+				touch(fmt.Sprintf("a/file%d.txt", i))
+			}
+			touch("z/index.php")
+			opts.MaxEntries = 5
+
+			result, err := detect.Run(buildDir, opts)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.Rules[1].Matched).To(BeFalse())
+			Expect(result.Rules[1].Reason).To(Equal("no file ending in .php in the first 5 entries, stopped searching"))
+		})
+	})
+
+	Context("WEBDIR", func() {
+		It("matches an empty WEBDIR", func() {
+			Expect(os.MkdirAll(filepath.Join(buildDir, "htdocs"), 0755)).To(Succeed())
+
+			result, err := detect.Run(buildDir, opts)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.Detected).To(BeTrue())
+			Expect(result.Rules).To(HaveLen(3))
+			Expect(result.Rules[2]).To(Equal(detect.RuleResult{Rule: detect.WebDirRule, Matched: true, File: "htdocs"}))
+		})
+
+		It("explains every failed rule", func() {
+			touch("README.md")
+			opts.WebDir = "web"
+
+			result, err := detect.Run(buildDir, opts)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.Detected).To(BeFalse())
+			Expect(result.Rules).To(Equal([]detect.RuleResult{
+				{Rule: detect.ComposerRule, Reason: "no composer.json at composer.json, web/composer.json"},
+				{Rule: detect.PHPFileRule, Reason: "no file ending in .php among 1 entries"},
+				{Rule: detect.WebDirRule, Reason: "no web at the application root"},
+			}))
+		})
+	})
+
+	Context("command", func() {
+		var bin string
+
+		BeforeEach(func() {
+			var err error
+			bin, err = gexec.Build("php/detect/cli")
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		AfterEach(func() {
+			gexec.CleanupBuildArtifacts()
+		})
+
+		It("prints the buildpack version and the explanation", func() {
+			touch("index.php")
+
+			session, err := gexec.Start(exec.Command(bin, "-explain", "-version", "4.3.51", buildDir), GinkgoWriter, GinkgoWriter)
+			Expect(err).NotTo(HaveOccurred())
+			Eventually(session).Should(gexec.Exit(0))
+			Expect(string(session.Out.Contents())).To(Equal("php 4.3.51\n"))
+			Expect(string(session.Err.Contents())).To(Equal(
+				"composer.json: no composer.json at composer.json, htdocs/composer.json\n" +
+					"*.php: matched index.php\n"))
+		})
+
+		It("prints no and fails when nothing matched", func() {
+			session, err := gexec.Start(exec.Command(bin, buildDir), GinkgoWriter, GinkgoWriter)
+			Expect(err).NotTo(HaveOccurred())
+			Eventually(session).Should(gexec.Exit(1))
+			Expect(string(session.Out.Contents())).To(Equal("no\n"))
+			Expect(session.Err.Contents()).To(BeEmpty())
+		})
+	})
+})
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"php/extkit"
+)
+
+func main() {
+	opts := extkit.Options{}
+	flag.StringVar(&opts.BuildpackDir, "buildpack", buildpackDir(), "root of the buildpack")
+	flag.StringVar(&opts.DownloadsDir, "downloads", "", "directory holding the files of the downloads, named as the last element of their URL")
+	flag.StringVar(&opts.AppDir, "app", "", "app to stage the extension into, an empty one when not set")
+	flag.StringVar(&opts.Python, "python", "python", "Python 2 interpreter")
+	keep := flag.Bool("keep", false, "keep the staged app and print where it is")
+	flag.Parse()
+	if flag.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "usage: extension-kit [-downloads DIR] [-app DIR] [-keep] <extension dir>")
+		os.Exit(2)
+	}
+	opts.ExtensionDir = flag.Arg(0)
+
+	r, err := extkit.Run(opts)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if *keep {
+		fmt.Printf("staged app: %s\n", r.AppDir)
+	} else {
+		defer r.Close()
+	}
+
+	for _, p := range r.Paths {
+		fmt.Printf("wrote %s\n", p)
+	}
+	for _, name := range sortedKeys(r.Processes) {
+		fmt.Printf("process %s: %s\n", name, r.Processes[name])
+	}
+	for _, key := range sortedKeys(r.Env) {
+		fmt.Printf("env %s=%s\n", key, r.Env[key])
+	}
+	for _, p := range r.Problems {
+		fmt.Printf("PROBLEM: %s\n", p)
+	}
+	if len(r.Problems) > 0 {
+		r.Close()
+		os.Exit(1)
+	}
+	fmt.Printf("%s is compatible with api_version %d of this buildpack\n", r.Manifest.Name, r.Manifest.APIVersion)
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// buildpackDir is the root of the buildpack when running from its bin
+// directory.
+func buildpackDir() string {
+	exe, err := os.Executable()
+	if err != nil {
+		return "."
+	}
+	return filepath.Dir(filepath.Dir(exe))
+}
@@ -0,0 +1,204 @@
+// Package extkit stages an app extension with a declarative manifest the
+// way the buildpack does, without network access, and checks what it added.
+// Extension authors run it as bin/extension-kit before pushing an app.
+package extkit
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"php/extmanifest"
+
+	"github.com/cloudfoundry/libbuildpack"
+)
+
+// Options tell the kit where to find everything.
+type Options struct {
+	// BuildpackDir is the root of the buildpack, whose
+	// scripts/extension_kit.py executes the manifest.
+	BuildpackDir string
+	// ExtensionDir holds the manifest and the files it refers to.
+	ExtensionDir string
+	// AppDir is copied to stage the extension into, an empty app is used
+	// when it is empty.
+	AppDir string
+	// DownloadsDir holds the files of the downloads, named as the last
+	// element of their URL.
+	DownloadsDir string
+	// Python runs the buildpack scripts, python when empty.
+	Python string
+}
+
+// Result is what staging the extension added.
+type Result struct {
+	Manifest extmanifest.Manifest
+	// AppDir is the staged copy of the app, removed by Close.
+	AppDir string
+	// Paths the extension wrote, relative to AppDir.
+	Paths     []string
+	Processes map[string]string
+	// Env holds the variables of the manifest after sourcing .profile.d.
+	Env map[string]string
+	// Problems found by the checks, the extension is compatible when there
+	// are none.
+	Problems []string
+}
+
+// Close removes the staged app.
+func (r *Result) Close() error {
+	return os.RemoveAll(filepath.Dir(r.AppDir))
+}
+
+var leftoverPattern = regexp.MustCompile(`#\{[A-Za-z0-9_]+\}`)
+
+// Run validates the manifest, stages the extension into a copy of the app
+// and checks the result. An error means the extension can't be staged at
+// all, problems are listed in the result.
+func Run(opts Options) (*Result, error) {
+	m, err := extmanifest.Load(opts.ExtensionDir)
+	if err != nil {
+		return nil, err
+	}
+	if len(m.Downloads) > 0 && opts.DownloadsDir == "" {
+		return nil, fmt.Errorf("%s has downloads, pass the directory holding them", m.Name)
+	}
+
+	tmp, err := ioutil.TempDir("", "extension-kit")
+	if err != nil {
+		return nil, err
+	}
+	r := &Result{Manifest: m, AppDir: filepath.Join(tmp, "app")}
+	if err := stage(opts, r); err != nil {
+		r.Close()
+		return nil, err
+	}
+	r.check()
+	return r, nil
+}
+
+func stage(opts Options, r *Result) error {
+	name := filepath.Base(filepath.Clean(opts.ExtensionDir))
+	extDir := filepath.Join(r.AppDir, ".extensions", name)
+	if err := os.MkdirAll(extDir, 0755); err != nil {
+		return err
+	}
+	if opts.AppDir != "" {
+		if err := libbuildpack.CopyDirectory(opts.AppDir, r.AppDir); err != nil {
+			return err
+		}
+	}
+	if err := libbuildpack.CopyDirectory(opts.ExtensionDir, extDir); err != nil {
+		return err
+	}
+
+	python := opts.Python
+	if python == "" {
+		python = "python"
+	}
+	downloads, err := filepath.Abs(opts.DownloadsDir)
+	if err != nil {
+		return err
+	}
+	cmd := exec.Command(python, filepath.Join(opts.BuildpackDir, "scripts", "extension_kit.py"), r.AppDir, name, downloads)
+	cmd.Env = append(os.Environ(), "PYTHONPATH="+filepath.Join(opts.BuildpackDir, "lib"), "PYTHONDONTWRITEBYTECODE=1")
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return fmt.Errorf("staging %s failed: %s\n%s", r.Manifest.Name, err, strings.TrimSpace(stderr.String()))
+	}
+
+	var staged struct {
+		Processes map[string]string `json:"processes"`
+		Paths     []string          `json:"paths"`
+	}
+	if err := json.Unmarshal(out, &staged); err != nil {
+		return fmt.Errorf("staging %s printed %q: %s", r.Manifest.Name, out, err)
+	}
+	r.Processes, r.Paths = staged.Processes, staged.Paths
+	return nil
+}
+
+func (r *Result) problem(format string, args ...interface{}) {
+	r.Problems = append(r.Problems, fmt.Sprintf(format, args...))
+}
+
+// check looks at the staged app as the container would run it.
+func (r *Result) check() {
+	for _, p := range r.Paths {
+		if _, err := os.Stat(filepath.Join(r.AppDir, p)); err != nil {
+			r.problem("%s was not written", p)
+		}
+	}
+	for _, d := range r.Manifest.Downloads {
+		if files, _ := ioutil.ReadDir(filepath.Join(r.AppDir, d.To)); len(files) == 0 {
+			r.problem("%s is empty after installing %s", d.To, d.URL)
+		}
+	}
+	for _, c := range r.Manifest.ConfigFiles {
+		data, err := ioutil.ReadFile(filepath.Join(r.AppDir, c.To))
+		if err == nil && c.Rewrite {
+			if left := leftoverPattern.FindAll(data, -1); len(left) > 0 {
+				r.problem("%s still has %s, which staging does not set", c.To, left[0])
+			}
+		}
+	}
+
+	scripts, _ := filepath.Glob(filepath.Join(r.AppDir, ".profile.d", "ext_"+r.Manifest.Name+"_*"))
+	if len(r.Manifest.Env) > 0 {
+		scripts = append(scripts, filepath.Join(r.AppDir, ".profile.d", "ext_"+r.Manifest.Name+".sh"))
+	}
+	for _, script := range scripts {
+		if out, err := exec.Command("bash", "-n", script).CombinedOutput(); err != nil {
+			r.problem("%s is not valid bash: %s", filepath.Base(script), strings.TrimSpace(string(out)))
+		}
+	}
+	for _, name := range sortedKeys(r.Processes) {
+		if out, err := exec.Command("bash", "-n", "-c", r.Processes[name]).CombinedOutput(); err != nil {
+			r.problem("the command of process %s is not valid bash: %s", name, strings.TrimSpace(string(out)))
+		}
+	}
+
+	r.Env = map[string]string{}
+	if len(r.Manifest.Env) == 0 {
+		return
+	}
+	// the launcher sources .profile.d with HOME set to the app
+	cmd := exec.Command("bash", "-c", `for f in "$HOME"/.profile.d/*.sh; do . "$f" || exit; done; env -0`)
+	cmd.Dir = r.AppDir
+	cmd.Env = append(os.Environ(), "HOME="+r.AppDir)
+	out, err := cmd.Output()
+	if err != nil {
+		r.problem("sourcing .profile.d failed: %s", err)
+		return
+	}
+	for _, kv := range strings.Split(string(out), "\x00") {
+		if i := strings.Index(kv, "="); i > 0 {
+			if _, ok := r.Manifest.Env[kv[:i]]; ok {
+				r.Env[kv[:i]] = kv[i+1:]
+			}
+		}
+	}
+	for _, key := range sortedKeys(r.Manifest.Env) {
+		if _, ok := r.Env[key]; !ok {
+			r.problem("%s is not set after sourcing .profile.d", key)
+		}
+	}
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
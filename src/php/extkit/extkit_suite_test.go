@@ -0,0 +1,13 @@
+package extkit_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestExtkit(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Extkit Suite")
+}
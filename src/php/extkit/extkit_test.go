@@ -0,0 +1,185 @@
+package extkit_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"php/extkit"
+
+	"github.com/cloudfoundry/libbuildpack/cutlass"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// agentArchive is a release of an agent, with its files below a top
+// directory as most releases have them.
+func agentArchive() []byte {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for name, content := range map[string]string{
+		"agent-1.0/agent.so":   "not really a PHP extension",
+		"agent-1.0/README.txt": "agent 1.0",
+	} {
+		Expect(tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(content))})).To(Succeed())
+		_, err := tw.Write([]byte(content))
+		Expect(err).NotTo(HaveOccurred())
+	}
+	Expect(tw.Close()).To(Succeed())
+	Expect(gz.Close()).To(Succeed())
+	return buf.Bytes()
+}
+
+var _ = Describe("Run", func() {
+	var (
+		dir  string
+		opts extkit.Options
+		sum  string
+	)
+
+	write := func(path, content string) {
+		path = filepath.Join(dir, path)
+		Expect(os.MkdirAll(filepath.Dir(path), 0755)).To(Succeed())
+		Expect(ioutil.WriteFile(path, []byte(content), 0644)).To(Succeed())
+	}
+
+	BeforeEach(func() {
+		for _, tool := range []string{"python2", "bash", "tar"} {
+			if _, err := exec.LookPath(tool); err != nil {
+				Skip(tool + " is not available")
+			}
+		}
+		bpDir, err := cutlass.FindRoot()
+		Expect(err).NotTo(HaveOccurred())
+		dir, err = ioutil.TempDir("", "extkit")
+		Expect(err).NotTo(HaveOccurred())
+
+		archive := agentArchive()
+		digest := sha256.Sum256(archive)
+		sum = hex.EncodeToString(digest[:])
+		write("downloads/agent-1.0.tar.gz", string(archive))
+
+		write("app/.bp-config/options.json", `{"AGENT_COLLECTOR": "collector.internal:4317"}`)
+		write("app/htdocs/index.php", "<?php echo 'hello';")
+		write("agent/agent.ini", "extension=@{HOME}/agent/agent.so\nagent.collector=#{AGENT_COLLECTOR}\n")
+		write("agent/start-agent.sh", "mkdir -p \"$AGENT_LOG_DIR\"\n")
+
+		opts = extkit.Options{
+			BuildpackDir: bpDir,
+			ExtensionDir: filepath.Join(dir, "agent"),
+			AppDir:       filepath.Join(dir, "app"),
+			DownloadsDir: filepath.Join(dir, "downloads"),
+			Python:       "python2",
+		}
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	manifest := func(extra string) {
+		write("agent/extension.yml", `api_version: 1
+name: agent
+downloads:
+  - url: https://downloads.example.com/agent/agent-1.0.tar.gz
+    sha256: `+sum+`
+    to: agent
+    strip: true
+config_files:
+  - from: agent.ini
+    to: php/etc/php.ini.d/agent.ini
+    rewrite: true
+env:
+  AGENT_LOG_DIR: $HOME/logs/agent
+  AGENT_BANNER: say "hi" with `+"`backticks`"+`
+processes:
+  agent-forwarder: $HOME/agent/forwarder --listen 127.0.0.1:4318
+profile_d:
+  - name: start.sh
+    from: start-agent.sh
+`+extra)
+	}
+
+	It("stages the extension into a copy of the app", func() {
+		manifest("")
+		r, err := extkit.Run(opts)
+		Expect(err).NotTo(HaveOccurred())
+		defer r.Close()
+
+		Expect(r.Problems).To(BeEmpty())
+		Expect(r.Paths).To(Equal([]string{
+			"agent",
+			"php/etc/php.ini.d/agent.ini",
+			".profile.d/ext_agent.sh",
+			".profile.d/ext_agent_start.sh",
+		}))
+		Expect(filepath.Join(r.AppDir, "agent", "agent.so")).To(BeARegularFile())
+		Expect(filepath.Join(r.AppDir, "htdocs", "index.php")).To(BeARegularFile())
+		Expect(filepath.Join(r.AppDir, ".extensions", "agent", "extension.yml")).To(BeARegularFile())
+
+		ini, err := ioutil.ReadFile(filepath.Join(r.AppDir, "php", "etc", "php.ini.d", "agent.ini"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(ini)).To(Equal("extension=@{HOME}/agent/agent.so\nagent.collector=collector.internal:4317\n"))
+
+		Expect(r.Processes).To(Equal(map[string]string{"agent-forwarder": "$HOME/agent/forwarder --listen 127.0.0.1:4318"}))
+		Expect(r.Env).To(Equal(map[string]string{
+			"AGENT_LOG_DIR": filepath.Join(r.AppDir, "logs", "agent"),
+			"AGENT_BANNER":  "say \"hi\" with `backticks`",
+		}))
+		Expect(filepath.Join(r.AppDir, "logs", "agent")).To(BeADirectory())
+	})
+
+	It("passes the extension of the fixture", func() {
+		opts.ExtensionDir = filepath.Join(opts.BuildpackDir, "fixtures", "declarative_extension", ".extensions", "greeting")
+		opts.AppDir = ""
+		r, err := extkit.Run(opts)
+		Expect(err).NotTo(HaveOccurred())
+		defer r.Close()
+
+		Expect(r.Problems).To(BeEmpty())
+		Expect(r.Env).To(Equal(map[string]string{"GREETING_CONFIG": filepath.Join(r.AppDir, "config", "greeting.json")}))
+		Expect(ioutil.ReadFile(filepath.Join(r.AppDir, "config", "greeting.json"))).To(ContainSubstring(`"web_server": "httpd"`))
+	})
+
+	It("fails on an invalid manifest before staging", func() {
+		manifest("  - name: broken\n")
+		_, err := extkit.Run(opts)
+		Expect(err).To(MatchError(ContainSubstring("profile_d[1].name: must be a file name ending in .sh")))
+	})
+
+	It("does not download", func() {
+		manifest("")
+		Expect(os.Remove(filepath.Join(dir, "downloads", "agent-1.0.tar.gz"))).To(Succeed())
+		_, err := extkit.Run(opts)
+		Expect(err).To(MatchError(ContainSubstring("agent-1.0.tar.gz is not in " + filepath.Join(dir, "downloads") + ", the kit does not download")))
+	})
+
+	It("checks the downloads against their SHA-256", func() {
+		manifest("")
+		write("downloads/agent-1.0.tar.gz", "a different release")
+		_, err := extkit.Run(opts)
+		Expect(err).To(MatchError(ContainSubstring("the manifest expects " + sum)))
+	})
+
+	It("reports keys staging does not set and scripts bash can't run", func() {
+		write("agent/agent.ini", "agent.collector=#{AGENT_COLECTOR}\n")
+		write("agent/start-agent.sh", "if [ -d \"$AGENT_LOG_DIR\" ]; then\n")
+		manifest("")
+		r, err := extkit.Run(opts)
+		Expect(err).NotTo(HaveOccurred())
+		defer r.Close()
+
+		Expect(r.Problems).To(ConsistOf(
+			"php/etc/php.ini.d/agent.ini still has #{AGENT_COLECTOR}, which staging does not set",
+			MatchRegexp(`^ext_agent_start.sh is not valid bash: .*syntax error`),
+			MatchRegexp(`^sourcing .profile.d failed: exit status \d`),
+		))
+	})
+})
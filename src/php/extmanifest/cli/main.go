@@ -0,0 +1,49 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"php/extmanifest"
+)
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: extension-manifest <extension dir>...\n       extension-manifest -reserved-processes")
+		fmt.Fprintf(os.Stderr, "checks .extensions/<name>/%s against api_version 1 to %d\n", extmanifest.FileNames[0], extmanifest.APIVersion)
+	}
+	reservedProcesses := flag.Bool("reserved-processes", false, "print the names of the processes the buildpack starts, which neither extensions nor ADDITIONAL_PROCESSES may use")
+	flag.Parse()
+	if *reservedProcesses {
+		for _, name := range extmanifest.ReservedProcesses {
+			fmt.Println(name)
+		}
+		return
+	}
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	failed := false
+	for _, dir := range flag.Args() {
+		m, err := extmanifest.Load(dir)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s:\n", dir)
+			if errs, ok := err.(extmanifest.Errors); ok {
+				for _, e := range errs {
+					fmt.Fprintf(os.Stderr, "  %s\n", e)
+				}
+			} else {
+				fmt.Fprintf(os.Stderr, "  %s\n", err)
+			}
+			failed = true
+			continue
+		}
+		fmt.Printf("%s: %s is valid for api_version %d\n", dir, m.Name, m.APIVersion)
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,343 @@
+// Package extmanifest reads and validates the declarative manifests of app
+// extensions, .extensions/<name>/extension.yml, which the buildpack executes
+// in place of an extension.py.
+package extmanifest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// APIVersion is the newest api_version this buildpack executes. Older
+// versions keep working when it is raised.
+const APIVersion = 1
+
+// FileNames are the names a manifest may have, only one of them may exist.
+var FileNames = []string{"extension.yml", "extension.yaml", "extension.json"}
+
+// ReservedProcesses are started by the buildpack, an extension can't
+// replace them. This is the only list of them, staging reads it with
+// extension-manifest -reserved-processes to check ADDITIONAL_PROCESSES.
+var ReservedProcesses = []string{"php-fpm", "php-fpm-slowlog", "php-app", "httpd", "nginx", "php-metrics", "cron", "release"}
+
+// Manifest declares what an extension adds to the app. Paths of To are
+// relative to the app directory, paths of From to the extension directory.
+type Manifest struct {
+	APIVersion  int               `json:"api_version" yaml:"api_version"`
+	Name        string            `json:"name" yaml:"name"`
+	Downloads   []Download        `json:"downloads,omitempty" yaml:"downloads"`
+	ConfigFiles []ConfigFile      `json:"config_files,omitempty" yaml:"config_files"`
+	Env         map[string]string `json:"env,omitempty" yaml:"env"`
+	Processes   map[string]string `json:"processes,omitempty" yaml:"processes"`
+	ProfileD    []ProfileScript   `json:"profile_d,omitempty" yaml:"profile_d"`
+}
+
+// Download is fetched during staging and checked against SHA256. Archives
+// are extracted into the directory To unless Extract is false, which copies
+// the file there. Strip drops the top directory of the archive.
+type Download struct {
+	URL     string `json:"url" yaml:"url"`
+	SHA256  string `json:"sha256" yaml:"sha256"`
+	To      string `json:"to" yaml:"to"`
+	Extract *bool  `json:"extract,omitempty" yaml:"extract"`
+	Strip   bool   `json:"strip,omitempty" yaml:"strip"`
+}
+
+// Extracts tells whether the download is extracted, which is the default.
+func (d Download) Extracts() bool {
+	return d.Extract == nil || *d.Extract
+}
+
+// ConfigFile is copied into the app, with #{KEY} replaced by the staging
+// value of KEY when Rewrite is set, as for the files of .bp-config.
+type ConfigFile struct {
+	From    string `json:"from" yaml:"from"`
+	To      string `json:"to" yaml:"to"`
+	Rewrite bool   `json:"rewrite,omitempty" yaml:"rewrite"`
+}
+
+// ProfileScript is written to .profile.d, from a file of the extension or
+// inline.
+type ProfileScript struct {
+	Name   string `json:"name" yaml:"name"`
+	From   string `json:"from,omitempty" yaml:"from"`
+	Script string `json:"script,omitempty" yaml:"script"`
+}
+
+// FieldError is a problem with one field of a manifest.
+type FieldError struct {
+	Field   string
+	Message string
+}
+
+func (e FieldError) Error() string {
+	if e.Field == "" {
+		return e.Message
+	}
+	return e.Field + ": " + e.Message
+}
+
+// Errors are all the problems of a manifest, one per line.
+type Errors []FieldError
+
+func (e Errors) Error() string {
+	lines := make([]string, len(e))
+	for i, err := range e {
+		lines[i] = err.Error()
+	}
+	return strings.Join(lines, "\n")
+}
+
+var (
+	namePattern    = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+	envPattern     = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+	sha256Pattern  = regexp.MustCompile(`^[0-9a-f]{64}$`)
+	urlPattern     = regexp.MustCompile(`^https?://[^/\s]+/\S*$`)
+	profilePattern = regexp.MustCompile(`^[A-Za-z0-9_.-]+\.sh$`)
+)
+
+// Find returns the path of the manifest in dir, or an empty path when the
+// directory has none.
+func Find(dir string) (string, error) {
+	var found []string
+	for _, name := range FileNames {
+		if _, err := os.Stat(filepath.Join(dir, name)); err == nil {
+			found = append(found, name)
+		} else if !os.IsNotExist(err) {
+			return "", err
+		}
+	}
+	switch len(found) {
+	case 0:
+		return "", nil
+	case 1:
+		return filepath.Join(dir, found[0]), nil
+	}
+	return "", fmt.Errorf("%s has more than one manifest: %s", dir, strings.Join(found, ", "))
+}
+
+// Load reads and validates the manifest of the extension in dir.
+func Load(dir string) (Manifest, error) {
+	file, err := Find(dir)
+	if err != nil {
+		return Manifest{}, err
+	}
+	if file == "" {
+		return Manifest{}, fmt.Errorf("%s has no %s", dir, strings.Join(FileNames, ", "))
+	}
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return Manifest{}, err
+	}
+	m, err := Parse(data, filepath.Ext(file) == ".json")
+	if err != nil {
+		return Manifest{}, fmt.Errorf("%s: %s", file, err)
+	}
+	if err := m.Validate(dir); err != nil {
+		return Manifest{}, err
+	}
+	return m, nil
+}
+
+// Parse decodes a manifest, rejecting unknown keys. The api_version is
+// checked first, so a manifest written for a newer buildpack asks for it
+// rather than failing on the keys it added.
+func Parse(data []byte, isJSON bool) (Manifest, error) {
+	var version struct {
+		APIVersion interface{} `json:"api_version" yaml:"api_version"`
+	}
+	if err := unmarshal(data, isJSON, false, &version); err != nil {
+		return Manifest{}, err
+	}
+	if err := checkVersion(version.APIVersion); err != nil {
+		return Manifest{}, err
+	}
+
+	var m Manifest
+	if err := unmarshal(data, isJSON, true, &m); err != nil {
+		return Manifest{}, err
+	}
+	return m, nil
+}
+
+func unmarshal(data []byte, isJSON, strict bool, v interface{}) error {
+	if !isJSON {
+		if strict {
+			return yaml.UnmarshalStrict(data, v)
+		}
+		return yaml.Unmarshal(data, v)
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	if strict {
+		decoder.DisallowUnknownFields()
+	}
+	return decoder.Decode(v)
+}
+
+func checkVersion(v interface{}) error {
+	var version int
+	switch n := v.(type) {
+	case nil:
+		return FieldError{"api_version", fmt.Sprintf("is required, this buildpack supports 1 to %d", APIVersion)}
+	case int:
+		version = n
+	case float64:
+		version = int(n)
+		if float64(version) != n {
+			return FieldError{"api_version", fmt.Sprintf("must be a whole number, not %v", n)}
+		}
+	default:
+		return FieldError{"api_version", fmt.Sprintf("must be a number, not %q", fmt.Sprint(n))}
+	}
+	if version < 1 {
+		return FieldError{"api_version", fmt.Sprintf("must be 1 to %d, not %d", APIVersion, version)}
+	}
+	if version > APIVersion {
+		return FieldError{"api_version", fmt.Sprintf("%d needs a newer buildpack, this one supports 1 to %d", version, APIVersion)}
+	}
+	return nil
+}
+
+// Validate checks the values of the manifest. The files it refers to are
+// looked up in dir unless it is empty.
+func (m Manifest) Validate(dir string) error {
+	var errs Errors
+	add := func(field, format string, args ...interface{}) {
+		errs = append(errs, FieldError{field, fmt.Sprintf(format, args...)})
+	}
+
+	if err := checkVersion(m.APIVersion); err != nil {
+		errs = append(errs, err.(FieldError))
+	}
+	if !namePattern.MatchString(m.Name) {
+		add("name", "must be lower case letters, digits, - and _, not %q", m.Name)
+	}
+
+	for i, d := range m.Downloads {
+		field := fmt.Sprintf("downloads[%d]", i)
+		if !urlPattern.MatchString(d.URL) {
+			add(field+".url", "must be an http or https URL, not %q", d.URL)
+		}
+		if !sha256Pattern.MatchString(d.SHA256) {
+			add(field+".sha256", "must be the 64 lower case hex digits of the SHA-256 of the file, not %q", d.SHA256)
+		}
+		if msg := relativePath(d.To); msg != "" {
+			add(field+".to", "%s", msg)
+		}
+		if d.Strip && !d.Extracts() {
+			add(field+".strip", "only applies to extracted archives")
+		}
+	}
+
+	for i, c := range m.ConfigFiles {
+		field := fmt.Sprintf("config_files[%d]", i)
+		if msg := relativePath(c.From); msg != "" {
+			add(field+".from", "%s", msg)
+		} else if msg := regularFile(dir, c.From); msg != "" {
+			add(field+".from", "%s", msg)
+		}
+		if msg := relativePath(c.To); msg != "" {
+			add(field+".to", "%s", msg)
+		}
+	}
+
+	for _, key := range sortedKeys(m.Env) {
+		if !envPattern.MatchString(key) {
+			add("env", "%q is not a valid environment variable name", key)
+		}
+	}
+
+	for _, name := range sortedKeys(m.Processes) {
+		field := "processes." + name
+		if !namePattern.MatchString(name) {
+			add(field, "names must be lower case letters, digits, - and _")
+		} else if reserved(name) {
+			add(field, "is started by the buildpack, pick another name")
+		}
+		if strings.TrimSpace(m.Processes[name]) == "" {
+			add(field, "the command is empty")
+		}
+	}
+
+	names := map[string]bool{}
+	for i, p := range m.ProfileD {
+		field := fmt.Sprintf("profile_d[%d]", i)
+		if !profilePattern.MatchString(p.Name) {
+			add(field+".name", "must be a file name ending in .sh, not %q", p.Name)
+		} else if names[p.Name] {
+			add(field+".name", "%q is listed twice", p.Name)
+		}
+		names[p.Name] = true
+		switch {
+		case (p.From == "") == (p.Script == ""):
+			add(field, "needs either from or script")
+		case p.From != "":
+			if msg := relativePath(p.From); msg != "" {
+				add(field+".from", "%s", msg)
+			} else if msg := regularFile(dir, p.From); msg != "" {
+				add(field+".from", "%s", msg)
+			}
+		}
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// relativePath returns why p can't be used as a path below a directory, or
+// an empty string.
+func relativePath(p string) string {
+	switch {
+	case p == "":
+		return "is required"
+	case strings.HasPrefix(p, "/"):
+		return fmt.Sprintf("must be relative, not %q", p)
+	case path.Clean(p) == ".." || strings.HasPrefix(path.Clean(p), "../"):
+		return fmt.Sprintf("must stay inside its directory, not %q", p)
+	}
+	return ""
+}
+
+func regularFile(dir, p string) string {
+	if dir == "" {
+		return ""
+	}
+	info, err := os.Stat(filepath.Join(dir, filepath.FromSlash(p)))
+	if err != nil {
+		return fmt.Sprintf("%s is not in the extension", p)
+	}
+	if !info.Mode().IsRegular() {
+		return fmt.Sprintf("%s is not a file", p)
+	}
+	return ""
+}
+
+func reserved(name string) bool {
+	for _, r := range ReservedProcesses {
+		if name == r {
+			return true
+		}
+	}
+	return false
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
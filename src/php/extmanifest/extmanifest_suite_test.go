@@ -0,0 +1,13 @@
+package extmanifest_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestExtmanifest(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Extmanifest Suite")
+}
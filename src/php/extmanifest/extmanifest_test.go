@@ -0,0 +1,195 @@
+package extmanifest_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"php/extmanifest"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+)
+
+const valid = `
+api_version: 1
+name: ext
+`
+
+var _ = Describe("Load", func() {
+	It("reads a YAML manifest", func() {
+		m, err := extmanifest.Load(filepath.Join("testdata", "phpmyadmin"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(m.Name).To(Equal("phpmyadmin"))
+		Expect(m.Downloads).To(HaveLen(1))
+		Expect(m.Downloads[0].Extracts()).To(BeTrue())
+		Expect(m.Downloads[0].Strip).To(BeTrue())
+		Expect(m.ConfigFiles).To(Equal([]extmanifest.ConfigFile{{From: "config.inc.php", To: "htdocs/phpmyadmin/config.inc.php", Rewrite: true}}))
+		Expect(m.Env).To(Equal(map[string]string{"PMA_TEMP_DIR": "$HOME/tmp/phpmyadmin"}))
+		Expect(m.Processes).To(HaveKeyWithValue("sessions-gc", "php $HOME/htdocs/phpmyadmin/gc.php"))
+		Expect(m.ProfileD).To(Equal([]extmanifest.ProfileScript{
+			{Name: "tmp.sh", From: "profile.sh"},
+			{Name: "motd.sh", Script: `echo "phpMyAdmin is at /phpmyadmin"`},
+		}))
+	})
+
+	It("reads a JSON manifest", func() {
+		m, err := extmanifest.Load(filepath.Join("testdata", "json"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(m.Processes).To(Equal(map[string]string{"worker": "php $HOME/worker.php"}))
+	})
+
+	Context("in a directory of its own", func() {
+		var dir string
+
+		BeforeEach(func() {
+			var err error
+			dir, err = ioutil.TempDir("", "extmanifest")
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		AfterEach(func() {
+			os.RemoveAll(dir)
+		})
+
+		It("fails without a manifest", func() {
+			_, err := extmanifest.Load(dir)
+			Expect(err).To(MatchError(ContainSubstring("has no extension.yml, extension.yaml, extension.json")))
+		})
+
+		It("refuses more than one manifest", func() {
+			Expect(ioutil.WriteFile(filepath.Join(dir, "extension.yml"), []byte(valid), 0644)).To(Succeed())
+			Expect(ioutil.WriteFile(filepath.Join(dir, "extension.json"), []byte(`{"api_version": 1, "name": "ext"}`), 0644)).To(Succeed())
+			_, err := extmanifest.Load(dir)
+			Expect(err).To(MatchError(ContainSubstring("more than one manifest: extension.yml, extension.json")))
+		})
+
+		It("looks up the files it copies in the extension", func() {
+			manifest := valid + "config_files:\n  - {from: missing.conf, to: missing.conf}\n"
+			Expect(ioutil.WriteFile(filepath.Join(dir, "extension.yml"), []byte(manifest), 0644)).To(Succeed())
+			_, err := extmanifest.Load(dir)
+			Expect(err).To(MatchError("config_files[0].from: missing.conf is not in the extension"))
+		})
+	})
+})
+
+var _ = Describe("Parse", func() {
+	DescribeTable("the api_version",
+		func(manifest string, isJSON bool, expected string) {
+			_, err := extmanifest.Parse([]byte(manifest), isJSON)
+			Expect(err).To(MatchError(expected))
+		},
+		Entry("is required", "name: ext\n", false, "api_version: is required, this buildpack supports 1 to 1"),
+		Entry("is a number", "api_version: one\n", false, `api_version: must be a number, not "one"`),
+		Entry("is whole", `{"api_version": 1.5}`, true, "api_version: must be a whole number, not 1.5"),
+		Entry("starts at 1", "api_version: 0\n", false, "api_version: must be 1 to 1, not 0"),
+		Entry("asks for a newer buildpack before looking at the keys", "api_version: 2\nname: ext\nhooks: {}\n", false, "api_version: 2 needs a newer buildpack, this one supports 1 to 1"),
+	)
+
+	It("rejects unknown keys", func() {
+		_, err := extmanifest.Parse([]byte(valid+"proccesses: {}\n"), false)
+		Expect(err).To(MatchError(ContainSubstring("field proccesses not found")))
+
+		_, err = extmanifest.Parse([]byte(`{"api_version": 1, "name": "ext", "enviroment": {}}`), true)
+		Expect(err).To(MatchError(ContainSubstring(`unknown field "enviroment"`)))
+	})
+
+	It("reads YAML scalars as strings", func() {
+		m, err := extmanifest.Parse([]byte(valid+"env:\n  PORT: 8080\n  DEBUG: true\n"), false)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(m.Env).To(Equal(map[string]string{"PORT": "8080", "DEBUG": "true"}))
+	})
+})
+
+var _ = Describe("Validate", func() {
+	validate := func(manifest string) []string {
+		m, err := extmanifest.Parse([]byte(valid+manifest), false)
+		Expect(err).NotTo(HaveOccurred())
+		err = m.Validate("")
+		if err == nil {
+			return nil
+		}
+		var messages []string
+		for _, e := range err.(extmanifest.Errors) {
+			messages = append(messages, e.Error())
+		}
+		return messages
+	}
+
+	It("accepts a manifest which only names the extension", func() {
+		Expect(validate("")).To(BeEmpty())
+	})
+
+	It("checks the name", func() {
+		m := extmanifest.Manifest{APIVersion: 1, Name: "My Extension"}
+		Expect(m.Validate("")).To(MatchError(`name: must be lower case letters, digits, - and _, not "My Extension"`))
+	})
+
+	It("reports every problem of the downloads", func() {
+		Expect(validate(`
+downloads:
+  - url: ftp://example.com/agent.tgz
+    sha256: 2C1E
+    to: /opt/agent
+  - url: https://example.com/agent.phar
+    sha256: 2c1e7ad8cb1a4fa4cbe1e1b6e2f0f3f8d1f6e3a2e7c9a9b2c1d4e5f60718293a
+    to: lib/../../agent
+    extract: false
+    strip: true
+  - url: https://example.com/agent.tgz
+    sha256: 2c1e7ad8cb1a4fa4cbe1e1b6e2f0f3f8d1f6e3a2e7c9a9b2c1d4e5f60718293a
+`)).To(Equal([]string{
+			`downloads[0].url: must be an http or https URL, not "ftp://example.com/agent.tgz"`,
+			`downloads[0].sha256: must be the 64 lower case hex digits of the SHA-256 of the file, not "2C1E"`,
+			`downloads[0].to: must be relative, not "/opt/agent"`,
+			`downloads[1].to: must stay inside its directory, not "lib/../../agent"`,
+			`downloads[1].strip: only applies to extracted archives`,
+			`downloads[2].to: is required`,
+		}))
+	})
+
+	It("keeps config files inside the extension and the app", func() {
+		Expect(validate(`
+config_files:
+  - from: ../secrets.conf
+    to: etc/secrets.conf
+  - from: app.conf
+`)).To(Equal([]string{
+			`config_files[0].from: must stay inside its directory, not "../secrets.conf"`,
+			`config_files[1].to: is required`,
+		}))
+	})
+
+	It("checks the environment variable names", func() {
+		Expect(validate("env:\n  1PASSWORD: x\n  AGENT_HOME: $HOME/agent\n")).To(Equal([]string{
+			`env: "1PASSWORD" is not a valid environment variable name`,
+		}))
+	})
+
+	It("keeps the processes of the buildpack", func() {
+		Expect(validate("processes:\n  php-fpm: php-fpm -F\n  Worker: php worker.php\n  cron: ' '\n")).To(Equal([]string{
+			"processes.Worker: names must be lower case letters, digits, - and _",
+			"processes.cron: is started by the buildpack, pick another name",
+			"processes.cron: the command is empty",
+			"processes.php-fpm: is started by the buildpack, pick another name",
+		}))
+	})
+
+	It("needs one source for each profile.d script", func() {
+		Expect(validate(`
+profile_d:
+  - name: agent
+    script: export AGENT=1
+  - name: agent.sh
+  - name: agent.sh
+    from: agent.sh
+    script: export AGENT=1
+`)).To(Equal([]string{
+			`profile_d[0].name: must be a file name ending in .sh, not "agent"`,
+			"profile_d[1]: needs either from or script",
+			`profile_d[2].name: "agent.sh" is listed twice`,
+			"profile_d[2]: needs either from or script",
+		}))
+	})
+})
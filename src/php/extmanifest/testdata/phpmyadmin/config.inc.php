@@ -0,0 +1,3 @@
+<?php
+$cfg['TempDir'] = getenv('PMA_TEMP_DIR');
+$cfg['Servers'][1]['host'] = '#{PMA_HOST}';
@@ -0,0 +1 @@
+mkdir -p "$PMA_TEMP_DIR"
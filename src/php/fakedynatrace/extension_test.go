@@ -0,0 +1,178 @@
+package fakedynatrace_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"php/fakedynatrace"
+
+	"github.com/cloudfoundry/libbuildpack/cutlass"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Dynatrace extension", func() {
+	var (
+		server   *fakedynatrace.Server
+		buildDir string
+	)
+
+	BeforeEach(func() {
+		for _, tool := range []string{"python2", "sh", "sed", "base64", "tar"} {
+			if _, err := exec.LookPath(tool); err != nil {
+				Skip(tool + " is not available")
+			}
+		}
+
+		server = fakedynatrace.New("TOKEN")
+
+		var err error
+		buildDir, err = ioutil.TempDir("", "fakedynatrace")
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		if server != nil {
+			server.Close()
+		}
+		os.RemoveAll(buildDir)
+	})
+
+	stage := func(env ...string) (string, error) {
+		bpDir, err := cutlass.FindRoot()
+		Expect(err).NotTo(HaveOccurred())
+
+		cmd := exec.Command("python2", filepath.Join("testdata", "paas_agent.py"), bpDir, buildDir)
+		cmd.Env = append(os.Environ(),
+			"PYTHONDONTWRITEBYTECODE=1",
+			"DYNATRACE_API_URL="+server.URL,
+			"DYNATRACE_API_TOKEN=TOKEN",
+			"DYNATRACE_SKIPERRORS=",
+		)
+		cmd.Env = append(cmd.Env, env...)
+		output, err := cmd.CombinedOutput()
+		return string(output), err
+	}
+
+	envFile := func() string {
+		return filepath.Join(buildDir, ".profile.d", "dynatrace-env.sh")
+	}
+
+	ldPreload := func() string {
+		env, err := ioutil.ReadFile(envFile())
+		Expect(err).NotTo(HaveOccurred())
+		for _, line := range strings.Split(string(env), "\n") {
+			if strings.HasPrefix(line, "export LD_PRELOAD=") {
+				return strings.Trim(strings.TrimPrefix(line, "export LD_PRELOAD="), `"`)
+			}
+		}
+		Fail("LD_PRELOAD is not set in dynatrace-env.sh:\n" + string(env))
+		return ""
+	}
+
+	sleeps := func(output string) []string {
+		var waits []string
+		for _, line := range strings.Split(output, "\n") {
+			if strings.HasPrefix(line, "sleep ") {
+				waits = append(waits, strings.TrimPrefix(line, "sleep "))
+			}
+		}
+		return waits
+	}
+
+	It("downloads and installs the agent from the manifest.json path", func() {
+		output, err := stage()
+		Expect(err).NotTo(HaveOccurred(), output)
+		Expect(output).To(ContainSubstring("Found one matching Dynatrace service"))
+		Expect(output).To(ContainSubstring("Dynatrace OneAgent installed to " + filepath.Join(buildDir, "dynatrace", "oneagent")))
+		Expect(output).To(ContainSubstring("Using manifest.json"))
+		Expect(sleeps(output)).To(BeEmpty())
+
+		Expect(server.Requests()).To(Equal([]fakedynatrace.Request{{
+			Path:    fakedynatrace.InstallerPath,
+			Token:   "TOKEN",
+			Bitness: "64",
+			Include: []string{"php", "nginx", "apache"},
+		}}))
+		Expect(filepath.Join(buildDir, "dynatrace", "paasInstaller.sh")).NotTo(BeAnExistingFile())
+		Expect(filepath.Join(buildDir, "dynatrace", "oneagent", "dynatrace-env.sh")).NotTo(BeAnExistingFile())
+
+		Expect(ldPreload()).To(Equal("/home/vcap/app/dynatrace/oneagent/agent/bin/linux-x86-64/liboneagentloader.so"))
+		env, err := ioutil.ReadFile(envFile())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(env)).To(HavePrefix("export DT_TENANT=envid\n"))
+		Expect(string(env)).To(HaveSuffix("\nexport DT_HOST_ID=php-app_${CF_INSTANCE_INDEX}"))
+	})
+
+	It("retries failed downloads with a growing wait", func() {
+		server.Fail(http.StatusInternalServerError, http.StatusServiceUnavailable)
+
+		output, err := stage()
+		Expect(err).NotTo(HaveOccurred(), output)
+		Expect(output).To(ContainSubstring("Error during installer download, retrying in 4 seconds"))
+		Expect(output).To(ContainSubstring("Error during installer download, retrying in 5 seconds"))
+		Expect(sleeps(output)).To(Equal([]string{"4", "5"}))
+		Expect(server.Requests()).To(HaveLen(3))
+		Expect(ldPreload()).To(HaveSuffix("/liboneagentloader.so"))
+	})
+
+	It("fails staging after three failed downloads", func() {
+		server.Fail(http.StatusInternalServerError, http.StatusBadGateway, http.StatusServiceUnavailable)
+
+		output, err := stage()
+		Expect(err).To(HaveOccurred(), output)
+		Expect(sleeps(output)).To(Equal([]string{"4", "5", "7"}))
+		Expect(output).To(ContainSubstring("ERROR: Dynatrace agent download failed"))
+		Expect(output).To(ContainSubstring("HTTP Error 503"))
+		Expect(server.Requests()).To(HaveLen(3))
+		Expect(envFile()).NotTo(BeAnExistingFile())
+	})
+
+	It("fails staging with a rejected token", func() {
+		output, err := stage("DYNATRACE_API_TOKEN=OTHER")
+		Expect(err).To(HaveOccurred(), output)
+		Expect(output).To(ContainSubstring("HTTP Error 401"))
+		Expect(server.Requests()).To(HaveLen(3))
+	})
+
+	It("skips the agent after three failed downloads with skiperrors", func() {
+		server.Fail(http.StatusInternalServerError, http.StatusInternalServerError, http.StatusInternalServerError)
+
+		output, err := stage("DYNATRACE_SKIPERRORS=true")
+		Expect(err).NotTo(HaveOccurred(), output)
+		Expect(sleeps(output)).To(Equal([]string{"4", "5", "7"}))
+		Expect(output).To(ContainSubstring("Error during installer download, skipping installation"))
+		Expect(output).NotTo(ContainSubstring("Extracting Dynatrace PAAS-Agent"))
+		Expect(filepath.Join(buildDir, "dynatrace", "oneagent")).NotTo(BeADirectory())
+		Expect(envFile()).NotTo(BeAnExistingFile())
+	})
+
+	DescribeTable("falls back to the default agent path",
+		func(manifest *fakedynatrace.Manifest) {
+			server.SetAgent(fakedynatrace.Agent{Manifest: manifest, Env: "export DT_TENANT=envid\n"})
+
+			output, err := stage()
+			Expect(err).NotTo(HaveOccurred(), output)
+			Expect(output).To(ContainSubstring("Agent path not found in manifest.json, using fallback"))
+			Expect(output).NotTo(ContainSubstring("Using manifest.json"))
+			Expect(ldPreload()).To(Equal("/home/vcap/app/dynatrace/oneagent/" + fakedynatrace.FallbackAgentPath))
+			Expect(filepath.Join(buildDir, "dynatrace", "oneagent", fakedynatrace.FallbackAgentPath)).To(BeARegularFile())
+		},
+		Entry("without manifest.json", nil),
+		Entry("without the process technology", &fakedynatrace.Manifest{
+			Technologies: map[string]map[string][]fakedynatrace.Binary{
+				"java": {"linux-x86-64": {{Path: "agent/lib64/liboneagentjava.so", BinaryType: "primary"}}},
+			},
+		}),
+		Entry("without a primary binary", &fakedynatrace.Manifest{
+			Technologies: map[string]map[string][]fakedynatrace.Binary{
+				"process": {"linux-x86-64": {{Path: "agent/conf/ruxitagentproc.conf"}}},
+			},
+		}),
+	)
+})
@@ -0,0 +1,245 @@
+// Package fakedynatrace is a local stand-in for the Dynatrace API endpoint
+// which serves the PaaS installer of OneAgent, so the download, retry and
+// LD_PRELOAD handling of the dynatrace extension can be exercised without
+// network access or a Dynatrace environment.
+//
+// The installer it serves is a shell script, like the real one, which
+// unpacks a generated OneAgent into <build dir>/dynatrace/oneagent.
+package fakedynatrace
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// InstallerPath is the API path of the PaaS installer for unix.
+const InstallerPath = "/v1/deployment/installer/agent/unix/paas-sh/latest"
+
+// FallbackAgentPath is where the extension looks for the agent when
+// manifest.json does not name it.
+const FallbackAgentPath = "agent/lib64/liboneagentproc.so"
+
+// Binary is an entry of a technology in manifest.json.
+type Binary struct {
+	Path       string `json:"path"`
+	BinaryType string `json:"binarytype,omitempty"`
+}
+
+// Manifest is the manifest.json shipped with the agent, listing the binaries
+// of each technology by platform.
+type Manifest struct {
+	Technologies map[string]map[string][]Binary `json:"technologies"`
+}
+
+// PrimaryManifest lists path as the primary binary of the process technology.
+func PrimaryManifest(path string) *Manifest {
+	return &Manifest{Technologies: map[string]map[string][]Binary{
+		"process": {"linux-x86-64": {
+			{Path: "agent/conf/ruxitagentproc.conf"},
+			{Path: path, BinaryType: "primary"},
+		}},
+	}}
+}
+
+// Agent describes the OneAgent the installer unpacks.
+type Agent struct {
+	// Manifest is written as manifest.json, unless it is nil.
+	Manifest *Manifest
+	// Env is the content of dynatrace-env.sh.
+	Env string
+}
+
+// Files returns the files of the agent by their path below oneagent/. The
+// primary binary named by the manifest, or the fallback binary without
+// one, is always included.
+func (a Agent) Files() (map[string]string, error) {
+	files := map[string]string{
+		"dynatrace-env.sh":  a.Env,
+		FallbackAgentPath:   "fallback agent\n",
+		"agent/conf/README": "fake OneAgent\n",
+	}
+	if a.Manifest == nil {
+		return files, nil
+	}
+	manifest, err := json.MarshalIndent(a.Manifest, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	files["manifest.json"] = string(manifest)
+	for _, binaries := range a.Manifest.Technologies["process"] {
+		for _, binary := range binaries {
+			if binary.BinaryType == "primary" {
+				files[binary.Path] = "primary agent\n"
+			}
+		}
+	}
+	return files, nil
+}
+
+// Installer returns the shell script which unpacks the agent into
+// $1/dynatrace/oneagent.
+func (a Agent) Installer() ([]byte, error) {
+	files, err := a.Files()
+	if err != nil {
+		return nil, err
+	}
+	tarball, err := tarGz(files)
+	if err != nil {
+		return nil, err
+	}
+	script := bytes.NewBufferString(`#!/bin/sh
+set -e
+target="$1/dynatrace/oneagent"
+mkdir -p "$target"
+sed '1,/^__ARCHIVE__$/d' "$0" | base64 -d | tar xzf - -C "$target"
+echo "Dynatrace OneAgent installed to $target"
+exit 0
+__ARCHIVE__
+`)
+	encoded := base64.StdEncoding.EncodeToString(tarball)
+	for len(encoded) > 76 {
+		script.WriteString(encoded[:76] + "\n")
+		encoded = encoded[76:]
+	}
+	script.WriteString(encoded + "\n")
+	return script.Bytes(), nil
+}
+
+func tarGz(files map[string]string) ([]byte, error) {
+	var paths []string
+	for path := range files {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for _, path := range paths {
+		hdr := &tar.Header{Name: path, Mode: 0644, Size: int64(len(files[path]))}
+		if strings.HasSuffix(path, ".so") {
+			hdr.Mode = 0755
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return nil, err
+		}
+		if _, err := tw.Write([]byte(files[path])); err != nil {
+			return nil, err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	if err := gz.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Request records a single call made against the server.
+type Request struct {
+	Path    string
+	Token   string
+	Bitness string
+	Include []string
+}
+
+type Server struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	token    string
+	agent    Agent
+	failures []int
+	requests []Request
+}
+
+// New starts a server which accepts token and serves an agent with a
+// manifest.json naming its primary binary. Call Close when done.
+func New(token string) *Server {
+	s := &Server{
+		token: token,
+		agent: Agent{
+			Manifest: PrimaryManifest("agent/bin/linux-x86-64/liboneagentloader.so"),
+			Env:      "export DT_TENANT=envid\nexport DT_CONNECTION_POINT=\"https://envid.live.dynatrace.com\"\n",
+		},
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	return s
+}
+
+// SetAgent changes the agent the installer unpacks.
+func (s *Server) SetAgent(agent Agent) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.agent = agent
+}
+
+// Fail answers the next requests for the installer with statuses, one per
+// request and in order, before serving it again.
+func (s *Server) Fail(statuses ...int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures = append(s.failures, statuses...)
+}
+
+func (s *Server) Requests() []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Request{}, s.requests...)
+}
+
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	token := query.Get("Api-Token")
+	if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Api-Token ") {
+		token = strings.TrimPrefix(auth, "Api-Token ")
+	}
+
+	s.mu.Lock()
+	s.requests = append(s.requests, Request{
+		Path:    r.URL.Path,
+		Token:   token,
+		Bitness: query.Get("bitness"),
+		Include: query["include"],
+	})
+	status := 0
+	if r.URL.Path == InstallerPath && len(s.failures) > 0 {
+		status, s.failures = s.failures[0], s.failures[1:]
+	}
+	agent := s.agent
+	s.mu.Unlock()
+
+	switch {
+	case r.URL.Path != InstallerPath:
+		writeError(w, http.StatusNotFound, "Not Found")
+	case token != s.token:
+		writeError(w, http.StatusUnauthorized, "Token Authentication failed")
+	case status != 0:
+		writeError(w, status, http.StatusText(status))
+	default:
+		installer, err := agent.Installer()
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Write(installer)
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"error": map[string]interface{}{"code": status, "message": message},
+	})
+}
@@ -0,0 +1,13 @@
+package fakedynatrace_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestFakedynatrace(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Fakedynatrace Suite")
+}
@@ -0,0 +1,112 @@
+package fakedynatrace_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"php/fakedynatrace"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Fake Dynatrace API", func() {
+	var server *fakedynatrace.Server
+
+	BeforeEach(func() { server = fakedynatrace.New("TOKEN") })
+	AfterEach(func() { server.Close() })
+
+	get := func(path string) (int, []byte) {
+		resp, err := http.Get(server.URL + path)
+		Expect(err).NotTo(HaveOccurred())
+		defer resp.Body.Close()
+		body, err := ioutil.ReadAll(resp.Body)
+		Expect(err).NotTo(HaveOccurred())
+		return resp.StatusCode, body
+	}
+
+	installer := fakedynatrace.InstallerPath + "?Api-Token=TOKEN&bitness=64&include=php&include=nginx"
+
+	It("serves the installer and records the request", func() {
+		status, body := get(installer)
+		Expect(status).To(Equal(http.StatusOK))
+		Expect(string(body)).To(HavePrefix("#!/bin/sh\n"))
+		Expect(server.Requests()).To(Equal([]fakedynatrace.Request{{
+			Path:    fakedynatrace.InstallerPath,
+			Token:   "TOKEN",
+			Bitness: "64",
+			Include: []string{"php", "nginx"},
+		}}))
+	})
+
+	It("rejects other tokens", func() {
+		status, body := get(fakedynatrace.InstallerPath + "?Api-Token=OTHER")
+		Expect(status).To(Equal(http.StatusUnauthorized))
+		Expect(string(body)).To(ContainSubstring("Token Authentication failed"))
+	})
+
+	It("answers unknown paths with not found", func() {
+		status, _ := get("/v1/deployment/installer/agent/windows/default/latest?Api-Token=TOKEN")
+		Expect(status).To(Equal(http.StatusNotFound))
+	})
+
+	It("fails requests in order before serving the installer again", func() {
+		server.Fail(http.StatusInternalServerError, http.StatusServiceUnavailable)
+
+		var statuses []int
+		for i := 0; i < 3; i++ {
+			status, _ := get(installer)
+			statuses = append(statuses, status)
+		}
+		Expect(statuses).To(Equal([]int{500, 503, 200}))
+	})
+
+	Describe("Agent", func() {
+		It("lists the primary binary named by the manifest", func() {
+			files, err := fakedynatrace.Agent{Manifest: fakedynatrace.PrimaryManifest("agent/bin/primary.so")}.Files()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(files).To(HaveKey("manifest.json"))
+			Expect(files).To(HaveKey("agent/bin/primary.so"))
+			Expect(files).To(HaveKey(fakedynatrace.FallbackAgentPath))
+		})
+
+		It("leaves out manifest.json without a manifest", func() {
+			files, err := fakedynatrace.Agent{}.Files()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(files).NotTo(HaveKey("manifest.json"))
+			Expect(files).To(HaveKey("dynatrace-env.sh"))
+		})
+
+		It("builds an installer which unpacks the agent", func() {
+			for _, tool := range []string{"sh", "sed", "base64", "tar"} {
+				if _, err := exec.LookPath(tool); err != nil {
+					Skip(tool + " is not available")
+				}
+			}
+			dir, err := ioutil.TempDir("", "fakedynatrace")
+			Expect(err).NotTo(HaveOccurred())
+			defer os.RemoveAll(dir)
+
+			script, err := fakedynatrace.Agent{
+				Manifest: fakedynatrace.PrimaryManifest("agent/bin/primary.so"),
+				Env:      "export DT_TENANT=envid\n",
+			}.Installer()
+			Expect(err).NotTo(HaveOccurred())
+			path := filepath.Join(dir, "paasInstaller.sh")
+			Expect(ioutil.WriteFile(path, script, 0755)).To(Succeed())
+
+			output, err := exec.Command(path, dir).CombinedOutput()
+			Expect(err).NotTo(HaveOccurred(), string(output))
+
+			oneagent := filepath.Join(dir, "dynatrace", "oneagent")
+			Expect(filepath.Join(oneagent, "agent", "bin", "primary.so")).To(BeARegularFile())
+			Expect(filepath.Join(oneagent, "manifest.json")).To(BeARegularFile())
+			env, err := ioutil.ReadFile(filepath.Join(oneagent, "dynatrace-env.sh"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(env)).To(Equal("export DT_TENANT=envid\n"))
+		})
+	})
+})
@@ -0,0 +1,59 @@
+# Stages the dynatrace extension against the API at DYNATRACE_API_URL, as
+# bound through a user-provided service.
+#
+#   python paas_agent.py <buildpack dir> <build dir>
+#
+# Waits between download attempts are printed instead of slept.
+import json
+import logging
+import os
+import sys
+
+bp_dir = os.path.abspath(sys.argv[1])
+sys.path.insert(0, os.path.join(bp_dir, 'lib'))
+
+from build_pack_utils import utils
+
+logging.basicConfig(stream=sys.stdout, level=logging.INFO,
+                    format='%(levelname)s %(message)s')
+
+extension = utils.load_extension(os.path.join(bp_dir, 'extensions',
+                                              'dynatrace'))
+
+
+def sleep(seconds):
+    print('sleep %s' % seconds)
+extension.time.sleep = sleep
+
+
+class Builder(object):
+    def __init__(self, ctx):
+        self._ctx = ctx
+
+
+class Installer(object):
+    def __init__(self, ctx):
+        self.builder = Builder(ctx)
+
+
+credentials = {
+    'apiurl': os.environ['DYNATRACE_API_URL'],
+    'environmentid': 'envid',
+    'apitoken': os.environ['DYNATRACE_API_TOKEN']
+}
+if os.environ.get('DYNATRACE_SKIPERRORS'):
+    credentials['skiperrors'] = os.environ['DYNATRACE_SKIPERRORS']
+
+ctx = utils.FormattedDict({
+    'BP_DIR': bp_dir,
+    'BUILD_DIR': sys.argv[2],
+    'HOME': '/home/vcap',
+    'PHP_VM': 'php',
+    'VCAP_APPLICATION': {'name': 'php-app'},
+    'VCAP_SERVICES': {'user-provided': [{
+        'name': 'dynatrace-service',
+        'label': 'user-provided',
+        'credentials': credentials
+    }]}
+})
+extension.compile(Installer(ctx))
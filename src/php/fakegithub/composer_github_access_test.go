@@ -0,0 +1,102 @@
+package fakegithub_test
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"php/fakegithub"
+
+	"github.com/cloudfoundry/libbuildpack/cutlass"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Composer extension GitHub access", func() {
+	var (
+		server   *fakegithub.Server
+		buildDir string
+	)
+
+	BeforeEach(func() {
+		for _, tool := range []string{"python2", "curl"} {
+			if _, err := exec.LookPath(tool); err != nil {
+				Skip(tool + " is not available")
+			}
+		}
+
+		server = fakegithub.New()
+		server.AddToken("valid-token", 5000, 5000)
+		server.AddToken("exhausted-token", 5000, 0)
+
+		var err error
+		buildDir, err = ioutil.TempDir("", "fakegithub")
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		if server != nil {
+			server.Close()
+		}
+		os.RemoveAll(buildDir)
+	})
+
+	stage := func(token string) string {
+		bpDir, err := cutlass.FindRoot()
+		Expect(err).NotTo(HaveOccurred())
+
+		cmd := exec.Command("python2", filepath.Join("testdata", "github_access.py"), bpDir, buildDir)
+		cmd.Env = append(os.Environ(),
+			"PYTHONDONTWRITEBYTECODE=1",
+			"COMPOSER_GITHUB_API_URL="+server.URL,
+			"COMPOSER_GITHUB_OAUTH_TOKEN="+token,
+		)
+		output, err := cmd.CombinedOutput()
+		Expect(err).NotTo(HaveOccurred(), string(output))
+		return string(output)
+	}
+
+	It("configures composer with a valid token", func() {
+		output := stage("valid-token")
+		Expect(output).To(ContainSubstring("-----> Using custom GitHub OAuth token in $COMPOSER_GITHUB_OAUTH_TOKEN"))
+		Expect(output).To(ContainSubstring(`composer config -g github-oauth.github.com "valid-token"`))
+		Expect(output).NotTo(ContainSubstring("rate limit has been exceeded"))
+		Expect(server.Requests()).To(Equal([]fakegithub.Request{
+			{Method: "GET", Path: "/rate_limit", Token: "valid-token"},
+			{Method: "GET", Path: "/rate_limit", Token: "valid-token"},
+		}))
+	})
+
+	It("reports an invalid token and falls back to anonymous access", func() {
+		output := stage("bad-token")
+		Expect(output).To(ContainSubstring("-----> The GitHub OAuth token supplied from $COMPOSER_GITHUB_OAUTH_TOKEN is invalid"))
+		Expect(output).NotTo(ContainSubstring("composer config"))
+		Expect(server.Requests()).To(Equal([]fakegithub.Request{
+			{Method: "GET", Path: "/rate_limit", Token: "bad-token"},
+			{Method: "GET", Path: "/rate_limit"},
+		}))
+	})
+
+	It("warns when a valid token is rate limited", func() {
+		output := stage("exhausted-token")
+		Expect(output).To(ContainSubstring("-----> Using custom GitHub OAuth token"))
+		Expect(output).To(ContainSubstring("-----> The GitHub api rate limit has been exceeded."))
+	})
+
+	It("warns when anonymous access is rate limited", func() {
+		server.SetAnonymousLimit(60, 0)
+
+		output := stage("")
+		Expect(output).NotTo(ContainSubstring("Using custom GitHub OAuth token"))
+		Expect(output).To(ContainSubstring("-----> The GitHub api rate limit has been exceeded."))
+		Expect(server.Requests()).To(Equal([]fakegithub.Request{
+			{Method: "GET", Path: "/rate_limit"},
+		}))
+	})
+
+	It("does not warn while anonymous requests remain", func() {
+		output := stage("")
+		Expect(output).NotTo(ContainSubstring("rate limit has been exceeded"))
+	})
+})
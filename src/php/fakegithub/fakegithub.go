@@ -0,0 +1,155 @@
+// Package fakegithub is a local stand-in for the parts of the GitHub API the
+// composer extension talks to, so the token and rate limit handling can be
+// exercised without network access or a real OAuth token.
+package fakegithub
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const documentationURL = "https://developer.github.com/v3"
+
+// Limit is the rate limit reported for a token, or for anonymous requests.
+type Limit struct {
+	Limit     int
+	Remaining int
+	Reset     time.Time
+}
+
+// Request records a single call made against the server.
+type Request struct {
+	Method string
+	Path   string
+	Token  string
+}
+
+type Server struct {
+	*httptest.Server
+
+	mu        sync.Mutex
+	tokens    map[string]*Limit
+	anonymous *Limit
+	requests  []Request
+}
+
+// New starts a server which only knows anonymous access, limited to 60
+// requests per hour like the real API. Call Close when done.
+func New() *Server {
+	s := &Server{
+		tokens:    map[string]*Limit{},
+		anonymous: newLimit(60, 60),
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	return s
+}
+
+// AddToken registers a valid token with its own rate limit. Any token which
+// was not added is rejected as bad credentials.
+func (s *Server) AddToken(token string, limit, remaining int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tokens[token] = newLimit(limit, remaining)
+}
+
+// SetAnonymousLimit changes the rate limit applied to unauthenticated requests.
+func (s *Server) SetAnonymousLimit(limit, remaining int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.anonymous = newLimit(limit, remaining)
+}
+
+func (s *Server) Requests() []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Request{}, s.requests...)
+}
+
+func newLimit(limit, remaining int) *Limit {
+	return &Limit{Limit: limit, Remaining: remaining, Reset: time.Now().Add(time.Hour).Truncate(time.Second)}
+}
+
+// tokenFrom accepts both the `token` and `Bearer` authorization schemes.
+func tokenFrom(r *http.Request) string {
+	auth := strings.TrimSpace(r.Header.Get("Authorization"))
+	for _, scheme := range []string{"token ", "Bearer "} {
+		if strings.HasPrefix(auth, scheme) {
+			return strings.TrimSpace(strings.TrimPrefix(auth, scheme))
+		}
+	}
+	return ""
+}
+
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) {
+	token := tokenFrom(r)
+
+	s.mu.Lock()
+	s.requests = append(s.requests, Request{Method: r.Method, Path: r.URL.Path, Token: token})
+	limit := s.anonymous
+	if token != "" {
+		limit = s.tokens[token]
+	}
+	var current Limit
+	if limit != nil {
+		current = *limit
+		// like GitHub, querying the rate limit itself is free
+		if r.URL.Path != "/rate_limit" && limit.Remaining > 0 {
+			limit.Remaining--
+		}
+	}
+	s.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	if limit == nil {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{
+			"message":           "Bad credentials",
+			"documentation_url": documentationURL,
+		})
+		return
+	}
+
+	w.Header().Set("X-RateLimit-Limit", strconv.Itoa(current.Limit))
+	w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(current.Remaining))
+	w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(current.Reset.Unix(), 10))
+
+	switch {
+	case r.URL.Path == "/rate_limit":
+		rate := map[string]int64{
+			"limit":     int64(current.Limit),
+			"remaining": int64(current.Remaining),
+			"reset":     current.Reset.Unix(),
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"resources": map[string]interface{}{"core": rate},
+			"rate":      rate,
+		})
+	case current.Remaining <= 0:
+		writeJSON(w, http.StatusForbidden, map[string]string{
+			"message":           fmt.Sprintf("API rate limit exceeded for %s.", clientName(r, token)),
+			"documentation_url": documentationURL + "/#rate-limiting",
+		})
+	default:
+		writeJSON(w, http.StatusNotFound, map[string]string{
+			"message":           "Not Found",
+			"documentation_url": documentationURL,
+		})
+	}
+}
+
+func clientName(r *http.Request, token string) string {
+	if token != "" {
+		return "this token"
+	}
+	return strings.Split(r.RemoteAddr, ":")[0]
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
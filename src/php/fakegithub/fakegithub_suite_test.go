@@ -0,0 +1,13 @@
+package fakegithub_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestFakegithub(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Fakegithub Suite")
+}
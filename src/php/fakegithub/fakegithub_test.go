@@ -0,0 +1,84 @@
+package fakegithub_test
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"php/fakegithub"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Fake GitHub API", func() {
+	var server *fakegithub.Server
+
+	BeforeEach(func() {
+		server = fakegithub.New()
+		server.AddToken("valid-token", 5000, 4999)
+		server.AddToken("exhausted-token", 5000, 0)
+	})
+	AfterEach(func() { server.Close() })
+
+	get := func(path, token string) (*http.Response, map[string]interface{}) {
+		req, err := http.NewRequest("GET", server.URL+path, nil)
+		Expect(err).NotTo(HaveOccurred())
+		if token != "" {
+			req.Header.Set("Authorization", "token "+token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		Expect(err).NotTo(HaveOccurred())
+		defer resp.Body.Close()
+
+		body := map[string]interface{}{}
+		Expect(json.NewDecoder(resp.Body).Decode(&body)).To(Succeed())
+		return resp, body
+	}
+
+	It("reports the rate limit of a valid token", func() {
+		resp, body := get("/rate_limit", "valid-token")
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+		Expect(resp.Header.Get("X-RateLimit-Limit")).To(Equal("5000"))
+		Expect(resp.Header.Get("X-RateLimit-Remaining")).To(Equal("4999"))
+		Expect(resp.Header.Get("X-RateLimit-Reset")).NotTo(BeEmpty())
+		Expect(body).To(HaveKey("resources"))
+		Expect(body["rate"]).To(HaveKeyWithValue("remaining", BeNumerically("==", 4999)))
+	})
+
+	It("rejects an unknown token as bad credentials", func() {
+		resp, body := get("/rate_limit", "bad-token")
+		Expect(resp.StatusCode).To(Equal(http.StatusUnauthorized))
+		Expect(resp.Header.Get("X-RateLimit-Limit")).To(BeEmpty())
+		Expect(body).NotTo(HaveKey("resources"))
+		Expect(body).To(HaveKeyWithValue("message", "Bad credentials"))
+	})
+
+	It("applies the anonymous limit without a token", func() {
+		server.SetAnonymousLimit(60, 0)
+
+		resp, body := get("/rate_limit", "")
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+		Expect(resp.Header.Get("X-RateLimit-Limit")).To(Equal("60"))
+		Expect(body["rate"]).To(HaveKeyWithValue("remaining", BeNumerically("==", 0)))
+	})
+
+	It("refuses other calls once a token is rate limited", func() {
+		resp, body := get("/repos/composer/composer", "exhausted-token")
+		Expect(resp.StatusCode).To(Equal(http.StatusForbidden))
+		Expect(resp.Header.Get("X-RateLimit-Remaining")).To(Equal("0"))
+		Expect(body["message"]).To(ContainSubstring("API rate limit exceeded"))
+	})
+
+	It("counts calls other than rate_limit against the limit", func() {
+		get("/repos/composer/composer", "valid-token")
+		get("/rate_limit", "valid-token")
+		resp, _ := get("/rate_limit", "valid-token")
+		Expect(resp.Header.Get("X-RateLimit-Remaining")).To(Equal("4998"))
+
+		Expect(server.Requests()).To(Equal([]fakegithub.Request{
+			{Method: "GET", Path: "/repos/composer/composer", Token: "valid-token"},
+			{Method: "GET", Path: "/rate_limit", Token: "valid-token"},
+			{Method: "GET", Path: "/rate_limit", Token: "valid-token"},
+		}))
+	})
+})
@@ -0,0 +1,38 @@
+# Runs the GitHub token and rate limit checks of the composer extension
+# against the API at COMPOSER_GITHUB_API_URL.
+#
+#   python github_access.py <buildpack dir> <build dir>
+#
+# composer is not invoked; commands it would have run are printed instead.
+import os
+import sys
+
+bp_dir = os.path.abspath(sys.argv[1])
+sys.path.insert(0, os.path.join(bp_dir, 'lib'))
+
+from build_pack_utils import utils
+
+extension = utils.load_extension(os.path.join(bp_dir, 'extensions',
+                                              'composer'))
+extension.CompileExtensions.default_version_for = \
+    lambda self, manifest_file_path, dependency: (0, '1.6.3')
+
+
+class RecordingRunner(object):
+    def run(self, *args):
+        print('composer %s' % ' '.join(args))
+
+
+ctx = utils.FormattedDict({
+    'BP_DIR': bp_dir,
+    'BUILD_DIR': sys.argv[2],
+    'CACHE_DIR': sys.argv[2],
+    'TMPDIR': sys.argv[2],
+    'WEBDIR': 'htdocs',
+    'LIBDIR': 'lib',
+    'PHP_VM': 'php',
+    'COMPOSER_GITHUB_API_URL': os.environ['COMPOSER_GITHUB_API_URL']
+})
+composer = extension.ComposerExtension(ctx)
+composer.composer_runner = RecordingRunner()
+composer.setup_github_access()
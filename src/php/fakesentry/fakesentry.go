@@ -0,0 +1,164 @@
+// Package fakesentry is a local stand-in for the store endpoint of Sentry,
+// which the bootstrap of the sentry extension reports errors to, so the
+// reports can be checked without a Sentry account or network access.
+package fakesentry
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// Frame is a line of a stack trace, the oldest call first.
+type Frame struct {
+	Filename string `json:"filename"`
+	Lineno   int    `json:"lineno"`
+	Function string `json:"function"`
+}
+
+// Exception is an error or exception of an event.
+type Exception struct {
+	Type       string `json:"type"`
+	Value      string `json:"value"`
+	Stacktrace struct {
+		Frames []Frame `json:"frames"`
+	} `json:"stacktrace"`
+}
+
+// Event is a received report, with the fields the bootstrap sets.
+type Event struct {
+	EventID     string            `json:"event_id"`
+	Timestamp   string            `json:"timestamp"`
+	Platform    string            `json:"platform"`
+	Level       string            `json:"level"`
+	Release     string            `json:"release"`
+	Environment string            `json:"environment"`
+	ServerName  string            `json:"server_name"`
+	Tags        map[string]string `json:"tags"`
+	Exception   struct {
+		Values []Exception `json:"values"`
+	} `json:"exception"`
+	Request struct {
+		Method      string `json:"method"`
+		URL         string `json:"url"`
+		QueryString string `json:"query_string"`
+	} `json:"request"`
+
+	// Project and Key are taken from the URL and X-Sentry-Auth.
+	Project string `json:"-"`
+	Key     string `json:"-"`
+}
+
+var storePath = regexp.MustCompile(`^(.*)/api/([^/]+)/store/$`)
+
+type Server struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	projects map[string]string
+	events   []Event
+}
+
+// New starts a server which accepts events for project with the public key.
+// Call Close when done.
+func New(project, key string) *Server {
+	s := &Server{projects: map[string]string{project: key}}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	return s
+}
+
+// NewOn starts the server on listener, for reports from where the loopback
+// interface can't be reached, such as a container.
+func NewOn(listener net.Listener, project, key string) *Server {
+	s := &Server{projects: map[string]string{project: key}}
+	s.Server = httptest.NewUnstartedServer(http.HandlerFunc(s.serve))
+	s.Server.Listener.Close()
+	s.Server.Listener = listener
+	s.Server.Start()
+	return s
+}
+
+// DSN returns the DSN of a project, for SENTRY_DSN or the dsn credential of
+// a service.
+func (s *Server) DSN(project string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return strings.Replace(s.URL, "://", "://"+s.projects[project]+"@", 1) + "/" + project
+}
+
+// Events returns the events received so far, in order.
+func (s *Server) Events() []Event {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Event{}, s.events...)
+}
+
+// auth parses `Sentry sentry_version=7, sentry_key=..., ...`.
+func auth(header string) map[string]string {
+	fields := map[string]string{}
+	if !strings.HasPrefix(header, "Sentry ") {
+		return fields
+	}
+	for _, field := range strings.Split(strings.TrimPrefix(header, "Sentry "), ",") {
+		if kv := strings.SplitN(strings.TrimSpace(field), "=", 2); len(kv) == 2 {
+			fields[kv[0]] = kv[1]
+		}
+	}
+	return fields
+}
+
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) {
+	m := storePath.FindStringSubmatch(r.URL.Path)
+	if m == nil || m[1] != "" {
+		writeError(w, http.StatusNotFound, "not found")
+		return
+	}
+	if r.Method != "POST" {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	project := m[2]
+	fields := auth(r.Header.Get("X-Sentry-Auth"))
+
+	s.mu.Lock()
+	key, known := s.projects[project]
+	s.mu.Unlock()
+	switch {
+	case !known:
+		writeError(w, http.StatusNotFound, fmt.Sprintf("unknown project %q", project))
+		return
+	case fields["sentry_version"] != "7":
+		writeError(w, http.StatusBadRequest, "unsupported protocol version")
+		return
+	case fields["sentry_key"] != key:
+		writeError(w, http.StatusUnauthorized, "invalid api key")
+		return
+	}
+
+	var event Event
+	if err := json.NewDecoder(r.Body).Decode(&event); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	event.Project = project
+	event.Key = fields["sentry_key"]
+
+	s.mu.Lock()
+	s.events = append(s.events, event)
+	s.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"id": event.EventID})
+}
+
+func writeError(w http.ResponseWriter, status int, detail string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Sentry-Error", detail)
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"detail": detail})
+}
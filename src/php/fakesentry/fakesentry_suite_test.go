@@ -0,0 +1,13 @@
+package fakesentry_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestFakesentry(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Fakesentry Suite")
+}
@@ -0,0 +1,146 @@
+package fakesentry_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"php/fakesentry"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Fake Sentry", func() {
+	var server *fakesentry.Server
+
+	BeforeEach(func() { server = fakesentry.New("42", "public") })
+	AfterEach(func() { server.Close() })
+
+	store := func(path, auth, body string) *http.Response {
+		req, err := http.NewRequest("POST", server.URL+path, bytes.NewBufferString(body))
+		Expect(err).NotTo(HaveOccurred())
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Sentry-Auth", auth)
+		resp, err := http.DefaultClient.Do(req)
+		Expect(err).NotTo(HaveOccurred())
+		resp.Body.Close()
+		return resp
+	}
+
+	const event = `{"event_id": "fc6d8c0c43fc4630ad850ee518f1b9d0", "level": "error", "release": "shop@1",
+		"exception": {"values": [{"type": "RuntimeException", "value": "boom",
+		"stacktrace": {"frames": [{"filename": "/app/index.php", "lineno": 3, "function": "main"}]}}]}}`
+
+	It("builds the DSN of a project", func() {
+		Expect(server.DSN("42")).To(Equal("http://public@" + server.Listener.Addr().String() + "/42"))
+	})
+
+	It("records events", func() {
+		resp := store("/api/42/store/", "Sentry sentry_version=7, sentry_client=test/1.0, sentry_key=public", event)
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+
+		events := server.Events()
+		Expect(events).To(HaveLen(1))
+		Expect(events[0].Project).To(Equal("42"))
+		Expect(events[0].Key).To(Equal("public"))
+		Expect(events[0].Release).To(Equal("shop@1"))
+		Expect(events[0].Exception.Values).To(HaveLen(1))
+		Expect(events[0].Exception.Values[0].Type).To(Equal("RuntimeException"))
+		Expect(events[0].Exception.Values[0].Stacktrace.Frames).To(Equal([]fakesentry.Frame{
+			{Filename: "/app/index.php", Lineno: 3, Function: "main"},
+		}))
+	})
+
+	It("rejects other keys, projects and protocol versions", func() {
+		resp := store("/api/42/store/", "Sentry sentry_version=7, sentry_key=other", event)
+		Expect(resp.StatusCode).To(Equal(http.StatusUnauthorized))
+		Expect(resp.Header.Get("X-Sentry-Error")).To(Equal("invalid api key"))
+		Expect(store("/api/43/store/", "Sentry sentry_version=7, sentry_key=public", event).StatusCode).To(Equal(http.StatusNotFound))
+		Expect(store("/api/42/store/", "Sentry sentry_version=5, sentry_key=public", event).StatusCode).To(Equal(http.StatusBadRequest))
+		Expect(store("/api/42/envelope/", "Sentry sentry_version=7, sentry_key=public", event).StatusCode).To(Equal(http.StatusNotFound))
+		Expect(server.Events()).To(BeEmpty())
+	})
+
+	// set $PHP to a php binary, for example php/bin/php of a staged app,
+	// to run the bootstrap
+	Context("with php", func() {
+		var php string
+
+		BeforeEach(func() {
+			php = os.Getenv("PHP")
+			if php == "" {
+				php, _ = exec.LookPath("php")
+			}
+			if php == "" {
+				Skip("php is not available")
+			}
+		})
+
+		run := func(prepend string, env ...string) (string, error) {
+			abs, err := filepath.Abs(prepend)
+			Expect(err).NotTo(HaveOccurred())
+			cmd := exec.Command(php, "-n", "-d", "auto_prepend_file="+abs, "-d", "display_errors=stderr", "-d", "date.timezone=UTC", filepath.Join("testdata", "app.php"))
+			cmd.Env = append(os.Environ(), env...)
+			output, err := cmd.CombinedOutput()
+			return string(output), err
+		}
+
+		bootstrap := filepath.Join("..", "..", "..", "extensions", "sentry", "sentry.php")
+
+		It("reports warnings and the uncaught exception", func() {
+			output, err := run(bootstrap, "SENTRY_DSN="+server.DSN("42"), "SENTRY_RELEASE=shop@1+php-buildpack.4.3.51", "SENTRY_ENVIRONMENT=test")
+			Expect(err).To(HaveOccurred(), output)
+			Expect(output).To(ContainSubstring("payment of 42 declined"))
+			Expect(output).To(ContainSubstring("stock is running low"))
+
+			events := server.Events()
+			Expect(events).To(HaveLen(2))
+
+			warning := events[0]
+			Expect(warning.Level).To(Equal("warning"))
+			Expect(warning.Exception.Values[0].Type).To(Equal("E_USER_WARNING"))
+			Expect(warning.Exception.Values[0].Value).To(Equal("stock is running low"))
+
+			exception := events[1]
+			Expect(exception.EventID).To(MatchRegexp("^[0-9a-f]{32}$"))
+			Expect(exception.Platform).To(Equal("php"))
+			Expect(exception.Level).To(Equal("error"))
+			Expect(exception.Release).To(Equal("shop@1+php-buildpack.4.3.51"))
+			Expect(exception.Environment).To(Equal("test"))
+			Expect(exception.Exception.Values[0].Type).To(Equal("RuntimeException"))
+			Expect(exception.Exception.Values[0].Value).To(Equal("payment of 42 declined"))
+			frames := exception.Exception.Values[0].Stacktrace.Frames
+			Expect(frames).To(HaveLen(2))
+			Expect(frames[0].Function).To(Equal("Checkout->pay"))
+			Expect(frames[1].Filename).To(HaveSuffix("app.php"))
+			Expect(frames[1].Lineno).To(Equal(7))
+		})
+
+		It("does nothing without a DSN", func() {
+			output, err := run(bootstrap, "SENTRY_DSN=")
+			Expect(err).To(HaveOccurred(), output)
+			Expect(output).To(ContainSubstring("payment of 42 declined"))
+			Expect(server.Events()).To(BeEmpty())
+		})
+
+		It("keeps the handlers of LOG_FORMAT json working", func() {
+			dir, err := os.Getwd()
+			Expect(err).NotTo(HaveOccurred())
+			chain := filepath.Join(os.TempDir(), "fakesentry-auto-prepend.php")
+			Expect(ioutil.WriteFile(chain, []byte("<?php\n"+
+				"require '"+filepath.Join(dir, "..", "..", "..", "lib", "php", "log-format.php")+"';\n"+
+				"require '"+filepath.Join(dir, bootstrap)+"';\n"), 0644)).To(Succeed())
+			defer os.Remove(chain)
+
+			output, err := run(chain, "SENTRY_DSN="+server.DSN("42"))
+			Expect(err).To(HaveOccurred(), output)
+			Expect(output).To(ContainSubstring(`"message":"stock is running low"`))
+			Expect(output).To(ContainSubstring(`"level":"error"`))
+			Expect(server.Events()).To(HaveLen(2))
+		})
+	})
+})
@@ -0,0 +1,13 @@
+<?php
+// An app with a warning and an uncaught exception, for the bootstrap.
+class Checkout
+{
+    public function pay($amount)
+    {
+        throw new RuntimeException("payment of $amount declined");
+    }
+}
+
+trigger_error('stock is running low', E_USER_WARNING);
+@trigger_error('suppressed', E_USER_WARNING);
+(new Checkout())->pay(42);
@@ -0,0 +1,153 @@
+// Package fpmstatus reads the status and ping pages php-fpm serves when
+// FPM_STATUS is on, through the web server like any other client, so a test
+// harness can tell whether the pool behind it is healthy.
+package fpmstatus
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultStatusPath = "/fpm-status"
+	DefaultPingPath   = "/fpm-ping"
+)
+
+// Status is the JSON status page of a pool. The request reading it is
+// served by one of the workers, so ActiveProcesses is at least one.
+type Status struct {
+	Pool               string `json:"pool"`
+	ProcessManager     string `json:"process manager"`
+	StartTime          int64  `json:"start time"`
+	StartSince         int64  `json:"start since"`
+	AcceptedConn       int64  `json:"accepted conn"`
+	ListenQueue        int    `json:"listen queue"`
+	MaxListenQueue     int    `json:"max listen queue"`
+	ListenQueueLen     int    `json:"listen queue len"`
+	IdleProcesses      int    `json:"idle processes"`
+	ActiveProcesses    int    `json:"active processes"`
+	TotalProcesses     int    `json:"total processes"`
+	MaxActiveProcesses int    `json:"max active processes"`
+	MaxChildrenReached int    `json:"max children reached"`
+	SlowRequests       int    `json:"slow requests"`
+}
+
+func Parse(data []byte) (*Status, error) {
+	status := &Status{}
+	if err := json.Unmarshal(data, status); err != nil {
+		return nil, fmt.Errorf("invalid status page: %s", err)
+	}
+	if status.Pool == "" {
+		return nil, fmt.Errorf("invalid status page: no pool in %q", data)
+	}
+	return status, nil
+}
+
+// Healthy returns why the pool cannot take more requests, or nil.
+func (s *Status) Healthy() error {
+	if s.TotalProcesses == 0 {
+		return fmt.Errorf("pool %s has no workers", s.Pool)
+	}
+	if s.IdleProcesses == 0 && s.ListenQueue > 0 {
+		return fmt.Errorf("pool %s has no idle worker and %d requests waiting", s.Pool, s.ListenQueue)
+	}
+	return nil
+}
+
+// Client reaches the pages at BaseURL, the root of the app. Username and
+// Password are sent when FPM_STATUS_HTPASSWD protects the pages.
+type Client struct {
+	BaseURL    string
+	StatusPath string
+	PingPath   string
+	Username   string
+	Password   string
+	HTTP       *http.Client
+}
+
+// Ping succeeds when php-fpm answers the ping page with pong.
+func (c *Client) Ping() error {
+	body, err := c.get(or(c.PingPath, DefaultPingPath))
+	if err != nil {
+		return err
+	}
+	if strings.TrimSpace(string(body)) != "pong" {
+		return fmt.Errorf("ping answered %q instead of pong", body)
+	}
+	return nil
+}
+
+func (c *Client) Status() (*Status, error) {
+	body, err := c.get(or(c.StatusPath, DefaultStatusPath) + "?json")
+	if err != nil {
+		return nil, err
+	}
+	return Parse(body)
+}
+
+// Probe pings the pool, then reads its status and checks it is healthy.
+func (c *Client) Probe() (*Status, error) {
+	if err := c.Ping(); err != nil {
+		return nil, err
+	}
+	status, err := c.Status()
+	if err != nil {
+		return nil, err
+	}
+	return status, status.Healthy()
+}
+
+// Wait probes every interval until the pool is healthy and ready returns
+// true, and returns the last status and error when timeout passes first.
+func (c *Client) Wait(timeout, interval time.Duration, ready func(*Status) bool) (*Status, error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		status, err := c.Probe()
+		if err == nil && ready != nil && !ready(status) {
+			err = fmt.Errorf("pool %s is not ready: %d active, %d idle, %d total workers",
+				status.Pool, status.ActiveProcesses, status.IdleProcesses, status.TotalProcesses)
+		}
+		if err == nil || time.Now().After(deadline) {
+			return status, err
+		}
+		time.Sleep(interval)
+	}
+}
+
+func (c *Client) get(path string) ([]byte, error) {
+	req, err := http.NewRequest("GET", strings.TrimSuffix(c.BaseURL, "/")+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	if c.Username != "" {
+		req.SetBasicAuth(c.Username, c.Password)
+	}
+	client := c.HTTP
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s: %s", path, resp.Status)
+	}
+	return body, nil
+}
+
+func or(value, fallback string) string {
+	if value == "" {
+		return fallback
+	}
+	return value
+}
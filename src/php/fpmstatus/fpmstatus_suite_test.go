@@ -0,0 +1,13 @@
+package fpmstatus_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestFpmstatus(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Fpmstatus Suite")
+}
@@ -0,0 +1,162 @@
+package fpmstatus_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"php/fpmstatus"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+)
+
+func recorded(name string) []byte {
+	data, err := ioutil.ReadFile(filepath.Join("testdata", name))
+	Expect(err).NotTo(HaveOccurred())
+	return data
+}
+
+// fakeWebServer answers like the web server in front of php-fpm, with the
+// pages protected by basic auth.
+type fakeWebServer struct {
+	*httptest.Server
+
+	mu     sync.Mutex
+	status []byte
+	ping   string
+}
+
+func newFakeWebServer() *fakeWebServer {
+	f := &fakeWebServer{status: recorded("idle.json"), ping: "pong"}
+	f.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, password, ok := r.BasicAuth(); !ok || user != "probe" || password != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		switch {
+		case r.URL.Path == "/fpm-ping":
+			w.Write([]byte(f.ping + "\n"))
+		case r.URL.Path == "/fpm-status" && r.URL.RawQuery == "json":
+			w.Header().Set("Content-Type", "application/json")
+			w.Write(f.status)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	return f
+}
+
+func (f *fakeWebServer) set(status []byte, ping string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.status, f.ping = status, ping
+}
+
+var _ = Describe("Fpmstatus", func() {
+	DescribeTable("Healthy",
+		func(file, message string) {
+			status, err := fpmstatus.Parse(recorded(file))
+			Expect(err).NotTo(HaveOccurred())
+			if message == "" {
+				Expect(status.Healthy()).To(Succeed())
+			} else {
+				Expect(status.Healthy()).To(MatchError(message))
+			}
+		},
+		Entry("idle workers", "idle.json", ""),
+		Entry("requests queue up", "saturated.json", "pool www has no idle worker and 12 requests waiting"),
+		Entry("no workers", "no_workers.json", "pool www has no workers"),
+	)
+
+	It("parses the recorded status page", func() {
+		status, err := fpmstatus.Parse(recorded("saturated.json"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(*status).To(Equal(fpmstatus.Status{
+			Pool:               "www",
+			ProcessManager:     "static",
+			StartTime:          1539900000,
+			StartSince:         3600,
+			AcceptedConn:       18234,
+			ListenQueue:        12,
+			MaxListenQueue:     40,
+			ListenQueueLen:     128,
+			IdleProcesses:      0,
+			ActiveProcesses:    5,
+			TotalProcesses:     5,
+			MaxActiveProcesses: 5,
+			SlowRequests:       3,
+		}))
+	})
+
+	It("rejects pages which are not a pool status", func() {
+		_, err := fpmstatus.Parse([]byte("<html>Not Found</html>"))
+		Expect(err).To(MatchError(ContainSubstring("invalid status page")))
+		_, err = fpmstatus.Parse([]byte("{}"))
+		Expect(err).To(MatchError(ContainSubstring("no pool")))
+	})
+
+	Describe("Client", func() {
+		var server *fakeWebServer
+		var client *fpmstatus.Client
+
+		BeforeEach(func() {
+			server = newFakeWebServer()
+			client = &fpmstatus.Client{BaseURL: server.URL + "/", Username: "probe", Password: "secret"}
+		})
+
+		AfterEach(func() {
+			server.Close()
+		})
+
+		It("probes the pool through the web server", func() {
+			status, err := client.Probe()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(status.ActiveProcesses).To(Equal(1))
+			Expect(status.IdleProcesses).To(Equal(2))
+		})
+
+		It("fails without the credentials", func() {
+			client.Password = ""
+			Expect(client.Ping()).To(MatchError("GET /fpm-ping: 401 Unauthorized"))
+		})
+
+		It("fails when ping does not answer pong", func() {
+			server.set(recorded("idle.json"), "File not found.")
+			Expect(client.Ping()).To(MatchError(`ping answered "File not found.\n" instead of pong`))
+		})
+
+		It("uses the configured paths", func() {
+			client.StatusPath = "/status"
+			_, err := client.Status()
+			Expect(err).To(MatchError("GET /status?json: 404 Not Found"))
+		})
+
+		It("waits for the pool to be ready", func() {
+			server.set(recorded("saturated.json"), "pong")
+			go func() {
+				defer GinkgoRecover()
+				time.Sleep(50 * time.Millisecond)
+				server.set(recorded("idle.json"), "pong")
+			}()
+			status, err := client.Wait(5*time.Second, 10*time.Millisecond, func(s *fpmstatus.Status) bool {
+				return s.IdleProcesses >= 2
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(status.TotalProcesses).To(Equal(3))
+		})
+
+		It("gives up after the timeout", func() {
+			_, err := client.Wait(30*time.Millisecond, 10*time.Millisecond, func(s *fpmstatus.Status) bool {
+				return s.IdleProcesses >= 5
+			})
+			Expect(err).To(MatchError("pool www is not ready: 1 active, 2 idle, 3 total workers"))
+		})
+	})
+})
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"php/fpmtune"
+)
+
+func main() {
+	etcDir := flag.String("etc-dir", filepath.Join(os.Getenv("HOME"), "php", "etc"), "directory holding php.ini and php.ini.d")
+	reserved := flag.String("reserved", "", "memory kept for the web server and other processes, e.g. 64M")
+	defaults := flag.Bool("defaults", false, "print the php.ini memory settings used when the pool can't be sized, as staging does")
+	config := fpmtune.Config{}
+	flag.StringVar(&config.Mode, "pm", fpmtune.Dynamic, "static, dynamic or ondemand")
+	flag.IntVar(&config.MaxChildren, "max-children", 0, "pm.max_children, computed when 0")
+	flag.IntVar(&config.StartServers, "start-servers", 0, "pm.start_servers, computed when 0")
+	flag.IntVar(&config.MinSpareServers, "min-spare-servers", 0, "pm.min_spare_servers, computed when 0")
+	flag.IntVar(&config.MaxSpareServers, "max-spare-servers", 0, "pm.max_spare_servers, computed when 0")
+	flag.StringVar(&config.ProcessIdleTimeout, "process-idle-timeout", fpmtune.DefaultProcessIdleTimeout, "pm.process_idle_timeout")
+	flag.Parse()
+
+	if *defaults {
+		for _, kv := range fpmtune.DefaultMemory.Env() {
+			fmt.Printf("%s=%s\n", kv[0], kv[1])
+		}
+		return
+	}
+
+	pool, memory, err := tune(config, *etcDir, *reserved)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "WARNING: could not size the php-fpm pool, using the defaults: %s\n", err)
+		pool, memory = fpmtune.Legacy, fpmtune.DefaultMemory
+	}
+
+	for _, kv := range append(pool.Env(), memory.Env()...) {
+		fmt.Printf("export %s='%s'\n", kv[0], kv[1])
+	}
+}
+
+func tune(config fpmtune.Config, etcDir, reserved string) (fpmtune.Pool, fpmtune.Memory, error) {
+	var err error
+	if config.ContainerMB, err = fpmtune.ContainerMB(os.Getenv); err != nil {
+		return fpmtune.Pool{}, fpmtune.Memory{}, err
+	}
+	if reserved != "" {
+		size, err := fpmtune.ParseSize(reserved)
+		if err != nil {
+			return fpmtune.Pool{}, fpmtune.Memory{}, err
+		}
+		config.ReservedMB = int(size >> 20)
+	}
+
+	files, err := fpmtune.IniFiles(etcDir)
+	if err != nil {
+		return fpmtune.Pool{}, fpmtune.Memory{}, err
+	}
+	memoryConfig := fpmtune.MemoryConfig{ContainerMB: config.ContainerMB, ReservedMB: config.ReservedMB, Sources: map[string]string{}}
+	for _, setting := range []struct {
+		key   string
+		shift uint
+		value *int
+	}{
+		{"memory_limit", 20, &memoryConfig.User.MemoryLimitMB},
+		{"opcache.memory_consumption", 0, &memoryConfig.User.OpcacheMB},
+		{"realpath_cache_size", 10, &memoryConfig.User.RealpathCacheKB},
+	} {
+		value, source, err := fpmtune.IniValue(setting.key, files...)
+		if err != nil {
+			return fpmtune.Pool{}, fpmtune.Memory{}, err
+		}
+		// placeholders are rendered from the values computed here
+		if value == "" || strings.HasPrefix(value, "@{") {
+			continue
+		}
+		size, err := fpmtune.ParseSize(value)
+		if err != nil {
+			return fpmtune.Pool{}, fpmtune.Memory{}, fmt.Errorf("%s: %s", setting.key, err)
+		}
+		if size > 0 {
+			size >>= setting.shift
+		}
+		*setting.value = int(size)
+		memoryConfig.Sources[setting.key] = source
+	}
+	zendExtensions, _, err := fpmtune.IniValues("zend_extension", files...)
+	if err != nil {
+		return fpmtune.Pool{}, fpmtune.Memory{}, err
+	}
+	for _, ext := range zendExtensions {
+		memoryConfig.Opcache = memoryConfig.Opcache || strings.Contains(ext, "opcache")
+	}
+
+	// a memory_limit set by the application sizes the pool, otherwise the
+	// pool is sized first and the memory_limit derived from it. Either way
+	// the opcache comes out of the container before the workers.
+	config.WorkerMB = memoryConfig.User.MemoryLimitMB
+	if memoryConfig.Opcache && config.ContainerMB > 0 {
+		config.OpcacheMB = memoryConfig.User.OpcacheMB
+		if config.OpcacheMB == 0 {
+			config.OpcacheMB = fpmtune.DefaultOpcacheMB(config.ContainerMB, config.ReservedMB)
+		}
+	}
+	pool, err := fpmtune.Compute(config)
+	if err != nil {
+		return fpmtune.Pool{}, fpmtune.Memory{}, err
+	}
+	memoryConfig.Workers = pool.MaxChildren
+	memory, warnings := fpmtune.ComputeMemory(memoryConfig)
+	for _, warning := range warnings {
+		fmt.Fprintf(os.Stderr, "WARNING: %s\n", warning)
+	}
+
+	fmt.Fprintf(os.Stderr, "php-fpm pool: pm = %s, pm.max_children = %d (container %dM, memory_limit %dM, opcache %dM)\n",
+		pool.Mode, pool.MaxChildren, config.ContainerMB, memory.MemoryLimitMB, memory.OpcacheMB)
+	return pool, memory, nil
+}
@@ -0,0 +1,206 @@
+// Package fpmtune sizes the php-fpm pool from the memory available to the
+// container and the PHP memory_limit of each worker.
+package fpmtune
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	Static   = "static"
+	Dynamic  = "dynamic"
+	OnDemand = "ondemand"
+
+	// DefaultWorkerMB is assumed per worker when memory_limit is unlimited
+	// or derived from the pool.
+	DefaultWorkerMB = 128
+	// MaxChildrenCap bounds the computed pool, however large the container.
+	MaxChildrenCap = 128
+	// DefaultProcessIdleTimeout is how long an ondemand worker may stay idle.
+	DefaultProcessIdleTimeout = "10s"
+)
+
+// Legacy is the pool every php-fpm.conf shipped with before autotuning. It
+// is used when the container memory is unknown.
+var Legacy = Pool{Mode: Dynamic, MaxChildren: 5, StartServers: 2, MinSpareServers: 1, MaxSpareServers: 3, ProcessIdleTimeout: DefaultProcessIdleTimeout}
+
+// Config holds the inputs of Compute. Zero values for the pool settings mean
+// they are computed, anything else is a user override.
+type Config struct {
+	ContainerMB int
+	// ReservedMB is kept for the web server and other processes.
+	ReservedMB int
+	// WorkerMB is the memory_limit of a worker, zero when it is derived from
+	// the pool and less than zero for unlimited.
+	WorkerMB int
+	// OpcacheMB is the shared memory of the opcache, zero when not loaded.
+	OpcacheMB int
+
+	Mode               string
+	MaxChildren        int
+	StartServers       int
+	MinSpareServers    int
+	MaxSpareServers    int
+	ProcessIdleTimeout string
+}
+
+type Pool struct {
+	Mode               string
+	MaxChildren        int
+	StartServers       int
+	MinSpareServers    int
+	MaxSpareServers    int
+	ProcessIdleTimeout string
+}
+
+// Env returns the variables used by the php-fpm.conf templates.
+func (p Pool) Env() [][2]string {
+	return [][2]string{
+		{"PHP_FPM_PM", p.Mode},
+		{"PHP_FPM_MAX_CHILDREN", strconv.Itoa(p.MaxChildren)},
+		{"PHP_FPM_START_SERVERS", strconv.Itoa(p.StartServers)},
+		{"PHP_FPM_MIN_SPARE_SERVERS", strconv.Itoa(p.MinSpareServers)},
+		{"PHP_FPM_MAX_SPARE_SERVERS", strconv.Itoa(p.MaxSpareServers)},
+		{"PHP_FPM_PROCESS_IDLE_TIMEOUT", p.ProcessIdleTimeout},
+	}
+}
+
+func Compute(c Config) (Pool, error) {
+	pool := Pool{Mode: c.Mode, ProcessIdleTimeout: c.ProcessIdleTimeout}
+	if pool.Mode == "" {
+		pool.Mode = Dynamic
+	}
+	if pool.Mode != Static && pool.Mode != Dynamic && pool.Mode != OnDemand {
+		return Pool{}, fmt.Errorf("unknown pm %q, expected static, dynamic or ondemand", pool.Mode)
+	}
+	if pool.ProcessIdleTimeout == "" {
+		pool.ProcessIdleTimeout = DefaultProcessIdleTimeout
+	}
+
+	pool.MaxChildren = c.MaxChildren
+	if pool.MaxChildren <= 0 {
+		if c.ContainerMB <= 0 {
+			pool.MaxChildren = Legacy.MaxChildren
+		} else {
+			pool.MaxChildren = computeMaxChildren(c)
+		}
+	}
+
+	pool.MinSpareServers = c.MinSpareServers
+	if pool.MinSpareServers <= 0 {
+		pool.MinSpareServers = max(1, pool.MaxChildren/4)
+	}
+	pool.MaxSpareServers = c.MaxSpareServers
+	if pool.MaxSpareServers <= 0 {
+		pool.MaxSpareServers = min(pool.MaxChildren, max(pool.MinSpareServers, pool.MaxChildren*3/4))
+	}
+	pool.StartServers = c.StartServers
+	if pool.StartServers <= 0 {
+		pool.StartServers = pool.MinSpareServers + (pool.MaxSpareServers-pool.MinSpareServers)/2
+	}
+
+	if pool.Mode == Dynamic {
+		if pool.MaxSpareServers > pool.MaxChildren {
+			return Pool{}, fmt.Errorf("pm.max_spare_servers (%d) must not be greater than pm.max_children (%d)", pool.MaxSpareServers, pool.MaxChildren)
+		}
+		if pool.MinSpareServers > pool.MaxSpareServers {
+			return Pool{}, fmt.Errorf("pm.min_spare_servers (%d) must not be greater than pm.max_spare_servers (%d)", pool.MinSpareServers, pool.MaxSpareServers)
+		}
+		if pool.StartServers < pool.MinSpareServers || pool.StartServers > pool.MaxSpareServers {
+			return Pool{}, fmt.Errorf("pm.start_servers (%d) must be between pm.min_spare_servers (%d) and pm.max_spare_servers (%d)", pool.StartServers, pool.MinSpareServers, pool.MaxSpareServers)
+		}
+	}
+	return pool, nil
+}
+
+func computeMaxChildren(c Config) int {
+	worker := c.WorkerMB
+	if worker <= 0 {
+		worker = DefaultWorkerMB
+	}
+	available := c.ContainerMB - reservedMB(c.ContainerMB, c.ReservedMB) - c.OpcacheMB
+	// a derived memory_limit never drops below the default, so small
+	// containers keep the pool they had before autotuning
+	least := 1
+	if c.WorkerMB == 0 {
+		least = Legacy.MaxChildren
+	}
+	return min(MaxChildrenCap, max(least, available/worker))
+}
+
+// reservedMB defaults to a tenth of the container, and at least 32M.
+func reservedMB(containerMB, reservedMB int) int {
+	if reservedMB > 0 {
+		return reservedMB
+	}
+	return max(32, containerMB/10)
+}
+
+// ParseSize converts sizes such as `256m`, `2G` or `1048576` to bytes. `-1`,
+// the PHP notation for unlimited, is returned as -1.
+func ParseSize(s string) (int64, error) {
+	s = strings.TrimSpace(s)
+	if s == "-1" {
+		return -1, nil
+	}
+	multiplier := int64(1)
+	if s != "" {
+		switch s[len(s)-1] {
+		case 'k', 'K':
+			multiplier = 1 << 10
+		case 'm', 'M':
+			multiplier = 1 << 20
+		case 'g', 'G':
+			multiplier = 1 << 30
+		}
+		if multiplier != 1 {
+			s = s[:len(s)-1]
+		}
+	}
+	n, err := strconv.ParseInt(strings.TrimSpace(s), 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	return n * multiplier, nil
+}
+
+// ContainerMB reads the memory limit of the container from $MEMORY_LIMIT,
+// falling back to the limits in $VCAP_APPLICATION. Zero means unknown.
+func ContainerMB(getenv func(string) string) (int, error) {
+	if limit := getenv("MEMORY_LIMIT"); limit != "" {
+		size, err := ParseSize(limit)
+		if err != nil {
+			return 0, fmt.Errorf("MEMORY_LIMIT: %s", err)
+		}
+		return int(size >> 20), nil
+	}
+	if app := getenv("VCAP_APPLICATION"); app != "" {
+		vcap := struct {
+			Limits struct {
+				Mem int `json:"mem"`
+			} `json:"limits"`
+		}{}
+		if err := json.Unmarshal([]byte(app), &vcap); err != nil {
+			return 0, fmt.Errorf("VCAP_APPLICATION: %s", err)
+		}
+		return vcap.Limits.Mem, nil
+	}
+	return 0, nil
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func max(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
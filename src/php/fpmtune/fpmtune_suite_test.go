@@ -0,0 +1,13 @@
+package fpmtune_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestFpmtune(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Fpmtune Suite")
+}
@@ -0,0 +1,134 @@
+package fpmtune_test
+
+import (
+	"path/filepath"
+
+	"php/fpmtune"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Fpmtune", func() {
+	DescribeTable("computing the pool",
+		func(config fpmtune.Config, expected fpmtune.Pool) {
+			pool, err := fpmtune.Compute(config)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(pool).To(Equal(expected))
+		},
+		Entry("keeps the old defaults without a container limit",
+			fpmtune.Config{WorkerMB: 128},
+			fpmtune.Legacy),
+		Entry("runs a single worker in 256M",
+			fpmtune.Config{ContainerMB: 256, WorkerMB: 128},
+			fpmtune.Pool{Mode: "dynamic", MaxChildren: 1, StartServers: 1, MinSpareServers: 1, MaxSpareServers: 1, ProcessIdleTimeout: "10s"}),
+		Entry("keeps the legacy pool in 256M when memory_limit is derived",
+			fpmtune.Config{ContainerMB: 256, OpcacheMB: 32},
+			fpmtune.Legacy),
+		Entry("sizes the pool after the opcache",
+			fpmtune.Config{ContainerMB: 2048, OpcacheMB: 230},
+			fpmtune.Pool{Mode: "dynamic", MaxChildren: 12, StartServers: 6, MinSpareServers: 3, MaxSpareServers: 9, ProcessIdleTimeout: "10s"}),
+		Entry("uses a 2G container",
+			fpmtune.Config{ContainerMB: 2048, WorkerMB: 128},
+			fpmtune.Pool{Mode: "dynamic", MaxChildren: 14, StartServers: 6, MinSpareServers: 3, MaxSpareServers: 10, ProcessIdleTimeout: "10s"}),
+		Entry("assumes 128M per worker when memory_limit is unlimited",
+			fpmtune.Config{ContainerMB: 1024, WorkerMB: -1},
+			fpmtune.Pool{Mode: "dynamic", MaxChildren: 7, StartServers: 3, MinSpareServers: 1, MaxSpareServers: 5, ProcessIdleTimeout: "10s"}),
+		Entry("honours the reserved memory",
+			fpmtune.Config{ContainerMB: 1024, ReservedMB: 512, WorkerMB: 64},
+			fpmtune.Pool{Mode: "dynamic", MaxChildren: 8, StartServers: 4, MinSpareServers: 2, MaxSpareServers: 6, ProcessIdleTimeout: "10s"}),
+		Entry("caps very large containers",
+			fpmtune.Config{ContainerMB: 65536, WorkerMB: 32},
+			fpmtune.Pool{Mode: "dynamic", MaxChildren: 128, StartServers: 64, MinSpareServers: 32, MaxSpareServers: 96, ProcessIdleTimeout: "10s"}),
+		Entry("sizes a static pool",
+			fpmtune.Config{ContainerMB: 1024, WorkerMB: 256, Mode: "static"},
+			fpmtune.Pool{Mode: "static", MaxChildren: 3, StartServers: 1, MinSpareServers: 1, MaxSpareServers: 2, ProcessIdleTimeout: "10s"}),
+		Entry("sizes an ondemand pool",
+			fpmtune.Config{ContainerMB: 1024, WorkerMB: 128, Mode: "ondemand", ProcessIdleTimeout: "30s"},
+			fpmtune.Pool{Mode: "ondemand", MaxChildren: 7, StartServers: 3, MinSpareServers: 1, MaxSpareServers: 5, ProcessIdleTimeout: "30s"}),
+		Entry("keeps overrides",
+			fpmtune.Config{ContainerMB: 2048, WorkerMB: 128, MaxChildren: 20, MinSpareServers: 2, MaxSpareServers: 4},
+			fpmtune.Pool{Mode: "dynamic", MaxChildren: 20, StartServers: 3, MinSpareServers: 2, MaxSpareServers: 4, ProcessIdleTimeout: "10s"}),
+	)
+
+	DescribeTable("rejecting invalid settings",
+		func(config fpmtune.Config, message string) {
+			_, err := fpmtune.Compute(config)
+			Expect(err).To(MatchError(ContainSubstring(message)))
+		},
+		Entry("unknown pm", fpmtune.Config{Mode: "adaptive"}, `unknown pm "adaptive"`),
+		Entry("max spare above max children", fpmtune.Config{MaxChildren: 2, MaxSpareServers: 3}, "pm.max_spare_servers (3)"),
+		Entry("min spare above max spare", fpmtune.Config{MinSpareServers: 4, MaxSpareServers: 3}, "pm.min_spare_servers (4)"),
+		Entry("start servers outside the spare range", fpmtune.Config{StartServers: 5}, "pm.start_servers (5)"),
+	)
+
+	It("does not validate spare servers of a static pool", func() {
+		_, err := fpmtune.Compute(fpmtune.Config{Mode: "static", MaxChildren: 2, MaxSpareServers: 3})
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	DescribeTable("parsing sizes",
+		func(size string, expected int64) {
+			Expect(fpmtune.ParseSize(size)).To(Equal(expected))
+		},
+		Entry("bytes", "1048576", int64(1048576)),
+		Entry("kilobytes", "512K", int64(512*1024)),
+		Entry("lower case megabytes", "256m", int64(256*1024*1024)),
+		Entry("gigabytes", "2G", int64(2*1024*1024*1024)),
+		Entry("unlimited", "-1", int64(-1)),
+	)
+
+	It("rejects invalid sizes", func() {
+		_, err := fpmtune.ParseSize("lots")
+		Expect(err).To(HaveOccurred())
+	})
+
+	DescribeTable("reading the container memory",
+		func(env map[string]string, expected int) {
+			Expect(fpmtune.ContainerMB(func(key string) string { return env[key] })).To(Equal(expected))
+		},
+		Entry("MEMORY_LIMIT", map[string]string{"MEMORY_LIMIT": "2048m", "VCAP_APPLICATION": `{"limits":{"mem":256}}`}, 2048),
+		Entry("VCAP_APPLICATION", map[string]string{"VCAP_APPLICATION": `{"limits":{"mem":256,"disk":1024}}`}, 256),
+		Entry("unknown", map[string]string{}, 0),
+	)
+
+	Context("php.ini", func() {
+		It("uses the last memory_limit PHP loads", func() {
+			files, err := fpmtune.IniFiles(filepath.Join("testdata", "etc"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(files).To(Equal([]string{
+				filepath.Join("testdata", "etc", "php.ini"),
+				filepath.Join("testdata", "etc", "php.ini.d", "10-ignored.ini"),
+				filepath.Join("testdata", "etc", "php.ini.d", "50-memory.ini"),
+			}))
+
+			value, source, err := fpmtune.IniValue("memory_limit", files...)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(value).To(Equal("256M"))
+			Expect(source).To(Equal(filepath.Join("testdata", "etc", "php.ini.d", "50-memory.ini")))
+		})
+
+		It("returns every value of a repeated setting", func() {
+			files, err := fpmtune.IniFiles(filepath.Join("testdata", "etc"))
+			Expect(err).NotTo(HaveOccurred())
+
+			values, sources, err := fpmtune.IniValues("zend_extension", files...)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(values).To(Equal([]string{"opcache.so", "xdebug.so"}))
+			Expect(sources).To(Equal([]string{
+				filepath.Join("testdata", "etc", "php.ini"),
+				filepath.Join("testdata", "etc", "php.ini.d", "10-ignored.ini"),
+			}))
+		})
+
+		It("skips missing files", func() {
+			files, err := fpmtune.IniFiles(filepath.Join("testdata", "etc_unlimited"))
+			Expect(err).NotTo(HaveOccurred())
+
+			value, _, err := fpmtune.IniValue("memory_limit", append(files, filepath.Join("testdata", "missing.ini"))...)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(value).To(Equal("-1"))
+		})
+	})
+})
@@ -0,0 +1,67 @@
+package fpmtune
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// IniFiles lists php.ini in etcDir followed by php.ini.d/*.ini, in the order
+// PHP loads them.
+func IniFiles(etcDir string) ([]string, error) {
+	files := []string{filepath.Join(etcDir, "php.ini")}
+	scanned, err := filepath.Glob(filepath.Join(etcDir, "php.ini.d", "*.ini"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(scanned)
+	return append(files, scanned...), nil
+}
+
+// IniValue returns the last value set for key across files, and the file
+// which set it. Missing files are skipped.
+func IniValue(key string, files ...string) (value, source string, err error) {
+	values, sources, err := IniValues(key, files...)
+	if err != nil || len(values) == 0 {
+		return "", "", err
+	}
+	return values[len(values)-1], sources[len(sources)-1], nil
+}
+
+// IniValues returns every value set for key across files, for settings such
+// as zend_extension which may repeat.
+func IniValues(key string, files ...string) (values, sources []string, err error) {
+	for _, path := range files {
+		f, err := os.Open(path)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return nil, nil, err
+		}
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if line == "" || strings.HasPrefix(line, ";") || strings.HasPrefix(line, "[") {
+				continue
+			}
+			parts := strings.SplitN(line, "=", 2)
+			if len(parts) != 2 || strings.TrimSpace(parts[0]) != key {
+				continue
+			}
+			v := strings.TrimSpace(parts[1])
+			if i := strings.Index(v, ";"); i >= 0 {
+				v = strings.TrimSpace(v[:i])
+			}
+			values = append(values, strings.Trim(v, `"'`))
+			sources = append(sources, path)
+		}
+		err = scanner.Err()
+		f.Close()
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	return values, sources, nil
+}
@@ -0,0 +1,126 @@
+package fpmtune
+
+import "fmt"
+
+const (
+	// MinMemoryLimitMB is the share of a worker below which the derived
+	// memory_limit is warned about, as it overcommits the container.
+	MinMemoryLimitMB = 32
+	// MaxMemoryLimitMB bounds the derived memory_limit of a small pool.
+	MaxMemoryLimitMB = 1024
+)
+
+// Memory holds the PHP settings which are sized from the container. A zero
+// value means unset, a MemoryLimitMB of -1 means unlimited.
+type Memory struct {
+	MemoryLimitMB   int
+	OpcacheMB       int
+	RealpathCacheKB int
+}
+
+// DefaultMemory is used when the container memory is unknown. Staging reads
+// it with `fpm-tune -defaults`, so both use the same values.
+var DefaultMemory = Memory{MemoryLimitMB: 128, OpcacheMB: 128, RealpathCacheKB: 4096}
+
+// Env returns the variables used by the php.ini templates.
+func (m Memory) Env() [][2]string {
+	memoryLimit := fmt.Sprintf("%dM", m.MemoryLimitMB)
+	if m.MemoryLimitMB < 0 {
+		memoryLimit = "-1"
+	}
+	return [][2]string{
+		{"PHP_MEMORY_LIMIT", memoryLimit},
+		{"PHP_OPCACHE_MEMORY_CONSUMPTION", fmt.Sprintf("%d", m.OpcacheMB)},
+		{"PHP_REALPATH_CACHE_SIZE", fmt.Sprintf("%dK", m.RealpathCacheKB)},
+	}
+}
+
+type MemoryConfig struct {
+	ContainerMB int
+	ReservedMB  int
+	// Workers is the number of PHP processes which may run at once.
+	Workers int
+	// Opcache is true when the opcache extension is loaded, so its shared
+	// memory has to fit as well.
+	Opcache bool
+	// User holds the values the application set itself, which are kept.
+	User Memory
+	// Sources names where each user value was set, keyed by ini setting.
+	Sources map[string]string
+}
+
+// ComputeMemory derives the settings the application did not set, so that
+// the opcache plus every worker at its memory_limit fit in the container,
+// without deriving a memory_limit below the default.
+// The returned warnings explain where user settings overcommit.
+func ComputeMemory(c MemoryConfig) (Memory, []string) {
+	if c.ContainerMB <= 0 {
+		return merge(c.User, DefaultMemory), nil
+	}
+	workers := max(1, c.Workers)
+	available := c.ContainerMB - reservedMB(c.ContainerMB, c.ReservedMB)
+
+	m := c.User
+	if m.OpcacheMB == 0 {
+		m.OpcacheMB = DefaultOpcacheMB(c.ContainerMB, c.ReservedMB)
+	}
+	if m.RealpathCacheKB == 0 {
+		m.RealpathCacheKB = 4096
+		if available < 1024 {
+			m.RealpathCacheKB = 1024
+		}
+	}
+	opcache := 0
+	if c.Opcache {
+		opcache = m.OpcacheMB
+	}
+	realpathMB := (m.RealpathCacheKB + 1023) / 1024
+
+	var warnings []string
+	if m.MemoryLimitMB == 0 {
+		share := (available-opcache)/workers - realpathMB
+		if share < MinMemoryLimitMB {
+			warnings = append(warnings, fmt.Sprintf("only %dM is left for each of %d workers, using a memory_limit of %dM",
+				max(0, share), workers, DefaultMemory.MemoryLimitMB))
+		}
+		m.MemoryLimitMB = min(MaxMemoryLimitMB, max(DefaultMemory.MemoryLimitMB, share))
+		return m, warnings
+	}
+
+	if m.MemoryLimitMB < 0 {
+		return m, append(warnings, fmt.Sprintf("memory_limit = -1%s leaves the memory of %d workers unbounded",
+			c.source("memory_limit"), workers))
+	}
+	total := opcache + workers*(m.MemoryLimitMB+realpathMB)
+	if total > available {
+		warnings = append(warnings, fmt.Sprintf("memory_limit = %dM%s overcommits memory: %d workers and the opcache may use %dM, only %dM is available",
+			m.MemoryLimitMB, c.source("memory_limit"), workers, total, available))
+	}
+	return m, warnings
+}
+
+// DefaultOpcacheMB is the opcache size used when the application sets none,
+// an eighth of the memory left after the reserve, between 32M and 256M.
+func DefaultOpcacheMB(containerMB, reserved int) int {
+	return min(256, max(32, (containerMB-reservedMB(containerMB, reserved))/8))
+}
+
+func (c MemoryConfig) source(setting string) string {
+	if s, ok := c.Sources[setting]; ok {
+		return " (set in " + s + ")"
+	}
+	return ""
+}
+
+func merge(user, defaults Memory) Memory {
+	if user.MemoryLimitMB == 0 {
+		user.MemoryLimitMB = defaults.MemoryLimitMB
+	}
+	if user.OpcacheMB == 0 {
+		user.OpcacheMB = defaults.OpcacheMB
+	}
+	if user.RealpathCacheKB == 0 {
+		user.RealpathCacheKB = defaults.RealpathCacheKB
+	}
+	return user
+}
@@ -0,0 +1,82 @@
+package fpmtune_test
+
+import (
+	"php/fpmtune"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Memory", func() {
+	DescribeTable("deriving the PHP memory settings",
+		func(config fpmtune.MemoryConfig, expected fpmtune.Memory) {
+			memory, warnings := fpmtune.ComputeMemory(config)
+			Expect(warnings).To(BeEmpty())
+			Expect(memory).To(Equal(expected))
+		},
+		Entry("keeps the defaults without a container limit",
+			fpmtune.MemoryConfig{Workers: 5, Opcache: true},
+			fpmtune.DefaultMemory),
+		Entry("keeps user settings without a container limit",
+			fpmtune.MemoryConfig{Workers: 5, User: fpmtune.Memory{MemoryLimitMB: 512}},
+			fpmtune.Memory{MemoryLimitMB: 512, OpcacheMB: 128, RealpathCacheKB: 4096}),
+		Entry("gives a single worker most of 256M",
+			fpmtune.MemoryConfig{ContainerMB: 256, Workers: 1, Opcache: true},
+			fpmtune.Memory{MemoryLimitMB: 191, OpcacheMB: 32, RealpathCacheKB: 1024}),
+		Entry("keeps the default memory_limit for the legacy pool in 256M",
+			fpmtune.MemoryConfig{ContainerMB: 256, Workers: 5, Opcache: true},
+			fpmtune.Memory{MemoryLimitMB: 128, OpcacheMB: 32, RealpathCacheKB: 1024}),
+		Entry("shares a 2G container between 12 workers and the opcache",
+			fpmtune.MemoryConfig{ContainerMB: 2048, Workers: 12, Opcache: true},
+			fpmtune.Memory{MemoryLimitMB: 130, OpcacheMB: 230, RealpathCacheKB: 4096}),
+		Entry("never derives less than the default in 4G",
+			fpmtune.MemoryConfig{ContainerMB: 4096, Workers: 26, Opcache: true},
+			fpmtune.Memory{MemoryLimitMB: 128, OpcacheMB: 256, RealpathCacheKB: 4096}),
+		Entry("leaves the opcache out when it is not loaded",
+			fpmtune.MemoryConfig{ContainerMB: 2048, Workers: 14},
+			fpmtune.Memory{MemoryLimitMB: 128, OpcacheMB: 230, RealpathCacheKB: 4096}),
+		Entry("caps the opcache and the memory_limit of large containers",
+			fpmtune.MemoryConfig{ContainerMB: 16384, Workers: 2, Opcache: true},
+			fpmtune.Memory{MemoryLimitMB: 1024, OpcacheMB: 256, RealpathCacheKB: 4096}),
+		Entry("sizes the remaining settings around the user's",
+			fpmtune.MemoryConfig{ContainerMB: 1024, Workers: 4, Opcache: true, User: fpmtune.Memory{OpcacheMB: 64, RealpathCacheKB: 16}},
+			fpmtune.Memory{MemoryLimitMB: 213, OpcacheMB: 64, RealpathCacheKB: 16}),
+		Entry("accepts a memory_limit which fits",
+			fpmtune.MemoryConfig{ContainerMB: 1024, Workers: 3, Opcache: true, User: fpmtune.Memory{MemoryLimitMB: 256}},
+			fpmtune.Memory{MemoryLimitMB: 256, OpcacheMB: 115, RealpathCacheKB: 1024}),
+	)
+
+	DescribeTable("warning about overcommitted memory",
+		func(config fpmtune.MemoryConfig, expected fpmtune.Memory, warning string) {
+			memory, warnings := fpmtune.ComputeMemory(config)
+			Expect(memory).To(Equal(expected))
+			Expect(warnings).To(ConsistOf(ContainSubstring(warning)))
+		},
+		Entry("memory_limit set in php.ini.d",
+			fpmtune.MemoryConfig{
+				ContainerMB: 1024, Workers: 7, Opcache: true,
+				User:    fpmtune.Memory{MemoryLimitMB: 256},
+				Sources: map[string]string{"memory_limit": ".bp-config/php/php.ini.d/memory.ini"},
+			},
+			fpmtune.Memory{MemoryLimitMB: 256, OpcacheMB: 115, RealpathCacheKB: 1024},
+			"memory_limit = 256M (set in .bp-config/php/php.ini.d/memory.ini) overcommits memory: 7 workers and the opcache may use 1914M, only 922M is available"),
+		Entry("unlimited memory_limit",
+			fpmtune.MemoryConfig{ContainerMB: 1024, Workers: 7, User: fpmtune.Memory{MemoryLimitMB: -1}},
+			fpmtune.Memory{MemoryLimitMB: -1, OpcacheMB: 115, RealpathCacheKB: 1024},
+			"memory_limit = -1 leaves the memory of 7 workers unbounded"),
+		Entry("too many workers for the container",
+			fpmtune.MemoryConfig{ContainerMB: 512, Workers: 20, Opcache: true},
+			fpmtune.Memory{MemoryLimitMB: 128, OpcacheMB: 57, RealpathCacheKB: 1024},
+			"only 19M is left for each of 20 workers, using a memory_limit of 128M"),
+	)
+
+	It("renders the php.ini variables", func() {
+		Expect(fpmtune.Memory{MemoryLimitMB: 111, OpcacheMB: 230, RealpathCacheKB: 4096}.Env()).To(Equal([][2]string{
+			{"PHP_MEMORY_LIMIT", "111M"},
+			{"PHP_OPCACHE_MEMORY_CONSUMPTION", "230"},
+			{"PHP_REALPATH_CACHE_SIZE", "4096K"},
+		}))
+		Expect(fpmtune.Memory{MemoryLimitMB: -1}.Env()[0]).To(Equal([2]string{"PHP_MEMORY_LIMIT", "-1"}))
+	})
+})
@@ -0,0 +1,141 @@
+// Package frameworks recognises the layout of common PHP frameworks so the
+// buildpack can pick the document root, front controller and writable cache
+// directories without an options.json.
+package frameworks
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Framework describes a detected application layout.
+//
+// An empty WebDir means the framework lives at the root of the application,
+// which the buildpack moves into the default WEBDIR during staging. In that
+// case CacheDirs are relative to the document root, otherwise they are
+// relative to the application root.
+type Framework struct {
+	Name            string   `json:"name"`
+	WebDir          string   `json:"webdir"`
+	LibDir          string   `json:"libdir"`
+	FrontController string   `json:"front_controller"`
+	CacheDirs       []string `json:"cache_dirs"`
+	Evidence        []string `json:"evidence"`
+}
+
+type layout struct {
+	name            string
+	files           []string
+	webDir          string
+	libDir          string
+	frontController string
+	cacheDirs       []string
+}
+
+type rule struct {
+	name    string
+	layouts []layout
+}
+
+// rules are tried in order and the first matching layout wins.
+var rules = []rule{
+	{"Laravel", []layout{
+		{files: []string{"artisan", "public/index.php"}, webDir: "public", libDir: "vendor", frontController: "index.php",
+			cacheDirs: []string{"bootstrap/cache", "storage/framework/cache", "storage/framework/sessions", "storage/framework/views", "storage/logs"}},
+	}},
+	{"Symfony", []layout{
+		{name: "Symfony 4", files: []string{"bin/console", "public/index.php"}, webDir: "public", libDir: "vendor", frontController: "index.php",
+			cacheDirs: []string{"var/cache", "var/log"}},
+		{name: "Symfony 3", files: []string{"bin/console", "web/app.php"}, webDir: "web", libDir: "vendor", frontController: "app.php",
+			cacheDirs: []string{"var/cache", "var/logs", "var/sessions"}},
+		{name: "Symfony 2", files: []string{"app/console", "web/app.php"}, webDir: "web", libDir: "vendor", frontController: "app.php",
+			cacheDirs: []string{"app/cache", "app/logs"}},
+	}},
+	{"CakePHP", []layout{
+		{name: "CakePHP 3", files: []string{"bin/cake", "webroot/index.php"}, webDir: "webroot", libDir: "vendor", frontController: "index.php",
+			cacheDirs: []string{"logs", "tmp/cache/models", "tmp/cache/persistent", "tmp/cache/views", "tmp/sessions"}},
+		{name: "CakePHP 2", files: []string{"lib/Cake", "app/webroot/index.php"}, webDir: "app/webroot", libDir: "vendor", frontController: "index.php",
+			cacheDirs: []string{"app/tmp/cache/models", "app/tmp/cache/persistent", "app/tmp/cache/views", "app/tmp/logs", "app/tmp/sessions"}},
+	}},
+	{"Zend Framework", []layout{
+		{files: []string{"config/application.config.php", "public/index.php"}, webDir: "public", libDir: "vendor", frontController: "index.php",
+			cacheDirs: []string{"data/cache"}},
+	}},
+	{"Drupal", []layout{
+		{name: "Drupal 8", files: []string{"web/core/lib/Drupal.php", "web/index.php"}, webDir: "web", libDir: "vendor", frontController: "index.php",
+			cacheDirs: []string{"web/sites/default/files"}},
+		{name: "Drupal 8", files: []string{"core/lib/Drupal.php", "index.php"}, frontController: "index.php",
+			cacheDirs: []string{"sites/default/files"}},
+		{name: "Drupal 7", files: []string{"includes/bootstrap.inc", "index.php"}, frontController: "index.php",
+			cacheDirs: []string{"sites/default/files"}},
+	}},
+	{"WordPress", []layout{
+		{name: "WordPress (Bedrock)", files: []string{"web/wp/wp-settings.php", "web/index.php"}, webDir: "web", libDir: "vendor", frontController: "index.php",
+			cacheDirs: []string{"web/app/uploads"}},
+		{files: []string{"wp-settings.php", "index.php"}, frontController: "index.php",
+			cacheDirs: []string{"wp-content/uploads"}},
+	}},
+}
+
+// Detect returns the framework found in dir, or nil if none matched.
+func Detect(dir string) (*Framework, error) {
+	if _, err := os.Stat(dir); err != nil {
+		return nil, err
+	}
+	for _, r := range rules {
+		for _, l := range r.layouts {
+			if !allExist(dir, l.files) {
+				continue
+			}
+			name := l.name
+			if name == "" {
+				name = r.name
+			}
+			if r.name == "Zend Framework" && requiresLaminas(dir) {
+				name = "Laminas"
+			}
+			return &Framework{
+				Name:            name,
+				WebDir:          l.webDir,
+				LibDir:          l.libDir,
+				FrontController: l.frontController,
+				CacheDirs:       append([]string{}, l.cacheDirs...),
+				Evidence:        append([]string{}, l.files...),
+			}, nil
+		}
+	}
+	return nil, nil
+}
+
+func allExist(dir string, files []string) bool {
+	for _, f := range files {
+		if _, err := os.Stat(filepath.Join(dir, filepath.FromSlash(f))); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// requiresLaminas is true when composer.json pulls in Laminas, the successor
+// of Zend Framework, which keeps the same application layout.
+func requiresLaminas(dir string) bool {
+	data, err := ioutil.ReadFile(filepath.Join(dir, "composer.json"))
+	if err != nil {
+		return false
+	}
+	composer := struct {
+		Require map[string]string `json:"require"`
+	}{}
+	if err := json.Unmarshal(data, &composer); err != nil {
+		return false
+	}
+	for name := range composer.Require {
+		if strings.HasPrefix(name, "laminas/") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,13 @@
+package frameworks_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestFrameworks(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Frameworks Suite")
+}
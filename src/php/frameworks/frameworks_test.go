@@ -0,0 +1,104 @@
+package frameworks_test
+
+import (
+	"path/filepath"
+
+	"php/frameworks"
+
+	"github.com/cloudfoundry/libbuildpack/cutlass"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Frameworks", func() {
+	var bpDir string
+
+	BeforeEach(func() {
+		var err error
+		bpDir, err = cutlass.FindRoot()
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	DescribeTable("detecting the buildpack fixtures",
+		func(fixture, name, webDir, frontController string, cacheDir string) {
+			framework, err := frameworks.Detect(filepath.Join(bpDir, "fixtures", fixture))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(framework).NotTo(BeNil())
+			Expect(framework.Name).To(Equal(name))
+			Expect(framework.WebDir).To(Equal(webDir))
+			Expect(framework.LibDir).To(Equal("vendor"))
+			Expect(framework.FrontController).To(Equal(frontController))
+			Expect(framework.CacheDirs).To(ContainElement(cacheDir))
+		},
+		Entry("CakePHP 2", "cake_local_deps", "CakePHP 2", "app/webroot", "index.php", "app/tmp/cache/models"),
+		Entry("Symfony 2", "symfony_2_local_deps", "Symfony 2", "web", "app.php", "app/cache"),
+		Entry("Symfony 2.8", "symfony_28_local_deps", "Symfony 2", "web", "app.php", "app/cache"),
+		Entry("Zend Framework", "zend_local_deps", "Zend Framework", "public", "index.php", "data/cache"),
+	)
+
+	DescribeTable("detecting framework layouts",
+		func(fixture, name, webDir, libDir string, evidence, cacheDirs []string) {
+			framework, err := frameworks.Detect(filepath.Join("testdata", fixture))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(framework).To(Equal(&frameworks.Framework{
+				Name:            name,
+				WebDir:          webDir,
+				LibDir:          libDir,
+				FrontController: "index.php",
+				CacheDirs:       cacheDirs,
+				Evidence:        evidence,
+			}))
+		},
+		Entry("Laravel", "laravel", "Laravel", "public", "vendor",
+			[]string{"artisan", "public/index.php"},
+			[]string{"bootstrap/cache", "storage/framework/cache", "storage/framework/sessions", "storage/framework/views", "storage/logs"}),
+		Entry("Symfony 4", "symfony4", "Symfony 4", "public", "vendor",
+			[]string{"bin/console", "public/index.php"},
+			[]string{"var/cache", "var/log"}),
+		Entry("CakePHP 3", "cakephp3", "CakePHP 3", "webroot", "vendor",
+			[]string{"bin/cake", "webroot/index.php"},
+			[]string{"logs", "tmp/cache/models", "tmp/cache/persistent", "tmp/cache/views", "tmp/sessions"}),
+		Entry("Laminas", "laminas", "Laminas", "public", "vendor",
+			[]string{"config/application.config.php", "public/index.php"},
+			[]string{"data/cache"}),
+		Entry("Drupal 8 with a web directory", "drupal8", "Drupal 8", "web", "vendor",
+			[]string{"web/core/lib/Drupal.php", "web/index.php"},
+			[]string{"web/sites/default/files"}),
+		Entry("Drupal 8 at the application root", "drupal8_root", "Drupal 8", "", "",
+			[]string{"core/lib/Drupal.php", "index.php"},
+			[]string{"sites/default/files"}),
+		Entry("Drupal 7", "drupal7", "Drupal 7", "", "",
+			[]string{"includes/bootstrap.inc", "index.php"},
+			[]string{"sites/default/files"}),
+		Entry("WordPress", "wordpress", "WordPress", "", "",
+			[]string{"wp-settings.php", "index.php"},
+			[]string{"wp-content/uploads"}),
+		Entry("WordPress with Bedrock", "bedrock", "WordPress (Bedrock)", "web", "vendor",
+			[]string{"web/wp/wp-settings.php", "web/index.php"},
+			[]string{"web/app/uploads"}),
+	)
+
+	It("uses the Symfony 3 front controller", func() {
+		framework, err := frameworks.Detect(filepath.Join("testdata", "symfony3"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(framework.Name).To(Equal("Symfony 3"))
+		Expect(framework.WebDir).To(Equal("web"))
+		Expect(framework.FrontController).To(Equal("app.php"))
+	})
+
+	It("detects nothing in a plain PHP app", func() {
+		framework, err := frameworks.Detect(filepath.Join("testdata", "plain"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(framework).To(BeNil())
+
+		framework, err = frameworks.Detect(filepath.Join(bpDir, "fixtures", "php_app"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(framework).To(BeNil())
+	})
+
+	It("fails for a missing directory", func() {
+		_, err := frameworks.Detect(filepath.Join("testdata", "missing"))
+		Expect(err).To(HaveOccurred())
+	})
+})
@@ -22,6 +22,7 @@ var _ = Describe("Composer", func() {
 	})
 
 	It("deploying an app with valid $COMPOSER_GITHUB_OAUTH_TOKEN variable set", func() {
+		SkipUnlessGithubToken()
 		app.SetEnv("COMPOSER_GITHUB_OAUTH_TOKEN", os.Getenv("COMPOSER_GITHUB_OAUTH_TOKEN"))
 		PushAppAndConfirm(app)
 
@@ -0,0 +1,30 @@
+package integration_test
+
+import (
+	"path/filepath"
+
+	"github.com/cloudfoundry/libbuildpack/cutlass"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("CF PHP Buildpack", func() {
+	var app *cutlass.App
+	AfterEach(func() { app = DestroyApp(app) })
+
+	Context("app has an extension with a declarative manifest", func() {
+		BeforeEach(func() {
+			app = cutlass.New(filepath.Join(bpDir, "fixtures", "declarative_extension"))
+			PushAppAndConfirm(app)
+		})
+
+		It("installs its config files, environment and profile.d scripts", func() {
+			Expect(app.Stdout.String()).To(ContainSubstring("Installing extension greeting"))
+			body, err := app.GetBody("/")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(body).To(ContainSubstring("Hello from a declarative extension on httpd"))
+			Expect(body).To(ContainSubstring("visits dir: yes"))
+		})
+	})
+})
@@ -0,0 +1,32 @@
+package integration_test
+
+import (
+	"path/filepath"
+	"time"
+
+	"github.com/cloudfoundry/libbuildpack/cutlass"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("CF PHP Buildpack", func() {
+	var app *cutlass.App
+	AfterEach(func() { app = DestroyApp(app) })
+
+	Context("running a task with php-task", func() {
+		BeforeEach(func() {
+			if !ApiHasTask() {
+				Skip("Running tasks is not supported before CF API version 2.75.0")
+			}
+			app = cutlass.New(filepath.Join(bpDir, "fixtures", "with_task"))
+			PushAppAndConfirm(app)
+		})
+
+		It("runs the command with the PHP of the app", func() {
+			_, err := app.RunTask(`$HOME/.bp/bin/php-task php bin/migrate.php`)
+			Expect(err).NotTo(HaveOccurred())
+			Eventually(app.Stdout.String, 2*time.Minute).Should(ContainSubstring("migrate: ini=/home/vcap/app/php/etc/php.ini bcmath=yes"))
+		})
+	})
+})
@@ -34,8 +34,6 @@ func init() {
 
 var _ = SynchronizedBeforeSuite(func() []byte {
 	// Run once
-	Expect(os.Getenv("COMPOSER_GITHUB_OAUTH_TOKEN")).ToNot(BeEmpty()) // Required for some tests
-
 	if buildpackVersion == "" {
 		packagedBuildpack, err := cutlass.PackageUniquelyVersionedBuildpack()
 		Expect(err).NotTo(HaveOccurred())
@@ -117,6 +115,12 @@ func SkipUnlessUncached() {
 	}
 }
 
+func SkipUnlessGithubToken() {
+	if os.Getenv("COMPOSER_GITHUB_OAUTH_TOKEN") == "" {
+		Skip("COMPOSER_GITHUB_OAUTH_TOKEN is not set")
+	}
+}
+
 func SkipUnlessCached() {
 	if !cutlass.Cached {
 		Skip("Running uncached tests")
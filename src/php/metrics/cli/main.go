@@ -0,0 +1,66 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"php/metrics"
+	"php/serverconf"
+)
+
+func main() {
+	listen := flag.String("listen", serverconf.MetricsListen, "address the metrics are served on")
+	path := flag.String("path", "/metrics", "path the metrics are served at, METRICS_PATH")
+	fpmConf := flag.String("fpm-conf", filepath.Join(os.Getenv("HOME"), "php", "etc", "php-fpm.conf"), "php-fpm.conf naming the status page and where php-fpm listens")
+	webServer := flag.String("web-server", "", "httpd, nginx or none")
+	statusURL := flag.String("status-url", "", "status page of the web server, defaults to the one the buildpack configures")
+	flag.Parse()
+
+	logger := log.New(os.Stderr, "php-metrics: ", 0)
+	exporter := &metrics.Exporter{Log: logger}
+
+	fpm, err := metrics.FPMFromConf(*fpmConf)
+	if err != nil {
+		// keep serving the web server metrics, phpfpm_up tells what is wrong
+		logger.Print(err)
+		exporter.Scrapers = append(exporter.Scrapers, broken{"phpfpm", err})
+	} else {
+		exporter.Scrapers = append(exporter.Scrapers, fpm)
+	}
+
+	switch *webServer {
+	case "nginx":
+		exporter.Scrapers = append(exporter.Scrapers, &metrics.Nginx{URL: or(*statusURL, "http://"+serverconf.StatusListen+serverconf.NginxStatusPath)})
+	case "httpd":
+		exporter.Scrapers = append(exporter.Scrapers, &metrics.HTTPD{URL: or(*statusURL, "http://"+serverconf.StatusListen+serverconf.HTTPDStatusPath+"?auto")})
+	case "", "none":
+	default:
+		fmt.Fprintf(os.Stderr, "unknown web server %q\n", *webServer)
+		os.Exit(2)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle(*path, exporter)
+	logger.Printf("serving %s on %s", *path, *listen)
+	logger.Fatal(http.ListenAndServe(*listen, mux))
+}
+
+// broken reports a scraper which could not be set up.
+type broken struct {
+	name string
+	err  error
+}
+
+func (b broken) Name() string                      { return b.name }
+func (b broken) Scrape() ([]metrics.Metric, error) { return nil, b.err }
+
+func or(value, fallback string) string {
+	if value == "" {
+		return fallback
+	}
+	return value
+}
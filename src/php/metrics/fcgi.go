@@ -0,0 +1,137 @@
+package metrics
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The parts of the FastCGI protocol needed to read a page from php-fpm.
+const (
+	fcgiVersion      = 1
+	fcgiBeginRequest = 1
+	fcgiEndRequest   = 3
+	fcgiParams       = 4
+	fcgiStdin        = 5
+	fcgiStdout       = 6
+	fcgiStderr       = 7
+	fcgiResponder    = 1
+	fcgiRequestID    = 1
+)
+
+type fcgiHeader struct {
+	Version       uint8
+	Type          uint8
+	RequestID     uint16
+	ContentLength uint16
+	PaddingLength uint8
+	Reserved      uint8
+}
+
+// fcgiGet requests path from a FastCGI server, such as php-fpm serving its
+// status page, and returns the body of a 200 response.
+func fcgiGet(network, address, path, query string, timeout time.Duration) ([]byte, error) {
+	conn, err := net.DialTimeout(network, address, timeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(timeout))
+
+	params := [][2]string{
+		{"GATEWAY_INTERFACE", "CGI/1.1"},
+		{"REQUEST_METHOD", "GET"},
+		{"SCRIPT_NAME", path},
+		{"SCRIPT_FILENAME", path},
+		{"REQUEST_URI", path + "?" + query},
+		{"QUERY_STRING", query},
+		{"SERVER_PROTOCOL", "HTTP/1.1"},
+	}
+	var encoded bytes.Buffer
+	for _, p := range params {
+		writeLength(&encoded, len(p[0]))
+		writeLength(&encoded, len(p[1]))
+		encoded.WriteString(p[0])
+		encoded.WriteString(p[1])
+	}
+
+	w := bufio.NewWriter(conn)
+	writeRecord(w, fcgiBeginRequest, []byte{0, fcgiResponder, 0, 0, 0, 0, 0, 0})
+	writeRecord(w, fcgiParams, encoded.Bytes())
+	writeRecord(w, fcgiParams, nil)
+	writeRecord(w, fcgiStdin, nil)
+	if err := w.Flush(); err != nil {
+		return nil, err
+	}
+
+	var stdout, stderr bytes.Buffer
+	r := bufio.NewReader(conn)
+	for {
+		var h fcgiHeader
+		if err := binary.Read(r, binary.BigEndian, &h); err != nil {
+			return nil, fmt.Errorf("reading FastCGI response: %s", err)
+		}
+		content := make([]byte, int(h.ContentLength)+int(h.PaddingLength))
+		if _, err := io.ReadFull(r, content); err != nil {
+			return nil, fmt.Errorf("reading FastCGI response: %s", err)
+		}
+		content = content[:h.ContentLength]
+		switch h.Type {
+		case fcgiStdout:
+			stdout.Write(content)
+		case fcgiStderr:
+			stderr.Write(content)
+		case fcgiEndRequest:
+			return cgiBody(stdout.Bytes(), strings.TrimSpace(stderr.String()))
+		}
+	}
+}
+
+// cgiBody splits the CGI headers from the body, and turns responses other
+// than 200 into errors.
+func cgiBody(response []byte, stderr string) ([]byte, error) {
+	r := textproto.NewReader(bufio.NewReader(bytes.NewReader(response)))
+	headers, err := r.ReadMIMEHeader()
+	if err != nil && err != io.EOF {
+		return nil, fmt.Errorf("invalid CGI response: %s", err)
+	}
+	if status := headers.Get("Status"); status != "" {
+		code, _ := strconv.Atoi(strings.Fields(status)[0])
+		if code != 200 {
+			if stderr != "" {
+				return nil, fmt.Errorf("status %s: %s", status, stderr)
+			}
+			return nil, fmt.Errorf("status %s", status)
+		}
+	}
+	body, err := ioutil.ReadAll(r.R)
+	if err != nil {
+		return nil, err
+	}
+	return body, nil
+}
+
+func writeLength(b *bytes.Buffer, n int) {
+	if n < 128 {
+		b.WriteByte(byte(n))
+		return
+	}
+	binary.Write(b, binary.BigEndian, uint32(n)|1<<31)
+}
+
+func writeRecord(w io.Writer, recordType uint8, content []byte) error {
+	h := fcgiHeader{Version: fcgiVersion, Type: recordType, RequestID: fcgiRequestID, ContentLength: uint16(len(content))}
+	if err := binary.Write(w, binary.BigEndian, h); err != nil {
+		return err
+	}
+	_, err := w.Write(content)
+	return err
+}
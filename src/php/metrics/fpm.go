@@ -0,0 +1,113 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"php/fpmstatus"
+)
+
+// FPM reads the status page straight from php-fpm, so it works whether or
+// not FPM_STATUS exposes the page through the web server.
+type FPM struct {
+	Network    string
+	Address    string
+	StatusPath string
+	Timeout    time.Duration
+}
+
+// FPMFromConf finds where the pool listens and its pm.status_path in a
+// php-fpm.conf which bin/rewrite has already processed.
+func FPMFromConf(path string) (*FPM, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	settings := map[string]string{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == ';' || line[0] == '[' {
+			continue
+		}
+		kv := strings.SplitN(line, "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		key := strings.TrimSpace(kv[0])
+		if _, ok := settings[key]; !ok {
+			settings[key] = strings.Trim(strings.TrimSpace(kv[1]), `"`)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	fpm := &FPM{StatusPath: settings["pm.status_path"]}
+	if fpm.StatusPath == "" {
+		return nil, fmt.Errorf("%s does not set pm.status_path", path)
+	}
+	fpm.Network, fpm.Address = listenAddress(settings["listen"])
+	if fpm.Address == "" {
+		return nil, fmt.Errorf("%s does not set listen", path)
+	}
+	return fpm, nil
+}
+
+// listenAddress converts the php-fpm listen setting, which is a socket
+// path, a port or an address with a port.
+func listenAddress(listen string) (string, string) {
+	switch {
+	case listen == "":
+		return "", ""
+	case strings.HasPrefix(listen, "/"):
+		return "unix", listen
+	case !strings.Contains(listen, ":"):
+		return "tcp", "127.0.0.1:" + listen
+	}
+	return "tcp", listen
+}
+
+func (f *FPM) Name() string {
+	return "phpfpm"
+}
+
+func (f *FPM) Scrape() ([]Metric, error) {
+	timeout := f.Timeout
+	if timeout == 0 {
+		timeout = DefaultTimeout
+	}
+	body, err := fcgiGet(f.Network, f.Address, f.StatusPath, "json", timeout)
+	if err != nil {
+		return nil, err
+	}
+	status, err := fpmstatus.Parse(body)
+	if err != nil {
+		return nil, err
+	}
+	return FPMMetrics(status), nil
+}
+
+// FPMMetrics converts a pool status. The request reading the status is
+// counted as an active process.
+func FPMMetrics(s *fpmstatus.Status) []Metric {
+	pool := map[string]string{"pool": s.Pool}
+	return []Metric{
+		{"phpfpm_start_since_seconds", "Seconds since php-fpm started the pool.", Counter, pool, float64(s.StartSince)},
+		{"phpfpm_accepted_connections_total", "Requests accepted by the pool.", Counter, pool, float64(s.AcceptedConn)},
+		{"phpfpm_listen_queue", "Requests waiting for a free process.", Gauge, pool, float64(s.ListenQueue)},
+		{"phpfpm_max_listen_queue", "Most requests which waited for a free process at once.", Gauge, pool, float64(s.MaxListenQueue)},
+		{"phpfpm_listen_queue_length", "Size of the queue of waiting requests.", Gauge, pool, float64(s.ListenQueueLen)},
+		{"phpfpm_idle_processes", "Processes waiting for a request.", Gauge, pool, float64(s.IdleProcesses)},
+		{"phpfpm_active_processes", "Processes serving a request.", Gauge, pool, float64(s.ActiveProcesses)},
+		{"phpfpm_total_processes", "Idle and active processes.", Gauge, pool, float64(s.TotalProcesses)},
+		{"phpfpm_max_active_processes", "Most processes active at once.", Gauge, pool, float64(s.MaxActiveProcesses)},
+		{"phpfpm_max_children_reached_total", "Times pm.max_children stopped the pool from starting a process.", Counter, pool, float64(s.MaxChildrenReached)},
+		{"phpfpm_slow_requests_total", "Requests which took longer than request_slowlog_timeout.", Counter, pool, float64(s.SlowRequests)},
+	}
+}
@@ -0,0 +1,95 @@
+// Package metrics serves the php-fpm and web server status pages as
+// Prometheus metrics. It runs as a process next to php-fpm and the web
+// server, which proxies METRICS_PATH to it.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	Counter = "counter"
+	Gauge   = "gauge"
+)
+
+// Metric is a single sample. Samples of the same name must be next to each
+// other, so HELP and TYPE are written once.
+type Metric struct {
+	Name   string
+	Help   string
+	Type   string
+	Labels map[string]string
+	Value  float64
+}
+
+// Scraper reads one status page.
+type Scraper interface {
+	// Name prefixes the metrics, and names the up metric.
+	Name() string
+	Scrape() ([]Metric, error)
+}
+
+// Exporter scrapes every status page for each request, so the metrics are
+// never older than the scrape of Prometheus.
+type Exporter struct {
+	Scrapers []Scraper
+	Log      *log.Logger
+}
+
+func (e *Exporter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var all []Metric
+	for _, s := range e.Scrapers {
+		metrics, err := s.Scrape()
+		up := 1.0
+		if err != nil {
+			up = 0
+			metrics = nil
+			if e.Log != nil {
+				e.Log.Printf("scraping %s: %s", s.Name(), err)
+			}
+		}
+		all = append(all, Metric{Name: s.Name() + "_up", Help: "Whether the " + s.Name() + " status page could be read.", Type: Gauge, Value: up})
+		all = append(all, metrics...)
+	}
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	Write(w, all)
+}
+
+// Write renders the metrics in the Prometheus text format.
+func Write(w io.Writer, metrics []Metric) error {
+	last := ""
+	for _, m := range metrics {
+		if m.Name != last {
+			if _, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", m.Name, m.Help, m.Name, m.Type); err != nil {
+				return err
+			}
+			last = m.Name
+		}
+		if _, err := fmt.Fprintf(w, "%s%s %s\n", m.Name, labels(m.Labels), strconv.FormatFloat(m.Value, 'f', -1, 64)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func labels(l map[string]string) string {
+	if len(l) == 0 {
+		return ""
+	}
+	var names []string
+	for name := range l {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var pairs []string
+	for _, name := range names {
+		pairs = append(pairs, fmt.Sprintf("%s=%q", name, l[name]))
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
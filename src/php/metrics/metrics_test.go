@@ -0,0 +1,184 @@
+package metrics_test
+
+import (
+	"errors"
+	"flag"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/fcgi"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"php/metrics"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+func recorded(name string) []byte {
+	data, err := ioutil.ReadFile(filepath.Join("testdata", name))
+	Expect(err).NotTo(HaveOccurred())
+	return data
+}
+
+func golden(name, actual string) {
+	path := filepath.Join("testdata", name)
+	if *update {
+		Expect(ioutil.WriteFile(path, []byte(actual), 0644)).To(Succeed())
+	}
+	expected, err := ioutil.ReadFile(path)
+	Expect(err).NotTo(HaveOccurred(), "run go test with -update to create %s", path)
+	Expect(actual).To(Equal(string(expected)))
+}
+
+// fakeFPM answers FastCGI requests like php-fpm does for its status page.
+func fakeFPM(status []byte) net.Listener {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	Expect(err).NotTo(HaveOccurred())
+	go fcgi.Serve(listener, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/fpm-status" || r.URL.RawQuery != "json" {
+			http.Error(w, "File not found.", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(status)
+	}))
+	return listener
+}
+
+func scrape(exporter *metrics.Exporter) string {
+	w := httptest.NewRecorder()
+	exporter.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	Expect(w.Code).To(Equal(http.StatusOK))
+	Expect(w.Header().Get("Content-Type")).To(HavePrefix("text/plain; version=0.0.4"))
+	return w.Body.String()
+}
+
+type failing struct{}
+
+func (failing) Name() string                      { return "phpfpm" }
+func (failing) Scrape() ([]metrics.Metric, error) { return nil, errors.New("connection refused") }
+
+var _ = Describe("Metrics", func() {
+	var fpm net.Listener
+
+	BeforeEach(func() {
+		fpm = fakeFPM(recorded("fpm-status.json"))
+	})
+
+	AfterEach(func() {
+		fpm.Close()
+	})
+
+	It("reads the status page from php-fpm over FastCGI", func() {
+		f := &metrics.FPM{Network: "tcp", Address: fpm.Addr().String(), StatusPath: "/fpm-status"}
+		scraped, err := f.Scrape()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(scraped).To(ContainElement(metrics.Metric{
+			Name:   "phpfpm_accepted_connections_total",
+			Help:   "Requests accepted by the pool.",
+			Type:   metrics.Counter,
+			Labels: map[string]string{"pool": "www"},
+			Value:  7,
+		}))
+	})
+
+	It("fails when php-fpm does not serve the status page", func() {
+		f := &metrics.FPM{Network: "tcp", Address: fpm.Addr().String(), StatusPath: "/status"}
+		_, err := f.Scrape()
+		Expect(err).To(MatchError(HavePrefix("status 404")))
+	})
+
+	DescribeTable("exports php-fpm and the web server",
+		func(file string, webServer func(url string) metrics.Scraper, page string) {
+			body := recorded(page)
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.Write(body) }))
+			defer server.Close()
+			exporter := &metrics.Exporter{Scrapers: []metrics.Scraper{
+				&metrics.FPM{Network: "tcp", Address: fpm.Addr().String(), StatusPath: "/fpm-status"},
+				webServer(server.URL),
+			}}
+			golden(file, scrape(exporter))
+		},
+		Entry("nginx", "nginx.prom", func(url string) metrics.Scraper { return &metrics.Nginx{URL: url} }, "stub_status.txt"),
+		Entry("httpd", "httpd.prom", func(url string) metrics.Scraper { return &metrics.HTTPD{URL: url} }, "server-status.txt"),
+	)
+
+	It("reports a status page which cannot be read as down", func() {
+		server := httptest.NewServer(http.NotFoundHandler())
+		defer server.Close()
+		exporter := &metrics.Exporter{Scrapers: []metrics.Scraper{failing{}, &metrics.Nginx{URL: server.URL}}}
+		Expect(scrape(exporter)).To(Equal(strings.Join([]string{
+			"# HELP phpfpm_up Whether the phpfpm status page could be read.",
+			"# TYPE phpfpm_up gauge",
+			"phpfpm_up 0",
+			"# HELP nginx_up Whether the nginx status page could be read.",
+			"# TYPE nginx_up gauge",
+			"nginx_up 0",
+			"",
+		}, "\n")))
+	})
+
+	DescribeTable("rejects pages which are not status pages",
+		func(parse func([]byte) ([]metrics.Metric, error)) {
+			_, err := parse([]byte("<html>Welcome</html>"))
+			Expect(err).To(HaveOccurred())
+		},
+		Entry("nginx", metrics.NginxMetrics),
+		Entry("httpd", metrics.HTTPDMetrics),
+	)
+
+	Describe("FPMFromConf", func() {
+		var dir string
+
+		BeforeEach(func() {
+			var err error
+			dir, err = ioutil.TempDir("", "metrics")
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		AfterEach(func() {
+			os.RemoveAll(dir)
+		})
+
+		conf := func(content string) string {
+			path := filepath.Join(dir, "php-fpm.conf")
+			Expect(ioutil.WriteFile(path, []byte(content), 0644)).To(Succeed())
+			return path
+		}
+
+		It("finds the socket and the status page", func() {
+			f, err := metrics.FPMFromConf(filepath.Join("testdata", "php-fpm.conf"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(*f).To(Equal(metrics.FPM{Network: "unix", Address: "/home/vcap/tmp/php-fpm.socket", StatusPath: "/fpm-status"}))
+		})
+
+		DescribeTable("listen addresses",
+			func(listen, network, address string) {
+				f, err := metrics.FPMFromConf(conf("[www]\nlisten = " + listen + "\npm.status_path = /fpm-status\n"))
+				Expect(err).NotTo(HaveOccurred())
+				Expect(f.Network).To(Equal(network))
+				Expect(f.Address).To(Equal(address))
+			},
+			Entry("address and port", "127.0.0.1:9000", "tcp", "127.0.0.1:9000"),
+			Entry("port", "9000", "tcp", "127.0.0.1:9000"),
+			Entry("socket", "/tmp/php-fpm.socket", "unix", "/tmp/php-fpm.socket"),
+		)
+
+		It("needs the status page", func() {
+			_, err := metrics.FPMFromConf(conf("[www]\nlisten = 9000\n"))
+			Expect(err).To(MatchError(ContainSubstring("does not set pm.status_path")))
+		})
+
+		It("needs the listen address", func() {
+			_, err := metrics.FPMFromConf(conf("[www]\npm.status_path = /fpm-status\n"))
+			Expect(err).To(MatchError(ContainSubstring("does not set listen")))
+		})
+	})
+})
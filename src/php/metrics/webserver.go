@@ -0,0 +1,157 @@
+package metrics
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultTimeout bounds the scrape of each status page.
+const DefaultTimeout = 5 * time.Second
+
+// Nginx reads the page of the stub_status module.
+type Nginx struct {
+	URL    string
+	Client *http.Client
+}
+
+func (n *Nginx) Name() string {
+	return "nginx"
+}
+
+func (n *Nginx) Scrape() ([]Metric, error) {
+	body, err := get(n.Client, n.URL)
+	if err != nil {
+		return nil, err
+	}
+	return NginxMetrics(body)
+}
+
+// NginxMetrics parses a stub_status page:
+//
+//	Active connections: 291
+//	server accepts handled requests
+//	 16630948 16630948 31070465
+//	Reading: 6 Writing: 179 Waiting: 106
+func NginxMetrics(page []byte) ([]Metric, error) {
+	fields := strings.Fields(string(page))
+	if len(fields) != 16 || fields[0] != "Active" || fields[4] != "accepts" {
+		return nil, fmt.Errorf("invalid stub_status page %q", page)
+	}
+	var values []float64
+	for _, i := range []int{2, 7, 8, 9, 11, 13, 15} {
+		v, err := strconv.ParseFloat(fields[i], 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid stub_status page %q", page)
+		}
+		values = append(values, v)
+	}
+	return []Metric{
+		{"nginx_connections_active", "Open client connections, including waiting ones.", Gauge, nil, values[0]},
+		{"nginx_connections_accepted_total", "Accepted client connections.", Counter, nil, values[1]},
+		{"nginx_connections_handled_total", "Handled client connections.", Counter, nil, values[2]},
+		{"nginx_http_requests_total", "Client requests.", Counter, nil, values[3]},
+		{"nginx_connections_reading", "Connections reading the request header.", Gauge, nil, values[4]},
+		{"nginx_connections_writing", "Connections writing the response.", Gauge, nil, values[5]},
+		{"nginx_connections_waiting", "Idle client connections waiting for a request.", Gauge, nil, values[6]},
+	}, nil
+}
+
+// HTTPD reads the machine readable page of mod_status, `server-status?auto`.
+type HTTPD struct {
+	URL    string
+	Client *http.Client
+}
+
+func (h *HTTPD) Name() string {
+	return "apache"
+}
+
+func (h *HTTPD) Scrape() ([]Metric, error) {
+	body, err := get(h.Client, h.URL)
+	if err != nil {
+		return nil, err
+	}
+	return HTTPDMetrics(body)
+}
+
+// scoreboardStates names the slots of the mod_status scoreboard.
+var scoreboardStates = []struct {
+	key   byte
+	state string
+}{
+	{'_', "idle"},
+	{'S', "startup"},
+	{'R', "read"},
+	{'W', "reply"},
+	{'K', "keepalive"},
+	{'D', "dns"},
+	{'C', "closing"},
+	{'L', "logging"},
+	{'G', "graceful_stop"},
+	{'I', "idle_cleanup"},
+	{'.', "open_slot"},
+}
+
+// HTTPDMetrics parses a `server-status?auto` page. The totals are only
+// there with ExtendedStatus, which mod_status turns on by default.
+func HTTPDMetrics(page []byte) ([]Metric, error) {
+	values := map[string]string{}
+	scanner := bufio.NewScanner(bytes.NewReader(page))
+	for scanner.Scan() {
+		kv := strings.SplitN(scanner.Text(), ":", 2)
+		if len(kv) == 2 {
+			values[kv[0]] = strings.TrimSpace(kv[1])
+		}
+	}
+	if _, ok := values["Scoreboard"]; !ok {
+		return nil, fmt.Errorf("invalid server-status page %q", page)
+	}
+
+	var metrics []Metric
+	add := func(key, name, help, metricType string, scale float64, labels map[string]string) {
+		if v, err := strconv.ParseFloat(values[key], 64); err == nil {
+			metrics = append(metrics, Metric{name, help, metricType, labels, v * scale})
+		}
+	}
+	add("Total Accesses", "apache_accesses_total", "Requests served.", Counter, 1, nil)
+	add("Total kBytes", "apache_sent_bytes_total", "Bytes sent.", Counter, 1024, nil)
+	add("Uptime", "apache_uptime_seconds_total", "Seconds since the server started.", Counter, 1, nil)
+	add("BusyWorkers", "apache_workers", "Workers by state.", Gauge, 1, map[string]string{"state": "busy"})
+	add("IdleWorkers", "apache_workers", "Workers by state.", Gauge, 1, map[string]string{"state": "idle"})
+	add("ConnsTotal", "apache_connections", "Connections by state.", Gauge, 1, map[string]string{"state": "total"})
+	add("ConnsAsyncWriting", "apache_connections", "Connections by state.", Gauge, 1, map[string]string{"state": "writing"})
+	add("ConnsAsyncKeepAlive", "apache_connections", "Connections by state.", Gauge, 1, map[string]string{"state": "keepalive"})
+	add("ConnsAsyncClosing", "apache_connections", "Connections by state.", Gauge, 1, map[string]string{"state": "closing"})
+
+	scoreboard := values["Scoreboard"]
+	for _, s := range scoreboardStates {
+		metrics = append(metrics, Metric{"apache_scoreboard", "Scoreboard slots by state.", Gauge,
+			map[string]string{"state": s.state}, float64(strings.Count(scoreboard, string(s.key)))})
+	}
+	return metrics, nil
+}
+
+func get(client *http.Client, url string) ([]byte, error) {
+	if client == nil {
+		client = &http.Client{Timeout: DefaultTimeout}
+	}
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s: %s", url, resp.Status)
+	}
+	return body, nil
+}
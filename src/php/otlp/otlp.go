@@ -0,0 +1,165 @@
+// Package otlp is a local stand-in for an OpenTelemetry collector which
+// receives traces over OTLP/HTTP, so the configuration written by the
+// opentelemetry extension can be checked end to end without a collector.
+//
+// Only the JSON encoding of OTLP is understood; protobuf requests are
+// rejected with 415 Unsupported Media Type, which a real collector would
+// accept.
+package otlp
+
+import (
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+)
+
+// TracesPath is where OTLP/HTTP exporters send traces, relative to
+// OTEL_EXPORTER_OTLP_ENDPOINT.
+const TracesPath = "/v1/traces"
+
+// Span is a received span, with the attributes of its resource.
+type Span struct {
+	TraceID    string
+	SpanID     string
+	Name       string
+	Kind       int
+	Attributes map[string]string
+	Resource   map[string]string
+	// Header holds the HTTP headers of the export request.
+	Header http.Header
+}
+
+type Collector struct {
+	*httptest.Server
+
+	mu    sync.Mutex
+	spans []Span
+}
+
+// New starts a collector on a local port. Call Close when done.
+func New() *Collector {
+	c := &Collector{}
+	c.Server = httptest.NewServer(http.HandlerFunc(c.serve))
+	return c
+}
+
+// NewOn starts a collector on listener, for exporters which can't reach the
+// loopback interface, such as one in a container.
+func NewOn(listener net.Listener) *Collector {
+	c := &Collector{}
+	c.Server = httptest.NewUnstartedServer(http.HandlerFunc(c.serve))
+	c.Server.Listener.Close()
+	c.Server.Listener = listener
+	c.Server.Start()
+	return c
+}
+
+// Spans returns the spans received so far, in order.
+func (c *Collector) Spans() []Span {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]Span{}, c.spans...)
+}
+
+type anyValue struct {
+	StringValue *string     `json:"stringValue"`
+	BoolValue   *bool       `json:"boolValue"`
+	IntValue    json.Number `json:"intValue"`
+	DoubleValue json.Number `json:"doubleValue"`
+}
+
+func (v anyValue) String() string {
+	switch {
+	case v.StringValue != nil:
+		return *v.StringValue
+	case v.BoolValue != nil:
+		return strconv.FormatBool(*v.BoolValue)
+	case v.IntValue != "":
+		return v.IntValue.String()
+	default:
+		return v.DoubleValue.String()
+	}
+}
+
+type keyValue struct {
+	Key   string   `json:"key"`
+	Value anyValue `json:"value"`
+}
+
+type traces struct {
+	ResourceSpans []struct {
+		Resource struct {
+			Attributes []keyValue `json:"attributes"`
+		} `json:"resource"`
+		ScopeSpans []struct {
+			Spans []struct {
+				TraceID    string     `json:"traceId"`
+				SpanID     string     `json:"spanId"`
+				Name       string     `json:"name"`
+				Kind       int        `json:"kind"`
+				Attributes []keyValue `json:"attributes"`
+			} `json:"spans"`
+		} `json:"scopeSpans"`
+	} `json:"resourceSpans"`
+}
+
+func attributes(kvs []keyValue) map[string]string {
+	m := map[string]string{}
+	for _, kv := range kvs {
+		m[kv.Key] = kv.Value.String()
+	}
+	return m
+}
+
+func (c *Collector) serve(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != TracesPath {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != "POST" {
+		w.Header().Set("Allow", "POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType != "application/json" {
+		http.Error(w, fmt.Sprintf("unsupported content type %q, only application/json is understood", mediaType),
+			http.StatusUnsupportedMediaType)
+		return
+	}
+
+	var body traces
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var spans []Span
+	for _, rs := range body.ResourceSpans {
+		resource := attributes(rs.Resource.Attributes)
+		for _, ss := range rs.ScopeSpans {
+			for _, s := range ss.Spans {
+				spans = append(spans, Span{
+					TraceID:    s.TraceID,
+					SpanID:     s.SpanID,
+					Name:       s.Name,
+					Kind:       s.Kind,
+					Attributes: attributes(s.Attributes),
+					Resource:   resource,
+					Header:     r.Header,
+				})
+			}
+		}
+	}
+
+	c.mu.Lock()
+	c.spans = append(c.spans, spans...)
+	c.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write([]byte("{}"))
+}
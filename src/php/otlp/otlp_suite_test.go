@@ -0,0 +1,13 @@
+package otlp_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestOtlp(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Otlp Suite")
+}
@@ -0,0 +1,91 @@
+package otlp_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"path/filepath"
+
+	"php/otlp"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("OTLP collector", func() {
+	var collector *otlp.Collector
+
+	BeforeEach(func() { collector = otlp.New() })
+	AfterEach(func() { collector.Close() })
+
+	post := func(path, contentType string, body []byte) int {
+		req, err := http.NewRequest("POST", collector.URL+path, bytes.NewReader(body))
+		Expect(err).NotTo(HaveOccurred())
+		req.Header.Set("Content-Type", contentType)
+		req.Header.Set("X-Api-Key", "secret")
+		resp, err := http.DefaultClient.Do(req)
+		Expect(err).NotTo(HaveOccurred())
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	traces := func() []byte {
+		body, err := ioutil.ReadFile(filepath.Join("testdata", "traces.json"))
+		Expect(err).NotTo(HaveOccurred())
+		return body
+	}
+
+	It("records the spans of an export", func() {
+		Expect(post(otlp.TracesPath, "application/json", traces())).To(Equal(http.StatusOK))
+
+		spans := collector.Spans()
+		Expect(spans).To(HaveLen(1))
+		Expect(spans[0].TraceID).To(Equal("5b8efff798038103d269b633813fc60c"))
+		Expect(spans[0].SpanID).To(Equal("eee19b7ec3c1b174"))
+		Expect(spans[0].Name).To(Equal("GET /index.php"))
+		Expect(spans[0].Kind).To(Equal(2))
+		Expect(spans[0].Attributes).To(Equal(map[string]string{
+			"http.method":      "GET",
+			"http.status_code": "200",
+			"sampled":          "true",
+			"duration":         "1.5",
+		}))
+		Expect(spans[0].Resource).To(Equal(map[string]string{
+			"service.name":                 "php-app",
+			"cloudfoundry.app.instance.id": "2",
+		}))
+		Expect(spans[0].Header.Get("X-Api-Key")).To(Equal("secret"))
+	})
+
+	It("rejects protobuf", func() {
+		Expect(post(otlp.TracesPath, "application/x-protobuf", []byte{0x0a})).To(Equal(http.StatusUnsupportedMediaType))
+		Expect(collector.Spans()).To(BeEmpty())
+	})
+
+	It("rejects malformed JSON", func() {
+		Expect(post(otlp.TracesPath, "application/json", []byte("{"))).To(Equal(http.StatusBadRequest))
+	})
+
+	It("only serves traces", func() {
+		Expect(post("/v1/metrics", "application/json", []byte("{}"))).To(Equal(http.StatusNotFound))
+
+		resp, err := http.Get(collector.URL + otlp.TracesPath)
+		Expect(err).NotTo(HaveOccurred())
+		resp.Body.Close()
+		Expect(resp.StatusCode).To(Equal(http.StatusMethodNotAllowed))
+	})
+
+	It("serves on a given listener", func() {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		Expect(err).NotTo(HaveOccurred())
+		other := otlp.NewOn(listener)
+		defer other.Close()
+
+		Expect(other.URL).To(Equal("http://" + listener.Addr().String()))
+		resp, err := http.Post(other.URL+otlp.TracesPath, "application/json", bytes.NewReader(traces()))
+		Expect(err).NotTo(HaveOccurred())
+		resp.Body.Close()
+		Expect(other.Spans()).To(HaveLen(1))
+	})
+})
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"php/platform"
+)
+
+func main() {
+	lockPath := flag.String("lock", "composer.lock", "path to composer.lock")
+	manifestPath := flag.String("manifest", "manifest.yml", "path to the buildpack manifest")
+	phpVersion := flag.String("php", "", "selected PHP version")
+	includeDev := flag.Bool("dev", false, "also check packages-dev")
+	flag.Parse()
+
+	lock, err := platform.LoadLockfile(*lockPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	modules, err := platform.ModulesFor(*manifestPath, *phpVersion)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	checker := &platform.Checker{PHPVersion: *phpVersion, Modules: modules, IncludeDev: *includeDev}
+	result, err := checker.Check(lock)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	for _, ext := range result.Extensions {
+		fmt.Println(ext)
+	}
+	for _, req := range result.Unmet {
+		fmt.Fprintln(os.Stderr, req)
+	}
+	if len(result.Unmet) > 0 {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,239 @@
+package platform
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/Masterminds/semver"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// Extensions compiled into every PHP binary shipped by the buildpack. These
+// never appear in the manifest `modules` list but always satisfy an `ext-*`
+// requirement.
+var builtinExtensions = []string{
+	"core", "ctype", "date", "dom", "filter", "hash", "iconv", "json",
+	"libxml", "mysqlnd", "pcre", "phar", "posix", "readline", "reflection",
+	"session", "simplexml", "spl", "standard", "tokenizer", "xml",
+	"xmlreader", "xmlwriter",
+}
+
+// extensionAliases maps the names composer gives some extensions to the
+// module shipped in the manifest.
+var extensionAliases = map[string]string{
+	"zend-opcache": "opcache",
+}
+
+// RootPackage is the name reported for requirements declared by the
+// application itself, which composer.lock records under `platform`.
+const RootPackage = "<root>"
+
+// Requirements is the `require` map of a package. composer writes an empty
+// map as `[]`, so both forms are accepted.
+type Requirements map[string]string
+
+func (r *Requirements) UnmarshalJSON(data []byte) error {
+	if bytes.Equal(bytes.TrimSpace(data), []byte("[]")) {
+		*r = Requirements{}
+		return nil
+	}
+	m := map[string]string{}
+	if err := json.Unmarshal(data, &m); err != nil {
+		return err
+	}
+	*r = Requirements(m)
+	return nil
+}
+
+type Package struct {
+	Name    string       `json:"name"`
+	Require Requirements `json:"require"`
+}
+
+type Lockfile struct {
+	Packages    []Package    `json:"packages"`
+	PackagesDev []Package    `json:"packages-dev"`
+	Platform    Requirements `json:"platform"`
+	PlatformDev Requirements `json:"platform-dev"`
+}
+
+// Requirement is a single platform requirement which the selected PHP
+// version cannot satisfy.
+type Requirement struct {
+	Package    string
+	Name       string
+	Constraint string
+	Reason     string
+}
+
+func (r Requirement) String() string {
+	return fmt.Sprintf("%s requires %s %s (%s)", r.Package, r.Name, r.Constraint, r.Reason)
+}
+
+type Result struct {
+	Extensions []string
+	Unmet      []Requirement
+}
+
+type Checker struct {
+	PHPVersion string
+	Modules    []string
+	IncludeDev bool
+}
+
+type manifest struct {
+	Dependencies []struct {
+		Name    string   `yaml:"name"`
+		Version string   `yaml:"version"`
+		Modules []string `yaml:"modules"`
+	} `yaml:"dependencies"`
+}
+
+func LoadLockfile(path string) (*Lockfile, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	lock := &Lockfile{}
+	if err := json.Unmarshal(data, lock); err != nil {
+		return nil, fmt.Errorf("could not parse %s: %s", path, err)
+	}
+	return lock, nil
+}
+
+// ModulesFor returns the modules the manifest lists for the given PHP version.
+func ModulesFor(manifestPath, phpVersion string) ([]string, error) {
+	data, err := ioutil.ReadFile(manifestPath)
+	if err != nil {
+		return nil, err
+	}
+	m := manifest{}
+	if err := yaml.Unmarshal(data, &m); err != nil {
+		return nil, err
+	}
+	for _, dep := range m.Dependencies {
+		if dep.Name == "php" && dep.Version == phpVersion {
+			return dep.Modules, nil
+		}
+	}
+	return nil, fmt.Errorf("php %s not found in %s", phpVersion, manifestPath)
+}
+
+func (c *Checker) Check(lock *Lockfile) (*Result, error) {
+	version, err := semver.NewVersion(c.PHPVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	modules := map[string]bool{}
+	for _, m := range c.Modules {
+		modules[strings.ToLower(m)] = true
+	}
+	builtin := map[string]bool{}
+	for _, m := range builtinExtensions {
+		builtin[m] = true
+	}
+
+	packages := append([]Package{{Name: RootPackage, Require: lock.Platform}}, lock.Packages...)
+	if c.IncludeDev {
+		packages = append(packages, Package{Name: RootPackage, Require: lock.PlatformDev})
+		packages = append(packages, lock.PackagesDev...)
+	}
+
+	result := &Result{}
+	enabled := map[string]bool{}
+	for _, pkg := range packages {
+		for _, name := range sortedKeys(pkg.Require) {
+			constraint := pkg.Require[name]
+			switch {
+			case name == "php" || name == "php-64bit":
+				ok, err := satisfies(version, constraint)
+				if err != nil {
+					return nil, fmt.Errorf("%s: %s", pkg.Name, err)
+				}
+				if !ok {
+					result.Unmet = append(result.Unmet, Requirement{pkg.Name, name, constraint, "PHP " + c.PHPVersion + " selected"})
+				}
+			case strings.HasPrefix(name, "ext-"):
+				ext := strings.ToLower(strings.TrimPrefix(name, "ext-"))
+				if alias, ok := extensionAliases[ext]; ok {
+					ext = alias
+				}
+				if modules[ext] {
+					if !enabled[ext] {
+						enabled[ext] = true
+						result.Extensions = append(result.Extensions, ext)
+					}
+				} else if !builtin[ext] {
+					result.Unmet = append(result.Unmet, Requirement{pkg.Name, name, constraint, "not available for PHP " + c.PHPVersion})
+				}
+			}
+		}
+	}
+	return result, nil
+}
+
+var stabilityFlag = regexp.MustCompile(`@[a-zA-Z]+`)
+var orSeparator = regexp.MustCompile(`\s*\|\|?\s*`)
+var andSeparator = regexp.MustCompile(`\s*,\s*|\s+`)
+var operatorSpace = regexp.MustCompile(`(>=|<=|!=|>|<|=|\^|~)\s+`)
+var tildeRange = regexp.MustCompile(`^~(\d+)(?:\.(\d+))?(?:\.(\d+))?(.*)$`)
+
+// satisfies checks a version against a composer constraint, translating the
+// composer syntax (`|` and whitespace separators, stability flags, tilde
+// ranges) into the form understood by semver.
+func satisfies(version *semver.Version, constraint string) (bool, error) {
+	constraint = stabilityFlag.ReplaceAllString(strings.TrimSpace(constraint), "")
+	constraint = operatorSpace.ReplaceAllString(constraint, "$1")
+
+	var ors []string
+	for _, or := range orSeparator.Split(constraint, -1) {
+		if strings.Contains(or, " - ") {
+			ors = append(ors, or)
+			continue
+		}
+		ands := andSeparator.Split(strings.TrimSpace(or), -1)
+		for i, and := range ands {
+			ands[i] = composerTilde(and)
+		}
+		ors = append(ors, strings.Join(ands, ","))
+	}
+
+	c, err := semver.NewConstraint(strings.Join(ors, " || "))
+	if err != nil {
+		return false, fmt.Errorf("invalid constraint %q: %s", constraint, err)
+	}
+	return c.Check(version), nil
+}
+
+// composerTilde rewrites a composer tilde range as bounds. composer lets the
+// last given part of the version move, `~7.0` is `>=7.0,<8.0` and `~7.0.1`
+// is `>=7.0.1,<7.1`, where semver would read `~7.0` as `<7.1`.
+func composerTilde(constraint string) string {
+	m := tildeRange.FindStringSubmatch(constraint)
+	if m == nil {
+		return constraint
+	}
+	lower := strings.TrimPrefix(constraint, "~")
+	major, _ := strconv.Atoi(m[1])
+	if m[3] == "" {
+		return fmt.Sprintf(">=%s,<%d.0", lower, major+1)
+	}
+	minor, _ := strconv.Atoi(m[2])
+	return fmt.Sprintf(">=%s,<%d.%d", lower, major, minor+1)
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,85 @@
+package platform_test
+
+import (
+	"path/filepath"
+
+	"php/platform"
+
+	"github.com/cloudfoundry/libbuildpack/cutlass"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Platform", func() {
+	modules := []string{"curl", "fileinfo", "gd", "mbstring", "mongodb", "opcache", "openssl", "xdebug", "zip"}
+
+	unmetNames := func(result *platform.Result) []string {
+		names := []string{}
+		for _, req := range result.Unmet {
+			names = append(names, req.Package+" "+req.Name)
+		}
+		return names
+	}
+
+	DescribeTable("checking lockfile fixtures",
+		func(fixture, phpVersion string, includeDev bool, extensions, unmet []string) {
+			lock, err := platform.LoadLockfile(filepath.Join("testdata", fixture))
+			Expect(err).NotTo(HaveOccurred())
+
+			checker := &platform.Checker{PHPVersion: phpVersion, Modules: modules, IncludeDev: includeDev}
+			result, err := checker.Check(lock)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(result.Extensions).To(ConsistOf(extensions))
+			Expect(unmetNames(result)).To(ConsistOf(unmet))
+		},
+		Entry("enables extensions required by packages and the app", "extensions.lock", "7.1.15", false,
+			[]string{"gd", "opcache", "fileinfo", "mongodb"}, []string{}),
+		Entry("reports an extension the buildpack does not provide", "intl.lock", "7.2.3", false,
+			[]string{}, []string{"symfony/intl ext-intl"}),
+		Entry("reports packages which need a newer PHP", "php_version.lock", "5.6.34", false,
+			[]string{"mbstring", "openssl"}, []string{"symfony/console php", "laravel/framework php"}),
+		Entry("accepts a PHP satisfying every package", "php_version.lock", "7.2.3", false,
+			[]string{"mbstring", "openssl"}, []string{}),
+		Entry("reads tilde ranges as composer does", "tilde.lock", "7.2.3", false,
+			[]string{}, []string{"vendor/patch php"}),
+		Entry("reports tilde ranges below the selected PHP", "tilde.lock", "5.6.34", false,
+			[]string{}, []string{"guzzlehttp/psr7 php", "doctrine/cache php", "vendor/major php", "vendor/patch php"}),
+		Entry("ignores dev packages by default", "dev.lock", "7.1.15", false,
+			[]string{}, []string{}),
+		Entry("checks dev packages when requested", "dev.lock", "7.1.15", true,
+			[]string{"xdebug"}, []string{"<root> ext-sodium"}),
+	)
+
+	It("describes an unmet requirement", func() {
+		req := platform.Requirement{Package: "symfony/intl", Name: "ext-intl", Constraint: "*", Reason: "not available for PHP 7.2.3"}
+		Expect(req.String()).To(Equal("symfony/intl requires ext-intl * (not available for PHP 7.2.3)"))
+	})
+
+	It("returns an error for an invalid lockfile", func() {
+		_, err := platform.LoadLockfile(filepath.Join("..", "..", "..", "fixtures", "composer_lock_invalid_json", "composer.lock"))
+		Expect(err).To(HaveOccurred())
+	})
+
+	Describe("ModulesFor", func() {
+		var manifestPath string
+		BeforeEach(func() {
+			bpDir, err := cutlass.FindRoot()
+			Expect(err).NotTo(HaveOccurred())
+			manifestPath = filepath.Join(bpDir, "manifest.yml")
+		})
+
+		It("reads the modules for a PHP version in the manifest", func() {
+			modules, err := platform.ModulesFor(manifestPath, "7.2.3")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(modules).To(ContainElement("mbstring"))
+			Expect(modules).NotTo(ContainElement("intl"))
+		})
+
+		It("returns an error for a PHP version not in the manifest", func() {
+			_, err := platform.ModulesFor(manifestPath, "1.2.3")
+			Expect(err).To(HaveOccurred())
+		})
+	})
+})
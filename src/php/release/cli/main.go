@@ -0,0 +1,34 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"php/release"
+)
+
+func main() {
+	dir := flag.String("dir", os.Getenv("HOME"), "app directory, the commands run in it")
+	flag.Parse()
+	if flag.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "usage: php-release [-dir <app dir>] <release.json>")
+		os.Exit(2)
+	}
+
+	config, err := release.Load(flag.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	r := &release.Release{
+		Config:        config,
+		InstanceIndex: os.Getenv("CF_INSTANCE_INDEX"),
+		AppDir:        *dir,
+		Exec:          release.Shell(*dir),
+		Log:           log.New(os.Stdout, "php-release: ", 0),
+	}
+	os.Exit(r.ExitCode(r.Run()))
+}
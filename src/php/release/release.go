@@ -0,0 +1,219 @@
+// Package release runs the RELEASE_COMMANDS of an app on instance 0, once
+// per container, or per droplet with a marker dir on a volume service, before
+// or next to the processes of the app. It warns at startup when the marker
+// dir goes with the container.
+package release
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Policy tells what a failed release command does to the instance.
+type Policy string
+
+const (
+	// FailClosed stops the instance, so it is restarted and the commands
+	// run again.
+	FailClosed Policy = "fail-closed"
+	// FailOpen starts the app anyway, the commands run again on the next
+	// start.
+	FailOpen Policy = "fail-open"
+)
+
+// Config is .bp/release.json, written during staging.
+type Config struct {
+	// ReleaseID identifies the droplet, markers of other droplets don't
+	// count.
+	ReleaseID string   `json:"release_id"`
+	Commands  []string `json:"commands"`
+	Policy    Policy   `json:"policy"`
+	// MarkerDir holds the marker of each release which ran, $HOME and other
+	// variables are expanded. Unless it is on a volume service mounted by
+	// the instances, the marker goes with the container, and the commands
+	// run once per container rather than once per droplet.
+	MarkerDir string `json:"marker_dir"`
+	// Wait tells bin/start to run the commands before the processes.
+	Wait bool `json:"wait"`
+}
+
+// Load reads the config at path.
+func Load(path string) (Config, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return Config{}, err
+	}
+	var c Config
+	if err := json.Unmarshal(data, &c); err != nil {
+		return Config{}, fmt.Errorf("%s: %s", path, err)
+	}
+	if err := c.Validate(); err != nil {
+		return Config{}, fmt.Errorf("%s: %s", path, err)
+	}
+	return c, nil
+}
+
+// Validate checks the values of the config.
+func (c Config) Validate() error {
+	switch {
+	case c.ReleaseID == "" || strings.ContainsAny(c.ReleaseID, `/\`):
+		return fmt.Errorf("release_id must be a file name, not %q", c.ReleaseID)
+	case len(c.Commands) == 0:
+		return fmt.Errorf("commands is empty")
+	case c.Policy != FailClosed && c.Policy != FailOpen:
+		return fmt.Errorf("policy must be %s or %s, not %q", FailClosed, FailOpen, c.Policy)
+	case c.MarkerDir == "":
+		return fmt.Errorf("marker_dir is required")
+	}
+	return nil
+}
+
+// Outcome is what Run did.
+type Outcome int
+
+const (
+	// Skipped means this is not instance 0.
+	Skipped Outcome = iota
+	// AlreadyDone means the marker of the release exists.
+	AlreadyDone
+	Succeeded
+	Failed
+)
+
+// Release runs the commands of a config.
+type Release struct {
+	Config
+	// InstanceIndex is CF_INSTANCE_INDEX, empty for tasks.
+	InstanceIndex string
+	// AppDir is the directory of the app, a marker dir on its filesystem is
+	// on the disk of the container. Empty skips the check.
+	AppDir string
+	// Exec runs a command and returns its exit code.
+	Exec func(command string) (int, error)
+	Log  *log.Logger
+}
+
+// Run runs the commands unless they ran for this release, or this is not
+// instance 0. It stops at the first command which fails. Only a run which
+// succeeded leaves a marker, so a failed one is tried again. Errors with the
+// marker count as a failure.
+func (r *Release) Run() Outcome {
+	outcome, err := r.run()
+	if err != nil {
+		r.Log.Printf("release %s failed: %s", r.ReleaseID, err)
+		return r.failed()
+	}
+	return outcome
+}
+
+func (r *Release) run() (Outcome, error) {
+	if r.InstanceIndex != "0" {
+		if r.InstanceIndex == "" {
+			r.Log.Printf("not running the release commands, this is not an app instance")
+		} else {
+			r.Log.Printf("not running the release commands, they run on instance 0 and this is instance %s", r.InstanceIndex)
+		}
+		return Skipped, nil
+	}
+
+	dir := os.ExpandEnv(r.MarkerDir)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return Failed, err
+	}
+	if r.AppDir != "" && sameFilesystem(dir, r.AppDir) {
+		r.Log.Printf("WARNING: the marker dir %s is on the disk of the container, which every restart, crash, restage or evacuation replaces, so the release commands run again in each new container of instance 0; set RELEASE_MARKER_DIR to a volume service mounted by every instance to run them once per droplet", dir)
+	}
+	// two runs sharing the marker dir, such as containers of instance 0
+	// mounting the same volume, take turns
+	lock, err := os.OpenFile(filepath.Join(dir, r.ReleaseID+".lock"), os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return Failed, err
+	}
+	defer lock.Close()
+	if err := syscall.Flock(int(lock.Fd()), syscall.LOCK_EX); err != nil {
+		return Failed, err
+	}
+
+	marker := filepath.Join(dir, r.ReleaseID+".done")
+	if data, err := ioutil.ReadFile(marker); err == nil {
+		r.Log.Printf("release %s ran already, at %s", r.ReleaseID, strings.TrimSpace(string(data)))
+		return AlreadyDone, nil
+	} else if !os.IsNotExist(err) {
+		return Failed, err
+	}
+
+	for i, command := range r.Commands {
+		r.Log.Printf("running release command %d of %d: %s", i+1, len(r.Commands), command)
+		start := time.Now()
+		code, err := r.Exec(command)
+		if err != nil {
+			r.Log.Printf("release command %d failed to start: %s", i+1, err)
+			return r.failed(), nil
+		}
+		r.Log.Printf("release command %d ended with exit code %d after %s", i+1, code, time.Since(start).Round(time.Millisecond))
+		if code != 0 {
+			return r.failed(), nil
+		}
+	}
+
+	tmp := marker + ".tmp"
+	if err := ioutil.WriteFile(tmp, []byte(time.Now().UTC().Format(time.RFC3339)+"\n"), 0644); err != nil {
+		return Failed, err
+	}
+	if err := os.Rename(tmp, marker); err != nil {
+		return Failed, err
+	}
+	r.Log.Printf("release %s done", r.ReleaseID)
+	return Succeeded, nil
+}
+
+// sameFilesystem tells whether a and b are on the same filesystem, false
+// when either can't be read.
+func sameFilesystem(a, b string) bool {
+	var sa, sb syscall.Stat_t
+	if syscall.Stat(a, &sa) != nil || syscall.Stat(b, &sb) != nil {
+		return false
+	}
+	return sa.Dev == sb.Dev
+}
+
+func (r *Release) failed() Outcome {
+	if r.Policy == FailOpen {
+		r.Log.Printf("starting the app anyway, the policy is %s; the commands run again on the next start", FailOpen)
+	} else {
+		r.Log.Printf("stopping the instance, the policy is %s; the commands run again when it restarts", FailClosed)
+	}
+	return Failed
+}
+
+// ExitCode is the exit code of php-release for an outcome, which stops the
+// instance when it isn't 0.
+func (r *Release) ExitCode(o Outcome) int {
+	if o == Failed && r.Policy == FailClosed {
+		return 1
+	}
+	return 0
+}
+
+// Shell runs commands with bash in dir, with the environment of the
+// caller, and returns their exit code.
+func Shell(dir string) func(command string) (int, error) {
+	return func(command string) (int, error) {
+		cmd := exec.Command("bash", "-c", command)
+		cmd.Dir = dir
+		cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+		err := cmd.Run()
+		if exit, ok := err.(*exec.ExitError); ok {
+			return exit.ExitCode(), nil
+		}
+		return 0, err
+	}
+}
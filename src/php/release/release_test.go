@@ -0,0 +1,271 @@
+package release_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"php/release"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+	"github.com/onsi/gomega/gexec"
+)
+
+// fakeExec records the commands run and answers with the exit code of each.
+type fakeExec struct {
+	mu    sync.Mutex
+	codes map[string]int
+	ran   []string
+	delay time.Duration
+}
+
+func (f *fakeExec) Exec(command string) (int, error) {
+	time.Sleep(f.delay)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.ran = append(f.ran, command)
+	return f.codes[command], nil
+}
+
+func (f *fakeExec) Ran() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string{}, f.ran...)
+}
+
+var _ = Describe("Load", func() {
+	It("reads the config written during staging", func() {
+		c, err := release.Load(filepath.Join("testdata", "release.json"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(c).To(Equal(release.Config{
+			ReleaseID: "20261018T101500-3f2a",
+			Commands:  []string{"php artisan migrate --force", "php artisan config:cache"},
+			Policy:    release.FailClosed,
+			MarkerDir: "$HOME/.bp/release",
+			Wait:      true,
+		}))
+	})
+
+	DescribeTable("rejecting a config",
+		func(c release.Config, message string) {
+			Expect(c.Validate()).To(MatchError(message))
+		},
+		Entry("without a release id", release.Config{Commands: []string{"true"}, Policy: release.FailOpen, MarkerDir: "/tmp"},
+			`release_id must be a file name, not ""`),
+		Entry("with a path as release id", release.Config{ReleaseID: "../x", Commands: []string{"true"}, Policy: release.FailOpen, MarkerDir: "/tmp"},
+			`release_id must be a file name, not "../x"`),
+		Entry("without commands", release.Config{ReleaseID: "r1", Policy: release.FailOpen, MarkerDir: "/tmp"},
+			"commands is empty"),
+		Entry("with an unknown policy", release.Config{ReleaseID: "r1", Commands: []string{"true"}, Policy: "retry", MarkerDir: "/tmp"},
+			`policy must be fail-closed or fail-open, not "retry"`),
+		Entry("without a marker dir", release.Config{ReleaseID: "r1", Commands: []string{"true"}, Policy: release.FailOpen},
+			"marker_dir is required"),
+	)
+})
+
+var _ = Describe("Release", func() {
+	var (
+		dir    string
+		runner *fakeExec
+		output *gbytes.Buffer
+	)
+
+	newRelease := func(id string, policy release.Policy, index string) *release.Release {
+		return &release.Release{
+			Config: release.Config{
+				ReleaseID: id,
+				Commands:  []string{"php migrate.php", "php warmup.php"},
+				Policy:    policy,
+				MarkerDir: "$RELEASE_TEST_DIR/markers",
+			},
+			InstanceIndex: index,
+			Exec:          runner.Exec,
+			Log:           log.New(output, "", 0),
+		}
+	}
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "release")
+		Expect(err).NotTo(HaveOccurred())
+		os.Setenv("RELEASE_TEST_DIR", dir)
+		runner = &fakeExec{codes: map[string]int{}}
+		output = gbytes.NewBuffer()
+	})
+
+	AfterEach(func() {
+		os.Unsetenv("RELEASE_TEST_DIR")
+		os.RemoveAll(dir)
+	})
+
+	It("runs the commands in order once per release", func() {
+		r := newRelease("r1", release.FailClosed, "0")
+		Expect(r.Run()).To(Equal(release.Succeeded))
+		Expect(runner.Ran()).To(Equal([]string{"php migrate.php", "php warmup.php"}))
+		Expect(output).To(gbytes.Say(`running release command 1 of 2: php migrate.php`))
+		Expect(output).To(gbytes.Say(`release command 1 ended with exit code 0 after `))
+		Expect(output).To(gbytes.Say(`release command 2 ended with exit code 0 after `))
+		Expect(output).To(gbytes.Say(`release r1 done`))
+		Expect(filepath.Join(dir, "markers", "r1.done")).To(BeAnExistingFile())
+
+		Expect(r.Run()).To(Equal(release.AlreadyDone))
+		Expect(output).To(gbytes.Say(`release r1 ran already, at \d{4}-\d\d-\d\dT`))
+		Expect(runner.Ran()).To(HaveLen(2))
+
+		Expect(newRelease("r2", release.FailClosed, "0").Run()).To(Equal(release.Succeeded))
+		Expect(runner.Ran()).To(HaveLen(4))
+		Expect(string(output.Contents())).NotTo(ContainSubstring("WARNING"))
+	})
+
+	It("warns when the marker dir is on the disk of the container", func() {
+		r := newRelease("r1", release.FailClosed, "0")
+		r.AppDir = dir
+		Expect(r.Run()).To(Equal(release.Succeeded))
+		Expect(output).To(gbytes.Say(`WARNING: the marker dir .*/markers is on the disk of the container, .* run again in each new container of instance 0`))
+	})
+
+	It("only runs on instance 0", func() {
+		Expect(newRelease("r1", release.FailClosed, "1").Run()).To(Equal(release.Skipped))
+		Expect(output).To(gbytes.Say(`they run on instance 0 and this is instance 1`))
+		Expect(newRelease("r1", release.FailClosed, "").Run()).To(Equal(release.Skipped))
+		Expect(output).To(gbytes.Say(`this is not an app instance`))
+		Expect(runner.Ran()).To(BeEmpty())
+		Expect(filepath.Join(dir, "markers")).NotTo(BeAnExistingFile())
+	})
+
+	It("stops the instance when a command fails closed", func() {
+		runner.codes["php migrate.php"] = 3
+		r := newRelease("r1", release.FailClosed, "0")
+		outcome := r.Run()
+		Expect(outcome).To(Equal(release.Failed))
+		Expect(r.ExitCode(outcome)).To(Equal(1))
+		Expect(runner.Ran()).To(Equal([]string{"php migrate.php"}))
+		Expect(output).To(gbytes.Say(`release command 1 ended with exit code 3`))
+		Expect(output).To(gbytes.Say(`stopping the instance, the policy is fail-closed`))
+		Expect(filepath.Join(dir, "markers", "r1.done")).NotTo(BeAnExistingFile())
+
+		// the restarted instance tries again
+		delete(runner.codes, "php migrate.php")
+		Expect(r.Run()).To(Equal(release.Succeeded))
+	})
+
+	It("starts the app when a command fails open", func() {
+		runner.codes["php warmup.php"] = 1
+		r := newRelease("r1", release.FailOpen, "0")
+		outcome := r.Run()
+		Expect(outcome).To(Equal(release.Failed))
+		Expect(r.ExitCode(outcome)).To(Equal(0))
+		Expect(output).To(gbytes.Say(`starting the app anyway, the policy is fail-open`))
+		Expect(filepath.Join(dir, "markers", "r1.done")).NotTo(BeAnExistingFile())
+	})
+
+	It("fails as the policy says when the marker can't be written", func() {
+		Expect(ioutil.WriteFile(filepath.Join(dir, "markers"), nil, 0644)).To(Succeed())
+		r := newRelease("r1", release.FailClosed, "0")
+		Expect(r.ExitCode(r.Run())).To(Equal(1))
+		Expect(output).To(gbytes.Say(`release r1 failed: .*markers`))
+		Expect(runner.Ran()).To(BeEmpty())
+	})
+
+	It("runs the commands once when two instances start together", func() {
+		runner.delay = 200 * time.Millisecond
+		outcomes := make(chan release.Outcome, 2)
+		for i := 0; i < 2; i++ {
+			go func() {
+				defer GinkgoRecover()
+				outcomes <- newRelease("r1", release.FailClosed, "0").Run()
+			}()
+		}
+		Expect([]release.Outcome{<-outcomes, <-outcomes}).To(ConsistOf(release.Succeeded, release.AlreadyDone))
+		Expect(runner.Ran()).To(HaveLen(2))
+	})
+})
+
+var _ = Describe("command", func() {
+	var (
+		bin  string
+		home string
+	)
+
+	// start runs php-release as bin/start does when the processes wait for
+	// the release
+	start := func(index string) *gexec.Session {
+		cmd := exec.Command(bin, filepath.Join(home, ".bp", "release.json"))
+		cmd.Env = append(os.Environ(), "HOME="+home, "CF_INSTANCE_INDEX="+index)
+		session, err := gexec.Start(cmd, GinkgoWriter, GinkgoWriter)
+		Expect(err).NotTo(HaveOccurred())
+		Eventually(session, 10*time.Second).Should(gexec.Exit())
+		return session
+	}
+
+	writeConfig := func(policy release.Policy, commands ...string) {
+		data, err := json.Marshal(release.Config{ReleaseID: "r1", Commands: commands, Policy: policy, MarkerDir: "$HOME/.bp/release", Wait: true})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ioutil.WriteFile(filepath.Join(home, ".bp", "release.json"), data, 0644)).To(Succeed())
+	}
+
+	BeforeEach(func() {
+		var err error
+		bin, err = gexec.Build("php/release/cli")
+		Expect(err).NotTo(HaveOccurred())
+		home, err = ioutil.TempDir("", "release")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(os.MkdirAll(filepath.Join(home, ".bp", "bin"), 0755)).To(Succeed())
+		Expect(os.Symlink(bin, filepath.Join(home, ".bp", "bin", "php-release"))).To(Succeed())
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(home)
+		gexec.CleanupBuildArtifacts()
+	})
+
+	It("runs the commands once per marker", func() {
+		writeConfig(release.FailClosed, "echo migrated >> migrations.log")
+
+		session := start("0")
+		Expect(session.ExitCode()).To(Equal(0))
+		Expect(session.Out).To(gbytes.Say(`php-release: WARNING: the marker dir .* is on the disk of the container`))
+		Expect(session.Out).To(gbytes.Say(`php-release: running release command 1 of 1`))
+
+		Expect(start("0").ExitCode()).To(Equal(0))
+		Expect(start("1").ExitCode()).To(Equal(0))
+		Expect(ioutil.ReadFile(filepath.Join(home, "migrations.log"))).To(Equal([]byte("migrated\n")))
+	})
+
+	It("fails when a command fails closed", func() {
+		writeConfig(release.FailClosed, "exit 5")
+
+		session := start("0")
+		Expect(session.ExitCode()).To(Equal(1))
+		Expect(session.Out).To(gbytes.Say(`release command 1 ended with exit code 5`))
+	})
+
+	It("succeeds when a command fails open", func() {
+		writeConfig(release.FailOpen, "exit 5")
+
+		session := start("0")
+		Expect(session.ExitCode()).To(Equal(0))
+		Expect(session.Out).To(gbytes.Say(`starting the app anyway`))
+	})
+})
+
+var _ = Describe("Shell", func() {
+	It("runs the command in the app directory", func() {
+		dir, err := ioutil.TempDir("", "release")
+		Expect(err).NotTo(HaveOccurred())
+		defer os.RemoveAll(dir)
+
+		code, err := release.Shell(dir)(`touch ran-here; exit 4`)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(code).To(Equal(4))
+		Expect(filepath.Join(dir, "ran-here")).To(BeAnExistingFile())
+	})
+})
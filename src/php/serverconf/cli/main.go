@@ -0,0 +1,59 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"php/serverconf"
+)
+
+func main() {
+	server := flag.String("server", "", "nginx or httpd")
+	dir := flag.String("dir", "", "configuration directory the includes are written to")
+	fpmListen := flag.String("fpm-listen", "", "address php-fpm listens on, for httpd")
+	flag.Parse()
+	if *server == "" || *dir == "" {
+		fmt.Fprintln(os.Stderr, "usage: server-conf -server nginx|httpd -dir <conf dir> < options.json")
+		os.Exit(2)
+	}
+
+	if err := run(*server, *dir, *fpmListen); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func run(server, dir, fpmListen string) error {
+	data, err := ioutil.ReadAll(os.Stdin)
+	if err != nil {
+		return err
+	}
+	opts, err := serverconf.Parse(data)
+	if err != nil {
+		return err
+	}
+	opts.FPMListen = fpmListen
+
+	var files []serverconf.File
+	switch server {
+	case "nginx":
+		files, err = serverconf.Nginx(opts)
+	case "httpd":
+		files, err = serverconf.HTTPD(opts)
+	default:
+		return fmt.Errorf("unknown web server %q", server)
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, f := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, f.Name), []byte(f.Content), 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
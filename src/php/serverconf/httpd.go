@@ -0,0 +1,132 @@
+package serverconf
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+)
+
+// HTTPDIncludes are included at the end of httpd.conf. Modules are loaded
+// on top of httpd-modules.conf and deflate types are added to the ones of
+// httpd-deflate.conf, so neither file has to be copied to change them.
+var HTTPDIncludes = []string{"extra/httpd-features.conf"}
+
+// HTTPDStaticFiles matches the static files cached by nginx.
+const HTTPDStaticFiles = `\.(?:ico|css|js|gif|jpeg|jpg|png)$`
+
+var httpdTemplates = template.Must(template.New("httpd").Funcs(template.FuncMap{
+	"join":            strings.Join,
+	"loadModule":      loadModule,
+	"static":          func() string { return HTTPDStaticFiles },
+	"list":            func(items ...string) []string { return items },
+	"metricsListen":   func() string { return MetricsListen },
+	"statusListen":    func() string { return StatusListen },
+	"httpdStatusPath": func() string { return HTTPDStatusPath },
+	"logFormat":       func() string { return strings.Replace(HTTPDLogFormat(), `"`, `\"`, -1) },
+}).Parse(`
+{{- define "extra/httpd-features.conf" -}}
+# Rendered during staging from the web server options in options.json
+{{- if .HTTPDExtraModules}}
+{{range .HTTPDExtraModules}}
+{{loadModule .}}
+{{- end}}
+{{- end}}
+{{- if .HTTPDDeflateTypes}}
+
+<IfModule filter_module>
+<IfModule deflate_module>
+AddOutputFilterByType DEFLATE {{join .HTTPDDeflateTypes " "}}
+</IfModule>
+</IfModule>
+{{- end}}
+{{- if .ForceHTTPS}}
+
+{{loadModule "rewrite"}}
+RewriteEngine On
+RewriteCond %{HTTP:X-Forwarded-Proto} =http
+RewriteRule ^ https://%{HTTP_HOST}%{REQUEST_URI} [R=301,L]
+{{- end}}
+{{- if .Headers}}
+{{range .Headers}}
+Header always set {{.Name}} "{{.Value}}"
+{{- end}}
+{{- end}}
+{{- with .MaxAgeSeconds}}
+
+{{loadModule "expires"}}
+<FilesMatch "{{static}}">
+    ExpiresActive On
+    ExpiresDefault "access plus {{.}} seconds"
+    Header set Pragma public
+    Header merge Cache-Control "public, must-revalidate, proxy-revalidate"
+</FilesMatch>
+{{- end}}
+{{- if .FPMPaths}}
+{{- if .FPMStatusHtpasswd}}
+{{range list "auth_basic" "authn_core" "authn_file" "authz_user"}}
+{{loadModule .}}
+{{- end}}
+{{- end}}
+{{range .FPMPaths}}
+<Location "{{.}}">
+    SetHandler "proxy:fcgi://{{$.FPMListenAddress}}"
+{{- if $.FPMStatusHtpasswd}}
+    AuthType Basic
+    AuthName "php-fpm"
+    AuthUserFile "${HOME}/{{$.FPMStatusHtpasswd}}"
+    Require valid-user
+{{- else}}
+    Require all granted
+{{- end}}
+</Location>
+{{- end}}
+{{- end}}
+{{- if .JSONLogs}}
+
+{{loadModule "unique_id"}}
+<IfModule log_config_module>
+    # replaces the format of the CustomLog in httpd-logging.conf
+    LogFormat "{{logFormat}}" extended
+</IfModule>
+{{- end}}
+{{- if .MetricsExporter}}
+
+{{loadModule "status"}}
+{{loadModule "proxy_http"}}
+Listen {{statusListen}}
+<VirtualHost {{statusListen}}>
+    <Location "{{httpdStatusPath}}">
+        SetHandler server-status
+        Require all granted
+    </Location>
+</VirtualHost>
+<Location "{{.MetricsPath}}">
+    ProxyPass "http://{{metricsListen}}{{.MetricsPath}}"
+    Require all granted
+</Location>
+{{- end}}
+{{end}}
+`))
+
+func loadModule(name string) string {
+	return fmt.Sprintf("<IfModule !mod_%[1]s.c>\n  LoadModule %[1]s_module modules/mod_%[1]s.so\n</IfModule>", name)
+}
+
+// DefaultFPMListen is where php-fpm listens when httpd is the web server.
+const DefaultFPMListen = "127.0.0.1:9000"
+
+// FPMListenAddress is FPMListen, or DefaultFPMListen when it is not set.
+func (o Options) FPMListenAddress() string {
+	if o.FPMListen == "" {
+		return DefaultFPMListen
+	}
+	return o.FPMListen
+}
+
+// HTTPD renders HTTPDIncludes.
+func HTTPD(opts Options) ([]File, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+	return render(httpdTemplates, HTTPDIncludes, opts)
+}
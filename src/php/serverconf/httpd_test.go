@@ -0,0 +1,131 @@
+package serverconf_test
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"php/serverconf"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gexec"
+)
+
+var httpdCombinations = combinations(
+	httpsToggle,
+	headersToggle,
+	cacheToggle,
+	toggle{"deflate", func(o *serverconf.Options) {
+		o.HTTPDDeflateTypes = serverconf.List{"application/json", "image/svg+xml"}
+	}, func(o *serverconf.Options) { o.HTTPDDeflateTypes = nil }},
+	toggle{"modules", func(o *serverconf.Options) { o.HTTPDExtraModules = serverconf.List{"expires", "cache"} }, func(o *serverconf.Options) { o.HTTPDExtraModules = nil }},
+)
+
+var _ = Describe("HTTPD", func() {
+	It("renders every toggle combination like its golden file", func() {
+		Expect(httpdCombinations).To(HaveLen(37))
+		for name, opts := range httpdCombinations {
+			files, err := serverconf.HTTPD(opts)
+			Expect(err).NotTo(HaveOccurred())
+			expectGolden(filepath.Join("testdata", "httpd", name+".conf"), concat(files))
+		}
+	})
+
+	It("renders the defaults shipped in defaults/config/httpd", func() {
+		files, err := serverconf.HTTPD(serverconf.Defaults)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(files).To(HaveLen(len(serverconf.HTTPDIncludes)))
+		for _, f := range files {
+			shipped, err := ioutil.ReadFile(filepath.Join("..", "..", "..", "defaults", "config", "httpd", f.Name))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(f.Content).To(Equal(string(shipped)), f.Name)
+		}
+	})
+
+	It("is included by httpd.conf", func() {
+		conf, err := ioutil.ReadFile(filepath.Join("..", "..", "..", "defaults", "config", "httpd", "httpd.conf"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(conf)).To(HaveSuffix("Include conf/extra/httpd-features.conf\n"))
+	})
+
+	It("does not cache static files unless asked to", func() {
+		files, err := serverconf.HTTPD(serverconf.Defaults)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(files[0].Content).NotTo(ContainSubstring("Expires"))
+	})
+
+	// set $HTTPD to the httpd binary of the buildpack, for example
+	// httpd/bin/httpd of a staged app, to check the syntax of each
+	// combination with the default configuration
+	Context("with httpd", func() {
+		var httpd, modules string
+
+		BeforeEach(func() {
+			httpd = os.Getenv("HTTPD")
+			if httpd == "" {
+				httpd, _ = exec.LookPath("httpd")
+			}
+			if httpd == "" {
+				Skip("httpd is not available")
+			}
+			modules = filepath.Join(filepath.Dir(filepath.Dir(httpd)), "modules")
+			if _, err := os.Stat(filepath.Join(modules, "mod_expires.so")); err != nil {
+				Skip("httpd has no modules directory next to its bin directory")
+			}
+		})
+
+		It("accepts every combination", func() {
+			for name, opts := range httpdCombinations {
+				home := stageHTTPD(modules)
+				defer os.RemoveAll(home)
+
+				files, err := serverconf.HTTPD(opts)
+				Expect(err).NotTo(HaveOccurred())
+				for _, f := range files {
+					Expect(ioutil.WriteFile(filepath.Join(home, "httpd", "conf", f.Name), []byte(f.Content), 0644)).To(Succeed())
+				}
+
+				cmd := exec.Command(httpd, "-t", "-f", filepath.Join(home, "httpd", "conf", "httpd.conf"))
+				cmd.Env = append(os.Environ(), "HOME="+home, "PORT=8080", "HTTPD_SERVER_ADMIN=admin@localhost")
+				session, err := gexec.Start(cmd, GinkgoWriter, GinkgoWriter)
+				Expect(err).NotTo(HaveOccurred())
+				Eventually(session).Should(gexec.Exit())
+				Expect(session.ExitCode()).To(Equal(0), name)
+			}
+		})
+	})
+})
+
+// stageHTTPD lays out the default configuration like staging does.
+func stageHTTPD(modules string) string {
+	home, err := ioutil.TempDir("", "serverconf")
+	Expect(err).NotTo(HaveOccurred())
+	Expect(os.MkdirAll(filepath.Join(home, "htdocs"), 0755)).To(Succeed())
+	Expect(os.MkdirAll(filepath.Join(home, "httpd", "logs"), 0755)).To(Succeed())
+	Expect(os.Symlink(modules, filepath.Join(home, "httpd", "modules"))).To(Succeed())
+
+	defaults := filepath.Join("..", "..", "..", "defaults", "config", "httpd")
+	rewrite := strings.NewReplacer("#{WEBDIR}", "htdocs", "#{PHP_FPM_LISTEN}", "127.0.0.1:9000", "#{HTTPD_FRONT_CONTROLLER}", "")
+	Expect(filepath.Walk(defaults, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(defaults, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(home, "httpd", "conf", rel)
+		if info.IsDir() {
+			return os.MkdirAll(target, 0755)
+		}
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		return ioutil.WriteFile(target, []byte(rewrite.Replace(string(data))), 0644)
+	})).To(Succeed())
+	return home
+}
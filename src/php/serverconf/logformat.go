@@ -0,0 +1,116 @@
+package serverconf
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	LogFormatText = "text"
+	LogFormatJSON = "json"
+)
+
+// LogFields are the keys of every line LOG_FORMAT=json writes, in order.
+// The web servers write a line of type access for each request and PHP a
+// line of type error for each error, so a pipeline can parse both the same
+// way. Keys which do not apply to a line are null, such as the file of an
+// access or the status of an error. The request id is generated by the web
+// server and passed to PHP, the vcap request id is the header the router
+// adds, and duration_ms is the time since the web server read the request.
+var LogFields = []string{
+	"time",
+	"source",
+	"type",
+	"level",
+	"request_id",
+	"vcap_request_id",
+	"remote_addr",
+	"method",
+	"uri",
+	"protocol",
+	"status",
+	"bytes",
+	"duration_ms",
+	"referer",
+	"user_agent",
+	"message",
+	"file",
+	"line",
+}
+
+// logField is a key of LogFields and the JSON value a web server logs for
+// it, which is quoted for strings.
+type logField struct {
+	key   string
+	value string
+}
+
+// nginx escapes the variables for JSON itself with escape=json. The
+// duration comes from a map, as $request_time is in seconds.
+var nginxLogFields = []logField{
+	{"time", `"$time_iso8601"`},
+	{"source", `"nginx"`},
+	{"type", `"access"`},
+	{"level", `"info"`},
+	{"request_id", `"$request_id"`},
+	{"vcap_request_id", `"$http_x_vcap_request_id"`},
+	{"remote_addr", `"$remote_addr"`},
+	{"method", `"$request_method"`},
+	{"uri", `"$request_uri"`},
+	{"protocol", `"$server_protocol"`},
+	{"status", `$status`},
+	{"bytes", `$body_bytes_sent`},
+	{"duration_ms", `$request_duration_ms`},
+	{"referer", `"$http_referer"`},
+	{"user_agent", `"$http_user_agent"`},
+	{"message", `null`},
+	{"file", `null`},
+	{"line", `null`},
+}
+
+// mod_log_config escapes quotes and backslashes in the values it logs,
+// which is enough for JSON unless a header holds control characters. The
+// request id comes from mod_unique_id.
+var httpdLogFields = []logField{
+	{"time", `"%{%Y-%m-%dT%H:%M:%S%z}t"`},
+	{"source", `"httpd"`},
+	{"type", `"access"`},
+	{"level", `"info"`},
+	{"request_id", `"%{UNIQUE_ID}e"`},
+	{"vcap_request_id", `"%{X-Vcap-Request-Id}i"`},
+	{"remote_addr", `"%a"`},
+	{"method", `"%m"`},
+	{"uri", `"%U%q"`},
+	{"protocol", `"%H"`},
+	{"status", `%>s`},
+	{"bytes", `%B`},
+	{"duration_ms", `%{ms}T`},
+	{"referer", `"%{Referer}i"`},
+	{"user_agent", `"%{User-Agent}i"`},
+	{"message", `null`},
+	{"file", `null`},
+	{"line", `null`},
+}
+
+func jsonLogFormat(fields []logField) string {
+	var pairs []string
+	for _, f := range fields {
+		pairs = append(pairs, fmt.Sprintf(`"%s":%s`, f.key, f.value))
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// NginxLogFormat is the log_format of LOG_FORMAT=json.
+func NginxLogFormat() string {
+	return jsonLogFormat(nginxLogFields)
+}
+
+// HTTPDLogFormat is the LogFormat of LOG_FORMAT=json.
+func HTTPDLogFormat() string {
+	return jsonLogFormat(httpdLogFields)
+}
+
+// JSONLogs tells whether LOG_FORMAT switches the logs to JSON.
+func (o Options) JSONLogs() bool {
+	return o.LogFormat == LogFormatJSON
+}
@@ -0,0 +1,269 @@
+package serverconf_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"php/serverconf"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// decodeLogLine returns the keys of a JSON log line in order, and the
+// values by key.
+func decodeLogLine(line string) ([]string, map[string]interface{}) {
+	dec := json.NewDecoder(strings.NewReader(line))
+	dec.UseNumber()
+	tok, err := dec.Token()
+	Expect(err).NotTo(HaveOccurred(), line)
+	Expect(tok).To(Equal(json.Delim('{')), line)
+	var keys []string
+	values := map[string]interface{}{}
+	for dec.More() {
+		tok, err := dec.Token()
+		Expect(err).NotTo(HaveOccurred(), line)
+		key := tok.(string)
+		var value interface{}
+		Expect(dec.Decode(&value)).To(Succeed(), line)
+		keys = append(keys, key)
+		values[key] = value
+	}
+	tok, err = dec.Token()
+	Expect(err).NotTo(HaveOccurred(), line)
+	Expect(tok).To(Equal(json.Delim('}')), line)
+	return keys, values
+}
+
+func jsonLogs() serverconf.Options {
+	opts := serverconf.Defaults
+	opts.LogFormat = serverconf.LogFormatJSON
+	return opts
+}
+
+var timePattern = `^\d{4}-\d\d-\d\dT\d\d:\d\d:\d\d([+-]\d\d:?\d\d|Z)$`
+
+var _ = Describe("LOG_FORMAT", func() {
+	It("logs text by default", func() {
+		files, err := serverconf.Nginx(serverconf.Defaults)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(concat(files)).NotTo(ContainSubstring("log_format"))
+		files, err = serverconf.HTTPD(serverconf.Defaults)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(concat(files)).NotTo(ContainSubstring("LogFormat"))
+	})
+
+	It("renders an nginx log_format which logs JSON", func() {
+		files, err := serverconf.Nginx(jsonLogs())
+		Expect(err).NotTo(HaveOccurred())
+		m := regexp.MustCompile(`log_format json escape=json '(.*)';`).FindStringSubmatch(concat(files))
+		Expect(m).NotTo(BeNil())
+
+		// values as nginx logs them, escaped for JSON
+		variables := map[string]string{
+			"time_iso8601":           "2018-10-18T12:00:00+00:00",
+			"request_id":             "6c0a1d4e5f3b2a19a7c2e4f1d3b5a7c9",
+			"http_x_vcap_request_id": "0f5e1a2b-3c4d-4e5f-8a9b-0c1d2e3f4a5b",
+			"remote_addr":            "10.0.0.1",
+			"request_method":         "GET",
+			"request_uri":            `/search?q=\"php\"`,
+			"server_protocol":        "HTTP/1.1",
+			"status":                 "200",
+			"body_bytes_sent":        "612",
+			"request_duration_ms":    "12",
+			"http_referer":           "",
+			"http_user_agent":        "curl/7.58.0",
+		}
+		line := regexp.MustCompile(`\$[a-z0-9_]+`).ReplaceAllStringFunc(m[1], func(v string) string {
+			value, ok := variables[v[1:]]
+			Expect(ok).To(BeTrue(), "no sample for %s", v)
+			return value
+		})
+
+		keys, values := decodeLogLine(line)
+		Expect(keys).To(Equal(serverconf.LogFields))
+		Expect(values["time"]).To(MatchRegexp(timePattern))
+		delete(values, "time")
+		Expect(values).To(Equal(map[string]interface{}{
+			"source":          "nginx",
+			"type":            "access",
+			"level":           "info",
+			"request_id":      "6c0a1d4e5f3b2a19a7c2e4f1d3b5a7c9",
+			"vcap_request_id": "0f5e1a2b-3c4d-4e5f-8a9b-0c1d2e3f4a5b",
+			"remote_addr":     "10.0.0.1",
+			"method":          "GET",
+			"uri":             `/search?q="php"`,
+			"protocol":        "HTTP/1.1",
+			"status":          json.Number("200"),
+			"bytes":           json.Number("612"),
+			"duration_ms":     json.Number("12"),
+			"referer":         "",
+			"user_agent":      "curl/7.58.0",
+			"message":         nil,
+			"file":            nil,
+			"line":            nil,
+		}))
+	})
+
+	It("converts $request_time to milliseconds", func() {
+		files, err := serverconf.Nginx(jsonLogs())
+		Expect(err).NotTo(HaveOccurred())
+		rules := regexp.MustCompile(`(?m)^\s+~(\S+)\s+(\S+);$`).FindAllStringSubmatch(concat(files), -1)
+		Expect(rules).To(HaveLen(2))
+		duration := func(requestTime string) string {
+			for _, r := range rules {
+				re := regexp.MustCompile(r[1])
+				if m := re.FindStringSubmatch(requestTime); m != nil {
+					return os.Expand(r[2], func(name string) string { return m[re.SubexpIndex(name)] })
+				}
+			}
+			return "0"
+		}
+		Expect(duration("0.000")).To(Equal("0"))
+		Expect(duration("0.003")).To(Equal("3"))
+		Expect(duration("0.120")).To(Equal("120"))
+		Expect(duration("1.005")).To(Equal("1005"))
+		Expect(duration("12.340")).To(Equal("12340"))
+	})
+
+	It("replaces the access log of the server with the JSON one", func() {
+		files, err := serverconf.Nginx(jsonLogs())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(files[1].Name).To(Equal("server-features.conf"))
+		Expect(files[1].Content).To(ContainSubstring("access_log  /dev/stdout  json;"))
+	})
+
+	It("renders an httpd LogFormat which logs JSON", func() {
+		files, err := serverconf.HTTPD(jsonLogs())
+		Expect(err).NotTo(HaveOccurred())
+		m := regexp.MustCompile(`LogFormat "((?:[^"\\]|\\.)*)" extended`).FindStringSubmatch(concat(files))
+		Expect(m).NotTo(BeNil())
+		Expect(concat(files)).To(ContainSubstring("LoadModule unique_id_module"))
+
+		// values as mod_log_config logs them, which escapes quotes
+		directives := map[string]string{
+			"%{%Y-%m-%dT%H:%M:%S%z}t": "2018-10-18T12:00:00+0000",
+			"%{UNIQUE_ID}e":           "W8h1UH8AAQEAAAALcYkAAAAA",
+			"%{X-Vcap-Request-Id}i":   "-",
+			"%a":                      "10.0.0.1",
+			"%m":                      "POST",
+			"%U":                      "/index.php",
+			"%q":                      `?q=\"php\"`,
+			"%H":                      "HTTP/1.1",
+			"%>s":                     "500",
+			"%B":                      "0",
+			"%{ms}T":                  "1503",
+			"%{Referer}i":             "https://example.com/",
+			"%{User-Agent}i":          "Mozilla/5.0",
+		}
+		format := strings.Replace(m[1], `\"`, `"`, -1)
+		line := regexp.MustCompile(`%(\{[^}]*\})?>?[a-zA-Z]`).ReplaceAllStringFunc(format, func(d string) string {
+			value, ok := directives[d]
+			Expect(ok).To(BeTrue(), "no sample for %s", d)
+			return value
+		})
+
+		keys, values := decodeLogLine(line)
+		Expect(keys).To(Equal(serverconf.LogFields))
+		Expect(values["time"]).To(MatchRegexp(timePattern))
+		delete(values, "time")
+		Expect(values).To(Equal(map[string]interface{}{
+			"source":          "httpd",
+			"type":            "access",
+			"level":           "info",
+			"request_id":      "W8h1UH8AAQEAAAALcYkAAAAA",
+			"vcap_request_id": "-",
+			"remote_addr":     "10.0.0.1",
+			"method":          "POST",
+			"uri":             `/index.php?q="php"`,
+			"protocol":        "HTTP/1.1",
+			"status":          json.Number("500"),
+			"bytes":           json.Number("0"),
+			"duration_ms":     json.Number("1503"),
+			"referer":         "https://example.com/",
+			"user_agent":      "Mozilla/5.0",
+			"message":         nil,
+			"file":            nil,
+			"line":            nil,
+		}))
+	})
+
+	Describe("PHP", func() {
+		script := filepath.Join("..", "..", "..", "lib", "php", "log-format.php")
+
+		It("logs the same keys", func() {
+			data, err := ioutil.ReadFile(script)
+			Expect(err).NotTo(HaveOccurred())
+			entry := regexp.MustCompile(`(?s)\$entry = array\((.*?)\n    \);`).FindSubmatch(data)
+			Expect(entry).NotTo(BeNil())
+			var keys []string
+			for _, m := range regexp.MustCompile(`'([a-z_]+)' =>`).FindAllSubmatch(entry[1], -1) {
+				keys = append(keys, string(m[1]))
+			}
+			Expect(keys).To(Equal(serverconf.LogFields))
+		})
+
+		// set $PHP to a php binary, for example php/bin/php of a staged app,
+		// to run the script
+		Context("with php", func() {
+			var php string
+
+			BeforeEach(func() {
+				php = os.Getenv("PHP")
+				if php == "" {
+					php, _ = exec.LookPath("php")
+				}
+				if php == "" {
+					Skip("php is not available")
+				}
+			})
+
+			It("writes JSON lines for errors", func() {
+				dir, err := ioutil.TempDir("", "logformat")
+				Expect(err).NotTo(HaveOccurred())
+				defer os.RemoveAll(dir)
+				app := filepath.Join(dir, "app.php")
+				Expect(ioutil.WriteFile(app, []byte("<?php\ntrigger_error('disk \"almost\" full', E_USER_WARNING);\nundefined_function();\n"), 0644)).To(Succeed())
+
+				abs, err := filepath.Abs(script)
+				Expect(err).NotTo(HaveOccurred())
+				var stderr bytes.Buffer
+				cmd := exec.Command(php, "-n", "-d", "auto_prepend_file="+abs, "-d", "log_errors=On", "-d", "display_errors=Off", "-d", "date.timezone=UTC", app)
+				cmd.Stderr = &stderr
+				Expect(cmd.Run()).To(HaveOccurred())
+
+				// PHP logs the fatal error as text too, the warning only as JSON
+				var lines []string
+				for _, line := range strings.Split(strings.TrimSpace(stderr.String()), "\n") {
+					if strings.HasPrefix(line, "{") {
+						lines = append(lines, line)
+					} else {
+						Expect(line).NotTo(ContainSubstring("almost"))
+					}
+				}
+				Expect(lines).To(HaveLen(2))
+				keys, warning := decodeLogLine(lines[0])
+				Expect(keys).To(Equal(serverconf.LogFields))
+				Expect(warning["time"]).To(MatchRegexp(timePattern))
+				Expect(warning["source"]).To(Equal("php"))
+				Expect(warning["type"]).To(Equal("error"))
+				Expect(warning["level"]).To(Equal("warning"))
+				Expect(warning["request_id"]).To(BeNil())
+				Expect(warning["status"]).To(BeNil())
+				Expect(warning["duration_ms"]).To(BeNil())
+				Expect(warning["message"]).To(Equal(`disk "almost" full`))
+				Expect(warning["file"]).To(Equal(app))
+				Expect(warning["line"]).To(Equal(json.Number("2")))
+				_, fatal := decodeLogLine(lines[1])
+				Expect(fatal["level"]).To(Equal("error"))
+				Expect(fatal["message"]).To(ContainSubstring("undefined_function"))
+			})
+		})
+	})
+})
@@ -0,0 +1,128 @@
+package serverconf
+
+import (
+	"strings"
+	"text/template"
+)
+
+// GzipTypes are compressed in addition to text/html.
+var GzipTypes = []string{
+	"application/javascript",
+	"application/json",
+	"application/rss+xml",
+	"application/xml",
+	"image/svg+xml",
+	"text/css",
+	"text/javascript",
+	"text/plain",
+	"text/xml",
+}
+
+// NginxIncludes are included from http-defaults.conf, server-defaults.conf
+// and the static file location of server-locations.conf respectively.
+var NginxIncludes = []string{"http-features.conf", "server-features.conf", "static-features.conf"}
+
+// A location which adds headers drops the ones added by the server, so
+// static-features.conf repeats the security headers. The access_log of the
+// server replaces the one of http-logging.conf.
+var nginxTemplates = template.Must(template.New("nginx").Funcs(template.FuncMap{
+	"join":            strings.Join,
+	"metricsListen":   func() string { return MetricsListen },
+	"statusListen":    func() string { return StatusListen },
+	"nginxStatusPath": func() string { return NginxStatusPath },
+	"logFormat":       NginxLogFormat,
+}).Parse(`
+{{- define "http-features.conf"}}
+{{- if .NginxGzip}}
+    gzip               on;
+    gzip_comp_level    5;
+    gzip_min_length    256;
+    gzip_proxied       any;
+    gzip_vary          on;
+    gzip_types         {{join .GzipTypes " "}};
+{{- else}}
+    gzip               off;
+{{- end}}
+{{- if .ClientMaxBodySize}}
+    client_max_body_size  {{.ClientMaxBodySize}};
+{{- end}}
+{{- if .JSONLogs}}
+
+    map $request_time $request_duration_ms {
+        ~^0\.0*(?<ms>[1-9][0-9]*)$             $ms;
+        ~^(?<s>[1-9][0-9]*)\.(?<ms>[0-9]+)$     $s$ms;
+        default                                 0;
+    }
+
+    log_format json escape=json '{{logFormat}}';
+{{- end}}
+{{- if .MetricsExporter}}
+
+    server {
+        listen          {{statusListen}};
+        access_log      off;
+
+        location = {{nginxStatusPath}} {
+            stub_status;
+        }
+    }
+{{- end}}
+{{end}}
+
+{{- define "server-features.conf"}}
+{{- if .JSONLogs}}
+        access_log  /dev/stdout  json;
+{{- end}}
+{{- if .ForceHTTPS}}
+        if ($http_x_forwarded_proto = "http") {
+            return 301 https://$host$request_uri;
+        }
+{{- end}}
+{{- range .Headers}}
+        add_header  {{.Name}} "{{.Value}}" always;
+{{- end}}
+{{- range .FPMPaths}}
+
+        location = {{.}} {
+{{- if $.FPMStatusHtpasswd}}
+            auth_basic              "php-fpm";
+            auth_basic_user_file    @{HOME}/{{$.FPMStatusHtpasswd}};
+{{- end}}
+            include         fastcgi_params;
+            fastcgi_param   SCRIPT_FILENAME $document_root$fastcgi_script_name;
+            fastcgi_pass    php_fpm;
+        }
+{{- end}}
+{{- if .MetricsExporter}}
+
+        location = {{.MetricsPath}} {
+            proxy_pass      http://{{metricsListen}};
+        }
+{{- end}}
+{{end}}
+
+{{- define "static-features.conf"}}
+{{- if eq .StaticCacheMaxAge "off"}}
+            expires         off;
+{{- else}}
+            expires         {{or .StaticCacheMaxAge "max"}};
+            add_header      Pragma public;
+            add_header      Cache-Control "public, must-revalidate, proxy-revalidate";
+{{- range .Headers}}
+            add_header      {{.Name}} "{{.Value}}" always;
+{{- end}}
+{{- end}}
+{{end}}
+`))
+
+// Nginx renders NginxIncludes.
+func Nginx(opts Options) ([]File, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+	return render(nginxTemplates, NginxIncludes, opts)
+}
+
+func (o Options) GzipTypes() []string {
+	return GzipTypes
+}
@@ -0,0 +1,52 @@
+package serverconf_test
+
+import (
+	"io/ioutil"
+	"path/filepath"
+
+	"php/serverconf"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Nginx", func() {
+	It("renders every toggle combination like its golden file", func() {
+		combos := combinations(
+			toggle{"gzip", func(o *serverconf.Options) { o.NginxGzip = true }, func(o *serverconf.Options) { o.NginxGzip = false }},
+			httpsToggle,
+			headersToggle,
+			cacheToggle,
+			toggle{"body", func(o *serverconf.Options) { o.ClientMaxBodySize = "20m" }, func(o *serverconf.Options) { o.ClientMaxBodySize = "" }},
+		)
+		Expect(combos).To(HaveLen(37))
+		for name, opts := range combos {
+			files, err := serverconf.Nginx(opts)
+			Expect(err).NotTo(HaveOccurred())
+			expectGolden(filepath.Join("testdata", "nginx", name+".conf"), concat(files))
+		}
+	})
+
+	It("renders the defaults shipped in defaults/config/nginx", func() {
+		files, err := serverconf.Nginx(serverconf.Defaults)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(files).To(HaveLen(len(serverconf.NginxIncludes)))
+		for _, f := range files {
+			shipped, err := ioutil.ReadFile(filepath.Join("..", "..", "..", "defaults", "config", "nginx", f.Name))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(f.Content).To(Equal(string(shipped)), f.Name)
+		}
+	})
+
+	It("is included by the default configuration", func() {
+		for file, include := range map[string]string{
+			"http-defaults.conf":    "include            http-features.conf;",
+			"server-defaults.conf":  "include                server-features.conf;",
+			"server-locations.conf": "include         static-features.conf;",
+		} {
+			conf, err := ioutil.ReadFile(filepath.Join("..", "..", "..", "defaults", "config", "nginx", file))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(conf)).To(ContainSubstring(include), file)
+		}
+	})
+})
@@ -0,0 +1,290 @@
+// Package serverconf renders the include files which apply the web server
+// options of options.json, so they can be changed without forking the
+// whole web server configuration.
+package serverconf
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+const (
+	HeadersNone   = "none"
+	HeadersBasic  = "basic"
+	HeadersStrict = "strict"
+)
+
+// Options holds the toggles, keyed as in options.json.
+type Options struct {
+	NginxGzip         Bool   `json:"NGINX_GZIP"`
+	ForceHTTPS        Bool   `json:"FORCE_HTTPS"`
+	SecurityHeaders   String `json:"SECURITY_HEADERS"`
+	StaticCacheMaxAge String `json:"STATIC_CACHE_MAX_AGE"`
+	ClientMaxBodySize String `json:"CLIENT_MAX_BODY_SIZE"`
+	HTTPDDeflateTypes List   `json:"HTTPD_DEFLATE_TYPES"`
+	HTTPDExtraModules List   `json:"HTTPD_EXTRA_MODULES"`
+	FPMStatus         Bool   `json:"FPM_STATUS"`
+	FPMStatusPath     String `json:"FPM_STATUS_PATH"`
+	FPMPingPath       String `json:"FPM_PING_PATH"`
+	FPMStatusHtpasswd String `json:"FPM_STATUS_HTPASSWD"`
+	MetricsExporter   Bool   `json:"METRICS_EXPORTER"`
+	MetricsPath       String `json:"METRICS_PATH"`
+	LogFormat         String `json:"LOG_FORMAT"`
+
+	// FPMListen is where httpd reaches php-fpm, which is not an option but
+	// set by the buildpack.
+	FPMListen string `json:"-"`
+}
+
+// Defaults keep the configuration the buildpack always shipped. The default
+// includes in defaults/config are rendered from them. An empty
+// StaticCacheMaxAge keeps the caching of each web server, which is `max` for
+// nginx and none for httpd.
+var Defaults = Options{
+	NginxGzip:       true,
+	SecurityHeaders: HeadersNone,
+	FPMStatusPath:   "/fpm-status",
+	FPMPingPath:     "/fpm-ping",
+	MetricsPath:     "/metrics",
+	LogFormat:       LogFormatText,
+}
+
+const (
+	// MetricsListen is where the metrics exporter listens, the web server
+	// proxies MetricsPath to it.
+	MetricsListen = "127.0.0.1:9253"
+	// StatusListen is where the web server serves its own status page to the
+	// exporter, away from the app route.
+	StatusListen = "127.0.0.1:9254"
+	// NginxStatusPath and HTTPDStatusPath are the status pages at StatusListen.
+	NginxStatusPath = "/stub_status"
+	HTTPDStatusPath = "/server-status"
+)
+
+// Header is a response header added by a security header preset.
+type Header struct {
+	Name  string
+	Value string
+}
+
+var presets = map[string][]Header{
+	HeadersNone: nil,
+	HeadersBasic: {
+		{"X-Content-Type-Options", "nosniff"},
+		{"X-Frame-Options", "SAMEORIGIN"},
+		{"X-XSS-Protection", "1; mode=block"},
+		{"Referrer-Policy", "strict-origin-when-cross-origin"},
+	},
+	HeadersStrict: {
+		{"X-Content-Type-Options", "nosniff"},
+		{"X-Frame-Options", "DENY"},
+		{"X-XSS-Protection", "1; mode=block"},
+		{"Referrer-Policy", "no-referrer"},
+		{"Content-Security-Policy", "frame-ancestors 'none'"},
+		{"Strict-Transport-Security", "max-age=31536000; includeSubDomains"},
+	},
+}
+
+var (
+	maxAgePattern   = regexp.MustCompile(`^(max|off|([0-9]+)([smhdwMy]?))$`)
+	sizePattern     = regexp.MustCompile(`^[0-9]+[kKmMgG]?$`)
+	mimeTypePattern = regexp.MustCompile(`^[a-z0-9.+-]+/[a-z0-9.+-]+$`)
+	modulePattern   = regexp.MustCompile(`^[a-z0-9_]+$`)
+	locationPattern = regexp.MustCompile(`^(/[A-Za-z0-9._~-]+)+$`)
+	filePattern     = regexp.MustCompile(`^[A-Za-z0-9._-]+(/[A-Za-z0-9._-]+)*$`)
+)
+
+// Parse reads the options from JSON, keeping the defaults for missing keys.
+func Parse(data []byte) (Options, error) {
+	opts := Defaults
+	if err := json.Unmarshal(data, &opts); err != nil {
+		return Options{}, err
+	}
+	return opts, opts.Validate()
+}
+
+func (o Options) Validate() error {
+	if _, ok := presets[string(o.SecurityHeaders)]; !ok && o.SecurityHeaders != "" {
+		return fmt.Errorf("SECURITY_HEADERS must be one of %s, not %q", strings.Join(presetNames(), ", "), o.SecurityHeaders)
+	}
+	if o.StaticCacheMaxAge != "" && !maxAgePattern.MatchString(string(o.StaticCacheMaxAge)) {
+		return fmt.Errorf("STATIC_CACHE_MAX_AGE must be max, off or a time such as 3600, 12h or 7d, not %q", o.StaticCacheMaxAge)
+	}
+	if o.ClientMaxBodySize != "" && !sizePattern.MatchString(string(o.ClientMaxBodySize)) {
+		return fmt.Errorf("CLIENT_MAX_BODY_SIZE must be a size such as 512k or 20m, not %q", o.ClientMaxBodySize)
+	}
+	for _, t := range o.HTTPDDeflateTypes {
+		if !mimeTypePattern.MatchString(t) {
+			return fmt.Errorf("HTTPD_DEFLATE_TYPES must list MIME types such as application/json, not %q", t)
+		}
+	}
+	for _, m := range o.HTTPDExtraModules {
+		if !modulePattern.MatchString(m) {
+			return fmt.Errorf("HTTPD_EXTRA_MODULES must list module names such as expires, not %q", m)
+		}
+	}
+	if o.FPMStatus {
+		for _, p := range []struct {
+			key  string
+			path String
+		}{{"FPM_STATUS_PATH", o.FPMStatusPath}, {"FPM_PING_PATH", o.FPMPingPath}} {
+			if !locationPattern.MatchString(string(p.path)) {
+				return fmt.Errorf("%s must be a path such as /fpm-status, not %q", p.key, p.path)
+			}
+		}
+		if o.FPMStatusPath == o.FPMPingPath {
+			return fmt.Errorf("FPM_STATUS_PATH and FPM_PING_PATH must differ, both are %q", o.FPMStatusPath)
+		}
+	}
+	if o.MetricsExporter {
+		if !locationPattern.MatchString(string(o.MetricsPath)) {
+			return fmt.Errorf("METRICS_PATH must be a path such as /metrics, not %q", o.MetricsPath)
+		}
+		for _, p := range o.FPMPaths() {
+			if p == o.MetricsPath {
+				return fmt.Errorf("METRICS_PATH must differ from FPM_STATUS_PATH and FPM_PING_PATH, not %q", o.MetricsPath)
+			}
+		}
+	}
+	if o.LogFormat != "" && o.LogFormat != LogFormatText && o.LogFormat != LogFormatJSON {
+		return fmt.Errorf("LOG_FORMAT must be %s or %s, not %q", LogFormatText, LogFormatJSON, o.LogFormat)
+	}
+	if htpasswd := string(o.FPMStatusHtpasswd); htpasswd != "" && (!filePattern.MatchString(htpasswd) || strings.Contains("/"+htpasswd+"/", "/../")) {
+		return fmt.Errorf("FPM_STATUS_HTPASSWD must be a path relative to the app such as .bp-config/fpm-status.htpasswd, not %q", o.FPMStatusHtpasswd)
+	}
+	return nil
+}
+
+// FPMPaths returns the status and ping paths of php-fpm when FPM_STATUS
+// exposes them.
+func (o Options) FPMPaths() []String {
+	if !o.FPMStatus {
+		return nil
+	}
+	return []String{o.FPMStatusPath, o.FPMPingPath}
+}
+
+// MaxAgeSeconds converts StaticCacheMaxAge to seconds, with `max` being ten
+// years like nginx. Zero means static files are not cached.
+func (o Options) MaxAgeSeconds() int {
+	m := maxAgePattern.FindStringSubmatch(string(o.StaticCacheMaxAge))
+	switch {
+	case m == nil || m[1] == "off":
+		return 0
+	case m[1] == "max":
+		return 10 * 365 * 24 * 60 * 60
+	}
+	n, _ := strconv.Atoi(m[2])
+	return n * units[m[3]]
+}
+
+var units = map[string]int{"": 1, "s": 1, "m": 60, "h": 60 * 60, "d": 24 * 60 * 60, "w": 7 * 24 * 60 * 60, "M": 30 * 24 * 60 * 60, "y": 365 * 24 * 60 * 60}
+
+// Headers returns the headers of the SECURITY_HEADERS preset.
+func (o Options) Headers() []Header {
+	return presets[string(o.SecurityHeaders)]
+}
+
+func presetNames() []string {
+	var names []string
+	for name := range presets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// File is a rendered include, named relative to the configuration directory.
+type File struct {
+	Name    string
+	Content string
+}
+
+func render(tmpl *template.Template, names []string, opts Options) ([]File, error) {
+	var files []File
+	for _, name := range names {
+		buf := &bytes.Buffer{}
+		if err := tmpl.ExecuteTemplate(buf, name, opts); err != nil {
+			return nil, err
+		}
+		files = append(files, File{Name: name, Content: buf.String()})
+	}
+	return files, nil
+}
+
+// Bool accepts JSON booleans as well as the strings environment variables
+// provide, such as "true" or "0".
+type Bool bool
+
+func (b *Bool) UnmarshalJSON(data []byte) error {
+	var v interface{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	switch t := v.(type) {
+	case bool:
+		*b = Bool(t)
+	case string:
+		parsed, err := strconv.ParseBool(t)
+		if err != nil {
+			return fmt.Errorf("%q is not a boolean", t)
+		}
+		*b = Bool(parsed)
+	default:
+		return fmt.Errorf("%s is not a boolean", data)
+	}
+	return nil
+}
+
+// String accepts JSON strings and numbers, so `"STATIC_CACHE_MAX_AGE": 3600`
+// works as well.
+type String string
+
+func (s *String) UnmarshalJSON(data []byte) error {
+	var v interface{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	switch t := v.(type) {
+	case string:
+		*s = String(t)
+	case float64:
+		*s = String(strconv.FormatFloat(t, 'f', -1, 64))
+	default:
+		return fmt.Errorf("%s is not a string", data)
+	}
+	return nil
+}
+
+// List accepts JSON arrays as well as the space or comma separated strings
+// environment variables provide.
+type List []string
+
+func (l *List) UnmarshalJSON(data []byte) error {
+	var v interface{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	switch t := v.(type) {
+	case string:
+		*l = strings.FieldsFunc(t, func(r rune) bool { return r == ',' || r == ' ' })
+	case []interface{}:
+		*l = nil
+		for _, item := range t {
+			s, ok := item.(string)
+			if !ok {
+				return fmt.Errorf("%s is not a list of strings", data)
+			}
+			*l = append(*l, s)
+		}
+	default:
+		return fmt.Errorf("%s is not a list of strings", data)
+	}
+	return nil
+}
@@ -0,0 +1,13 @@
+package serverconf_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestServerconf(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Serverconf Suite")
+}
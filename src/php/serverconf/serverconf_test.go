@@ -0,0 +1,130 @@
+package serverconf_test
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"php/serverconf"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// toggle is switched on and off in every combination.
+type toggle struct {
+	name string
+	on   func(*serverconf.Options)
+	off  func(*serverconf.Options)
+}
+
+var (
+	httpsToggle   = toggle{"https", func(o *serverconf.Options) { o.ForceHTTPS = true }, func(o *serverconf.Options) { o.ForceHTTPS = false }}
+	headersToggle = toggle{"headers", func(o *serverconf.Options) { o.SecurityHeaders = "basic" }, func(o *serverconf.Options) { o.SecurityHeaders = "none" }}
+	cacheToggle   = toggle{"cache", func(o *serverconf.Options) { o.StaticCacheMaxAge = "7d" }, func(o *serverconf.Options) { o.StaticCacheMaxAge = "off" }}
+)
+
+// combinations names each combination of toggles after the ones which are
+// on, and adds the strict security headers preset, the php-fpm status
+// locations with and without authentication, the metrics exporter and JSON
+// logs.
+func combinations(toggles ...toggle) map[string]serverconf.Options {
+	all := map[string]serverconf.Options{}
+	for bits := 0; bits < 1<<uint(len(toggles)); bits++ {
+		opts := serverconf.Defaults
+		var on []string
+		for i, t := range toggles {
+			if bits&(1<<uint(i)) != 0 {
+				t.on(&opts)
+				on = append(on, t.name)
+			} else {
+				t.off(&opts)
+			}
+		}
+		name := strings.Join(on, "_")
+		if name == "" {
+			name = "none"
+		}
+		all[name] = opts
+	}
+	strict := serverconf.Defaults
+	strict.SecurityHeaders = "strict"
+	all["headers_strict"] = strict
+	status := serverconf.Defaults
+	status.FPMStatus = true
+	all["fpm_status"] = status
+	status.FPMStatusHtpasswd = ".bp-config/fpm-status.htpasswd"
+	all["fpm_status_auth"] = status
+	metrics := serverconf.Defaults
+	metrics.MetricsExporter = true
+	all["metrics"] = metrics
+	logs := serverconf.Defaults
+	logs.LogFormat = "json"
+	all["json_logs"] = logs
+	return all
+}
+
+// concat joins the includes into a single golden file.
+func concat(files []serverconf.File) string {
+	var out []string
+	for _, f := range files {
+		out = append(out, fmt.Sprintf("# --- %s\n%s", f.Name, f.Content))
+	}
+	return strings.Join(out, "")
+}
+
+func expectGolden(path, actual string) {
+	if *update {
+		Expect(os.MkdirAll(filepath.Dir(path), 0755)).To(Succeed())
+		Expect(ioutil.WriteFile(path, []byte(actual), 0644)).To(Succeed())
+	}
+	expected, err := ioutil.ReadFile(path)
+	Expect(err).NotTo(HaveOccurred(), "run go test with -update to create %s", path)
+	Expect(actual).To(Equal(string(expected)))
+}
+
+var _ = Describe("Options", func() {
+	It("keeps the defaults for missing keys", func() {
+		Expect(serverconf.Parse([]byte(`{}`))).To(Equal(serverconf.Defaults))
+	})
+
+	It("accepts the strings and numbers of environment variables", func() {
+		opts, err := serverconf.Parse([]byte(`{"NGINX_GZIP": "false", "FORCE_HTTPS": "1", "STATIC_CACHE_MAX_AGE": 3600}`))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(opts.NginxGzip).To(BeEquivalentTo(false))
+		Expect(opts.ForceHTTPS).To(BeEquivalentTo(true))
+		Expect(opts.StaticCacheMaxAge).To(BeEquivalentTo("3600"))
+	})
+
+	It("accepts lists as arrays or separated strings", func() {
+		opts, err := serverconf.Parse([]byte(`{"HTTPD_DEFLATE_TYPES": "application/json, image/svg+xml", "HTTPD_EXTRA_MODULES": ["expires"]}`))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(opts.HTTPDDeflateTypes).To(Equal(serverconf.List{"application/json", "image/svg+xml"}))
+		Expect(opts.HTTPDExtraModules).To(Equal(serverconf.List{"expires"}))
+	})
+
+	DescribeTable("rejecting invalid values",
+		func(options, message string) {
+			_, err := serverconf.Parse([]byte(options))
+			Expect(err).To(MatchError(ContainSubstring(message)))
+		},
+		Entry("unknown preset", `{"SECURITY_HEADERS": "paranoid"}`, `SECURITY_HEADERS must be one of basic, none, strict, not "paranoid"`),
+		Entry("bad max age", `{"STATIC_CACHE_MAX_AGE": "forever"}`, `STATIC_CACHE_MAX_AGE must be max, off or a time`),
+		Entry("bad body size", `{"CLIENT_MAX_BODY_SIZE": "lots"}`, `CLIENT_MAX_BODY_SIZE must be a size`),
+		Entry("bad mime type", `{"HTTPD_DEFLATE_TYPES": ["json"]}`, `HTTPD_DEFLATE_TYPES must list MIME types`),
+		Entry("bad module", `{"HTTPD_EXTRA_MODULES": "mod_expires.so"}`, `HTTPD_EXTRA_MODULES must list module names such as expires, not "mod_expires.so"`),
+		Entry("bad status path", `{"FPM_STATUS": true, "FPM_STATUS_PATH": "status"}`, `FPM_STATUS_PATH must be a path such as /fpm-status, not "status"`),
+		Entry("same status and ping path", `{"FPM_STATUS": true, "FPM_PING_PATH": "/fpm-status"}`, `FPM_STATUS_PATH and FPM_PING_PATH must differ`),
+		Entry("unknown log format", `{"LOG_FORMAT": "logfmt"}`, `LOG_FORMAT must be text or json, not "logfmt"`),
+		Entry("htpasswd outside the app", `{"FPM_STATUS_HTPASSWD": "../etc/htpasswd"}`, `FPM_STATUS_HTPASSWD must be a path relative to the app`),
+		Entry("bad metrics path", `{"METRICS_EXPORTER": true, "METRICS_PATH": "/metrics?x"}`, `METRICS_PATH must be a path such as /metrics, not "/metrics?x"`),
+		Entry("metrics path taken by php-fpm", `{"METRICS_EXPORTER": true, "FPM_STATUS": true, "METRICS_PATH": "/fpm-ping"}`, `METRICS_PATH must differ from FPM_STATUS_PATH and FPM_PING_PATH`),
+		Entry("bad boolean", `{"FORCE_HTTPS": "sometimes"}`, `"sometimes" is not a boolean`),
+	)
+})
@@ -0,0 +1,218 @@
+package servicebinding_test
+
+import (
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"php/servicebinding"
+
+	"github.com/cloudfoundry/libbuildpack/cutlass"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+)
+
+type service map[string]interface{}
+
+// credentials satisfies every agent, so only the matching rules decide.
+var credentials = map[string]string{
+	"environmentid": "env",
+	"apitoken":      "token",
+	"licenseKey":    "license",
+	"collhost":      "collector",
+	"endpoint":      "http://collector:4318",
+	"dsn":           "https://public@sentry.example.com/1",
+}
+
+func bound(name string, tags ...string) service {
+	return service{"name": name, "tags": tags, "credentials": credentials}
+}
+
+func unusable(name string) service {
+	return service{"name": name, "tags": []string{}, "credentials": map[string]string{}}
+}
+
+// byLabel binds one service per agent, each under the label of its agent.
+func byLabel(services func(agent string) []service) map[string][]service {
+	vcap := map[string][]service{}
+	for _, agent := range servicebinding.Agents {
+		vcap[agent] = services(agent)
+	}
+	return vcap
+}
+
+func found(service, match string, candidates ...string) servicebinding.Diagnostic {
+	return servicebinding.Diagnostic{Result: servicebinding.Found, Service: service, Match: match, Candidates: candidates}
+}
+
+func none() servicebinding.Diagnostic {
+	return servicebinding.Diagnostic{Result: servicebinding.None}
+}
+
+// quiet is no diagnostic at all, lookups which came nowhere near a service
+// print nothing.
+func quiet() servicebinding.Diagnostic {
+	return servicebinding.Diagnostic{}
+}
+
+func each(d func(agent string) servicebinding.Diagnostic) map[string]servicebinding.Diagnostic {
+	expected := map[string]servicebinding.Diagnostic{}
+	for _, agent := range servicebinding.Agents {
+		expected[agent] = d(agent)
+	}
+	return expected
+}
+
+var _ = Describe("Agent extension conformance", func() {
+	var bpDir string
+
+	BeforeEach(func() {
+		if _, err := exec.LookPath("python2"); err != nil {
+			Skip("python2 is not available")
+		}
+		var err error
+		bpDir, err = cutlass.FindRoot()
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	resolve := func(agent string, vcap map[string][]service, env []string) []servicebinding.Diagnostic {
+		services, err := json.Marshal(vcap)
+		Expect(err).NotTo(HaveOccurred())
+
+		cmd := exec.Command("python2", filepath.Join("testdata", "resolve.py"), bpDir, agent)
+		cmd.Env = append(os.Environ(), "PYTHONDONTWRITEBYTECODE=1", "VCAP_SERVICES="+string(services))
+		for _, a := range servicebinding.Agents {
+			cmd.Env = append(cmd.Env, strings.ToUpper(a)+"_SERVICE_NAME=")
+		}
+		cmd.Env = append(cmd.Env, env...)
+		output, err := cmd.CombinedOutput()
+		Expect(err).NotTo(HaveOccurred(), string(output))
+
+		diagnostics, err := servicebinding.Diagnostics(string(output))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(len(diagnostics)).To(BeNumerically("<=", 1), string(output))
+		return diagnostics
+	}
+
+	DescribeTable("every agent",
+		func(vcap map[string][]service, env func(agent string) []string, expected map[string]servicebinding.Diagnostic) {
+			for _, agent := range servicebinding.Agents {
+				var agentEnv []string
+				if env != nil {
+					agentEnv = env(agent)
+				}
+				diagnostics := resolve(agent, vcap, agentEnv)
+				want := expected[agent]
+				if want.Result == "" {
+					Expect(diagnostics).To(BeEmpty(), agent)
+					continue
+				}
+				want.Agent = agent
+				Expect(diagnostics).To(Equal([]servicebinding.Diagnostic{want}), agent)
+			}
+		},
+		Entry("without services",
+			map[string][]service{}, nil,
+			each(func(string) servicebinding.Diagnostic { return quiet() })),
+		Entry("bound by label",
+			byLabel(func(agent string) []service { return []service{bound(agent + "-service")} }), nil,
+			each(func(agent string) servicebinding.Diagnostic { return found(agent+"-service", "label") })),
+		Entry("user-provided services matched by name",
+			map[string][]service{"user-provided": {
+				bound("database"),
+				bound("my-appdynamics"),
+				bound("caapm-collector"),
+				bound("dynatrace-prod"),
+				bound("new-relic"),
+				bound("otel-collector"),
+				bound("sentry-errors"),
+			}}, nil,
+			map[string]servicebinding.Diagnostic{
+				"appdynamics":   found("my-appdynamics", "name"),
+				"caapm":         found("caapm-collector", "name"),
+				"dynatrace":     found("dynatrace-prod", "name"),
+				"newrelic":      found("new-relic", "name"),
+				"opentelemetry": found("otel-collector", "name"),
+				"sentry":        found("sentry-errors", "name"),
+			}),
+		Entry("brokered services matched by tag",
+			map[string][]service{"apm-broker": {
+				bound("apm-1", "AppDynamics"),
+				bound("apm-2", "caapm"),
+				bound("apm-3", "monitoring", "Dynatrace"),
+				bound("apm-4", "NewRelic"),
+				bound("apm-5", "OTLP"),
+				bound("apm-6", "Sentry"),
+			}}, nil,
+			map[string]servicebinding.Diagnostic{
+				"appdynamics":   found("apm-1", "tag"),
+				"caapm":         found("apm-2", "tag"),
+				"dynatrace":     found("apm-3", "tag"),
+				"newrelic":      found("apm-4", "tag"),
+				"opentelemetry": found("apm-5", "tag"),
+				"sentry":        found("apm-6", "tag"),
+			}),
+		Entry("more than one service",
+			byLabel(func(agent string) []service { return []service{bound(agent + "-1"), bound(agent + "-2")} }), nil,
+			map[string]servicebinding.Diagnostic{
+				"appdynamics": found("appdynamics-1", "label", "appdynamics-1", "appdynamics-2"),
+				"caapm":       found("caapm-1", "label", "caapm-1", "caapm-2"),
+				"dynatrace": {
+					Result:     servicebinding.Duplicate,
+					Match:      "label",
+					Candidates: []string{"dynatrace-1", "dynatrace-2"},
+				},
+				"newrelic":      found("newrelic-1", "label", "newrelic-1", "newrelic-2"),
+				"opentelemetry": found("opentelemetry-1", "label", "opentelemetry-1", "opentelemetry-2"),
+				"sentry":        found("sentry-1", "label", "sentry-1", "sentry-2"),
+			}),
+		Entry("a service named by <AGENT>_SERVICE_NAME",
+			map[string][]service{
+				"user-provided": {bound("shared-apm")},
+				"appdynamics":   {bound("appdynamics")},
+				"dynatrace":     {bound("dynatrace")},
+			},
+			func(agent string) []string { return []string{strings.ToUpper(agent) + "_SERVICE_NAME=shared-apm"} },
+			each(func(string) servicebinding.Diagnostic { return found("shared-apm", "override") })),
+		Entry("a missing service named by <AGENT>_SERVICE_NAME",
+			byLabel(func(agent string) []service { return []service{bound(agent)} }),
+			func(agent string) []string { return []string{strings.ToUpper(agent) + "_SERVICE_NAME=missing"} },
+			each(func(string) servicebinding.Diagnostic { return none() })),
+		Entry("services without credentials",
+			byLabel(func(agent string) []service { return []service{unusable(agent + " without credentials")} }), nil,
+			map[string]servicebinding.Diagnostic{
+				"appdynamics": found("appdynamics without credentials", "label"),
+				"caapm":       found("caapm without credentials", "label"),
+				"dynatrace": {
+					Result:  servicebinding.None,
+					Skipped: []string{"dynatrace without credentials"},
+				},
+				"newrelic": {
+					Result:  servicebinding.None,
+					Skipped: []string{"newrelic without credentials"},
+				},
+				"opentelemetry": {
+					Result:  servicebinding.None,
+					Skipped: []string{"opentelemetry without credentials"},
+				},
+				"sentry": {
+					Result:  servicebinding.None,
+					Skipped: []string{"sentry without credentials"},
+				},
+			}),
+		Entry("a label before a name",
+			map[string][]service{
+				"user-provided": {bound("appdynamics-ups"), bound("caapm-ups"), bound("dynatrace-ups"), bound("newrelic-ups"), bound("opentelemetry-ups"), bound("sentry-ups")},
+				"appdynamics":   {bound("primary")},
+				"caapm":         {bound("primary")},
+				"dynatrace":     {bound("primary")},
+				"newrelic":      {bound("primary")},
+				"opentelemetry": {bound("primary")},
+				"sentry":        {bound("primary")},
+			}, nil,
+			each(func(string) servicebinding.Diagnostic { return found("primary", "label") })),
+	)
+})
@@ -0,0 +1,142 @@
+// Package servicebinding reads the diagnostics the agent extensions print
+// when they look up their service in VCAP_SERVICES.
+//
+// All agent extensions find their service with lib/service_bindings.py,
+// which prints a line when a lookup came near a service:
+//
+//	service-binding agent=newrelic result=found service=nr match=label candidates=nr,nr-2
+//
+// A lookup which matched nothing prints no line, unless <AGENT>_SERVICE_NAME
+// named a service. When every matching service lacked credentials the result
+// is none, with the services under skipped and no match.
+//
+// Keys without a value are left out and values containing spaces are JSON
+// quoted.
+package servicebinding
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+const prefix = "service-binding "
+
+// Results of a lookup.
+const (
+	Found     = "found"
+	None      = "none"
+	Duplicate = "duplicate"
+)
+
+// Agents lists the extensions which look up their service with
+// lib/service_bindings.py, by the name of their directory in extensions/.
+var Agents = []string{"appdynamics", "caapm", "dynatrace", "newrelic", "opentelemetry", "sentry"}
+
+// Diagnostic is the outcome of one lookup.
+type Diagnostic struct {
+	Agent      string
+	Result     string
+	Service    string
+	Match      string
+	Candidates []string
+	Skipped    []string
+}
+
+// ParseDiagnostic parses a single diagnostic line.
+func ParseDiagnostic(line string) (Diagnostic, error) {
+	var d Diagnostic
+	if !strings.HasPrefix(line, prefix) {
+		return d, fmt.Errorf("not a service binding diagnostic: %q", line)
+	}
+	fields, err := split(strings.TrimPrefix(line, prefix))
+	if err != nil {
+		return d, err
+	}
+	for _, field := range fields {
+		i := strings.Index(field, "=")
+		if i < 0 {
+			return d, fmt.Errorf("field without a value: %q", field)
+		}
+		key, value := field[:i], field[i+1:]
+		if strings.HasPrefix(value, `"`) {
+			if err := json.Unmarshal([]byte(value), &value); err != nil {
+				return d, fmt.Errorf("bad quoting in %q: %v", field, err)
+			}
+		}
+		switch key {
+		case "agent":
+			d.Agent = value
+		case "result":
+			d.Result = value
+		case "service":
+			d.Service = value
+		case "match":
+			d.Match = value
+		case "candidates":
+			d.Candidates = strings.Split(value, ",")
+		case "skipped":
+			d.Skipped = strings.Split(value, ",")
+		default:
+			return d, fmt.Errorf("unknown field %q", key)
+		}
+	}
+	if d.Agent == "" || d.Result == "" {
+		return d, fmt.Errorf("diagnostic without an agent or result: %q", line)
+	}
+	return d, nil
+}
+
+// Diagnostics returns the diagnostics in the output of a staging run, in
+// order, ignoring every other line.
+func Diagnostics(output string) ([]Diagnostic, error) {
+	var diagnostics []Diagnostic
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if !strings.HasPrefix(line, prefix) {
+			continue
+		}
+		d, err := ParseDiagnostic(line)
+		if err != nil {
+			return nil, err
+		}
+		diagnostics = append(diagnostics, d)
+	}
+	return diagnostics, scanner.Err()
+}
+
+// split splits on spaces outside of double quotes.
+func split(s string) ([]string, error) {
+	var (
+		fields  []string
+		field   strings.Builder
+		quoted  bool
+		escaped bool
+	)
+	for _, r := range s {
+		switch {
+		case escaped:
+			escaped = false
+		case quoted && r == '\\':
+			escaped = true
+		case r == '"':
+			quoted = !quoted
+		case r == ' ' && !quoted:
+			if field.Len() > 0 {
+				fields = append(fields, field.String())
+				field.Reset()
+			}
+			continue
+		}
+		field.WriteRune(r)
+	}
+	if quoted {
+		return nil, fmt.Errorf("unterminated quote in %q", s)
+	}
+	if field.Len() > 0 {
+		fields = append(fields, field.String())
+	}
+	return fields, nil
+}
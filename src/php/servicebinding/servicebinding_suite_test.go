@@ -0,0 +1,13 @@
+package servicebinding_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestServicebinding(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Servicebinding Suite")
+}
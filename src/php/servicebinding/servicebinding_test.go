@@ -0,0 +1,55 @@
+package servicebinding_test
+
+import (
+	"php/servicebinding"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ParseDiagnostic", func() {
+	It("parses every field", func() {
+		d, err := servicebinding.ParseDiagnostic(`service-binding agent=newrelic result=found service="my nr" match=label candidates="my nr,nr-2" skipped=nr-3`)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(d).To(Equal(servicebinding.Diagnostic{
+			Agent:      "newrelic",
+			Result:     servicebinding.Found,
+			Service:    "my nr",
+			Match:      "label",
+			Candidates: []string{"my nr", "nr-2"},
+			Skipped:    []string{"nr-3"},
+		}))
+	})
+
+	It("leaves out missing fields", func() {
+		d, err := servicebinding.ParseDiagnostic("service-binding agent=caapm result=none")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(d).To(Equal(servicebinding.Diagnostic{Agent: "caapm", Result: servicebinding.None}))
+	})
+
+	DescribeTable("rejects",
+		func(line string) {
+			_, err := servicebinding.ParseDiagnostic(line)
+			Expect(err).To(HaveOccurred())
+		},
+		Entry("other lines", "-----> Installing PHP"),
+		Entry("fields without a value", "service-binding agent=caapm result"),
+		Entry("unknown fields", "service-binding agent=caapm result=none plan=free"),
+		Entry("unterminated quotes", `service-binding agent=caapm result=found service="a b`),
+		Entry("a missing result", "service-binding agent=caapm"),
+	)
+})
+
+var _ = Describe("Diagnostics", func() {
+	It("picks the diagnostics out of the staging output", func() {
+		diagnostics, err := servicebinding.Diagnostics("-----> Installing PHP\n" +
+			"       service-binding agent=dynatrace result=duplicate match=name candidates=dt-1,dt-2\n" +
+			"service-binding agent=newrelic result=none\n")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(diagnostics).To(Equal([]servicebinding.Diagnostic{
+			{Agent: "dynatrace", Result: servicebinding.Duplicate, Match: "name", Candidates: []string{"dt-1", "dt-2"}},
+			{Agent: "newrelic", Result: servicebinding.None},
+		}))
+	})
+})
@@ -0,0 +1,19 @@
+# Looks up the service of an agent extension in the VCAP_SERVICES of the
+# environment, honouring <AGENT>_SERVICE_NAME, and prints the diagnostic.
+#
+#   python resolve.py <buildpack dir> <agent>
+import json
+import os
+import sys
+
+bp_dir = os.path.abspath(sys.argv[1])
+sys.path.insert(0, os.path.join(bp_dir, 'lib'))
+
+from build_pack_utils import utils
+from service_bindings import find_service
+
+extension = utils.load_extension(os.path.join(bp_dir, 'extensions',
+                                              sys.argv[2]))
+ctx = dict(os.environ)
+ctx['VCAP_SERVICES'] = json.loads(os.environ.get('VCAP_SERVICES', '{}'))
+find_service(ctx, extension.SERVICE_RULE)
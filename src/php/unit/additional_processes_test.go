@@ -0,0 +1,110 @@
+package unit_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/cloudfoundry/libbuildpack/cutlass"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gexec"
+)
+
+var _ = Describe("additional processes", func() {
+	var container string
+
+	AfterEach(func() {
+		if container != "" {
+			exec.Command("docker", "rm", "-f", container).Run()
+			container = ""
+		}
+	})
+
+	It("are added to .procs and restarted next to php-fpm", func() {
+		if !IsDockerAvailable() {
+			Skip("running the fixture needs docker")
+		}
+
+		container = startFixture("with_additional_processes", "nginx")
+		logs := func() string {
+			return containerLogs(container)
+		}
+		defer func() {
+			GinkgoWriter.Write([]byte(logs()))
+		}()
+
+		url := "http://" + appAddress(container) + "/index.php"
+		Eventually(func() int {
+			resp, err := http.Get(url)
+			if err != nil {
+				return 0
+			}
+			resp.Body.Close()
+			return resp.StatusCode
+		}, 10*time.Minute, 2*time.Second).Should(Equal(http.StatusOK))
+
+		procs, err := exec.Command("docker", "exec", container, "cat", "/home/vcap/app/.procs").Output()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(procs)).To(ContainSubstring("heartbeat [restart=always,delay=1,max_restarts=0]: php bin/heartbeat.php\n"))
+		Expect(string(procs)).To(ContainSubstring("migrate [restart=on-failure,delay=1,max_restarts=0]: php bin/migrate.php\n"))
+		Expect(string(procs)).To(MatchRegexp(`(?m)^php-fpm: `))
+
+		Eventually(logs, time.Minute).Should(MatchRegexp(`heartbeat\s+\| exited with status 0, restarting it in 1s \(restart 3\)`))
+		Expect(logs()).To(MatchRegexp(`migrate\s+\| migrations done`))
+		Expect(logs()).To(MatchRegexp(`migrate\s+\| exited with status 0, not restarting it`))
+
+		resp, err := http.Get(url)
+		Expect(err).NotTo(HaveOccurred())
+		body, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(body)).To(MatchRegexp(`heartbeats: [3-9]`))
+	})
+
+	Context("running bin/start without a container", func() {
+		var home string
+
+		BeforeEach(func() {
+			if _, err := exec.LookPath("python2"); err != nil {
+				Skip("python2 is not available")
+			}
+			var err error
+			home, err = ioutil.TempDir("", "additional-processes")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(os.Mkdir(filepath.Join(home, "logs"), 0755)).To(Succeed())
+		})
+
+		AfterEach(func() {
+			os.RemoveAll(home)
+		})
+
+		It("supervises the processes of .procs with their policies", func() {
+			bpDir, err := cutlass.FindRoot()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(ioutil.WriteFile(filepath.Join(home, ".procs"), []byte(
+				"web: sleep 3; exit 4\n"+
+					"ticker [restart=always,delay=0.5,max_restarts=0]: echo tick\n"+
+					"setup [restart=on-failure,delay=0,max_restarts=0]: echo ready\n"), 0644)).To(Succeed())
+
+			cmd := exec.Command("python2", filepath.Join(bpDir, "bin", "start"))
+			cmd.Dir = home
+			cmd.Env = append(os.Environ(), "HOME="+home, "PYTHONPATH="+filepath.Join(bpDir, "lib"), "PYTHONDONTWRITEBYTECODE=1")
+			session, err := gexec.Start(cmd, GinkgoWriter, GinkgoWriter)
+			Expect(err).NotTo(HaveOccurred())
+
+			// the web process exiting stops the others, as it always did
+			Eventually(session, 20*time.Second).Should(gexec.Exit(4))
+			output := string(session.Out.Contents())
+			Expect(strings.Count(output, "| tick")).To(BeNumerically(">=", 3))
+			Expect(output).To(MatchRegexp(`ticker\s+\| exited with status 0, restarting it in 0.5s \(restart 2\)`))
+			Expect(output).To(MatchRegexp(`setup\s+\| ready`))
+			Expect(output).To(MatchRegexp(`setup\s+\| exited with status 0, not restarting it`))
+			Expect(output).NotTo(ContainSubstring("setup   | exited with status 0, restarting"))
+		})
+	})
+})
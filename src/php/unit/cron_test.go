@@ -0,0 +1,70 @@
+package unit_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+
+	"github.com/cloudfoundry/libbuildpack/cutlass"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("cron jobs", func() {
+	var container string
+
+	AfterEach(func() {
+		if container != "" {
+			exec.Command("docker", "rm", "-f", container).Run()
+			container = ""
+		}
+	})
+
+	It("run next to php-fpm with the PHP of the app", func() {
+		if !IsDockerAvailable() {
+			Skip("running the fixture needs docker")
+		}
+		bpDir, err := cutlass.FindRoot()
+		Expect(err).NotTo(HaveOccurred())
+		if _, err := os.Stat(filepath.Join(bpDir, "bin", "php-cron")); err != nil {
+			Skip("bin/php-cron is not built, run scripts/build.sh")
+		}
+
+		container = startFixture("with_cron", "httpd")
+		logs := func() string {
+			return containerLogs(container)
+		}
+		defer func() {
+			GinkgoWriter.Write([]byte(logs()))
+		}()
+
+		url := "http://" + appAddress(container) + "/index.php"
+		Eventually(func() int {
+			resp, err := http.Get(url)
+			if err != nil {
+				return 0
+			}
+			resp.Body.Close()
+			return resp.StatusCode
+		}, 10*time.Minute, 2*time.Second).Should(Equal(http.StatusOK))
+
+		procs, err := exec.Command("docker", "exec", container, "cat", "/home/vcap/app/.procs").Output()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(procs)).To(ContainSubstring(`cron [restart=always,delay=1,max_restarts=0]: $HOME/.bp/bin/php-cron "$HOME/.bp/crontab"` + "\n"))
+
+		Eventually(logs, 3*time.Minute, 5*time.Second).Should(MatchRegexp(`cron\s+\| job 2 skipped, the run due \S+ is still running`))
+		Expect(logs()).To(MatchRegexp(`cron\s+\| job 1 started, due \S+: php bin/tick.php`))
+		Expect(logs()).To(MatchRegexp(`cron\s+\| tick with /home/vcap/app/php/etc/php.ini`))
+		Expect(logs()).To(MatchRegexp(`cron\s+\| job 1 ended with exit code 0 after `))
+
+		resp, err := http.Get(url)
+		Expect(err).NotTo(HaveOccurred())
+		body, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(body)).To(MatchRegexp(`ticks: [1-9]`))
+	})
+})
@@ -0,0 +1,57 @@
+package unit_test
+
+import (
+	"net/http"
+	"os/exec"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("php-fpm slowlog", func() {
+	var container string
+
+	AfterEach(func() {
+		if container != "" {
+			exec.Command("docker", "rm", "-f", container).Run()
+			container = ""
+		}
+	})
+
+	It("streams the trace of slow requests and stops stuck ones", func() {
+		if !IsDockerAvailable() {
+			Skip("running the fixture needs docker")
+		}
+
+		// php-fpm traces the slow worker with ptrace
+		container = startFixture("fpm_slowlog", "httpd", "--cap-add", "SYS_PTRACE")
+		logs := func() string {
+			return containerLogs(container)
+		}
+		defer func() {
+			GinkgoWriter.Write([]byte(logs()))
+		}()
+
+		url := "http://" + appAddress(container) + "/slow.php"
+
+		get := func(query string) int {
+			resp, err := http.Get(url + query)
+			if err != nil {
+				return 0
+			}
+			resp.Body.Close()
+			return resp.StatusCode
+		}
+		Eventually(func() int { return get("?seconds=0") }, 10*time.Minute, 2*time.Second).Should(Equal(http.StatusOK))
+
+		Expect(get("?seconds=3")).To(Equal(http.StatusOK))
+		Eventually(logs, 30*time.Second).Should(MatchRegexp(`php-fpm-slowlog\s+\|.*script_filename = /home/vcap/app/htdocs/slow.php`))
+		Expect(logs()).To(MatchRegexp(`php-fpm-slowlog\s+\|.*wait_for_the_report\(\) /home/vcap/app/htdocs/slow.php:7`))
+
+		start := time.Now()
+		Expect(get("?seconds=60")).To(BeNumerically(">=", 500))
+		Expect(time.Since(start)).To(BeNumerically("<", 30*time.Second))
+		Expect(logs()).To(ContainSubstring("execution timed out"))
+	})
+})
@@ -0,0 +1,62 @@
+package unit_test
+
+import (
+	"fmt"
+	"net/http"
+	"os/exec"
+	"time"
+
+	"php/fpmstatus"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("php-fpm status", func() {
+	var container string
+
+	AfterEach(func() {
+		if container != "" {
+			exec.Command("docker", "rm", "-f", container).Run()
+			container = ""
+		}
+	})
+
+	DescribeTable("is served by the web server behind basic auth",
+		func(webServer string) {
+			if !IsDockerAvailable() {
+				Skip("running the fixture needs docker")
+			}
+			container = startFixture("fpm_status", webServer)
+			defer func() {
+				GinkgoWriter.Write([]byte(containerLogs(container)))
+			}()
+
+			client := &fpmstatus.Client{
+				BaseURL:  fmt.Sprintf("http://%s", appAddress(container)),
+				Username: "probe",
+				Password: "secret",
+			}
+
+			status, err := client.Wait(10*time.Minute, 2*time.Second, func(s *fpmstatus.Status) bool {
+				return s.TotalProcesses == 3
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(status.Pool).To(Equal("www"))
+			Expect(status.ProcessManager).To(Equal("static"))
+			Expect(status.ActiveProcesses).To(Equal(1))
+			Expect(status.IdleProcesses).To(Equal(2))
+
+			anonymous := &fpmstatus.Client{BaseURL: client.BaseURL}
+			Expect(anonymous.Ping()).To(MatchError(ContainSubstring("401")))
+
+			resp, err := http.Get(client.BaseURL + "/index.php")
+			Expect(err).NotTo(HaveOccurred())
+			resp.Body.Close()
+			Expect(resp.StatusCode).To(Equal(http.StatusOK))
+		},
+		Entry("httpd", "httpd"),
+		Entry("nginx", "nginx"),
+	)
+})
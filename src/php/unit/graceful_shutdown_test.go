@@ -0,0 +1,181 @@
+package unit_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"syscall"
+	"time"
+
+	"github.com/cloudfoundry/libbuildpack/cutlass"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gexec"
+)
+
+// fakeHttpd serves requests which take ?seconds to answer and, as httpd does
+// with SIGWINCH, stops listening and ends with the requests in flight.
+const fakeHttpd = `
+import BaseHTTPServer, SocketServer, signal, sys, threading, time, urlparse
+
+class Handler(BaseHTTPServer.BaseHTTPRequestHandler):
+    def do_GET(self):
+        query = urlparse.parse_qs(urlparse.urlparse(self.path).query)
+        time.sleep(float(query.get('seconds', ['0'])[0]))
+        self.send_response(200)
+        self.end_headers()
+        self.wfile.write('slow request done\n')
+
+class Server(SocketServer.ThreadingMixIn, BaseHTTPServer.HTTPServer):
+    pass
+
+server = Server(('127.0.0.1', int(sys.argv[1])), Handler)
+signal.signal(signal.SIGWINCH,
+              lambda signum, frame: threading.Thread(target=server.shutdown).start())
+print 'listening'
+server.serve_forever()
+server.server_close()
+`
+
+// fakeFpm exits on SIGQUIT, as php-fpm does once its workers are idle.
+const fakeFpm = `trap 'echo workers idle; exit 0' QUIT
+while :; do sleep 0.1; done
+`
+
+var _ = Describe("graceful shutdown", func() {
+	var (
+		bpDir string
+		home  string
+		port  int
+	)
+
+	BeforeEach(func() {
+		if _, err := exec.LookPath("python2"); err != nil {
+			Skip("python2 is not available")
+		}
+		var err error
+		bpDir, err = cutlass.FindRoot()
+		Expect(err).NotTo(HaveOccurred())
+		home, err = ioutil.TempDir("", "graceful-shutdown")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(os.Mkdir(filepath.Join(home, "logs"), 0755)).To(Succeed())
+		Expect(ioutil.WriteFile(filepath.Join(home, "httpd.py"), []byte(fakeHttpd), 0644)).To(Succeed())
+		Expect(ioutil.WriteFile(filepath.Join(home, "php-fpm.sh"), []byte(fakeFpm), 0644)).To(Succeed())
+
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		Expect(err).NotTo(HaveOccurred())
+		port = l.Addr().(*net.TCPAddr).Port
+		l.Close()
+
+		Expect(ioutil.WriteFile(filepath.Join(home, ".procs"), []byte(fmt.Sprintf(
+			"httpd: python2 -u $HOME/httpd.py %d\n"+
+				"php-fpm: bash $HOME/php-fpm.sh\n"+
+				"worker: sleep 60\n", port)), 0644)).To(Succeed())
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(home)
+	})
+
+	// start runs bin/start as the launcher does, after bp_env_vars.sh
+	start := func(grace string) *gexec.Session {
+		cmd := exec.Command("python2", filepath.Join(bpDir, "bin", "start"))
+		cmd.Dir = home
+		cmd.Env = append(os.Environ(), "HOME="+home, "PYTHONPATH="+filepath.Join(bpDir, "lib"), "PYTHONDONTWRITEBYTECODE=1",
+			"SHUTDOWN_GRACE_SECONDS="+grace)
+		session, err := gexec.Start(cmd, GinkgoWriter, GinkgoWriter)
+		Expect(err).NotTo(HaveOccurred())
+		Eventually(session, 10*time.Second).Should(outputMatches(`httpd\s+\| listening`))
+		return session
+	}
+
+	type response struct {
+		body string
+		err  error
+	}
+
+	// slowRequest returns once the request is being served
+	slowRequest := func(seconds int) <-chan response {
+		responses := make(chan response, 1)
+		go func() {
+			resp, err := http.Get(fmt.Sprintf("http://127.0.0.1:%d/?seconds=%d", port, seconds))
+			if err != nil {
+				responses <- response{err: err}
+				return
+			}
+			defer resp.Body.Close()
+			body, err := ioutil.ReadAll(resp.Body)
+			responses <- response{body: string(body), err: err}
+		}()
+		time.Sleep(500 * time.Millisecond)
+		return responses
+	}
+
+	It("finishes the requests in flight before stopping php-fpm", func() {
+		session := start("10")
+		responses := slowRequest(2)
+
+		session.Signal(syscall.SIGTERM)
+		Eventually(func() error {
+			conn, err := net.Dial("tcp", fmt.Sprintf("127.0.0.1:%d", port))
+			if err == nil {
+				conn.Close()
+			}
+			return err
+		}, 2*time.Second).Should(HaveOccurred(), "the web server takes no new connections")
+
+		var r response
+		Eventually(responses, 10*time.Second).Should(Receive(&r))
+		Expect(r.err).NotTo(HaveOccurred())
+		Expect(r.body).To(Equal("slow request done\n"))
+
+		Eventually(session, 10*time.Second).Should(gexec.Exit(143))
+		output := string(session.Out.Contents())
+		expectInOrder(output,
+			`httpd\s+\| stopping gracefully with SIGWINCH, waiting up to 10s for it`,
+			`httpd\s+\| stopped after \d+\.\ds`,
+			`php-fpm\s+\| stopping gracefully with SIGQUIT`,
+			`php-fpm\s+\| workers idle`)
+		Expect(output).To(MatchRegexp(`php-fpm\s+\| stopped after`))
+		Expect(output).NotTo(MatchRegexp(`worker\s+\| stopping`))
+		Expect(ioutil.ReadFile(filepath.Join(home, "logs", "proc-man.log"))).To(ContainSubstring("SIGTERM received"))
+	})
+
+	It("stops a request which outlasts the grace period", func() {
+		session := start("1")
+		responses := slowRequest(30)
+
+		session.Signal(syscall.SIGTERM)
+		var r response
+		Eventually(responses, 10*time.Second).Should(Receive(&r))
+		Expect(r.err).To(HaveOccurred())
+
+		Eventually(session, 10*time.Second).Should(gexec.Exit(143))
+		Expect(session.Out.Contents()).To(MatchRegexp(`httpd\s+\| still running after the 1s grace period, stopping it`))
+		Expect(session.Out.Contents()).NotTo(MatchRegexp(`php-fpm\s+\| stopping gracefully`))
+	})
+})
+
+// outputMatches matches the output of a session so far, without moving on
+// as gbytes.Say does, so the same output can be checked again afterwards
+func outputMatches(pattern string) OmegaMatcher {
+	return WithTransform(func(s *gexec.Session) string {
+		return string(s.Out.Contents())
+	}, MatchRegexp(pattern))
+}
+
+// expectInOrder checks that each pattern matches output after the one
+// before it
+func expectInOrder(output string, patterns ...string) {
+	rest := output
+	for _, pattern := range patterns {
+		loc := regexp.MustCompile(pattern).FindStringIndex(rest)
+		ExpectWithOffset(1, loc).NotTo(BeNil(), "%q after the lines before it in:\n%s", pattern, output)
+		rest = rest[loc[1]:]
+	}
+}
@@ -0,0 +1,61 @@
+package unit_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"os/exec"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("metrics exporter", func() {
+	var container string
+
+	AfterEach(func() {
+		if container != "" {
+			exec.Command("docker", "rm", "-f", container).Run()
+			container = ""
+		}
+	})
+
+	DescribeTable("serves php-fpm and web server metrics through the app route",
+		func(webServer, prefix string) {
+			if !IsDockerAvailable() {
+				Skip("running the fixture needs docker")
+			}
+			container = startFixture("metrics", webServer)
+			defer func() {
+				GinkgoWriter.Write([]byte(containerLogs(container)))
+			}()
+
+			url := "http://" + appAddress(container) + "/metrics"
+
+			scrape := func() string {
+				resp, err := http.Get(url)
+				if err != nil {
+					return err.Error()
+				}
+				defer resp.Body.Close()
+				body, _ := ioutil.ReadAll(resp.Body)
+				return string(body)
+			}
+			Eventually(scrape, 10*time.Minute, 2*time.Second).Should(And(
+				ContainSubstring("\nphpfpm_up 1\n"),
+				ContainSubstring("\n"+prefix+"_up 1\n"),
+			))
+			Expect(scrape()).To(ContainSubstring(`phpfpm_total_processes{pool="www"}`))
+
+			// the status pages are only read by the exporter
+			resp, err := http.Get(strings.TrimSuffix(url, "/metrics") + "/fpm-status")
+			Expect(err).NotTo(HaveOccurred())
+			resp.Body.Close()
+			Expect(resp.StatusCode).To(Equal(http.StatusNotFound))
+		},
+		Entry("httpd", "httpd", "apache"),
+		Entry("nginx", "nginx", "nginx"),
+	)
+})
@@ -0,0 +1,56 @@
+package unit_test
+
+import (
+	"os/exec"
+	"path/filepath"
+	"time"
+
+	"github.com/cloudfoundry/libbuildpack/cutlass"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gexec"
+)
+
+// stages the fixture, then moves it to where CF runs the app and loads the
+// start script environment, like a launch does
+const opcacheWarmupScript = `set -e
+cp -r /fixture /tmp/app
+/buildpack/bin/compile /tmp/app /tmp/cache
+echo "cached: $(find /tmp/app/.opcache -name '*.bin' | sed 's|^/tmp/app/.opcache/[^/]*||' | sort | tr '\n' ' ')"
+
+mkdir -p /home/vcap
+mv /tmp/app /home/vcap/app
+cd /home/vcap/app
+export HOME=/home/vcap/app
+for f in .profile.d/*.sh; do . "$f"; done
+
+touch /tmp/launched
+sleep 1
+php -d opcache.enable_cli=1 htdocs/index.php
+echo "compiled at launch: $(find .opcache -name '*.bin' -newer /tmp/launched | wc -l)"
+`
+
+var _ = Describe("OPcache warmup", func() {
+	It("ships a file cache which is used at launch", func() {
+		if !IsDockerAvailable() {
+			Skip("staging the fixture needs docker")
+		}
+		bpDir, err := cutlass.FindRoot()
+		Expect(err).NotTo(HaveOccurred())
+
+		cmd := exec.Command("docker", "run", "--rm",
+			"-v", bpDir+":/buildpack:ro",
+			"-v", filepath.Join(bpDir, "fixtures", "opcache_warmup")+":/fixture:ro",
+			"cloudfoundry/cflinuxfs2", "bash", "-c", opcacheWarmupScript)
+		session, err := gexec.Start(cmd, GinkgoWriter, GinkgoWriter)
+		Expect(err).NotTo(HaveOccurred())
+		Eventually(session, 10*time.Minute).Should(gexec.Exit(0))
+
+		output := string(session.Out.Contents())
+		Expect(output).To(ContainSubstring("Warming up OPcache"))
+		Expect(output).To(ContainSubstring("/home/vcap/app/htdocs/index.php.bin"))
+		Expect(output).To(ContainSubstring("/home/vcap/app/lib/Greeting.php.bin"))
+		Expect(output).To(ContainSubstring("Hello from lib"))
+		Expect(output).To(ContainSubstring("compiled at launch: 0"))
+	})
+})
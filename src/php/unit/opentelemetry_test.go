@@ -0,0 +1,108 @@
+package unit_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os/exec"
+	"time"
+
+	"php/otlp"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("opentelemetry extension", func() {
+	var (
+		container string
+		collector *otlp.Collector
+	)
+
+	AfterEach(func() {
+		if container != "" {
+			exec.Command("docker", "rm", "-f", container).Run()
+			container = ""
+		}
+		if collector != nil {
+			collector.Close()
+			collector = nil
+		}
+	})
+
+	// the fixture exports its span the way the SDK would, so this checks the
+	// exporter configuration the extension writes, not instrumentation
+	It("configures the exporter of the fixture for the bound collector", func() {
+		if !IsDockerAvailable() {
+			Skip("running the fixture needs docker")
+		}
+
+		// the container reaches the collector through the docker host
+		listener, err := net.Listen("tcp", "0.0.0.0:0")
+		Expect(err).NotTo(HaveOccurred())
+		collector = otlp.NewOn(listener)
+		port := listener.Addr().(*net.TCPAddr).Port
+
+		vcapApplication, err := json.Marshal(map[string]string{
+			"application_id":    "app-guid",
+			"application_name":  "otel-app",
+			"name":              "otel-app",
+			"space_id":          "space-guid",
+			"space_name":        "dev",
+			"organization_id":   "org-guid",
+			"organization_name": "acme",
+		})
+		Expect(err).NotTo(HaveOccurred())
+		vcapServices, err := json.Marshal(map[string]interface{}{
+			"user-provided": []interface{}{map[string]interface{}{
+				"name":  "otel-collector",
+				"label": "user-provided",
+				"tags":  []string{},
+				"credentials": map[string]interface{}{
+					"endpoint": fmt.Sprintf("http://collector:%d", port),
+					"protocol": "http/json",
+					"headers":  map[string]string{"x-api-key": "s3cret"},
+				},
+			}},
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		container = startFixture("with_opentelemetry", "nginx",
+			"--add-host", "collector:host-gateway",
+			"-e", "VCAP_APPLICATION="+string(vcapApplication),
+			"-e", "VCAP_SERVICES="+string(vcapServices),
+			"-e", "CF_INSTANCE_INDEX=0",
+			"-e", "CF_INSTANCE_GUID=instance-guid")
+		defer func() {
+			GinkgoWriter.Write([]byte(containerLogs(container)))
+		}()
+
+		url := "http://" + appAddress(container) + "/index.php?id=1"
+
+		Eventually(func() []otlp.Span {
+			if resp, err := http.Get(url); err == nil {
+				resp.Body.Close()
+			}
+			return collector.Spans()
+		}, 10*time.Minute, 2*time.Second).ShouldNot(BeEmpty())
+
+		span := collector.Spans()[0]
+		Expect(span.Name).To(Equal("GET /index.php"))
+		Expect(span.Kind).To(Equal(2))
+		Expect(span.TraceID).To(MatchRegexp("^[0-9a-f]{32}$"))
+		Expect(span.Attributes).To(HaveKeyWithValue("http.target", "/index.php?id=1"))
+		Expect(span.Header.Get("X-Api-Key")).To(Equal("s3cret"))
+		Expect(span.Resource).To(Equal(map[string]string{
+			"service.name":                 "otel-app",
+			"service.instance.id":          "instance-guid",
+			"cloudfoundry.app.id":          "app-guid",
+			"cloudfoundry.app.name":        "otel-app",
+			"cloudfoundry.app.instance.id": "0",
+			"cloudfoundry.space.id":        "space-guid",
+			"cloudfoundry.space.name":      "dev",
+			"cloudfoundry.org.id":          "org-guid",
+			"cloudfoundry.org.name":        "acme",
+		}))
+	})
+})
@@ -0,0 +1,91 @@
+package unit_test
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/cloudfoundry/libbuildpack/cutlass"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("php-task", func() {
+	var (
+		bpDir string
+		home  string
+	)
+
+	write := func(path, content string) {
+		Expect(os.MkdirAll(filepath.Dir(filepath.Join(home, path)), 0755)).To(Succeed())
+		Expect(ioutil.WriteFile(filepath.Join(home, path), []byte(content), 0755)).To(Succeed())
+	}
+
+	// run starts php-task as a task would, with only HOME and PATH set
+	run := func(env []string, args ...string) (string, int) {
+		cmd := exec.Command(filepath.Join(home, ".bp", "bin", "php-task"), args...)
+		cmd.Dir = "/"
+		cmd.Env = append([]string{"HOME=" + home, "PATH=" + os.Getenv("PATH"), "PYENV_VERSION=" + os.Getenv("PYENV_VERSION")}, env...)
+		out, err := cmd.CombinedOutput()
+		if exit, ok := err.(*exec.ExitError); ok {
+			return string(out), exit.ExitCode()
+		}
+		Expect(err).NotTo(HaveOccurred())
+		return string(out), 0
+	}
+
+	BeforeEach(func() {
+		if _, err := exec.LookPath("python2"); err != nil {
+			Skip("python2 is not available")
+		}
+		var err error
+		bpDir, err = cutlass.FindRoot()
+		Expect(err).NotTo(HaveOccurred())
+		home, err = ioutil.TempDir("", "php-task")
+		Expect(err).NotTo(HaveOccurred())
+
+		// a droplet as staging leaves it, with the scripts bin/start needs
+		for _, name := range []string{"php-task", "rewrite"} {
+			data, err := ioutil.ReadFile(filepath.Join(bpDir, "bin", name))
+			Expect(err).NotTo(HaveOccurred())
+			write(filepath.Join(".bp", "bin", name), string(data))
+		}
+		Expect(os.Symlink(filepath.Join(bpDir, "lib"), filepath.Join(home, ".bp", "lib"))).To(Succeed())
+		Expect(os.Mkdir(filepath.Join(home, "logs"), 0755)).To(Succeed())
+		write("php/etc/php.ini", "memory_limit = @{PHP_MEMORY_LIMIT}\nsys_temp_dir = \"@{TMPDIR}\"\n")
+		write(".profile.d/bp_env_vars.sh", "export PHPRC=$HOME/php/etc\nexport LD_LIBRARY_PATH=$LD_LIBRARY_PATH:$HOME/php/lib\n")
+		write(".profile.d/rewrite.sh", "export PYTHONPATH=$HOME/.bp/lib\nexport PYTHONDONTWRITEBYTECODE=1\n"+
+			"export PHP_MEMORY_LIMIT=96M\necho preprocessed >> $HOME/preprocess.log\n$HOME/.bp/bin/rewrite \"$HOME/php/etc\"")
+		write(".profile.d/z_app.sh", "export APP_GREETING=hi\n")
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(home)
+	})
+
+	It("sets PHP up as bin/start does before running the command", func() {
+		out, code := run([]string{"TMPDIR=/tmp/task"}, "bash", "-c", `echo "$PWD $PHPRC $APP_GREETING"; cat "$PHPRC/php.ini"; exit 3`)
+		Expect(code).To(Equal(3))
+		Expect(out).To(Equal(strings.Join([]string{
+			home + " " + filepath.Join(home, "php", "etc") + " hi",
+			"memory_limit = 96M",
+			`sys_temp_dir = "/tmp/task"`,
+			"",
+		}, "\n")))
+	})
+
+	It("keeps what the launcher sourced already", func() {
+		out, code := run([]string{"PHPRC=" + filepath.Join(home, "php", "etc")}, "bash", "-c", `echo "greeting=$APP_GREETING"`)
+		Expect(code).To(Equal(0))
+		Expect(out).To(Equal("greeting=\n"))
+		Expect(filepath.Join(home, "preprocess.log")).NotTo(BeAnExistingFile())
+	})
+
+	It("needs a command", func() {
+		out, code := run(nil)
+		Expect(code).To(Equal(2))
+		Expect(out).To(ContainSubstring("usage: php-task <command>"))
+	})
+})
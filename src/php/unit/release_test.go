@@ -0,0 +1,98 @@
+package unit_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+
+	"php/release"
+
+	"github.com/cloudfoundry/libbuildpack/cutlass"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gexec"
+)
+
+var _ = Describe("release commands", func() {
+	var (
+		bpDir string
+		home  string
+	)
+
+	writeConfig := func(config release.Config) {
+		data, err := json.Marshal(config)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ioutil.WriteFile(filepath.Join(home, ".bp", "release.json"), data, 0644)).To(Succeed())
+	}
+
+	// start runs bin/start as the launcher does on instance 0
+	start := func() *gexec.Session {
+		cmd := exec.Command("python2", filepath.Join(bpDir, "bin", "start"))
+		cmd.Dir = home
+		cmd.Env = append(os.Environ(), "HOME="+home, "PYTHONPATH="+filepath.Join(bpDir, "lib"), "PYTHONDONTWRITEBYTECODE=1",
+			"CF_INSTANCE_INDEX=0")
+		session, err := gexec.Start(cmd, GinkgoWriter, GinkgoWriter)
+		Expect(err).NotTo(HaveOccurred())
+		Eventually(session, 20*time.Second).Should(gexec.Exit())
+		return session
+	}
+
+	BeforeEach(func() {
+		if _, err := exec.LookPath("python2"); err != nil {
+			Skip("python2 is not available")
+		}
+		var err error
+		bpDir, err = cutlass.FindRoot()
+		Expect(err).NotTo(HaveOccurred())
+		home, err = ioutil.TempDir("", "release")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(os.MkdirAll(filepath.Join(home, ".bp", "bin"), 0755)).To(Succeed())
+		Expect(os.Mkdir(filepath.Join(home, "logs"), 0755)).To(Succeed())
+		bin, err := gexec.Build("php/release/cli")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(os.Symlink(bin, filepath.Join(home, ".bp", "bin", "php-release"))).To(Succeed())
+		Expect(ioutil.WriteFile(filepath.Join(home, ".procs"), []byte("web: echo started\n"), 0644)).To(Succeed())
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(home)
+		gexec.CleanupBuildArtifacts()
+	})
+
+	It("run from bin/start before the processes", func() {
+		writeConfig(release.Config{ReleaseID: "r1", Commands: []string{"echo migrated >> migrations.log"},
+			Policy: release.FailClosed, MarkerDir: "$HOME/.bp/release", Wait: true})
+
+		session := start()
+		Expect(session.ExitCode()).To(Equal(0))
+		expectInOrder(string(session.Out.Contents()),
+			`php-release: running release command 1 of 1`,
+			`web\s+\| started`)
+
+		Expect(start().ExitCode()).To(Equal(0))
+		Expect(ioutil.ReadFile(filepath.Join(home, "migrations.log"))).To(Equal([]byte("migrated\n")))
+	})
+
+	It("keep the processes from starting when a command fails closed", func() {
+		writeConfig(release.Config{ReleaseID: "r1", Commands: []string{"exit 5"},
+			Policy: release.FailClosed, MarkerDir: "$HOME/.bp/release", Wait: true})
+
+		session := start()
+		Expect(session.ExitCode()).To(Equal(1))
+		Expect(session.Out.Contents()).To(ContainSubstring("release command 1 ended with exit code 5"))
+		Expect(session.Out.Contents()).NotTo(ContainSubstring("started"))
+	})
+
+	It("are left to the release process when the others don't wait", func() {
+		writeConfig(release.Config{ReleaseID: "r1", Commands: []string{"echo migrated >> migrations.log"},
+			Policy: release.FailClosed, MarkerDir: "$HOME/.bp/release"})
+
+		session := start()
+		Expect(session.ExitCode()).To(Equal(0))
+		Expect(session.Out.Contents()).NotTo(ContainSubstring("php-release"))
+		Expect(filepath.Join(home, "migrations.log")).NotTo(BeAnExistingFile())
+	})
+})
@@ -0,0 +1,99 @@
+package unit_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os/exec"
+	"time"
+
+	"php/fakesentry"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("sentry extension", func() {
+	var (
+		container string
+		server    *fakesentry.Server
+	)
+
+	AfterEach(func() {
+		if container != "" {
+			exec.Command("docker", "rm", "-f", container).Run()
+			container = ""
+		}
+		if server != nil {
+			server.Close()
+			server = nil
+		}
+	})
+
+	It("reports an uncaught exception of the fixture to the bound service", func() {
+		if !IsDockerAvailable() {
+			Skip("running the fixture needs docker")
+		}
+
+		// the container reaches the server through the docker host
+		listener, err := net.Listen("tcp", "0.0.0.0:0")
+		Expect(err).NotTo(HaveOccurred())
+		server = fakesentry.NewOn(listener, "42", "public")
+		port := listener.Addr().(*net.TCPAddr).Port
+
+		vcapApplication, err := json.Marshal(map[string]string{
+			"application_name":    "shop",
+			"application_version": "v1",
+		})
+		Expect(err).NotTo(HaveOccurred())
+		vcapServices, err := json.Marshal(map[string]interface{}{
+			"sentry": []interface{}{map[string]interface{}{
+				"name":        "errors",
+				"label":       "sentry",
+				"tags":        []string{},
+				"credentials": map[string]string{"dsn": fmt.Sprintf("http://public@sentry:%d/42", port)},
+			}},
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		container = startFixture("with_sentry", "httpd",
+			"--add-host", "sentry:host-gateway",
+			"-e", "VCAP_APPLICATION="+string(vcapApplication),
+			"-e", "VCAP_SERVICES="+string(vcapServices))
+		defer func() {
+			GinkgoWriter.Write([]byte(containerLogs(container)))
+		}()
+
+		url := "http://" + appAddress(container)
+
+		Eventually(func() int {
+			resp, err := http.Get(url + "/index.php")
+			if err != nil {
+				return 0
+			}
+			resp.Body.Close()
+			return resp.StatusCode
+		}, 10*time.Minute, 2*time.Second).Should(Equal(http.StatusOK))
+		Expect(server.Events()).To(BeEmpty())
+
+		resp, err := http.Get(url + "/index.php?fail=1")
+		Expect(err).NotTo(HaveOccurred())
+		resp.Body.Close()
+		Expect(resp.StatusCode).To(Equal(http.StatusInternalServerError))
+
+		Eventually(server.Events).Should(HaveLen(1))
+		event := server.Events()[0]
+		Expect(event.Level).To(Equal("error"))
+		Expect(event.Release).To(MatchRegexp(`^shop@v1\+php-buildpack\.\d+\.\d+\.\d+$`))
+		Expect(event.Exception.Values).To(HaveLen(1))
+		Expect(event.Exception.Values[0].Type).To(Equal("RuntimeException"))
+		Expect(event.Exception.Values[0].Value).To(Equal("checkout failed"))
+		Expect(event.Exception.Values[0].Stacktrace.Frames).NotTo(BeEmpty())
+		Expect(event.Request.Method).To(Equal("GET"))
+		Expect(event.Request.QueryString).To(Equal("fail=1"))
+
+		// LOG_FORMAT json is prepended before the bootstrap and still logs
+		Expect(containerLogs(container)).To(MatchRegexp(`"source":"php".*checkout failed`))
+	})
+})
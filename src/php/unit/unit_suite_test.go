@@ -2,7 +2,10 @@ package unit_test
 
 import (
 	"os/exec"
+	"path/filepath"
+	"strings"
 
+	"github.com/cloudfoundry/libbuildpack/cutlass"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 	"github.com/onsi/gomega/gexec"
@@ -22,3 +25,49 @@ func IsDockerAvailable() bool {
 	session.Wait()
 	return session.ExitCode() == 0
 }
+
+// launchScript stages the fixture for the web server in $WEB_SERVER, then
+// launches it like CF does
+const launchScript = `set -e
+cp -r /fixture /tmp/app
+sed -i "s/^{/{\n\t\"WEB_SERVER\": \"$WEB_SERVER\",/" /tmp/app/.bp-config/options.json
+/buildpack/bin/compile /tmp/app /tmp/cache
+
+mkdir -p /home/vcap
+mv /tmp/app /home/vcap/app
+cd /home/vcap/app
+export HOME=/home/vcap/app PORT=8080 MEMORY_LIMIT=256m
+for f in .profile.d/*.sh; do . "$f"; done
+exec .bp/bin/start
+`
+
+// startFixture stages and launches a fixture in a cflinuxfs2 container, with
+// port 8080 published on the loopback, and returns the container. dockerArgs
+// are passed on to docker run.
+func startFixture(fixture, webServer string, dockerArgs ...string) string {
+	bpDir, err := cutlass.FindRoot()
+	ExpectWithOffset(1, err).NotTo(HaveOccurred())
+	args := append([]string{"run", "-d",
+		"-e", "WEB_SERVER=" + webServer,
+		"-p", "127.0.0.1::8080",
+		"-v", bpDir + ":/buildpack:ro",
+		"-v", filepath.Join(bpDir, "fixtures", fixture) + ":/fixture:ro",
+	}, dockerArgs...)
+	args = append(args, "cloudfoundry/cflinuxfs2", "bash", "-c", launchScript)
+	out, err := exec.Command("docker", args...).Output()
+	ExpectWithOffset(1, err).NotTo(HaveOccurred())
+	return strings.TrimSpace(string(out))
+}
+
+// appAddress returns the host:port the app of a container listens on
+func appAddress(container string) string {
+	out, err := exec.Command("docker", "port", container, "8080").Output()
+	ExpectWithOffset(1, err).NotTo(HaveOccurred())
+	return strings.TrimSpace(string(out))
+}
+
+// containerLogs returns the output of a container so far
+func containerLogs(container string) string {
+	out, _ := exec.Command("docker", "logs", container).CombinedOutput()
+	return string(out)
+}
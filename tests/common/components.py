@@ -37,6 +37,7 @@ class BuildPackAssertHelper(object):
         fah = FileAssertHelper()
         (fah.expect()
             .path(build_dir, '.bp', 'bin', 'rewrite')
+            .path(build_dir, '.bp', 'bin', 'php-task')
             .root(build_dir, '.bp', 'lib', 'build_pack_utils')
                 .directory_count_equals(20)  # noqa
                 .path('utils.py')
@@ -1,8 +1,11 @@
 import os
 import os.path
+import json
 import tempfile
 import shutil
+import sys
 import mock
+from StringIO import StringIO
 from nose.tools import eq_
 from nose.tools import assert_raises_regexp
 from build_pack_utils import utils
@@ -15,6 +18,22 @@ from compile_helpers import find_all_php_versions
 from compile_helpers import validate_php_version
 from compile_helpers import validate_php_ini_extensions
 from compile_helpers import setup_log_dir
+from compile_helpers import detect_framework
+from compile_helpers import setup_framework_dirs
+from compile_helpers import fpm_pool_command
+from compile_helpers import php_memory_defaults
+from compile_helpers import setup_opcache_warmup
+from compile_helpers import write_opcache_ini
+from compile_helpers import warm_opcache
+from compile_helpers import render_server_conf
+from compile_helpers import report_config_drift
+from compile_helpers import setup_fpm_status
+from compile_helpers import setup_fpm_request_limits
+from compile_helpers import shutdown_grace_seconds
+from compile_helpers import setup_fpm_log_format
+from compile_helpers import write_log_format_ini
+from compile_helpers import add_auto_prepend_file
+from compile_helpers import additional_processes
 
 
 class TestCompileHelpers(object):
@@ -35,6 +54,52 @@ class TestCompileHelpers(object):
             if name.startswith('php-') and name.endswith('.gz'):
                 os.remove(os.path.join(os.environ['TMPDIR'], name))
 
+    def fake_detector(self, output):
+        bp_dir = tempfile.mkdtemp(prefix='bp-')
+        os.makedirs(os.path.join(bp_dir, 'bin'))
+        detector = os.path.join(bp_dir, 'bin', 'detect-framework')
+        with open(detector, 'wt') as f:
+            f.write("#!/bin/sh\necho '%s'\n" % output)
+        os.chmod(detector, 0755)
+        return bp_dir
+
+    def printed(self, f, *args):
+        """Calls f and returns what it printed"""
+        stdout = sys.stdout
+        sys.stdout = StringIO()
+        try:
+            f(*args)
+            return sys.stdout.getvalue()
+        finally:
+            sys.stdout = stdout
+
+    def fake_php(self):
+        """Installs a php which writes a cache entry for each listed file"""
+        php_dir = os.path.join(self.build_dir, 'php')
+        os.makedirs(os.path.join(php_dir, 'bin'))
+        os.makedirs(os.path.join(php_dir, 'etc'))
+        ext_dir = os.path.join(php_dir, 'lib', 'php', 'extensions',
+                               'no-debug-non-zts-20160303')
+        os.makedirs(ext_dir)
+        open(os.path.join(ext_dir, 'opcache.so'), 'w').close()
+        php = os.path.join(php_dir, 'bin', 'php')
+        with open(php, 'wt') as f:
+            f.write('#!/bin/sh\n'
+                    'for arg; do\n'
+                    '  case "$arg" in\n'
+                    '    opcache.file_cache=*) cache="${arg#*=}" ;;\n'
+                    '  esac\n'
+                    '  list="$arg"\n'
+                    'done\n'
+                    'n=0\n'
+                    'while read -r f; do\n'
+                    '  mkdir -p "$cache/sysid$(dirname "$f")"\n'
+                    '  touch "$cache/sysid$f.bin"\n'
+                    '  n=$((n + 1))\n'
+                    'done < "$list"\n'
+                    'echo "$n files compiled, 0 skipped"\n')
+        os.chmod(php, 0755)
+
     def assert_exists(self, *args):
         eq_(True, os.path.exists(os.path.join(*args)),
             "Does not exists: %s" % os.path.join(*args))
@@ -364,3 +429,564 @@ class TestCompileHelpers(object):
         ctx['PHP_VERSION'] = '5.6.30'
         validate_php_version(ctx)
         eq_('5.6.30', ctx['PHP_VERSION'])
+
+    def test_detect_framework_applies_presets(self):
+        os.makedirs(self.build_dir)
+        bp_dir = self.fake_detector(
+            '{"name": "Laravel", "webdir": "public", "libdir": "vendor", '
+            '"front_controller": "index.php", '
+            '"cache_dirs": ["bootstrap/cache", "storage/logs"], '
+            '"evidence": ["artisan", "public/index.php"]}')
+        ctx = utils.FormattedDict({
+            'BP_DIR': bp_dir,
+            'BUILD_DIR': self.build_dir,
+            'WEBDIR': 'htdocs',
+            'LIBDIR': 'lib'
+        })
+        try:
+            detect_framework(ctx)
+        finally:
+            shutil.rmtree(bp_dir)
+        eq_('public', ctx['WEBDIR'])
+        eq_('vendor', ctx['LIBDIR'])
+        eq_(os.path.join(self.build_dir, 'vendor'), ctx['COMPOSER_VENDOR_DIR'])
+        eq_('index.php', ctx['FRAMEWORK_FRONT_CONTROLLER'])
+        eq_(['bootstrap/cache', 'storage/logs'], ctx['FRAMEWORK_CACHE_DIRS'])
+
+        setup_framework_dirs(ctx)
+        self.assert_exists(self.build_dir, 'bootstrap', 'cache')
+        self.assert_exists(self.build_dir, 'storage', 'logs')
+
+    def test_detect_framework_keeps_options_json_settings(self):
+        os.makedirs(os.path.join(self.build_dir, '.bp-config'))
+        with open(os.path.join(self.build_dir, '.bp-config',
+                               'options.json'), 'wt') as f:
+            f.write('{"WEBDIR": "web", "COMPOSER_VENDOR_DIR": "vendor"}')
+        bp_dir = self.fake_detector(
+            '{"name": "Symfony 4", "webdir": "public", "libdir": "vendor", '
+            '"front_controller": "index.php", "cache_dirs": ["var/cache"], '
+            '"evidence": ["bin/console", "public/index.php"]}')
+        ctx = utils.FormattedDict({
+            'BP_DIR': bp_dir,
+            'BUILD_DIR': self.build_dir,
+            'WEBDIR': 'web',
+            'LIBDIR': 'lib',
+            'COMPOSER_VENDOR_DIR': 'vendor'
+        })
+        try:
+            detect_framework(ctx)
+        finally:
+            shutil.rmtree(bp_dir)
+        eq_('web', ctx['WEBDIR'])
+        eq_('vendor', ctx['LIBDIR'])
+        eq_('vendor', ctx['COMPOSER_VENDOR_DIR'])
+        eq_('index.php', ctx['FRAMEWORK_FRONT_CONTROLLER'])
+
+    def test_detect_framework_keeps_the_vendor_dir_of_an_own_libdir(self):
+        os.makedirs(os.path.join(self.build_dir, '.bp-config'))
+        with open(os.path.join(self.build_dir, '.bp-config',
+                               'options.json'), 'wt') as f:
+            f.write('{"WEBDIR": "app/webroot", "LIBDIR": "library"}')
+        bp_dir = self.fake_detector(
+            '{"name": "CakePHP", "webdir": "webroot", "libdir": "vendor", '
+            '"front_controller": "index.php", "cache_dirs": ["tmp"], '
+            '"evidence": ["bin/cake", "webroot/index.php"]}')
+        ctx = utils.FormattedDict({
+            'BP_DIR': bp_dir,
+            'BUILD_DIR': self.build_dir,
+            'WEBDIR': 'app/webroot',
+            'LIBDIR': 'library'
+        })
+        try:
+            detect_framework(ctx)
+        finally:
+            shutil.rmtree(bp_dir)
+        eq_('library', ctx['LIBDIR'])
+        assert 'COMPOSER_VENDOR_DIR' not in ctx
+
+    def test_detect_framework_at_app_root(self):
+        os.makedirs(self.build_dir)
+        bp_dir = self.fake_detector(
+            '{"name": "WordPress", "webdir": "", "libdir": "", '
+            '"front_controller": "index.php", '
+            '"cache_dirs": ["wp-content/uploads"], '
+            '"evidence": ["wp-settings.php", "index.php"]}')
+        ctx = utils.FormattedDict({
+            'BP_DIR': bp_dir,
+            'BUILD_DIR': self.build_dir,
+            'WEBDIR': 'htdocs',
+            'LIBDIR': 'lib'
+        })
+        try:
+            detect_framework(ctx)
+        finally:
+            shutil.rmtree(bp_dir)
+        eq_('htdocs', ctx['WEBDIR'])
+        eq_('lib', ctx['LIBDIR'])
+        assert 'COMPOSER_VENDOR_DIR' not in ctx
+        eq_(['htdocs/wp-content/uploads'], ctx['FRAMEWORK_CACHE_DIRS'])
+
+    def test_detect_framework_nothing_found(self):
+        os.makedirs(self.build_dir)
+        bp_dir = self.fake_detector('null')
+        ctx = utils.FormattedDict({
+            'BP_DIR': bp_dir,
+            'BUILD_DIR': self.build_dir,
+            'WEBDIR': 'htdocs'
+        })
+        try:
+            detect_framework(ctx)
+        finally:
+            shutil.rmtree(bp_dir)
+        eq_('htdocs', ctx['WEBDIR'])
+        eq_([], ctx['FRAMEWORK_CACHE_DIRS'])
+        assert 'FRAMEWORK_FRONT_CONTROLLER' not in ctx
+
+    def test_detect_framework_disabled(self):
+        ctx = utils.FormattedDict({
+            'BP_DIR': '/does/not/exist',
+            'BUILD_DIR': self.build_dir,
+            'WEBDIR': 'htdocs',
+            'FRAMEWORK_DETECTION': False
+        })
+        detect_framework(ctx)
+        eq_('htdocs', ctx['WEBDIR'])
+        eq_([], ctx['FRAMEWORK_CACHE_DIRS'])
+
+    def test_fpm_pool_command_without_tuner(self):
+        os.makedirs(self.build_dir)
+        eq_(('export', 'PHP_FPM_PM=dynamic', 'PHP_FPM_MAX_CHILDREN=5',
+             'PHP_FPM_START_SERVERS=2', 'PHP_FPM_MIN_SPARE_SERVERS=1',
+             'PHP_FPM_MAX_SPARE_SERVERS=3',
+             'PHP_FPM_PROCESS_IDLE_TIMEOUT=10s', 'PHP_MEMORY_LIMIT=128M',
+             'PHP_OPCACHE_MEMORY_CONSUMPTION=128',
+             'PHP_REALPATH_CACHE_SIZE=4096K'),
+            fpm_pool_command({'BP_DIR': self.build_dir,
+                              'BUILD_DIR': self.build_dir}))
+        eq_('PHP_FPM_PM=static', fpm_pool_command({
+            'BP_DIR': self.build_dir,
+            'BUILD_DIR': self.build_dir,
+            'PHP_FPM_PM': 'static'
+        })[1])
+
+    def test_php_memory_defaults_from_tuner(self):
+        os.makedirs(os.path.join(self.build_dir, 'bin'))
+        tuner = os.path.join(self.build_dir, 'bin', 'fpm-tune')
+        with open(tuner, 'w') as f:
+            f.write('#!/bin/sh\n'
+                    '[ "$1" = -defaults ] || exit 1\n'
+                    'echo PHP_MEMORY_LIMIT=128M\n'
+                    'echo PHP_OPCACHE_MEMORY_CONSUMPTION=96\n')
+        os.chmod(tuner, 0755)
+        eq_((('PHP_MEMORY_LIMIT', '128M'),
+             ('PHP_OPCACHE_MEMORY_CONSUMPTION', '96')),
+            php_memory_defaults({'BP_DIR': self.build_dir}))
+
+    def test_fpm_pool_command_with_tuner(self):
+        os.makedirs(os.path.join(self.build_dir, '.bp', 'bin'))
+        open(os.path.join(self.build_dir, '.bp', 'bin', 'fpm-tune'),
+             'w').close()
+        eq_(('eval', '"$($HOME/.bp/bin/fpm-tune)"'),
+            fpm_pool_command({'BUILD_DIR': self.build_dir}))
+        eq_(('eval', '"$($HOME/.bp/bin/fpm-tune -pm=ondemand '
+                     '-max-children=12 -reserved=256M)"'),
+            fpm_pool_command({
+                'BUILD_DIR': self.build_dir,
+                'PHP_FPM_PM': 'ondemand',
+                'PHP_FPM_MAX_CHILDREN': 12,
+                'PHP_FPM_RESERVED_MEMORY': '256M'
+            }))
+
+    def test_setup_opcache_warmup_loads_opcache(self):
+        ctx = {'OPCACHE_WARMUP': True, 'PHP_VERSION': '7.1.15',
+               'ZEND_EXTENSIONS': ['xdebug']}
+        setup_opcache_warmup(ctx)
+        eq_(['xdebug', 'opcache'], ctx['ZEND_EXTENSIONS'])
+        setup_opcache_warmup(ctx)
+        eq_(['xdebug', 'opcache'], ctx['ZEND_EXTENSIONS'])
+
+    def test_setup_opcache_warmup_needs_php_7(self):
+        ctx = {'OPCACHE_WARMUP': True, 'PHP_VERSION': '5.6.34',
+               'ZEND_EXTENSIONS': []}
+        setup_opcache_warmup(ctx)
+        eq_(False, ctx['OPCACHE_WARMUP'])
+        eq_([], ctx['ZEND_EXTENSIONS'])
+
+    def test_setup_opcache_warmup_warns_about_preload_without_it(self):
+        ctx = {'OPCACHE_PRELOAD': 'composer', 'PHP_VERSION': '7.4.0',
+               'ZEND_EXTENSIONS': []}
+        eq_('WARNING: OPCACHE_PRELOAD needs OPCACHE_WARMUP, nothing is '
+            'preloaded\n', self.printed(setup_opcache_warmup, ctx))
+        eq_([], ctx['ZEND_EXTENSIONS'])
+
+    def test_warm_opcache_compiles_through_the_runtime_path(self):
+        shutil.copytree('tests/data/app-1', self.build_dir)
+        self.fake_php()
+        os.makedirs(os.path.join(self.build_dir, '.git'))
+        open(os.path.join(self.build_dir, '.git', 'hook.php'), 'w').close()
+        runtime_dir = os.path.join(self.cache_dir, 'home', 'vcap', 'app')
+        ctx = {
+            'BUILD_DIR': self.build_dir,
+            'BP_DIR': os.getcwd(),
+            'TMPDIR': os.environ['TMPDIR'],
+            'PHP_VERSION': '7.1.15',
+            'OPCACHE_WARMUP': True,
+            'OPCACHE_RUNTIME_DIR': runtime_dir
+        }
+        write_opcache_ini(ctx)
+        warm_opcache(ctx)
+        cache = os.path.join(self.build_dir, '.opcache', 'sysid')
+        self.assert_exists(cache, runtime_dir.strip('/'), 'htdocs',
+                           'index.php.bin')
+        build_dir = os.path.realpath(self.build_dir).strip('/')
+        eq_(False, os.path.exists(os.path.join(cache, build_dir)))
+        eq_(False, os.path.exists(os.path.join(
+            cache, runtime_dir.strip('/'), '.git')))
+        eq_(False, os.path.lexists(runtime_dir))
+        eq_('; written during staging because OPCACHE_WARMUP is set\n'
+            'opcache.file_cache=@{HOME}/.opcache\n',
+            open(os.path.join(self.build_dir, 'php', 'etc', 'php.ini.d',
+                              'opcache-warmup.ini')).read())
+
+    def test_warm_opcache_skips_a_taken_runtime_path(self):
+        shutil.copytree('tests/data/app-1', self.build_dir)
+        self.fake_php()
+        runtime_dir = os.path.join(self.cache_dir, 'home', 'vcap', 'app')
+        os.makedirs(runtime_dir)
+        warm_opcache({
+            'BUILD_DIR': self.build_dir,
+            'BP_DIR': os.getcwd(),
+            'TMPDIR': os.environ['TMPDIR'],
+            'PHP_VERSION': '7.1.15',
+            'OPCACHE_WARMUP': True,
+            'OPCACHE_RUNTIME_DIR': runtime_dir
+        })
+        eq_(False, os.path.exists(os.path.join(self.build_dir, '.opcache')))
+        eq_(True, os.path.isdir(runtime_dir))
+
+    def test_warm_opcache_preloads_composer_classmap(self):
+        shutil.copytree('tests/data/app-1', self.build_dir)
+        self.fake_php()
+        composer_dir = os.path.join(self.build_dir, 'lib', 'vendor',
+                                    'composer')
+        os.makedirs(composer_dir)
+        open(os.path.join(composer_dir, 'autoload_classmap.php'),
+             'w').close()
+        ctx = utils.FormattedDict({
+            'BUILD_DIR': self.build_dir,
+            'BP_DIR': os.getcwd(),
+            'TMPDIR': os.environ['TMPDIR'],
+            'LIBDIR': 'lib',
+            'COMPOSER_VENDOR_DIR': '{BUILD_DIR}/{LIBDIR}/vendor',
+            'PHP_VERSION': '7.4.0',
+            'OPCACHE_WARMUP': True,
+            'OPCACHE_PRELOAD': 'composer',
+            'OPCACHE_RUNTIME_DIR': os.path.join(self.cache_dir, 'app')
+        })
+        write_opcache_ini(ctx)
+        warm_opcache(ctx)
+        preload = open(os.path.join(self.build_dir, 'php', 'etc',
+                                    'preload.php')).read()
+        assert "$app = dirname(__DIR__, 2);" in preload
+        assert ("require $app . '/lib/vendor/composer/autoload_classmap.php'"
+                in preload)
+        assert 'opcache.preload=@{HOME}/php/etc/preload.php' in open(
+            os.path.join(self.build_dir, 'php', 'etc', 'php.ini.d',
+                         'opcache-warmup.ini')).read()
+
+    def test_warm_opcache_preload_list_needs_php_74(self):
+        shutil.copytree('tests/data/app-1', self.build_dir)
+        self.fake_php()
+        ctx = {
+            'BUILD_DIR': self.build_dir,
+            'BP_DIR': os.getcwd(),
+            'TMPDIR': os.environ['TMPDIR'],
+            'PHP_VERSION': '7.2.3',
+            'OPCACHE_WARMUP': True,
+            'OPCACHE_PRELOAD': ['htdocs/*.php'],
+            'OPCACHE_RUNTIME_DIR': os.path.join(self.cache_dir, 'app')
+        }
+        write_opcache_ini(ctx)
+        printed = self.printed(warm_opcache, ctx)
+        assert ('WARNING: OPCACHE_PRELOAD needs PHP 7.4 or later, PHP 7.2.3 '
+                'does not support it' in printed), printed
+        eq_(False, os.path.exists(os.path.join(
+            self.build_dir, 'php', 'etc', 'preload.php')))
+
+        ctx['PHP_VERSION'] = '7.4.0'
+        warm_opcache(ctx)
+        preload = open(os.path.join(self.build_dir, 'php', 'etc',
+                                    'preload.php')).read()
+        assert "    'htdocs/index.php',\n" in preload
+
+    def test_render_server_conf_passes_options(self):
+        os.makedirs(self.build_dir)
+        bp_dir = tempfile.mkdtemp(prefix='bp-')
+        os.makedirs(os.path.join(bp_dir, 'bin'))
+        renderer = os.path.join(bp_dir, 'bin', 'server-conf')
+        with open(renderer, 'wt') as f:
+            f.write('#!/bin/sh\n'
+                    'echo "$@" > "%s/args"\n'
+                    'cat > "%s/options"\n' % (self.build_dir, self.build_dir))
+        os.chmod(renderer, 0755)
+        try:
+            render_server_conf({
+                'BP_DIR': bp_dir,
+                'FORCE_HTTPS': True,
+                'SECURITY_HEADERS': 'basic',
+                'WEBDIR': 'htdocs'
+            }, 'nginx', '/conf')
+        finally:
+            shutil.rmtree(bp_dir)
+        eq_('-server nginx -dir /conf\n',
+            open(os.path.join(self.build_dir, 'args')).read())
+        eq_({'FORCE_HTTPS': True, 'SECURITY_HEADERS': 'basic'},
+            json.load(open(os.path.join(self.build_dir, 'options'))))
+
+    def test_render_server_conf_rejects_invalid_options(self):
+        bp_dir = tempfile.mkdtemp(prefix='bp-')
+        os.makedirs(os.path.join(bp_dir, 'bin'))
+        renderer = os.path.join(bp_dir, 'bin', 'server-conf')
+        with open(renderer, 'wt') as f:
+            f.write('#!/bin/sh\necho "bad SECURITY_HEADERS" >&2\nexit 1\n')
+        os.chmod(renderer, 0755)
+        try:
+            assert_raises_regexp(RuntimeError, 'bad SECURITY_HEADERS',
+                                 render_server_conf,
+                                 {'BP_DIR': bp_dir}, 'nginx', '/conf')
+        finally:
+            shutil.rmtree(bp_dir)
+
+    def test_render_server_conf_keeps_defaults_without_renderer(self):
+        bp_dir = tempfile.mkdtemp(prefix='bp-')
+        try:
+            render_server_conf({'BP_DIR': bp_dir, 'NGINX_GZIP': False},
+                               'nginx', '/conf')
+        finally:
+            shutil.rmtree(bp_dir)
+
+    def test_render_server_conf_tells_httpd_where_fpm_listens(self):
+        os.makedirs(self.build_dir)
+        bp_dir = tempfile.mkdtemp(prefix='bp-')
+        os.makedirs(os.path.join(bp_dir, 'bin'))
+        renderer = os.path.join(bp_dir, 'bin', 'server-conf')
+        with open(renderer, 'wt') as f:
+            f.write('#!/bin/sh\necho "$@" > "%s/args"\n' % self.build_dir)
+        os.chmod(renderer, 0755)
+        try:
+            render_server_conf({
+                'BP_DIR': bp_dir,
+                'PHP_FPM_LISTEN': '127.0.0.1:9000'
+            }, 'httpd', '/conf')
+        finally:
+            shutil.rmtree(bp_dir)
+        eq_('-server httpd -dir /conf -fpm-listen 127.0.0.1:9000\n',
+            open(os.path.join(self.build_dir, 'args')).read())
+
+    def test_setup_fpm_status_off_by_default(self):
+        ctx = {'BUILD_DIR': self.build_dir}
+        setup_fpm_status(ctx)
+        eq_('', ctx['PHP_FPM_STATUS'])
+
+    def test_setup_fpm_status_sets_paths(self):
+        ctx = {
+            'BUILD_DIR': self.build_dir,
+            'FPM_STATUS': True,
+            'FPM_PING_PATH': '/healthz'
+        }
+        setup_fpm_status(ctx)
+        eq_('pm.status_path = /fpm-status\nping.path = /healthz',
+            ctx['PHP_FPM_STATUS'])
+
+    def test_setup_fpm_status_for_the_metrics_exporter(self):
+        ctx = {
+            'BUILD_DIR': self.build_dir,
+            'METRICS_EXPORTER': True
+        }
+        setup_fpm_status(ctx)
+        eq_('pm.status_path = /fpm-status\nping.path = /fpm-ping',
+            ctx['PHP_FPM_STATUS'])
+
+    def test_setup_fpm_request_limits_off_by_default(self):
+        ctx = {}
+        setup_fpm_request_limits(ctx)
+        eq_('', ctx['PHP_FPM_REQUEST_LIMITS'])
+
+    def test_setup_fpm_request_limits(self):
+        ctx = {
+            'PHP_FPM_SLOWLOG_TIMEOUT': '5s',
+            'PHP_FPM_MAX_REQUESTS': '1000'
+        }
+        setup_fpm_request_limits(ctx)
+        eq_('request_slowlog_timeout = 5s\n'
+            'slowlog = @{HOME}/php/var/log/slowlog.fifo\n'
+            'pm.max_requests = 1000', ctx['PHP_FPM_REQUEST_LIMITS'])
+
+    def test_setup_fpm_request_limits_rejects_invalid_values(self):
+        assert_raises_regexp(RuntimeError,
+                             'PHP_FPM_TERMINATE_TIMEOUT must be a time',
+                             setup_fpm_request_limits,
+                             {'PHP_FPM_TERMINATE_TIMEOUT': 'a minute'})
+        assert_raises_regexp(RuntimeError,
+                             'PHP_FPM_MAX_REQUESTS must be a number',
+                             setup_fpm_request_limits,
+                             {'PHP_FPM_MAX_REQUESTS': -1})
+
+    def test_shutdown_grace_seconds(self):
+        eq_(5, shutdown_grace_seconds({}))
+        eq_(20, shutdown_grace_seconds({'SHUTDOWN_GRACE_SECONDS': 20}))
+        eq_(0, shutdown_grace_seconds({'SHUTDOWN_GRACE_SECONDS': ' 0'}))
+        assert_raises_regexp(RuntimeError,
+                             'SHUTDOWN_GRACE_SECONDS must be a number',
+                             shutdown_grace_seconds,
+                             {'SHUTDOWN_GRACE_SECONDS': '5s'})
+
+    def fake_manifest_tool(self):
+        """Returns a BP_DIR whose extension-manifest lists two processes"""
+        bp_dir = os.path.join(self.cache_dir, 'bp')
+        os.makedirs(os.path.join(bp_dir, 'bin'))
+        lister = os.path.join(bp_dir, 'bin', 'extension-manifest')
+        with open(lister, 'wt') as f:
+            f.write('#!/bin/sh\n'
+                    '[ "$1" = -reserved-processes ] || exit 2\n'
+                    'echo php-fpm\n'
+                    'echo httpd\n')
+        os.chmod(lister, 0755)
+        return bp_dir
+
+    def test_additional_processes(self):
+        ctx = {'BP_DIR': self.fake_manifest_tool(), 'ADDITIONAL_PROCESSES': {
+            'queue': 'php artisan queue:work --tries=3',
+            'messenger': {
+                'command': 'php bin/console messenger:consume async',
+                'restart': 'on-failure',
+                'restart_delay': 5,
+                'max_restarts': 10
+            },
+            'websocket': {
+                'command': 'php bin/websocket-server',
+                'restart': 'never'
+            }
+        }}
+        eq_({
+            'queue [restart=always,delay=1,max_restarts=0]':
+                ('php artisan queue:work --tries=3',),
+            'messenger [restart=on-failure,delay=5,max_restarts=10]':
+                ('php bin/console messenger:consume async',),
+            'websocket': ('php bin/websocket-server',)
+        }, additional_processes(ctx))
+        eq_({}, additional_processes({}))
+
+    def test_additional_processes_without_the_manifest_tool(self):
+        eq_({'httpd [restart=always,delay=1,max_restarts=0]': ('httpd',)},
+            additional_processes({'BP_DIR': self.cache_dir,
+                                  'ADDITIONAL_PROCESSES': {'httpd': 'httpd'}}))
+
+    def test_additional_processes_rejects_invalid_values(self):
+        bp_dir = self.fake_manifest_tool()
+        for (processes, error) in (
+                (['php worker.php'], 'must map process names to commands'),
+                ({'Queue': 'php worker.php'}, 'names must be lower case'),
+                ({'php-fpm': 'php-fpm -F'}, 'can not replace \\[php-fpm\\]'),
+                ({'queue': 42}, 'must be a command or an object'),
+                ({'queue': {'cmd': 'php worker.php'}},
+                 'has unknown keys \\[cmd\\]'),
+                ({'queue': {'command': ' '}}, 'needs a command'),
+                ({'queue': {'command': 'php worker.php',
+                            'restart': 'unless-stopped'}},
+                 'restart must be one of never, on-failure, always'),
+                ({'queue': {'command': 'php worker.php',
+                            'restart_delay': '5s'}},
+                 'restart_delay must be a number of seconds'),
+                ({'queue': {'command': 'php worker.php',
+                            'max_restarts': -1}},
+                 'max_restarts must be a number of restarts')):
+            assert_raises_regexp(RuntimeError, error, additional_processes,
+                                 {'BP_DIR': bp_dir,
+                                  'ADDITIONAL_PROCESSES': processes})
+
+    def test_write_log_format_ini(self):
+        etc = os.path.join(self.build_dir, 'php', 'etc')
+        os.makedirs(etc)
+        open(os.path.join(etc, 'php.ini'), 'wt').write(
+            'auto_prepend_file =\nauto_append_file =\n')
+        ctx = {
+            'BP_DIR': os.getcwd(),
+            'BUILD_DIR': self.build_dir,
+            'LOG_FORMAT': 'json'
+        }
+        write_log_format_ini(ctx)
+        eq_('; written during staging for LOG_FORMAT json\n'
+            'auto_prepend_file = "@{HOME}/.bp/lib/auto-prepend.php"\n',
+            open(os.path.join(etc, 'php.ini.d', 'auto-prepend.ini')).read())
+        assert os.path.isfile(os.path.join(self.build_dir, '.bp', 'lib',
+                                           'log-format.php'))
+
+    def test_add_auto_prepend_file_chains_the_scripts(self):
+        etc = os.path.join(self.build_dir, 'php', 'etc')
+        os.makedirs(os.path.join(etc, 'php.ini.d'))
+        open(os.path.join(etc, 'php.ini.d', 'app.ini'), 'wt').write(
+            'auto_prepend_file = "@{HOME}/bootstrap.php"\n')
+        ctx = {'BP_DIR': os.getcwd(), 'BUILD_DIR': self.build_dir}
+        add_auto_prepend_file(ctx, 'lib/php/log-format.php', 'LOG_FORMAT json')
+        add_auto_prepend_file(ctx, 'extensions/sentry/sentry.php', 'sentry')
+        eq_("<?php\n// written during staging\n"
+            "require __DIR__ . '/log-format.php'; // LOG_FORMAT json\n"
+            "require __DIR__ . '/sentry.php'; // sentry\n",
+            open(os.path.join(self.build_dir, '.bp', 'lib',
+                              'auto-prepend.php')).read())
+        eq_('; written during staging for LOG_FORMAT json, sentry\n'
+            'auto_prepend_file = "@{HOME}/.bp/lib/auto-prepend.php"\n',
+            open(os.path.join(etc, 'php.ini.d', 'auto-prepend.ini')).read())
+        assert os.path.isfile(os.path.join(self.build_dir, '.bp', 'lib',
+                                           'sentry.php'))
+
+    def test_setup_fpm_log_format(self):
+        ctx = {'LOG_FORMAT': 'json'}
+        setup_fpm_log_format(ctx)
+        eq_('catch_workers_output = yes', ctx['PHP_FPM_LOG_FORMAT'])
+        ctx = {}
+        setup_fpm_log_format(ctx)
+        eq_('', ctx['PHP_FPM_LOG_FORMAT'])
+
+    def test_write_log_format_ini_keeps_text_logs(self):
+        ctx = {'BUILD_DIR': self.build_dir}
+        write_log_format_ini(ctx)
+        eq_(False, os.path.exists(self.build_dir))
+
+    def test_setup_fpm_status_needs_the_htpasswd_file(self):
+        os.makedirs(os.path.join(self.build_dir, '.bp-config'))
+        ctx = {
+            'BUILD_DIR': self.build_dir,
+            'FPM_STATUS': True,
+            'FPM_STATUS_HTPASSWD': '.bp-config/fpm-status.htpasswd'
+        }
+        assert_raises_regexp(RuntimeError, 'not a file of the application',
+                             setup_fpm_status, ctx)
+        open(os.path.join(self.build_dir, '.bp-config',
+                          'fpm-status.htpasswd'), 'wt').write('probe:x\n')
+        setup_fpm_status(ctx)
+        assert 'ping.path = /fpm-ping' in ctx['PHP_FPM_STATUS']
+
+    def test_report_config_drift_passes_staged_versions(self):
+        os.makedirs(self.build_dir)
+        bp_dir = tempfile.mkdtemp(prefix='bp-')
+        os.makedirs(os.path.join(bp_dir, 'bin'))
+        reporter = os.path.join(bp_dir, 'bin', 'config-drift')
+        with open(reporter, 'wt') as f:
+            f.write('#!/bin/sh\necho "$@" > "%s/args"\n' % self.build_dir)
+        os.chmod(reporter, 0755)
+        try:
+            report_config_drift({
+                'BP_DIR': bp_dir,
+                'BUILD_DIR': self.build_dir,
+                'WEB_SERVER': 'nginx',
+                'PHP_VERSION': '7.2.3'
+            })
+        finally:
+            shutil.rmtree(bp_dir)
+        eq_('-summary -defaults %s/defaults/config '
+            '-history %s/defaults/config-history.json '
+            '-web-server nginx -php-version 7.2.3 %s\n' % (
+                bp_dir, bp_dir, self.build_dir),
+            open(os.path.join(self.build_dir, 'args')).read())
@@ -2,6 +2,7 @@ import os
 import tempfile
 import shutil
 import re
+from StringIO import StringIO
 from nose.tools import eq_
 from dingus import Dingus
 from dingus import patch
@@ -18,6 +19,12 @@ class TestComposer(object):
         os.environ['COMPOSER_GITHUB_OAUTH_TOKEN'] = ""
         assert(os.getenv('COMPOSER_GITHUB_OAUTH_TOKEN') == "")
         self.buildpack_dir = os.path.join(os.path.dirname(os.path.abspath(__file__)), '..')
+        self.bp_dir = tempfile.mkdtemp(prefix='bp-')
+        os.makedirs(os.path.join(self.bp_dir, 'bin'))
+        open(os.path.join(self.bp_dir, 'bin', 'check-platform'), 'wt').close()
+
+    def tearDown(self):
+        shutil.rmtree(self.bp_dir)
 
     def test_composer_tool_should_compile(self):
         ctx = utils.FormattedDict({
@@ -808,6 +815,34 @@ class TestComposer(object):
         assert executed_command.find('https://api.github.com/rate_limit') > 0,\
             'No URL was passed to curl. Command was: %s' % executed_command
 
+    def test_github_api_url_is_configurable(self):
+        ctx = utils.FormattedDict({
+            'BP_DIR': '',
+            'BUILD_DIR': '/usr/awesome',
+            'PHP_VM': 'php',
+            'TMPDIR': tempfile.gettempdir(),
+            'LIBDIR': 'lib',
+            'CACHE_DIR': 'cache',
+            'WEBDIR': '',
+            'COMPOSER_GITHUB_API_URL': 'http://127.0.0.1:8080/'
+        })
+
+        instance_stub = Dingus()
+        instance_stub._set_return_value("""{"rate": {"limit": 60, "remaining": 60}}""")
+
+        stream_output_stub = Dingus(
+            'test_github_api_url_is_configurable : stream_output')
+
+        with patches({
+            'StringIO.StringIO.getvalue': instance_stub,
+            'composer.extension.stream_output': stream_output_stub,
+        }):
+            ct = self.extension_module.ComposerExtension(ctx)
+            ct._github_rate_exceeded(False)
+            executed_command = stream_output_stub.calls()[0].args[1]
+
+        eq_('curl http://127.0.0.1:8080/rate_limit', executed_command)
+
     def test_github_oauth_token_is_valid_interprets_github_api_200_as_true(self):  # noqa
         ctx = utils.FormattedDict({
             'BP_DIR': '',
@@ -887,6 +922,7 @@ class TestComposer(object):
             'test_github_oauth_token_uses_curl : stream_output')
         with patches({
             'os.path.exists': path_exists_stub,
+            'composer.extension.php_memory_defaults': lambda ctx: (),
             'composer.extension.ComposerExtension.setup_composer_github_token': setup_composer_github_token_stub,
             'composer.extension.ComposerExtension.check_github_rate_exceeded': check_github_rate_exceeded_stub,
             'composer.extension.utils.rewrite_cfgs': rewrite_stub,
@@ -956,3 +992,115 @@ class TestComposer(object):
 
         assert result is True, \
             '_github_oauth_token_is_valid returned %s, expected True' % result
+
+    def test_platform_check_skipped_without_lock_file(self):
+        ctx = utils.FormattedDict({
+            'BP_DIR': '/bp',
+            'BUILD_DIR': 'tests/data/composer-no-php',
+            'WEBDIR': '',
+            'PHP_VERSION': '7.1.15',
+            'ALL_PHP_VERSIONS': ['7.1.15']
+        })
+        popen_stub = Dingus()
+        with patches({'composer.extension.subprocess.Popen': popen_stub}):
+            self.extension_module.PlatformRequirements(ctx).check()
+        eq_(0, len(popen_stub.calls()))
+
+    def test_platform_check_skipped_for_unknown_php_version(self):
+        ctx = utils.FormattedDict({
+            'BP_DIR': '/bp',
+            'BUILD_DIR': 'tests/data/composer',
+            'WEBDIR': '',
+            'PHP_VERSION': '5.4.31',
+            'ALL_PHP_VERSIONS': ['7.1.15']
+        })
+        popen_stub = Dingus()
+        with patches({'composer.extension.subprocess.Popen': popen_stub}):
+            self.extension_module.PlatformRequirements(ctx).check()
+        eq_(0, len(popen_stub.calls()))
+
+    def test_platform_check_skipped_without_the_checker(self):
+        ctx = utils.FormattedDict({
+            'BP_DIR': '/bp',
+            'BUILD_DIR': 'tests/data/composer',
+            'WEBDIR': '',
+            'PHP_VERSION': '7.1.15',
+            'ALL_PHP_VERSIONS': ['7.1.15']
+        })
+        popen_stub = Dingus()
+        out = StringIO()
+        with patches({'composer.extension.subprocess.Popen': popen_stub,
+                      'sys.stdout': out}):
+            self.extension_module.PlatformRequirements(ctx).check()
+        eq_(0, len(popen_stub.calls()))
+        eq_('', out.getvalue())
+
+    def test_platform_check_set_without_the_checker_warns(self):
+        ctx = utils.FormattedDict({
+            'BP_DIR': '/bp',
+            'BUILD_DIR': 'tests/data/composer',
+            'WEBDIR': '',
+            'PHP_VERSION': '7.1.15',
+            'ALL_PHP_VERSIONS': ['7.1.15'],
+            'COMPOSER_PLATFORM_CHECK': True
+        })
+        out = StringIO()
+        with patches({'sys.stdout': out}):
+            self.extension_module.PlatformRequirements(ctx).check()
+        eq_('WARNING: ignoring COMPOSER_PLATFORM_CHECK, this buildpack was '
+            'built without check-platform\n', out.getvalue())
+
+    def test_platform_check_command(self):
+        ctx = utils.FormattedDict({
+            'BP_DIR': '/bp',
+            'BUILD_DIR': 'tests/data/composer',
+            'WEBDIR': '',
+            'PHP_VERSION': '7.1.15'
+        })
+        cmd = self.extension_module.PlatformRequirements(ctx)._command()
+        eq_('/bp/bin/check-platform', cmd[0])
+        eq_(['-lock', 'tests/data/composer/composer.lock'], cmd[1:3])
+        eq_(['-manifest', '/bp/manifest.yml'], cmd[3:5])
+        eq_(['-php', '7.1.15'], cmd[5:7])
+        assert '-dev' not in cmd
+
+        ctx['COMPOSER_INSTALL_OPTIONS'] = ['--optimize-autoloader']
+        cmd = self.extension_module.PlatformRequirements(ctx)._command()
+        eq_('-dev', cmd[-1])
+
+    def test_platform_check_enables_extensions(self):
+        ctx = utils.FormattedDict({
+            'BP_DIR': self.bp_dir,
+            'BUILD_DIR': 'tests/data/composer',
+            'WEBDIR': '',
+            'PHP_VERSION': '7.1.15',
+            'ALL_PHP_VERSIONS': ['7.1.15'],
+            'PHP_EXTENSIONS': ['openssl', 'zip']
+        })
+        process = Dingus(returncode=0)
+        process.communicate = Dingus(return_value=('zip\nintl\nopcache\n',
+                                                   ''))
+        with patches({'composer.extension.subprocess.Popen':
+                      Dingus(return_value=process)}):
+            self.extension_module.PlatformRequirements(ctx).check()
+        eq_(['openssl', 'zip', 'intl'], ctx['PHP_EXTENSIONS'])
+        eq_(['opcache'], ctx['ZEND_EXTENSIONS'])
+
+    def test_platform_check_exits_on_unmet_requirements(self):
+        ctx = utils.FormattedDict({
+            'BP_DIR': self.bp_dir,
+            'BUILD_DIR': 'tests/data/composer',
+            'WEBDIR': '',
+            'PHP_VERSION': '7.1.15',
+            'ALL_PHP_VERSIONS': ['7.1.15']
+        })
+        process = Dingus(returncode=1)
+        process.communicate = Dingus(return_value=(
+            '', 'symfony/intl requires ext-intl * (not available)\n'))
+        with patches({'composer.extension.subprocess.Popen':
+                      Dingus(return_value=process)}):
+            try:
+                self.extension_module.PlatformRequirements(ctx).check()
+                assert False, 'expected SystemExit'
+            except SystemExit, e:
+                eq_(1, e.code)
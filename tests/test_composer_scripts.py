@@ -0,0 +1,177 @@
+import os
+import os.path
+import sys
+import tempfile
+import shutil
+from build_pack_utils.runner import CalledProcessError
+from nose.tools import eq_
+from nose.tools import assert_raises
+from dingus import Dingus
+from build_pack_utils import utils
+
+
+class TestComposerScripts(object):
+    """Runs the composer extension against a stub `php` which records the
+    composer commands, so no network or PHP binary is needed."""
+
+    def __init__(self):
+        self.extension_module = utils.load_extension('extensions/composer')
+
+    def setUp(self):
+        os.environ['COMPOSER_GITHUB_OAUTH_TOKEN'] = ""
+        self.build_dir = tempfile.mkdtemp(prefix='build-')
+        self.cache_dir = tempfile.mkdtemp(prefix='cache-')
+        self.temp_dir = tempfile.mkdtemp(prefix='temp-')
+        os.rmdir(self.build_dir)
+        shutil.copytree('tests/data/composer-scripts', self.build_dir)
+        os.makedirs(os.path.join(self.build_dir, 'php', 'bin'))
+        shutil.copy('tests/data/composer-stub/php',
+                    os.path.join(self.build_dir, 'php', 'bin', 'php'))
+        open(os.path.join(self.temp_dir, 'php.ini'), 'w').close()
+        os.makedirs(os.path.join(self.cache_dir, 'composer'))
+
+    def tearDown(self):
+        for path in (self.build_dir, self.cache_dir, self.temp_dir):
+            if os.path.exists(path):
+                shutil.rmtree(path)
+
+    def _ctx(self, **options):
+        ctx = utils.FormattedDict({
+            'BP_DIR': '',
+            'BUILD_DIR': self.build_dir,
+            'CACHE_DIR': self.cache_dir,
+            'TMPDIR': self.temp_dir,
+            'PHP_VM': 'php',
+            'WEBDIR': 'htdocs',
+            'LIBDIR': 'lib'
+        })
+        ctx.update(options)
+        return ctx
+
+    def _run(self, ctx):
+        builder = Dingus(_ctx=ctx)
+        ct = self.extension_module.ComposerExtension(ctx)
+        ct._builder = builder
+        ct.check_github_rate_exceeded = Dingus()
+        ct.composer_runner = \
+            self.extension_module.ComposerCommandRunner(ctx, builder)
+        ct.run()
+
+    def _run_failing(self, ctx):
+        """Runs ctx expecting a failed script and returns what was printed.
+        The output goes to a file, which stream_output waits on for the exit
+        code of composer."""
+        stdout = sys.stdout
+        sys.stdout = tempfile.TemporaryFile()
+        try:
+            assert_raises(CalledProcessError, self._run, ctx)
+            sys.stdout.seek(0)
+            return sys.stdout.read()
+        finally:
+            sys.stdout.close()
+            sys.stdout = stdout
+
+    def _commands(self):
+        with open(os.path.join(self.cache_dir, 'composer',
+                               'commands.log'), 'rt') as log:
+            return [line.strip() for line in log]
+
+    def test_all_runs_each_install_event(self):
+        self._run(self._ctx())
+        eq_(['run-script --no-dev pre-install-cmd',
+             'install --no-progress --no-interaction --no-dev --no-scripts',
+             'run-script --no-dev pre-autoload-dump',
+             'dump-autoload --no-scripts --no-dev',
+             'run-script --no-dev post-autoload-dump',
+             'run-script --no-dev post-install-cmd'],
+            self._commands())
+
+    def test_pre_autoload_dump_dumps_the_autoloader_again(self):
+        self._run(self._ctx(COMPOSER_INSTALL_OPTIONS=['--optimize-autoloader'],
+                            COMPOSER_RUN_SCRIPTS=['pre-autoload-dump']))
+        eq_(['install --no-progress --optimize-autoloader --no-scripts',
+             'run-script pre-autoload-dump',
+             'dump-autoload --no-scripts --optimize-autoloader'],
+            self._commands())
+
+    def test_no_scripts(self):
+        self._run(self._ctx(COMPOSER_RUN_SCRIPTS='none'))
+        eq_(['install --no-progress --no-interaction --no-dev --no-scripts'],
+            self._commands())
+
+    def test_all_reports_the_failing_event(self):
+        with open(os.path.join(self.cache_dir, 'composer',
+                               'failing-scripts'), 'wt') as f:
+            f.write('post-autoload-dump\n')
+        printed = self._run_failing(self._ctx())
+        assert printed.find(
+            'Composer script [post-autoload-dump] failed') >= 0, printed
+        eq_('run-script --no-dev post-autoload-dump', self._commands()[-1])
+
+    def test_no_scripts_in_install_options(self):
+        self._run(self._ctx(COMPOSER_INSTALL_OPTIONS=['--no-scripts']))
+        eq_(['install --no-progress --no-scripts'],
+            self._commands())
+
+    def test_allowlist_runs_scripts_around_install(self):
+        self._run(self._ctx(COMPOSER_RUN_SCRIPTS=[
+            'cache-warmup', 'post-install-cmd', 'pre-install-cmd',
+            'undefined-script']))
+        eq_(['run-script --no-dev pre-install-cmd',
+             'install --no-progress --no-interaction --no-dev --no-scripts',
+             'run-script --no-dev post-install-cmd',
+             'run-script --no-dev cache-warmup'],
+            self._commands())
+
+    def test_allowlist_from_environment_string(self):
+        self._run(self._ctx(COMPOSER_RUN_SCRIPTS='post-autoload-dump, '
+                                                 'post-install-cmd'))
+        eq_(['install --no-progress --no-interaction --no-dev --no-scripts',
+             'run-script --no-dev post-autoload-dump',
+             'run-script --no-dev post-install-cmd'],
+            self._commands())
+
+    def test_allowlist_uses_update_events_without_lock_file(self):
+        os.remove(os.path.join(self.build_dir, 'composer.lock'))
+        self._run(self._ctx(COMPOSER_RUN_SCRIPTS=['pre-install-cmd',
+                                                  'cache-warmup']))
+        eq_(['install --no-progress --no-interaction --no-dev --no-scripts',
+             'run-script --no-dev cache-warmup'],
+            self._commands())
+
+    def test_failing_script_is_reported_by_name(self):
+        printed = self._run_failing(
+            self._ctx(COMPOSER_RUN_SCRIPTS=['broken']))
+        assert printed.find('Composer script [broken] failed') >= 0, printed
+        assert printed.find('handling the broken event') >= 0, printed
+
+    def test_dev_packages(self):
+        self._run(self._ctx(COMPOSER_NO_DEV=False,
+                            COMPOSER_RUN_SCRIPTS=['post-install-cmd']))
+        eq_(['install --no-progress --no-interaction --no-scripts',
+             'run-script post-install-cmd'],
+            self._commands())
+
+    def test_no_dev_from_environment_string(self):
+        self._run(self._ctx(COMPOSER_NO_DEV='false',
+                            COMPOSER_RUN_SCRIPTS='none'))
+        eq_(['install --no-progress --no-interaction --no-scripts'],
+            self._commands())
+
+    def test_no_dev_adds_flag_to_custom_options(self):
+        self._run(self._ctx(COMPOSER_NO_DEV=True,
+                            COMPOSER_INSTALL_OPTIONS=['--optimize-autoloader'],
+                            COMPOSER_RUN_SCRIPTS='none'))
+        eq_(['install --no-progress --optimize-autoloader --no-dev '
+             '--no-scripts'],
+            self._commands())
+
+    def test_script_timeout(self):
+        self._run(self._ctx(COMPOSER_SCRIPT_TIMEOUT=900,
+                            COMPOSER_RUN_SCRIPTS=['pre-install-cmd',
+                                                  'cache-warmup']))
+        eq_(['run-script --no-dev --timeout=900 pre-install-cmd',
+             'install --no-progress --no-interaction --no-dev --no-scripts',
+             'run-script --no-dev --timeout=900 cache-warmup'],
+            self._commands())
+
@@ -0,0 +1,105 @@
+import os
+import os.path
+import shutil
+import tempfile
+from nose.tools import eq_
+from nose.tools import raises
+from build_pack_utils import utils
+
+
+class TestCron(object):
+
+    def __init__(self):
+        self.extension_module = utils.load_extension('extensions/cron')
+
+    def setUp(self):
+        self.bp_dir = tempfile.mkdtemp(prefix='bp-')
+        self.build_dir = tempfile.mkdtemp(prefix='build-')
+        os.makedirs(os.path.join(self.build_dir, '.bp-config'))
+
+    def tearDown(self):
+        shutil.rmtree(self.bp_dir)
+        shutil.rmtree(self.build_dir)
+
+    def write(self, path, content, mode=0644):
+        if not os.path.exists(os.path.dirname(path)):
+            os.makedirs(os.path.dirname(path))
+        with open(path, 'wt') as f:
+            f.write(content)
+        os.chmod(path, mode)
+
+    def scheduler(self, script):
+        self.write(os.path.join(self.bp_dir, 'bin', 'php-cron'),
+                   '#!/bin/sh\n' + script, 0755)
+
+    def cron(self, **ctx):
+        ctx.update({'BP_DIR': self.bp_dir, 'BUILD_DIR': self.build_dir})
+        return self.extension_module.Cron(ctx)
+
+    def crontab(self):
+        with open(os.path.join(self.build_dir, '.bp', 'crontab')) as f:
+            return f.read()
+
+    def test_should_compile(self):
+        eq_(False, self.cron()._should_compile())
+        eq_(False, self.cron(CRON_JOBS=[])._should_compile())
+        eq_(True, self.cron(
+            CRON_JOBS=['* * * * * php tick.php'])._should_compile())
+        self.write(os.path.join(self.build_dir, '.bp-config', 'crontab'),
+                   '@daily php prune.php\n')
+        eq_(True, self.cron()._should_compile())
+
+    @raises(RuntimeError)
+    def test_configure_needs_a_list(self):
+        self.cron(CRON_JOBS='* * * * * php tick.php').configure()
+
+    def test_compile_merges_the_jobs(self):
+        self.scheduler('echo "job 1 (line 2) checked: $2"\n')
+        self.write(os.path.join(self.build_dir, '.bp-config', 'crontab'),
+                   '# nightly\n@daily php prune.php\n')
+        self.cron(CRON_JOBS=['*/5 * * * * php sync.php']).compile(None)
+        eq_('# written during staging, edit CRON_JOBS of '
+            '.bp-config/options.json or .bp-config/crontab\n'
+            '*/5 * * * * php sync.php\n'
+            '# nightly\n'
+            '@daily php prune.php\n', self.crontab())
+        assert os.path.exists(os.path.join(self.build_dir, '.bp', 'bin',
+                                           'php-cron'))
+
+    def test_compile_rejects_invalid_jobs(self):
+        self.scheduler('echo "line 2 (61 * * * * php x.php): minute: 61 is '
+                       'not between 0 and 59" >&2\nexit 1\n')
+        cron = self.cron(CRON_JOBS=['61 * * * * php x.php'])
+        try:
+            cron.compile(None)
+            assert False, 'invalid jobs were accepted'
+        except RuntimeError as e:
+            eq_('Invalid cron jobs\nline 2 (61 * * * * php x.php): minute: '
+                '61 is not between 0 and 59', str(e))
+        eq_(False, os.path.exists(os.path.join(self.build_dir, '.bp',
+                                                'crontab')))
+        eq_({}, cron.service_commands())
+
+    def test_compile_without_the_scheduler(self):
+        cron = self.cron(CRON_JOBS=['* * * * * php tick.php'])
+        cron.compile(None)
+        eq_(False, os.path.exists(os.path.join(self.build_dir, '.bp')))
+        eq_({}, cron.service_commands())
+
+    def test_service_commands(self):
+        self.scheduler('exit 0\n')
+        cron = self.cron(CRON_JOBS=['* * * * * php tick.php'])
+        cron.compile(None)
+        eq_({'cron [restart=always,delay=1,max_restarts=0]': (
+            '$HOME/.bp/bin/php-cron',
+            '"$HOME/.bp/crontab"')}, cron.service_commands())
+
+    def test_service_commands_on_all_instances(self):
+        self.scheduler('exit 0\n')
+        cron = self.cron(CRON_JOBS=['* * * * * php tick.php'],
+                         CRON_ALL_INSTANCES=True)
+        cron.compile(None)
+        eq_({'cron [restart=always,delay=1,max_restarts=0]': (
+            '$HOME/.bp/bin/php-cron',
+            '-all-instances',
+            '"$HOME/.bp/crontab"')}, cron.service_commands())
@@ -0,0 +1,163 @@
+import hashlib
+import os
+import os.path
+import json
+import shutil
+import subprocess
+import tempfile
+from nose.tools import eq_
+from nose.tools import raises
+from build_pack_utils import utils
+
+
+MANIFEST = """api_version: 1
+name: agent
+config_files:
+  - from: agent.ini
+    to: php/etc/php.ini.d/agent.ini
+    rewrite: true
+env:
+  AGENT_HOME: $HOME/agent
+  AGENT_BANNER: say "hi"
+processes:
+  agent-forwarder: $HOME/agent/forwarder
+profile_d:
+  - name: start.sh
+    script: mkdir -p $AGENT_HOME
+"""
+
+
+class TestDeclarativeExtensions(object):
+
+    def __init__(self):
+        self.extension_module = utils.load_extension(
+            'lib/declarative_extensions')
+
+    def setUp(self):
+        self.build_dir = tempfile.mkdtemp(prefix='build-')
+        self.ext_dir = os.path.join(self.build_dir, '.extensions', 'agent')
+        os.makedirs(self.ext_dir)
+        self.write(os.path.join(self.ext_dir, 'extension.yml'), MANIFEST)
+        self.write(os.path.join(self.ext_dir, 'agent.ini'),
+                   'agent.collector=#{AGENT_COLLECTOR}\n')
+
+    def tearDown(self):
+        shutil.rmtree(self.build_dir)
+
+    def write(self, path, content):
+        if not os.path.exists(os.path.dirname(path)):
+            os.makedirs(os.path.dirname(path))
+        with open(path, 'w') as f:
+            f.write(content)
+
+    def read(self, *path):
+        with open(os.path.join(self.build_dir, *path)) as f:
+            return f.read()
+
+    def ctx(self):
+        return utils.FormattedDict({
+            'BP_DIR': os.getcwd(),
+            'BUILD_DIR': self.build_dir,
+            'TMPDIR': self.build_dir,
+            'AGENT_COLLECTOR': 'collector.internal:4317'
+        })
+
+    def test_find_extensions_leaves_python_extensions(self):
+        python_ext = os.path.join(self.build_dir, '.extensions', 'legacy')
+        self.write(os.path.join(python_ext, 'extension.py'), '')
+        self.write(os.path.join(python_ext, 'extension.yml'), MANIFEST)
+        os.makedirs(os.path.join(self.build_dir, '.extensions', 'empty'))
+        eq_([self.ext_dir],
+            self.extension_module.find_extensions(self.build_dir))
+
+    def test_load_manifest_reads_json(self):
+        os.remove(os.path.join(self.ext_dir, 'extension.yml'))
+        self.write(os.path.join(self.ext_dir, 'extension.json'),
+                   json.dumps({'api_version': 1, 'name': 'agent'}))
+        eq_({'api_version': 1, 'name': 'agent'},
+            self.extension_module.load_manifest(self.ext_dir))
+
+    def test_install(self):
+        manifest = self.extension_module.load_manifest(self.ext_dir)
+        written = self.extension_module.install(
+            self.ctx(), self.ext_dir, manifest)
+        eq_(['php/etc/php.ini.d/agent.ini', '.profile.d/ext_agent.sh',
+             '.profile.d/ext_agent_start.sh'], written)
+        eq_('agent.collector=collector.internal:4317\n',
+            self.read('php', 'etc', 'php.ini.d', 'agent.ini'))
+        eq_('# written during staging from .extensions/agent/extension.yml\n'
+            'export AGENT_BANNER="say \\"hi\\""\n'
+            'export AGENT_HOME="$HOME/agent"\n',
+            self.read('.profile.d', 'ext_agent.sh'))
+        eq_('mkdir -p $AGENT_HOME', self.read('.profile.d',
+                                              'ext_agent_start.sh'))
+
+        output = subprocess.check_output(
+            ['bash', '-c', 'for f in .profile.d/*.sh; do . $f; done; env'],
+            cwd=self.build_dir, env={'HOME': self.build_dir})
+        assert 'AGENT_BANNER=say "hi"' in output.splitlines()
+        assert os.path.isdir(os.path.join(self.build_dir, 'agent'))
+
+    def test_install_verifies_downloads(self):
+        fetched = []
+
+        def fetch(ctx, url, sha256):
+            fetched.append((url, sha256))
+            path = os.path.join(self.build_dir, 'agent.phar')
+            self.write(path, '<?php')
+            return path
+        manifest = {'api_version': 1, 'name': 'agent', 'downloads': [{
+            'url': 'https://example.com/agent.phar',
+            'sha256': 'a' * 64,
+            'to': 'lib',
+            'extract': False}]}
+        eq_(['lib'], self.extension_module.install(
+            self.ctx(), self.ext_dir, manifest, fetch=fetch))
+        eq_([('https://example.com/agent.phar', 'a' * 64)], fetched)
+        eq_('<?php', self.read('lib', 'agent.phar'))
+
+    def test_download_verifies_the_sha256(self):
+        src = os.path.join(self.build_dir, 'src', 'agent.phar')
+        self.write(src, '<?php')
+        url = 'file://' + src
+        ctx = self.ctx()
+        ctx['TMPDIR'] = os.path.join(self.build_dir, 'tmp')
+        os.makedirs(ctx['TMPDIR'])
+        path = self.extension_module.download(
+            ctx, url, hashlib.sha256('<?php').hexdigest())
+        eq_(os.path.join(ctx['TMPDIR'], 'agent.phar'), path)
+        eq_('<?php', self.read('tmp', 'agent.phar'))
+        try:
+            self.extension_module.download(ctx, url, 'a' * 64)
+            assert False, 'download did not fail'
+        except RuntimeError as e:
+            assert str(e).startswith('SHA-256 of %s is ' % url)
+
+    @raises(RuntimeError)
+    def test_install_stays_inside_the_app(self):
+        manifest = {'api_version': 1, 'name': 'agent', 'config_files': [{
+            'from': 'agent.ini', 'to': '../agent.ini'}]}
+        self.extension_module.install(self.ctx(), self.ext_dir, manifest)
+
+    def test_service_commands(self):
+        eq_({'agent-forwarder': ('$HOME/agent/forwarder',)},
+            self.extension_module.service_commands(self.ctx()))
+
+    def test_validate_needs_the_validator(self):
+        ctx = self.ctx()
+        ctx['BP_DIR'] = self.build_dir
+        # warns and goes on when the buildpack was built without it
+        self.extension_module.validate(ctx, [self.ext_dir])
+
+    def test_validate_fails_staging(self):
+        ctx = self.ctx()
+        ctx['BP_DIR'] = self.build_dir
+        self.write(os.path.join(self.build_dir, 'bin', 'extension-manifest'),
+                   '#!/bin/sh\necho "  name: is required" >&2\nexit 1\n')
+        os.chmod(os.path.join(self.build_dir, 'bin', 'extension-manifest'),
+                 0755)
+        try:
+            self.extension_module.validate(ctx, [self.ext_dir])
+            assert False, 'validate did not fail'
+        except RuntimeError as e:
+            eq_('Invalid extension manifest\n  name: is required', str(e))
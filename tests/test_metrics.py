@@ -0,0 +1,64 @@
+import os
+import os.path
+import shutil
+import tempfile
+from nose.tools import eq_
+from build_pack_utils import utils
+
+
+class TestMetricsExporter(object):
+
+    def __init__(self):
+        self.extension_module = utils.load_extension('extensions/metrics')
+
+    def setUp(self):
+        self.bp_dir = tempfile.mkdtemp(prefix='bp-')
+        self.build_dir = tempfile.mkdtemp(prefix='build-')
+
+    def tearDown(self):
+        shutil.rmtree(self.bp_dir)
+        shutil.rmtree(self.build_dir)
+
+    def test_should_compile(self):
+        exporter = self.extension_module.MetricsExporter
+        eq_(False, exporter({'WEB_SERVER': 'httpd'})._should_compile())
+        eq_(True, exporter({'WEB_SERVER': 'httpd',
+                            'METRICS_EXPORTER': True})._should_compile())
+        eq_(False, exporter({'WEB_SERVER': 'none',
+                             'METRICS_EXPORTER': True})._should_compile())
+
+    def test_service_commands(self):
+        exporter = self.extension_module.MetricsExporter({
+            'WEB_SERVER': 'nginx',
+            'METRICS_EXPORTER': True,
+            'METRICS_PATH': '/internal/metrics'
+        })
+        eq_({'php-metrics': (
+            '$HOME/.bp/bin/php-metrics',
+            '-path "/internal/metrics"',
+            '-web-server nginx',
+            '-fpm-conf "$HOME/php/etc/php-fpm.conf"')},
+            exporter.service_commands())
+
+    def test_compile_copies_the_exporter(self):
+        os.makedirs(os.path.join(self.bp_dir, 'bin'))
+        open(os.path.join(self.bp_dir, 'bin', 'php-metrics'), 'wt').close()
+        exporter = self.extension_module.MetricsExporter({
+            'BP_DIR': self.bp_dir,
+            'BUILD_DIR': self.build_dir,
+            'WEB_SERVER': 'httpd',
+            'METRICS_EXPORTER': True
+        })
+        exporter.compile(None)
+        assert os.path.exists(os.path.join(self.build_dir, '.bp', 'bin',
+                                           'php-metrics'))
+
+    def test_compile_without_the_exporter(self):
+        exporter = self.extension_module.MetricsExporter({
+            'BP_DIR': self.bp_dir,
+            'BUILD_DIR': self.build_dir,
+            'WEB_SERVER': 'httpd',
+            'METRICS_EXPORTER': True
+        })
+        exporter.compile(None)
+        eq_(False, os.path.exists(os.path.join(self.build_dir, '.bp')))
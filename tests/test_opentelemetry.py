@@ -0,0 +1,132 @@
+import os
+import os.path
+import json
+import shutil
+import subprocess
+import tempfile
+from nose.tools import eq_
+from build_pack_utils import utils
+
+
+otel = utils.load_extension('extensions/opentelemetry')
+
+VCAP_APPLICATION = {
+    'application_id': 'app-guid',
+    'application_name': 'php-app',
+    'name': 'php-app',
+    'space_id': 'space-guid',
+    'space_name': 'dev',
+    'organization_id': 'org-guid',
+    'organization_name': 'acme, inc'
+}
+
+
+def collector(**credentials):
+    credentials.setdefault('endpoint', 'http://collector:4318')
+    return {'user-provided': [{
+        'name': 'otel-collector',
+        'label': 'user-provided',
+        'tags': [],
+        'credentials': credentials
+    }]}
+
+
+class TestOpenTelemetry(object):
+
+    def setUp(self):
+        self.build_dir = tempfile.mkdtemp(prefix='build-')
+
+    def tearDown(self):
+        shutil.rmtree(self.build_dir)
+
+    def installer(self, **ctx):
+        ctx.setdefault('BP_DIR', os.path.abspath('.'))
+        ctx.setdefault('BUILD_DIR', self.build_dir)
+        ctx.setdefault('PHP_VM', 'php')
+        ctx.setdefault('VCAP_APPLICATION', VCAP_APPLICATION)
+        return otel.OpenTelemetryInstaller(utils.FormattedDict(ctx))
+
+    def run_profile_script(self, installer, **env):
+        installer.write_profile_script()
+        script = os.path.join(self.build_dir, '.profile.d',
+                              '0_opentelemetry_env.sh')
+        env.setdefault('PATH', os.environ['PATH'])
+        output = subprocess.check_output(
+            ['bash', '-c', '. "$0" && env', script], env=env)
+        return dict(line.split('=', 1) for line in output.splitlines()
+                    if line.startswith('OTEL_'))
+
+    def test_should_not_install(self):
+        eq_(False, self.installer().should_install())
+        eq_(False, self.installer(
+            VCAP_SERVICES=collector(endpoint='')).should_install())
+
+    def test_service(self):
+        installer = self.installer(VCAP_SERVICES=collector(
+            protocol='http/json', headers={'x-api-key': 'se cret'}))
+        eq_(True, installer.should_install())
+        eq_('http://collector:4318', installer.endpoint)
+        eq_('php-app', installer.service_name)
+        eq_({
+            'OTEL_SERVICE_NAME': 'php-app',
+            'OTEL_EXPORTER_OTLP_ENDPOINT': 'http://collector:4318',
+            'OTEL_EXPORTER_OTLP_PROTOCOL': 'http/json',
+            'OTEL_EXPORTER_OTLP_HEADERS': 'x-api-key=se%20cret',
+            'OTEL_RESOURCE_ATTRIBUTES': ','.join([
+                'cloudfoundry.app.id=app-guid',
+                'cloudfoundry.app.name=php-app',
+                'cloudfoundry.space.id=space-guid',
+                'cloudfoundry.space.name=dev',
+                'cloudfoundry.org.id=org-guid',
+                'cloudfoundry.org.name=acme%2C inc',
+                'service.instance.id=instance-guid',
+                'cloudfoundry.app.instance.id=2'])
+        }, self.run_profile_script(
+            installer,
+            VCAP_SERVICES=json.dumps(collector(
+                headers={'x-api-key': 'se cret'})),
+            CF_INSTANCE_GUID='instance-guid',
+            CF_INSTANCE_INDEX='2'))
+
+    def test_service_name_from_the_service(self):
+        installer = self.installer(
+            VCAP_SERVICES=collector(service_name='checkout'))
+        eq_('checkout', installer.service_name)
+
+    def test_env_wins_over_the_service(self):
+        installer = self.installer(
+            VCAP_SERVICES=collector(service_name='checkout'),
+            OTEL_EXPORTER_OTLP_ENDPOINT='https://otlp.example.com',
+            OTEL_SERVICE_NAME='shop')
+        eq_(True, installer.should_install())
+        eq_('https://otlp.example.com', installer.endpoint)
+        eq_('shop', installer.service_name)
+
+    def test_env_only(self):
+        installer = self.installer(
+            OTEL_EXPORTER_OTLP_ENDPOINT='https://otlp.example.com')
+        eq_(True, installer.should_install())
+        env = self.run_profile_script(
+            installer,
+            OTEL_SERVICE_NAME='set-env',
+            OTEL_EXPORTER_OTLP_HEADERS='a=b',
+            OTEL_RESOURCE_ATTRIBUTES='deployment.environment=prod')
+        eq_('set-env', env['OTEL_SERVICE_NAME'])
+        eq_('https://otlp.example.com', env['OTEL_EXPORTER_OTLP_ENDPOINT'])
+        eq_('a=b', env['OTEL_EXPORTER_OTLP_HEADERS'])
+        assert env['OTEL_RESOURCE_ATTRIBUTES'].endswith(
+            ',service.instance.id=,cloudfoundry.app.instance.id='
+            ',deployment.environment=prod'), env['OTEL_RESOURCE_ATTRIBUTES']
+        assert 'OTEL_EXPORTER_OTLP_PROTOCOL' not in env
+
+    def test_values_are_not_expanded(self):
+        installer = self.installer(
+            OTEL_EXPORTER_OTLP_ENDPOINT=utils.wrap(
+                'http://collector:4318/$HOME`id`}'),
+            VCAP_APPLICATION={'application_name': 'a"b$c'})
+        env = self.run_profile_script(installer)
+        eq_('http://collector:4318/$HOME`id`}',
+            env['OTEL_EXPORTER_OTLP_ENDPOINT'])
+        eq_('a"b$c', env['OTEL_SERVICE_NAME'])
+        assert env['OTEL_RESOURCE_ATTRIBUTES'].startswith(
+            'cloudfoundry.app.name=a"b$c,'), env['OTEL_RESOURCE_ATTRIBUTES']
@@ -1,4 +1,10 @@
 import os
+import shutil
+import tempfile
+from nose.tools import eq_
+from build_pack_utils import utils
+from compile_helpers import setup_fpm_request_limits
+from compile_helpers import setup_fpm_log_format
 
 
 class TestPHPConfigFiles(object):
@@ -9,3 +15,34 @@ class TestPHPConfigFiles(object):
             with open(ini_file) as f:
                 s = f.read()
                 assert 'expose_php = Off' in s
+
+    def test_renders_fpm_settings_into_the_pool(self):
+        ctx = {
+            'PHP_FPM_SLOWLOG_TIMEOUT': '5s',
+            'PHP_FPM_TERMINATE_TIMEOUT': '2m',
+            'PHP_FPM_MAX_REQUESTS': 500,
+            'LOG_FORMAT': 'json'
+        }
+        setup_fpm_request_limits(ctx)
+        setup_fpm_log_format(ctx)
+        php_config_dir = 'defaults/config/php'
+        for version_dir in os.listdir(php_config_dir):
+            tmp = tempfile.mkdtemp()
+            try:
+                conf = os.path.join(tmp, 'php-fpm.conf')
+                shutil.copy(os.path.join(php_config_dir, version_dir,
+                                         'php-fpm.conf'), conf)
+                utils.rewrite_cfgs(conf, ctx)
+                with open(conf) as f:
+                    s = f.read()
+            finally:
+                shutil.rmtree(tmp)
+            assert '#{PHP_FPM_REQUEST_LIMITS}' not in s, version_dir
+            assert '#{PHP_FPM_LOG_FORMAT}' not in s, version_dir
+            pool = s[s.index('\n[www]'):]
+            for line in ('request_slowlog_timeout = 5s',
+                         'slowlog = @{HOME}/php/var/log/slowlog.fifo',
+                         'request_terminate_timeout = 2m',
+                         'pm.max_requests = 500',
+                         'catch_workers_output = yes'):
+                assert '\n%s\n' % line in pool, (version_dir, line)
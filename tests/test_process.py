@@ -0,0 +1,145 @@
+import os
+import os.path
+import sys
+import shutil
+import tempfile
+import time
+from StringIO import StringIO
+from nose.tools import eq_
+from build_pack_utils import utils
+from build_pack_utils.process import ProcessManager
+
+
+class TestProcessList(object):
+    def setUp(self):
+        self.tmp_dir = tempfile.mkdtemp(prefix='procs-')
+        self.procs = os.path.join(self.tmp_dir, '.procs')
+
+    def tearDown(self):
+        shutil.rmtree(self.tmp_dir)
+
+    def test_process_key(self):
+        eq_('php-fpm', utils.process_key('php-fpm'))
+        eq_('queue [restart=always,delay=1,max_restarts=0]',
+            utils.process_key('queue', 'always', 1, 0))
+        eq_('queue [restart=on-failure]',
+            utils.process_key('queue', 'on-failure'))
+
+    def test_load_process_specs(self):
+        with open(self.procs, 'wt') as f:
+            f.write('php-fpm: $HOME/php/sbin/php-fpm -p "$HOME/php/etc"\n')
+            f.write('queue [restart=on-failure,delay=2.5,max_restarts=3]: '
+                    'php artisan queue:work\n')
+        eq_([('php-fpm', '$HOME/php/sbin/php-fpm -p "$HOME/php/etc"',
+              {'restart': 'never', 'restart_delay': 1.0, 'max_restarts': 0}),
+             ('queue', 'php artisan queue:work',
+              {'restart': 'on-failure', 'restart_delay': 2.5,
+               'max_restarts': 3})],
+            utils.load_process_specs(self.procs))
+        eq_({'php-fpm': '$HOME/php/sbin/php-fpm -p "$HOME/php/etc"',
+             'queue': 'php artisan queue:work'},
+            utils.load_processes(self.procs))
+
+
+class TestProcessManager(object):
+    def setUp(self):
+        self.stdout = sys.stdout
+        sys.stdout = StringIO()
+
+    def tearDown(self):
+        sys.stdout = self.stdout
+
+    def output(self):
+        return sys.stdout.getvalue()
+
+    def test_stops_everything_when_a_process_exits(self):
+        pm = ProcessManager()
+        pm.add_process('web', 'sleep 30')
+        pm.add_process('app', 'exit 3')
+        start = time.time()
+        eq_(3, pm.loop())
+        assert time.time() - start < 10
+
+    def test_restarts_on_failure(self):
+        pm = ProcessManager()
+        pm.add_process('worker', 'echo run; exit 2', restart='on-failure',
+                       restart_delay=0, max_restarts=2)
+        eq_(2, pm.loop())
+        output = self.output()
+        eq_(3, output.count('| run'))
+        assert 'exited with status 2, restarting it in 0s (restart 1)' \
+            in output
+        assert 'exited with status 2, restarting it in 0s (restart 2)' \
+            in output
+        assert 'exited with status 2, giving up after 2 restarts' in output
+
+    def test_on_failure_leaves_a_clean_exit(self):
+        pm = ProcessManager()
+        pm.add_process('web', 'sleep 1; exit 7')
+        pm.add_process('migrate', 'exit 0', restart='on-failure',
+                       restart_delay=0)
+        eq_(7, pm.loop())
+        assert 'exited with status 0, not restarting it' in self.output()
+
+    def test_always_restarts(self):
+        pm = ProcessManager()
+        pm.add_process('web', 'sleep 2; exit 5')
+        pm.add_process('ticker', 'echo tick', restart='always',
+                       restart_delay=0.2)
+        eq_(5, pm.loop())
+        assert self.output().count('| tick') >= 3
+        assert 'restart 1)' in self.output()
+
+    def test_drains_in_stages_before_stopping_the_others(self):
+        pm = ProcessManager(grace=10, drain=({'web': 'SIGUSR1'},
+                                             {'fpm': 'SIGUSR2'}))
+        pm.add_process('web', "trap 'sleep 1; echo served; exit 0' USR1; "
+                       "while :; do sleep 0.1; done")
+        pm.add_process('fpm', "trap 'echo drained; exit 0' USR2; "
+                       "while :; do sleep 0.1; done")
+        pm.add_process('worker', 'sleep 30')
+        pm.add_process('deploy', 'sleep 0.5; exit 0')
+        start = time.time()
+        eq_(0, pm.loop())
+        assert time.time() - start < 5
+        output = self.output()
+        order = ['web    | stopping gracefully with SIGUSR1, waiting up to '
+                 '10s for it',
+                 'web    | stopped after 1.',
+                 'fpm    | stopping gracefully with SIGUSR2, waiting up to ',
+                 'fpm    | stopped after 1.']
+        positions = [output.find(line) for line in order]
+        assert -1 not in positions, output
+        eq_(sorted(positions), positions)
+        assert 'web    | served' in output
+        assert 'fpm    | drained' in output
+        assert 'worker | stopping' not in output
+
+    def test_stops_what_does_not_drain_in_time(self):
+        pm = ProcessManager(grace=1, drain=({'web': 'SIGUSR1'},))
+        pm.add_process('web', "trap '' USR1; while :; do sleep 0.1; done")
+        pm.add_process('deploy', 'sleep 0.5; exit 3')
+        start = time.time()
+        eq_(3, pm.loop())
+        assert time.time() - start < 5
+        assert 'web    | still running after the 1s grace period, ' \
+            'stopping it' in self.output()
+
+    def test_sigterm_drains(self):
+        pm = ProcessManager(grace=5, drain=({'web': 'SIGUSR1'},))
+        pm.add_process('web', "trap 'echo served; exit 0' USR1; "
+                       "while :; do sleep 0.1; done")
+        pm.add_process('cf', 'sleep 0.5; kill -TERM $PPID; sleep 30')
+        eq_(143, pm.loop())
+        assert 'web | stopping gracefully with SIGUSR1' in self.output()
+        assert 'web | served' in self.output()
+
+    def test_stops_what_the_processes_started(self):
+        pm = ProcessManager()
+        pm.add_process('web', 'sleep 30 & sleep 30 & wait')
+        pm.add_process('app', 'sleep 0.5; exit 2')
+        start = time.time()
+        eq_(2, pm.loop())
+        assert time.time() - start < 5
+        # the sleeps went with the group of web
+        eq_(False, pm.processes[0].group_alive())
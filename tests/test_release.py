@@ -0,0 +1,101 @@
+import json
+import os
+import os.path
+import shutil
+import tempfile
+from nose.tools import eq_
+from nose.tools import raises
+from build_pack_utils import utils
+
+
+class TestRelease(object):
+
+    def __init__(self):
+        self.extension_module = utils.load_extension('extensions/release')
+
+    def setUp(self):
+        self.bp_dir = tempfile.mkdtemp(prefix='bp-')
+        self.build_dir = tempfile.mkdtemp(prefix='build-')
+        os.makedirs(os.path.join(self.bp_dir, 'bin'))
+        open(os.path.join(self.bp_dir, 'bin', 'php-release'), 'wt').close()
+
+    def tearDown(self):
+        shutil.rmtree(self.bp_dir)
+        shutil.rmtree(self.build_dir)
+
+    def release(self, **ctx):
+        ctx.update({'BP_DIR': self.bp_dir, 'BUILD_DIR': self.build_dir})
+        return self.extension_module.Release(ctx)
+
+    def config(self):
+        with open(os.path.join(self.build_dir, '.bp', 'release.json')) as f:
+            return json.load(f)
+
+    def test_should_compile(self):
+        eq_(False, self.release()._should_compile())
+        eq_(False, self.release(RELEASE_COMMANDS=[])._should_compile())
+        eq_(True, self.release(
+            RELEASE_COMMANDS=['php migrate.php'])._should_compile())
+
+    @raises(RuntimeError)
+    def test_configure_needs_a_list(self):
+        self.release(RELEASE_COMMANDS='php migrate.php').configure()
+
+    @raises(RuntimeError)
+    def test_configure_rejects_empty_commands(self):
+        self.release(RELEASE_COMMANDS=['php migrate.php', ' ']).configure()
+
+    @raises(RuntimeError)
+    def test_configure_rejects_unknown_policies(self):
+        self.release(RELEASE_COMMANDS=['php migrate.php'],
+                     RELEASE_FAILURE_POLICY='retry').configure()
+
+    @raises(RuntimeError)
+    def test_configure_needs_a_boolean_wait(self):
+        self.release(RELEASE_COMMANDS=['php migrate.php'],
+                     RELEASE_WAIT='no').configure()
+
+    def test_compile_writes_the_config(self):
+        self.release(RELEASE_COMMANDS=[' php migrate.php ', 'php warm.php'],
+                     RELEASE_FAILURE_POLICY='fail-open').compile(None)
+        config = self.config()
+        assert config['release_id']
+        del config['release_id']
+        eq_({'commands': ['php migrate.php', 'php warm.php'],
+             'policy': 'fail-open',
+             'marker_dir': '$HOME/.bp/release',
+             'wait': True}, config)
+        assert os.path.exists(os.path.join(self.build_dir, '.bp', 'bin',
+                                           'php-release'))
+
+    def test_each_droplet_is_a_new_release(self):
+        release = self.release(RELEASE_COMMANDS=['php migrate.php'])
+        release.compile(None)
+        first = self.config()['release_id']
+        release.compile(None)
+        assert first != self.config()['release_id']
+
+    def test_waiting_leaves_the_commands_to_bin_start(self):
+        release = self.release(RELEASE_COMMANDS=['php migrate.php'])
+        release.compile(None)
+        eq_(True, self.config()['wait'])
+        eq_((), release.preprocess_commands())
+        eq_({}, release.service_commands())
+
+    def test_not_waiting_runs_next_to_the_processes(self):
+        release = self.release(RELEASE_COMMANDS=['php migrate.php'],
+                               RELEASE_WAIT=False)
+        release.compile(None)
+        eq_(False, self.config()['wait'])
+        eq_((), release.preprocess_commands())
+        eq_({'release [restart=on-failure,delay=1,max_restarts=1]': (
+            '$HOME/.bp/bin/php-release', '"$HOME/.bp/release.json"')},
+            release.service_commands())
+
+    def test_compile_without_the_runner(self):
+        os.remove(os.path.join(self.bp_dir, 'bin', 'php-release'))
+        release = self.release(RELEASE_COMMANDS=['php migrate.php'])
+        release.compile(None)
+        eq_(False, os.path.exists(os.path.join(self.build_dir, '.bp')))
+        eq_((), release.preprocess_commands())
+        eq_({}, release.service_commands())
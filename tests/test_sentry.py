@@ -0,0 +1,108 @@
+import os
+import os.path
+import json
+import shutil
+import subprocess
+import tempfile
+from nose.tools import eq_
+from build_pack_utils import utils
+
+
+def sentry_service(name='sentry', dsn='https://public@sentry.example.com/42'):
+    return {'sentry': [{
+        'name': name,
+        'label': 'sentry',
+        'tags': [],
+        'credentials': {'dsn': dsn}
+    }]}
+
+
+class TestSentry(object):
+
+    def __init__(self):
+        self.extension_module = utils.load_extension('extensions/sentry')
+
+    def setUp(self):
+        self.build_dir = tempfile.mkdtemp(prefix='build-')
+
+    def tearDown(self):
+        shutil.rmtree(self.build_dir)
+
+    def extension(self, **ctx):
+        ctx.setdefault('BP_DIR', os.getcwd())
+        ctx.setdefault('BUILD_DIR', self.build_dir)
+        ctx.setdefault('VCAP_APPLICATION', {
+            'application_name': 'shop',
+            'application_version': 'c5b9fd17-4b7d-4d8a-a3e1-2cf0f3a4b2c1'
+        })
+        return self.extension_module.SentryExtension(ctx)
+
+    def run_profile_script(self, **env):
+        script = os.path.join(self.build_dir, '.profile.d', '0_sentry_env.sh')
+        env.setdefault('PATH', os.environ['PATH'])
+        output = subprocess.check_output(
+            ['bash', '-c', '. "$0" && env', script], env=env)
+        return dict(line.split('=', 1) for line in output.splitlines()
+                    if line.startswith('SENTRY_'))
+
+    def test_should_compile(self):
+        eq_(False, self.extension()._should_compile())
+        eq_(True, self.extension(
+            VCAP_SERVICES=sentry_service())._should_compile())
+        eq_(False, self.extension()._should_compile())
+        eq_(True, self.extension(
+            SENTRY_DSN='https://public@sentry.example.com/1')
+            ._should_compile())
+
+    def test_release(self):
+        version = open('VERSION').read().strip()
+        eq_('shop@c5b9fd17-4b7d-4d8a-a3e1-2cf0f3a4b2c1+php-buildpack.' +
+            version, self.extension().release())
+        eq_('app+php-buildpack.' + version,
+            self.extension(VCAP_APPLICATION={}).release())
+
+    def test_compile_with_a_service(self):
+        services = sentry_service(name="team's sentry")
+        extension = self.extension(VCAP_SERVICES=services)
+        eq_(True, extension._should_compile())
+        extension._compile(None)
+
+        lib = os.path.join(self.build_dir, '.bp', 'lib')
+        assert os.path.isfile(os.path.join(lib, 'sentry.php'))
+        eq_("<?php\n// written during staging\n"
+            "require __DIR__ . '/sentry.php'; // sentry\n",
+            open(os.path.join(lib, 'auto-prepend.php')).read())
+        assert os.path.isfile(os.path.join(
+            self.build_dir, 'php', 'etc', 'php.ini.d', 'auto-prepend.ini'))
+
+        script = open(os.path.join(self.build_dir, '.profile.d',
+                                   '0_sentry_env.sh')).read()
+        assert 'public@' not in script, script
+        env = self.run_profile_script(VCAP_SERVICES=json.dumps(services))
+        eq_('https://public@sentry.example.com/42', env['SENTRY_DSN'])
+        eq_(extension.release(), env['SENTRY_RELEASE'])
+
+        env = self.run_profile_script(VCAP_SERVICES=json.dumps(services),
+                                      SENTRY_DSN='https://other@host/1',
+                                      SENTRY_RELEASE='v2')
+        eq_({'SENTRY_DSN': 'https://other@host/1', 'SENTRY_RELEASE': 'v2'},
+            env)
+
+    def test_compile_with_sentry_dsn(self):
+        extension = self.extension(SENTRY_DSN='https://public@host/7')
+        eq_(True, extension._should_compile())
+        extension._compile(None)
+        eq_('https://public@host/7', self.run_profile_script()['SENTRY_DSN'])
+
+    def test_compile_after_log_format(self):
+        ctx = {'LOG_FORMAT': 'json'}
+        extension = self.extension(VCAP_SERVICES=sentry_service(), **ctx)
+        from compile_helpers import write_log_format_ini
+        write_log_format_ini(extension._ctx)
+        extension._should_compile()
+        extension._compile(None)
+        eq_("<?php\n// written during staging\n"
+            "require __DIR__ . '/log-format.php'; // LOG_FORMAT json\n"
+            "require __DIR__ . '/sentry.php'; // sentry\n",
+            open(os.path.join(self.build_dir, '.bp', 'lib',
+                              'auto-prepend.php')).read())
@@ -0,0 +1,126 @@
+import sys
+from StringIO import StringIO
+from nose.tools import eq_
+from service_bindings import ServiceRule, find_service, \
+    FOUND, NONE, DUPLICATE, FAIL
+
+
+RULE = ServiceRule('apm',
+                   labels=['apm'],
+                   tags=['apm'],
+                   name_pattern='a-?pm',
+                   credentials=['key'])
+
+
+def service(name, tags=(), **credentials):
+    return {'name': name, 'tags': list(tags), 'credentials': credentials}
+
+
+class TestServiceBindings(object):
+
+    def test_no_services(self):
+        binding = find_service({}, RULE)
+        eq_(NONE, binding.result)
+        eq_('service-binding agent=apm result=none', binding.diagnostic())
+
+    def test_label(self):
+        binding = find_service({'VCAP_SERVICES': {
+            'apm': [service('mine', key='k')],
+            'user-provided': [service('apm-ups', key='other')]
+        }}, RULE)
+        eq_(FOUND, binding.result)
+        eq_('label', binding.match)
+        eq_({'key': 'k'}, binding.credentials)
+        eq_('service-binding agent=apm result=found service=mine '
+            'match=label', binding.diagnostic())
+
+    def test_tag_is_case_insensitive(self):
+        binding = find_service({'VCAP_SERVICES': {
+            'monitoring': [service('mine', tags=['APM'], key='k')]
+        }}, RULE)
+        eq_(FOUND, binding.result)
+        eq_('tag', binding.match)
+
+    def test_name(self):
+        binding = find_service({'VCAP_SERVICES': {
+            'user-provided': [service('db', key='k'),
+                              service('My-A-PM', key='k')]
+        }}, RULE)
+        eq_('My-A-PM', binding.service['name'])
+        eq_('name', binding.match)
+
+    def test_override(self):
+        ctx = {'APM_SERVICE_NAME': 'db', 'VCAP_SERVICES': {
+            'apm': [service('mine', key='k')],
+            'user-provided': [service('db', key='k')]
+        }}
+        eq_('db', find_service(ctx, RULE).service['name'])
+        ctx['APM_SERVICE_NAME'] = 'missing'
+        binding = find_service(ctx, RULE)
+        eq_(NONE, binding.result)
+        eq_('service-binding agent=apm result=none', binding.diagnostic())
+
+    def test_missing_credentials_are_skipped(self):
+        binding = find_service({'VCAP_SERVICES': {
+            'apm': [service('no key'), service('mine', key='k')]
+        }}, RULE)
+        eq_('mine', binding.service['name'])
+        eq_(['no key'], binding.skipped)
+        eq_('service-binding agent=apm result=found service=mine '
+            'match=label skipped="no key"', binding.diagnostic())
+
+    def test_only_the_first_matching_rule_is_tried(self):
+        binding = find_service({'VCAP_SERVICES': {
+            'apm': [service('mine', key='k')],
+            'user-provided': [service('apm', key='k')]
+        }}, RULE)
+        eq_('mine', binding.service['name'])
+        eq_('label', binding.match)
+
+    def test_a_rule_matching_only_skipped_services_falls_through(self):
+        binding = find_service({'VCAP_SERVICES': {
+            'apm': [service('mine')],
+            'user-provided': [service('apm', key='k')]
+        }}, RULE)
+        eq_(FOUND, binding.result)
+        eq_('apm', binding.service['name'])
+        eq_('name', binding.match)
+        eq_(['mine'], binding.skipped)
+
+        binding = find_service({'VCAP_SERVICES': {
+            'apm': [service('mine', tags=['apm'])]
+        }}, RULE)
+        eq_(NONE, binding.result)
+        eq_('service-binding agent=apm result=none skipped=mine',
+            binding.diagnostic())
+
+    def test_prints_only_when_a_service_came_close(self):
+        printed = StringIO()
+        sys.stdout, stdout = printed, sys.stdout
+        try:
+            find_service({}, RULE)
+            find_service({'VCAP_SERVICES': {
+                'user-provided': [service('db', key='k')]}}, RULE)
+            eq_('', printed.getvalue())
+            find_service({'VCAP_SERVICES': {'apm': [service('mine')]}}, RULE)
+            find_service({'APM_SERVICE_NAME': 'missing'}, RULE)
+        finally:
+            sys.stdout = stdout
+        eq_('service-binding agent=apm result=none skipped=mine\n'
+            'service-binding agent=apm result=none\n', printed.getvalue())
+
+    def test_duplicates(self):
+        ctx = {'VCAP_SERVICES': {
+            'apm': [service('one', key='k'), service('two', key='k')]
+        }}
+        binding = find_service(ctx, RULE)
+        eq_(FOUND, binding.result)
+        eq_('one', binding.service['name'])
+        eq_('service-binding agent=apm result=found service=one '
+            'match=label candidates=one,two', binding.diagnostic())
+        binding = find_service(ctx, ServiceRule('apm', labels=['apm'],
+                                                duplicates=FAIL))
+        eq_(DUPLICATE, binding.result)
+        eq_(None, binding.service)
+        eq_('service-binding agent=apm result=duplicate match=label '
+            'candidates=one,two', binding.diagnostic())